@@ -0,0 +1,272 @@
+// Package bench measure throughput and latency of RawConn, or net.Conn such
+// as user-space stack conn bound to RawConn, like iperf. Serve echo probes
+// back, Run send probes in window and report, probe payload is
+// deterministic, so reports of same options are comparable.
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	Duration time.Duration // send probes duration
+	Size     int           // probe payload size
+	Window   int           // max in-flight probes
+	Rate     int           // max probes per second, 0 is unlimited
+	Timeout  time.Duration // wait echo after sent, probe is lost if not echoed
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Duration: time.Second * 3,
+		Size:     1024,
+		Window:   64,
+		Timeout:  time.Second,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Duration send probes duration, default 3s
+func Duration(d time.Duration) Option {
+	return func(c *Config) {
+		c.Duration = d
+	}
+}
+
+// Size probe payload size, default 1024, min 16
+func Size(n int) Option {
+	return func(c *Config) {
+		c.Size = max(n, probeSize)
+	}
+}
+
+// Window max in-flight probes, default 64
+func Window(n int) Option {
+	return func(c *Config) {
+		c.Window = max(n, 1)
+	}
+}
+
+// Rate max probes per second, default 0 is unlimited
+func Rate(n int) Option {
+	return func(c *Config) {
+		c.Rate = max(n, 0)
+	}
+}
+
+// Timeout wait echo after sent, default 1s
+func Timeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+type Report struct {
+	Mode     string // raw or conn
+	Size     int    // probe payload size
+	Window   int
+	Elapsed  time.Duration // from first probe sent to last echo received
+	Sent     uint64        // probes
+	Recv     uint64        // echoed probes
+	Disorder uint64        // echo seq less than previous
+
+	Min, Avg, P50, P99, Max time.Duration // round trip time
+}
+
+// Loss probe loss rate
+func (r Report) Loss() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Sent-min(r.Recv, r.Sent)) / float64(r.Sent)
+}
+
+// Throughput echoed payload bits per second
+func (r Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Recv) * float64(r.Size) * 8 / r.Elapsed.Seconds()
+}
+
+// String one line report with stable fields order
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"mode=%s size=%d window=%d elapsed=%s sent=%d recv=%d loss=%.2f%% disorder=%d throughput=%.2fMbps rtt(min/avg/p50/p99/max)=%s/%s/%s/%s/%s",
+		r.Mode, r.Size, r.Window, r.Elapsed.Round(time.Millisecond), r.Sent, r.Recv,
+		r.Loss()*100, r.Disorder, r.Throughput()/1e6,
+		r.Min, r.Avg, r.P50, r.P99, r.Max,
+	)
+}
+
+// probe header: seq | send time offset
+const probeSize = 16
+
+type prober interface {
+	// send probe payload
+	send(probe []byte) error
+	// recv echoed probe payload
+	recv() ([]byte, error)
+	close() error
+}
+
+func run(ctx context.Context, p prober, mode string, cfg *Config) (*Report, error) {
+	var (
+		start  = time.Now()
+		tokens = make(chan struct{}, cfg.Window)
+		echoed = make(chan struct{}, 1) // recv caught up sent
+		probe  = make([]byte, cfg.Size)
+
+		mu   sync.Mutex
+		sent uint64
+		last time.Time // last echo recv time
+		rtts []time.Duration
+		rep  = &Report{Mode: mode, Size: cfg.Size, Window: cfg.Window}
+	)
+
+	var done = make(chan error, 1)
+	go func() {
+		var prev uint64
+		for {
+			b, err := p.recv()
+			if err != nil {
+				done <- err
+				return
+			}
+			now := time.Now()
+			if len(b) < probeSize {
+				continue
+			}
+			seq := binary.BigEndian.Uint64(b)
+			rtt := now.Sub(start) - time.Duration(binary.BigEndian.Uint64(b[8:]))
+
+			mu.Lock()
+			if seq < prev {
+				rep.Disorder++
+			}
+			prev = seq
+			rep.Recv++
+			last, rtts = now, append(rtts, rtt)
+			if rep.Recv >= sent {
+				select {
+				case echoed <- struct{}{}:
+				default:
+				}
+			}
+			mu.Unlock()
+
+			select {
+			case <-tokens:
+			default:
+			}
+		}
+	}()
+
+	var (
+		deadline = time.NewTimer(cfg.Duration)
+		exited   bool // recv goroutine exited
+		err      error
+	)
+	defer deadline.Stop()
+send:
+	for seq := uint64(0); ; seq++ {
+		if cfg.Rate > 0 {
+			if d := time.Until(start.Add(time.Duration(seq) * time.Second / time.Duration(cfg.Rate))); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-deadline.C:
+					break send
+				case <-ctx.Done():
+					break send
+				}
+			}
+		}
+		select {
+		case tokens <- struct{}{}:
+		case <-time.After(cfg.Timeout): // in-flight probe lost
+		case <-deadline.C:
+			break send
+		case <-ctx.Done():
+			break send
+		case err = <-done:
+			exited = true
+			break send
+		}
+
+		binary.BigEndian.PutUint64(probe, seq)
+		binary.BigEndian.PutUint64(probe[8:], uint64(time.Since(start)))
+		if err = p.send(probe); err != nil {
+			break
+		}
+		mu.Lock()
+		sent++
+		mu.Unlock()
+	}
+
+	if err == nil && ctx.Err() == nil {
+		timeout := time.NewTimer(cfg.Timeout)
+	wait:
+		for {
+			mu.Lock()
+			caught := rep.Recv >= sent
+			mu.Unlock()
+			if caught {
+				break
+			}
+			select {
+			case <-echoed: // maybe signaled before sending finished
+			case <-timeout.C:
+				break wait
+			case <-ctx.Done():
+				break wait
+			}
+		}
+		timeout.Stop()
+	}
+	if e := p.close(); err == nil {
+		err = e
+	}
+	if !exited {
+		<-done
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	rep.Sent = sent
+	if !last.IsZero() {
+		rep.Elapsed = last.Sub(start)
+	}
+	stat(rep, rtts)
+	return rep, errors.WithStack(err)
+}
+
+func stat(rep *Report, rtts []time.Duration) {
+	if len(rtts) == 0 {
+		return
+	}
+	slices.Sort(rtts)
+
+	var sum time.Duration
+	for _, e := range rtts {
+		sum += e
+	}
+	rep.Min, rep.Max = rtts[0], rtts[len(rtts)-1]
+	rep.Avg = sum / time.Duration(len(rtts))
+	rep.P50 = rtts[len(rtts)*50/100]
+	rep.P99 = rtts[len(rtts)*99/100]
+}
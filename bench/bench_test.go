@@ -0,0 +1,111 @@
+package bench_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/bench"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_RunRaw(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	for _, proto := range []tcpip.TransportProtocolNumber{header.TCPProtocolNumber, header.UDPProtocolNumber} {
+		client, server := test.NewMockRaw(t, proto, caddr, saddr, test.ValidChecksum)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- bench.ServeRaw(ctx, server, proto) }()
+
+		rep, err := bench.RunRaw(context.Background(), client, proto,
+			bench.Duration(time.Millisecond*200), bench.Size(512), bench.Window(8),
+		)
+		require.NoError(t, err)
+		require.NotZero(t, rep.Sent)
+		require.Equal(t, rep.Sent, rep.Recv)
+		require.Zero(t, rep.Loss())
+		require.NotZero(t, rep.Throughput())
+		require.LessOrEqual(t, rep.Min, rep.P50)
+		require.LessOrEqual(t, rep.P99, rep.Max)
+
+		cancel()
+		require.ErrorIs(t, <-served, context.Canceled)
+	}
+}
+
+func Test_RunRaw_Loss(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	client, server := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr, test.PacketLoss(0.2))
+	go bench.ServeRaw(context.Background(), server, header.UDPProtocolNumber)
+
+	rep, err := bench.RunRaw(context.Background(), client, header.UDPProtocolNumber,
+		bench.Duration(time.Millisecond*200), bench.Rate(1000),
+		bench.Timeout(time.Millisecond*100),
+	)
+	require.NoError(t, err)
+	require.Less(t, rep.Recv, rep.Sent)
+	require.Greater(t, rep.Loss(), 0.0)
+	// rate limited
+	require.LessOrEqual(t, rep.Sent, uint64(250))
+}
+
+func Test_Run(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		bench.Serve(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	rep, err := bench.Run(context.Background(), conn, bench.Duration(time.Millisecond*200))
+	require.NoError(t, err)
+	require.NotZero(t, rep.Sent)
+	require.Equal(t, rep.Sent, rep.Recv)
+	require.Zero(t, rep.Disorder)
+
+	s := rep.String()
+	require.True(t, strings.HasPrefix(s, "mode=conn size=1024 window=64 "), s)
+}
+
+func Test_Run_Cancel(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close() // peer not echo
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	go func() {
+		var buf = make([]byte, 1024)
+		for {
+			if _, err := b.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	rep, err := bench.Run(ctx, a, bench.Duration(time.Second*10))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second*2)
+	require.Zero(t, rep.Recv)
+}
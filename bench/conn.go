@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Run send probes over conn, such as tcp/udp conn of user-space stack bound
+// to RawConn, peer should Serve. conn is closed when return
+func Run(ctx context.Context, conn net.Conn, opts ...Option) (*Report, error) {
+	var cfg = Options(opts...)
+	p := &connProber{conn: conn, b: make([]byte, cfg.Size)}
+	return run(ctx, p, "conn", cfg)
+}
+
+// Serve echo probes back until ctx cancelled or conn closed by peer, conn
+// is closed when return
+func Serve(ctx context.Context, conn net.Conn) error {
+	var errs = make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, conn)
+		errs <- err
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	conn.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+type connProber struct {
+	conn net.Conn
+	b    []byte
+}
+
+func (p *connProber) send(probe []byte) error {
+	_, err := p.conn.Write(probe)
+	return err
+}
+
+// recv read a whole probe, stream conn maybe return partial probe
+func (p *connProber) recv() ([]byte, error) {
+	_, err := io.ReadFull(p.conn, p.b)
+	return p.b, err
+}
+
+func (p *connProber) close() error { return p.conn.Close() }
@@ -0,0 +1,182 @@
+package bench
+
+import (
+	"context"
+	"net"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// RunRaw send probes over conn, proto is transport protocol of conn, peer
+// should ServeRaw. conn is closed when return
+func RunRaw(ctx context.Context, conn rawsock.RawConn, proto tcpip.TransportProtocolNumber, opts ...Option) (*Report, error) {
+	if err := check(proto); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var cfg = Options(opts...)
+
+	p := &rawProber{
+		conn: conn, proto: proto,
+		psum: pseudoSum(proto, conn),
+		spkt: packet.Make(64, 0, header.TCPMinimumSize+cfg.Size),
+		size: header.TCPHeaderMaximumSize + cfg.Size,
+	}
+	p.rpkt = packet.Make(64, p.size)
+	return run(ctx, p, "raw", cfg)
+}
+
+// ServeRaw echo probes back until ctx cancelled or conn error, conn is
+// closed when return
+func ServeRaw(ctx context.Context, conn rawsock.RawConn, proto tcpip.TransportProtocolNumber) error {
+	if err := check(proto); err != nil {
+		conn.Close()
+		return err
+	}
+
+	var errs = make(chan error, 1)
+	go func() {
+		var (
+			pkt  = packet.Make(64, 0xffff)
+			psum = pseudoSum(proto, conn)
+		)
+		for {
+			if err := conn.Read(pkt.Sets(64, 0xffff)); err != nil {
+				if errorx.Temporary(err) {
+					continue
+				}
+				errs <- err
+				return
+			}
+
+			swap(proto, pkt.Bytes())
+			ipstack.Checksum(proto, pkt.Bytes(), psum)
+			if err := conn.Write(pkt); err != nil && !errorx.Temporary(err) {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	conn.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+type rawProber struct {
+	conn       rawsock.RawConn
+	proto      tcpip.TransportProtocolNumber
+	psum       uint16
+	seq        uint32 // tcp sequence number
+	spkt, rpkt *packet.Packet
+	size       int // read buffer size
+}
+
+func (p *rawProber) send(probe []byte) error {
+	var pkt = p.spkt.Sets(64, 0)
+	switch p.proto {
+	case header.TCPProtocolNumber:
+		pkt.Append(make([]byte, header.TCPMinimumSize)...)
+		header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+			SrcPort:    p.conn.LocalAddr().Port(),
+			DstPort:    p.conn.RemoteAddr().Port(),
+			SeqNum:     p.seq,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      header.TCPFlagAck | header.TCPFlagPsh,
+			WindowSize: 0xffff,
+		})
+		p.seq += uint32(len(probe))
+	default:
+		pkt.Append(make([]byte, header.UDPMinimumSize)...)
+		header.UDP(pkt.Bytes()).Encode(&header.UDPFields{
+			SrcPort: p.conn.LocalAddr().Port(),
+			DstPort: p.conn.RemoteAddr().Port(),
+		})
+	}
+	pkt.Append(probe...)
+	ipstack.Checksum(p.proto, pkt.Bytes(), p.psum)
+	return p.conn.Write(pkt)
+}
+
+func (p *rawProber) recv() ([]byte, error) {
+	for {
+		var pkt = p.rpkt.Sets(64, p.size)
+		if err := p.conn.Read(pkt); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			return nil, err
+		}
+		if payload := payload(p.proto, pkt.Bytes()); payload != nil {
+			return payload, nil
+		}
+	}
+}
+
+func (p *rawProber) close() error { return p.conn.Close() }
+
+func check(proto tcpip.TransportProtocolNumber) error {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+		return nil
+	default:
+		return errors.Errorf("not support transport protocol %d", proto)
+	}
+}
+
+// swap swap transport ports, echo packet back
+func swap(proto tcpip.TransportProtocolNumber, transport []byte) {
+	switch proto {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(transport)
+		src, dst := tcp.SourcePort(), tcp.DestinationPort()
+		tcp.SetSourcePort(dst)
+		tcp.SetDestinationPort(src)
+	default:
+		udp := header.UDP(transport)
+		src, dst := udp.SourcePort(), udp.DestinationPort()
+		udp.SetSourcePort(dst)
+		udp.SetDestinationPort(src)
+	}
+}
+
+// payload transport payload, nil if invalid
+func payload(proto tcpip.TransportProtocolNumber, transport []byte) []byte {
+	switch proto {
+	case header.TCPProtocolNumber:
+		if len(transport) < header.TCPMinimumSize {
+			return nil
+		}
+		if n := int(header.TCP(transport).DataOffset()); n <= len(transport) {
+			return transport[n:]
+		}
+	default:
+		if len(transport) >= header.UDPMinimumSize {
+			return transport[header.UDPMinimumSize:]
+		}
+	}
+	return nil
+}
+
+func pseudoSum(proto tcpip.TransportProtocolNumber, c rawsock.RawConn) uint16 {
+	return header.PseudoHeaderChecksum(
+		proto,
+		tcpip.AddrFromSlice(c.LocalAddr().Addr().AsSlice()),
+		tcpip.AddrFromSlice(c.RemoteAddr().Addr().AsSlice()),
+		0,
+	)
+}
@@ -0,0 +1,190 @@
+// Package bridge forward ethernet frames between ports with MAC learning and
+// aging, like a simple switch, port can be eth conn or TAP device, every
+// Read/Write carry one whole frame.
+package bridge
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Port read/write one ethernet frame per call, such as eth.ETHConn or TAP device
+type Port io.ReadWriter
+
+type Config struct {
+	Aging time.Duration // learned MAC expire if not seen in aging
+	MTU   int           // max frame size
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Aging: time.Minute * 5,
+		MTU:   1514,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Aging learned MAC address expire time, default 5min
+func Aging(d time.Duration) Option {
+	return func(c *Config) {
+		c.Aging = d
+	}
+}
+
+// MTU max frame size, default 1514
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+type Stats struct {
+	Forwarded uint64 // unicast to learned port
+	Flooded   uint64 // broadcast, multicast or unknown unicast
+	Dropped   uint64 // destination on ingress port or short frame
+}
+
+type Bridge struct {
+	ports []Port
+	cfg   *Config
+
+	mu    sync.RWMutex
+	table map[tcpip.LinkAddress]entry
+
+	forwarded, flooded, dropped atomic.Uint64
+}
+
+type entry struct {
+	port int
+	seen time.Time
+}
+
+func New(ports []Port, opts ...Option) (*Bridge, error) {
+	if len(ports) < 2 {
+		return nil, errors.Errorf("bridge require at least 2 ports, got %d", len(ports))
+	}
+	return &Bridge{
+		ports: ports,
+		cfg:   Options(opts...),
+		table: map[tcpip.LinkAddress]entry{},
+	}, nil
+}
+
+// Run forward frames until ctx cancelled or any port error. caller should
+// close ports after return.
+func (b *Bridge) Run(ctx context.Context) error {
+	var errs = make(chan error, len(b.ports))
+	for i := range b.ports {
+		go func(i int) { errs <- b.serve(i) }(i)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
+
+func (b *Bridge) serve(in int) error {
+	var frame = make([]byte, b.cfg.MTU)
+	for {
+		n, err := b.ports[in].Read(frame)
+		if err != nil {
+			return errors.WithStack(err)
+		} else if n < header.EthernetMinimumSize {
+			b.dropped.Add(1)
+			continue
+		}
+		eth := header.Ethernet(frame[:n])
+		src, dst := eth.SourceAddress(), eth.DestinationAddress()
+
+		if header.IsValidUnicastEthernetAddress(src) {
+			b.learn(src, in)
+		}
+
+		if out, ok := b.lookup(dst); ok {
+			if out == in {
+				b.dropped.Add(1)
+				continue
+			}
+			b.forwarded.Add(1)
+			if _, err := b.ports[out].Write(frame[:n]); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		b.flooded.Add(1)
+		for out := range b.ports {
+			if out == in {
+				continue
+			}
+			if _, err := b.ports[out].Write(frame[:n]); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+}
+
+func (b *Bridge) learn(mac tcpip.LinkAddress, port int) {
+	now := time.Now()
+
+	b.mu.RLock()
+	e, has := b.table[mac]
+	b.mu.RUnlock()
+	if has && e.port == port && now.Sub(e.seen) < time.Second {
+		return // avoid lock contention
+	}
+
+	b.mu.Lock()
+	b.table[mac] = entry{port: port, seen: now}
+	b.mu.Unlock()
+}
+
+func (b *Bridge) lookup(mac tcpip.LinkAddress) (port int, ok bool) {
+	if !header.IsValidUnicastEthernetAddress(mac) {
+		return 0, false
+	}
+
+	b.mu.RLock()
+	e, has := b.table[mac]
+	b.mu.RUnlock()
+	if !has {
+		return 0, false
+	} else if time.Since(e.seen) > b.cfg.Aging {
+		b.mu.Lock()
+		if e, has := b.table[mac]; has && time.Since(e.seen) > b.cfg.Aging {
+			delete(b.table, mac)
+		}
+		b.mu.Unlock()
+		return 0, false
+	}
+	return e.port, true
+}
+
+// Lookup get port index of learned MAC address
+func (b *Bridge) Lookup(mac net.HardwareAddr) (port int, ok bool) {
+	return b.lookup(tcpip.LinkAddress(mac))
+}
+
+func (b *Bridge) Stats() Stats {
+	return Stats{
+		Forwarded: b.forwarded.Load(),
+		Flooded:   b.flooded.Load(),
+		Dropped:   b.dropped.Load(),
+	}
+}
@@ -0,0 +1,133 @@
+package bridge_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/bridge"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type chanPort struct {
+	in, out chan []byte
+}
+
+func newPort() *chanPort {
+	return &chanPort{in: make(chan []byte, 8), out: make(chan []byte, 8)}
+}
+
+func (p *chanPort) Read(b []byte) (int, error) {
+	f, ok := <-p.in
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, f), nil
+}
+
+func (p *chanPort) Write(b []byte) (int, error) {
+	p.out <- append([]byte{}, b...)
+	return len(b), nil
+}
+
+func (p *chanPort) recv(t *testing.T) []byte {
+	select {
+	case f := <-p.out:
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("recv timeout")
+		return nil
+	}
+}
+
+func (p *chanPort) empty(t *testing.T) {
+	select {
+	case <-p.out:
+		t.Fatal("unexpected frame")
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+var (
+	macA = net.HardwareAddr{0x02, 0, 0, 0, 0, 0xa}
+	macB = net.HardwareAddr{0x02, 0, 0, 0, 0, 0xb}
+	bc   = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+)
+
+func frame(src, dst net.HardwareAddr) []byte {
+	var b = make([]byte, header.EthernetMinimumSize+4)
+	header.Ethernet(b).Encode(&header.EthernetFields{
+		SrcAddr: tcpip.LinkAddress(src),
+		DstAddr: tcpip.LinkAddress(dst),
+		Type:    header.IPv4ProtocolNumber,
+	})
+	return b
+}
+
+func Test_Bridge(t *testing.T) {
+	t.Run("learning", func(t *testing.T) {
+		p0, p1, p2 := newPort(), newPort(), newPort()
+		b, err := bridge.New([]bridge.Port{p0, p1, p2})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.Run(ctx)
+
+		// unknown, flood
+		p0.in <- frame(macA, bc)
+		require.Equal(t, frame(macA, bc), p1.recv(t))
+		require.Equal(t, frame(macA, bc), p2.recv(t))
+		p0.empty(t)
+
+		port, ok := b.Lookup(macA)
+		require.True(t, ok)
+		require.Equal(t, 0, port)
+
+		// learned, forward to p0 only
+		p2.in <- frame(macB, macA)
+		require.Equal(t, frame(macB, macA), p0.recv(t))
+		p1.empty(t)
+
+		p0.in <- frame(macA, macB)
+		require.Equal(t, frame(macA, macB), p2.recv(t))
+		p1.empty(t)
+
+		require.Equal(t, bridge.Stats{Forwarded: 2, Flooded: 1}, b.Stats())
+	})
+
+	t.Run("aging", func(t *testing.T) {
+		p0, p1 := newPort(), newPort()
+		b, err := bridge.New([]bridge.Port{p0, p1}, bridge.Aging(time.Millisecond*50))
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.Run(ctx)
+
+		p0.in <- frame(macA, bc)
+		p1.recv(t)
+		_, ok := b.Lookup(macA)
+		require.True(t, ok)
+
+		time.Sleep(time.Millisecond * 100)
+		_, ok = b.Lookup(macA)
+		require.False(t, ok)
+	})
+
+	t.Run("port error", func(t *testing.T) {
+		p0, p1 := newPort(), newPort()
+		b, err := bridge.New([]bridge.Port{p0, p1})
+		require.NoError(t, err)
+
+		close(p1.in)
+		require.ErrorIs(t, b.Run(context.Background()), io.EOF)
+	})
+
+	t.Run("single port", func(t *testing.T) {
+		_, err := bridge.New([]bridge.Port{newPort()})
+		require.Error(t, err)
+	})
+}
@@ -1,7 +1,11 @@
 package rawsock
 
 import (
+	"net/netip"
+	"time"
+
 	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/netns"
 )
 
 type Config struct {
@@ -9,6 +13,81 @@ type Config struct {
 	SetGRO   bool
 	IPStack  *ipstack.Configs
 
+	// drop outbound RST by nftables rule, instead of bind tcp port
+	SuppressRST bool
+
+	// local address is virtual ip not configured on host
+	VirtualIP bool
+
+	// eth listener answer ARP for all address in prefix, and capture traffic to them
+	ProxyARP netip.Prefix
+
+	// network namespace file path, empty is current netns
+	NetNS string
+
+	// linux VRF device name, sockets bind to it and route lookup in its table
+	VRF string
+
+	// pcap filter expression, see bpf.Compile
+	Filter string
+
+	// egress mtu, 0 means use interface mtu
+	MTU int
+	// fragment oversize ipv4 packet instead of return ErrPacketTooLarge
+	Fragment bool
+	// reassemble inbound ipv4 fragments instead of drop
+	Defrag bool
+	// segment oversize tcp packet to mss when Write
+	TSO bool
+	// Write take complete ip packet, see HdrIncl
+	HdrIncl bool
+	// split received tcp super-packet to mss when Read, see SplitGRO
+	SplitGRO bool
+	// preallocated read buffers of conn, see BufferConn
+	ReadBuffers int
+	// called when path mtu shrink by ICMPv6 packet too big
+	PMTUNotify func(mtu int)
+
+	// busy poll timeout and budget of capture socket, 0 is disable
+	BusyPoll       time.Duration
+	BusyPollBudget int
+
+	// SO_PRIORITY of outbound packets, 0 is default, see Priority
+	Priority int
+	// map Priority to 802.1p PCP of vlan egress interface, see PCP
+	PCP bool
+
+	// enable receive timestamp, see rawsock.MetaConn
+	Timestamp         bool
+	HardwareTimestamp bool
+
+	// enable receive ttl/tos/pktinfo, see rawsock.MetaConn
+	Ancillary bool
+
+	// max not closed conns accepted by Listener, 0 is unlimited
+	MaxConns int
+
+	// accepted conn Read handshake SYN received by Listener, see ReplaySYN
+	ReplaySYN bool
+	// called when Listener recv retransmitted SYN of accepted conn
+	OnDuplicateSYN func(laddr, raddr netip.AddrPort)
+
+	// Listener answer SYN with cookie, see SynProxy
+	SynProxy bool
+	// Accept wait first payload of flow, see PeekPayload
+	PeekTimeout time.Duration
+
+	// conn close self if not read or write any packet in IdleTimeout, then
+	// call OnIdle, 0 is disable
+	IdleTimeout time.Duration
+	OnIdle      func(conn RawConn)
+
+	// validate ip packet of conn paths at runtime, called with invalid packet
+	Validate func(ip []byte, err error)
+
+	// listener only capture flows hashed to shard, see bpf.WithShard
+	Shard, Shards int
+
 	DivertPriorty int16
 }
 
@@ -35,6 +114,92 @@ func UsedPort() Option {
 	}
 }
 
+// Shard listener only capture handshake of flows that hash(remote) % shards == shard,
+// used by multiple listeners on same address, a flow always be delivered to
+// same listener, avoid duplicate conns created by different listeners.
+func Shard(shard, shards int) Option {
+	return func(c *Config) {
+		c.Shard, c.Shards = shard, shards
+	}
+}
+
+// MaxConns limit not closed conns accepted by Listener, the handshake packet
+// exceed limit will be dropped, default unlimited
+func MaxConns(n int) Option {
+	return func(c *Config) {
+		c.MaxConns = n
+	}
+}
+
+// ReplaySYN accepted conn's Read return the handshake SYN first, and SYN
+// retransmitted before the conn's first Write, because they are received by
+// Listener, the conn can answer again if the SYN-ACK lost on lossy links
+func ReplaySYN() Option {
+	return func(c *Config) {
+		c.ReplaySYN = true
+	}
+}
+
+// OnDuplicateSYN fn is called when Listener recv retransmitted SYN (same
+// ISN) of accepted conn, fn should not block
+func OnDuplicateSYN(fn func(laddr, raddr netip.AddrPort)) Option {
+	return func(c *Config) {
+		c.OnDuplicateSYN = fn
+	}
+}
+
+// SynProxy Listener answer SYN with cookie encoded SYN-ACK, only accept conn
+// after the handshake final ACK validated, so SYN flood not reach the app.
+// accepted conn Read the SYN rebuilt from cookie, the app's SYN-ACK is not
+// sent, then Read the final ACK, sequence number is translated by the conn.
+// the cookie SYN-ACK only carry MSS option. only support linux tcp/raw.
+func SynProxy() Option {
+	return func(c *Config) {
+		c.SynProxy = true
+	}
+}
+
+// PeekPayload Accept wait the first payload of new flow (such as TLS
+// ClientHello), accepted conn implement PeekConn, so routing decision can be
+// made before committing resources to the conn. if the peer not send
+// payload within timeout (server speak first protocol), the conn is accepted
+// without payload. implies SynProxy, because the peer only send payload
+// after handshake completed.
+func PeekPayload(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.SynProxy = true
+		c.PeekTimeout = timeout
+	}
+}
+
+// SuppressRST drop system tcp stack's outbound RST of conn by nftables rule,
+// instead of binding a tcp listener to reserve the port, used when binding the
+// port conflicts with an existing service. need nft, only support linux tcp.
+func SuppressRST() Option {
+	return func(c *Config) {
+		c.SuppressRST = true
+	}
+}
+
+// VirtualIP local address is a virtual ip not configured on host interface, eth
+// backend answer ARP requests for it, so own a service ip on the LAN. only support
+// linux eth backend, ipv4.
+func VirtualIP() Option {
+	return func(c *Config) {
+		c.VirtualIP = true
+	}
+}
+
+// ProxyARP eth listener answer ARP for addresses in prefix and accept connections
+// to any of them on listen port, used for transparent interception. only support
+// linux eth backend, ipv4.
+func ProxyARP(prefix netip.Prefix) Option {
+	return func(c *Config) {
+		c.VirtualIP = true
+		c.ProxyARP = prefix.Masked()
+	}
+}
+
 // Checksum set recv/send tansport packet checksum calcuate mode
 // todo: replace by TX checksum offload
 func Checksum(opts ...ipstack.Option) Option {
@@ -49,3 +214,172 @@ func SetGRO(set bool) Option {
 		c.SetGRO = set
 	}
 }
+
+// NetNS create sockets inside the network namespace, name is a named netns
+// (ip netns add <name>) or a netns file path, only support linux
+func NetNS(name string) Option {
+	return func(c *Config) {
+		c.NetNS = netns.Path(name)
+	}
+}
+
+// NetNSFd create sockets inside the network namespace referred by fd, the
+// fd should keep open until Listener/Conn closed, only support linux
+func NetNSFd(fd int) Option {
+	return func(c *Config) {
+		c.NetNS = netns.FdPath(fd)
+	}
+}
+
+// NetNSPid create sockets inside the network namespace of process, such as
+// container's init process, only support linux
+func NetNSPid(pid int) Option {
+	return func(c *Config) {
+		c.NetNS = netns.PidPath(pid)
+	}
+}
+
+// VRF bind sockets to the linux VRF device, and select local address by
+// the VRF's route table, only support linux raw backend
+func VRF(name string) Option {
+	return func(c *Config) {
+		c.VRF = name
+	}
+}
+
+// Filter set additional pcap filter expression, such as "src net 10.0.0.0/8",
+// the packet not matched will be dropped by kernel, only support linux
+func Filter(expr string) Option {
+	return func(c *Config) {
+		c.Filter = expr
+	}
+}
+
+// MTU set egress mtu, default is mtu of local address's interface, and
+// shrink with the interface mtu on linux raw backend, see helper.WatchMTU
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+// Fragment fragment oversize ipv4 packet when Write, default return ErrPacketTooLarge
+func Fragment() Option {
+	return func(c *Config) {
+		c.Fragment = true
+	}
+}
+
+// Defrag reassemble inbound ipv4 fragments before Read, default fragments are
+// dropped by bpf, because port filter can't apply to them. AF_INET raw socket
+// recv packets reassembled by kernel, so only affect linux eth backend Read.
+func Defrag() Option {
+	return func(c *Config) {
+		c.Defrag = true
+	}
+}
+
+// ReadBuffers conn preallocate n read buffers sized to egress mtu (detected by
+// interface if not set MTU) at init, get by BufferConn.Packet, only support linux
+func ReadBuffers(n int) Option {
+	return func(c *Config) {
+		c.ReadBuffers = n
+	}
+}
+
+// PMTUNotify fn be called with new path mtu, when ipv6 conn recv ICMPv6 packet
+// too big message, conn's mtu/mss shrink automatically
+func PMTUNotify(fn func(mtu int)) Option {
+	return func(c *Config) {
+		c.PMTUNotify = fn
+	}
+}
+
+// TSO segment oversize tcp packet into mss-sized segments when Write, used
+// when nic not support tcp-segmentation-offload, only affect tcp
+func TSO() Option {
+	return func(c *Config) {
+		c.TSO = true
+	}
+}
+
+// SplitGRO split received tcp super-packet, that merged by nic LRO/GRO and
+// exceed path mtu, back into wire-sized segments with fixed sequence number
+// and checksum when Read. it is alternative of SetGRO, that not need modify
+// nic offload, only affect tcp
+func SplitGRO() Option {
+	return func(c *Config) {
+		c.SplitGRO = true
+	}
+}
+
+// HdrIncl Write take complete ip packet with caller's own header (id, ttl,
+// tos...), sent by raw ip socket with IP_HDRINCL, bypass ipstack and TSO.
+// only support linux raw backend
+func HdrIncl() Option {
+	return func(c *Config) {
+		c.HdrIncl = true
+	}
+}
+
+// BusyPoll enable busy polling on capture socket, the socket will busy poll nic
+// receive queue up to timeout when no packet, and poll at most budget packets
+// every time, 0 budget use kernel default. It reduce read latency, but cost cpu
+// time (one core busy when poll), only support linux, budget need CAP_NET_ADMIN.
+func BusyPoll(timeout time.Duration, budget int) Option {
+	return func(c *Config) {
+		c.BusyPoll, c.BusyPollBudget = timeout, budget
+	}
+}
+
+// Priority set SO_PRIORITY of outbound packets, select traffic class of
+// egress qdisc (such as mqprio), priority 7+ need CAP_NET_ADMIN, only
+// support linux eth backend
+func Priority(prio int) Option {
+	return func(c *Config) {
+		c.Priority = prio
+	}
+}
+
+// PCP outbound frames carry 802.1p priority code point pcp (0-7), the egress
+// interface should be a vlan device, the vlan's egress-qos-map is updated
+// to map priority pcp to pcp, need iproute2, only support linux eth backend
+func PCP(pcp uint8) Option {
+	return func(c *Config) {
+		c.Priority, c.PCP = int(pcp&0x7), true
+	}
+}
+
+// Timestamp enable receive timestamp, get by MetaConn.ReadMeta, hardware
+// timestamp need nic support, only support linux
+func Timestamp(hardware bool) Option {
+	return func(c *Config) {
+		c.Timestamp, c.HardwareTimestamp = true, hardware
+	}
+}
+
+// Ancillary enable receive ttl, tos and destination address of packet, get by
+// MetaConn.ReadMeta, only support linux raw ip backend
+func Ancillary() Option {
+	return func(c *Config) {
+		c.Ancillary = true
+	}
+}
+
+// IdleTimeout conn close self if not read or write any packet in timeout,
+// and then call fn (can be nil), avoid leak conn of silently vanished peer
+func IdleTimeout(timeout time.Duration, fn func(conn RawConn)) Option {
+	return func(c *Config) {
+		c.IdleTimeout, c.OnIdle = timeout, fn
+	}
+}
+
+// Validate check every ip packet of conn read/write paths (header fields,
+// length, checksum, see check.Packet) without debug build, fn is called
+// with the invalid packet and reason, fn should not retain ip. used by
+// staging environment, the check is expensive
+func Validate(fn func(ip []byte, err error)) Option {
+	return func(c *Config) {
+		c.Validate = fn
+	}
+}
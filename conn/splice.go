@@ -0,0 +1,157 @@
+// Package conn utilities operate on RawConns.
+package conn
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Rewrite modify transport packet before forwarded, such as ports or payload,
+// return false to drop the packet. destination conn's remote address can be
+// rewritten by rawsock.RoamConn.SetRemote.
+type Rewrite func(pkt *packet.Packet) (forward bool)
+
+type Config struct {
+	AtoB, BtoA Rewrite
+	MTU        int // read buffer size
+	Stats      *Stats
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		MTU: 1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// AtoB rewrite packets read from a and written to b
+func AtoB(fn Rewrite) Option {
+	return func(c *Config) {
+		c.AtoB = fn
+	}
+}
+
+// BtoA rewrite packets read from b and written to a
+func BtoA(fn Rewrite) Option {
+	return func(c *Config) {
+		c.BtoA = fn
+	}
+}
+
+// MTU read buffer size, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+// WithStats record forwarded packets to s
+func WithStats(s *Stats) Option {
+	return func(c *Config) {
+		c.Stats = s
+	}
+}
+
+type Stats struct {
+	AtoB, BtoA       atomic.Uint64 // forwarded packets
+	Dropped, Refused atomic.Uint64 // dropped by Rewrite, write temporary error
+}
+
+// Splice pump packets between a and b until ctx cancelled or any conn error,
+// packet is written synchronously after read, so slow side backpressure
+// the other. transport checksum is re-calculated if packet rewritten or
+// a and b have different addresses. a and b are closed when return.
+func Splice(ctx context.Context, a, b rawsock.RawConn, proto tcpip.TransportProtocolNumber, opts ...Option) error {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return errors.Errorf("not support transport protocol %d", proto)
+	}
+	var cfg = Options(opts...)
+	if cfg.Stats == nil {
+		cfg.Stats = &Stats{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		errs = make(chan error, 2)
+		once sync.Once
+	)
+	stop := func() {
+		once.Do(func() {
+			a.Close()
+			b.Close()
+		})
+	}
+	go func() { errs <- pump(a, b, proto, cfg.AtoB, &cfg.Stats.AtoB, cfg) }()
+	go func() { errs <- pump(b, a, proto, cfg.BtoA, &cfg.Stats.BtoA, cfg) }()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	stop()
+	return err
+}
+
+func pump(src, dst rawsock.RawConn, proto tcpip.TransportProtocolNumber, fn Rewrite, forwarded *atomic.Uint64, cfg *Config) error {
+	var (
+		pkt      = packet.Make(64, cfg.MTU)
+		tooLarge *rawsock.ErrPacketTooLarge
+	)
+	for {
+		if err := src.Read(pkt.Sets(64, cfg.MTU)); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			return err
+		}
+
+		if fn != nil && !fn(pkt) {
+			cfg.Stats.Dropped.Add(1)
+			continue
+		}
+		// dst remote address maybe roamed by fn or SetRemote
+		if sum := pseudoSum(proto, dst); fn != nil || sum != pseudoSum(proto, src) {
+			ipstack.Checksum(proto, pkt.Bytes(), sum)
+		}
+
+		if err := dst.Write(pkt); err != nil {
+			if errorx.Temporary(err) || errors.As(err, &tooLarge) {
+				cfg.Stats.Refused.Add(1)
+				continue
+			} else if errors.Is(err, net.ErrClosed) {
+				return errors.WithStack(net.ErrClosed)
+			}
+			return err
+		}
+		forwarded.Add(1)
+	}
+}
+
+func pseudoSum(proto tcpip.TransportProtocolNumber, c rawsock.RawConn) uint16 {
+	return header.PseudoHeaderChecksum(
+		proto,
+		tcpip.AddrFromSlice(c.LocalAddr().Addr().AsSlice()),
+		tcpip.AddrFromSlice(c.RemoteAddr().Addr().AsSlice()),
+		0,
+	)
+}
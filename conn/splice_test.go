@@ -0,0 +1,95 @@
+package conn_test
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/conn"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Splice(t *testing.T) {
+	var (
+		caddr  = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr  = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		caddr2 = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr2 = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	// peerA <-> rawA ==splice== rawB <-> peerB, mock not fix checksum
+	opt := test.RawOpts(rawsock.Checksum(ipstack.NotCalcChecksum))
+	peerA, rawA := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr, opt)
+	rawB, peerB := test.NewMockRaw(t, header.UDPProtocolNumber, caddr2, saddr2, opt)
+	validSum := func(t *testing.T, udp header.UDP, src, dst netip.AddrPort) {
+		sum := header.PseudoHeaderChecksum(
+			header.UDPProtocolNumber,
+			tcpip.AddrFrom4(src.Addr().As4()), tcpip.AddrFrom4(dst.Addr().As4()),
+			uint16(len(udp)),
+		)
+		require.Equal(t, uint16(0xffff), checksum.Checksum(udp, sum))
+	}
+
+	var stats conn.Stats
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- conn.Splice(ctx, rawA, rawB, header.UDPProtocolNumber,
+			conn.AtoB(func(pkt *packet.Packet) bool {
+				udp := header.UDP(pkt.Bytes())
+				if string(udp.Payload()) == "drop" {
+					return false
+				}
+				udp.SetDestinationPort(1234)
+				return true
+			}),
+			conn.WithStats(&stats),
+		)
+	}()
+
+	t.Run("rewrite", func(t *testing.T) {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		require.NoError(t, peerA.Write(packet.Make(64).Append(udp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, peerB.Read(pkt))
+		got := header.UDP(pkt.Bytes())
+		require.Equal(t, uint16(1234), got.DestinationPort())
+		require.Equal(t, []byte(udp.Payload()), []byte(got.Payload()))
+		validSum(t, got, caddr2, saddr2)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		drop := packet.Make(64).Append(udp[:header.UDPMinimumSize]...).Append([]byte("drop")...)
+		require.NoError(t, peerA.Write(drop))
+		require.NoError(t, peerA.Write(packet.Make(64).Append(udp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, peerB.Read(pkt))
+		require.Equal(t, []byte(udp.Payload()), []byte(header.UDP(pkt.Bytes()).Payload()))
+		require.Equal(t, uint64(1), stats.Dropped.Load())
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, saddr2, caddr2)))
+		require.NoError(t, peerB.Write(packet.Make(64).Append(udp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, peerA.Read(pkt))
+		got := header.UDP(pkt.Bytes())
+		require.Equal(t, []byte(udp.Payload()), []byte(got.Payload()))
+		validSum(t, got, saddr, caddr)
+		require.Equal(t, uint64(1), stats.BtoA.Load())
+	})
+
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+}
@@ -0,0 +1,201 @@
+//go:build linux
+// +build linux
+
+package encap
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Conn point-to-point tunnel, Read return decapsulated inner packet, Write
+// encapsulate inner packet and send to remote address
+type Conn struct {
+	laddr, raddr netip.Addr
+	tunnel       Tunnel
+
+	raw *net.IPConn
+	mtu *ipstack.PMTU  // outer path mtu
+	ptb net.PacketConn // recv ICMPv6 packet too big
+
+	closeErr errorx.CloseErr
+}
+
+// DialGRE create GRE tunnel from laddr to raddr, see GRETunnel
+func DialGRE(laddr, raddr netip.Addr, hdr GRE, opts ...rawsock.Option) (*Conn, error) {
+	return Dial(laddr, raddr, GRETunnel(hdr), opts...)
+}
+
+// DialIPIP create ipv4-in-ip tunnel from laddr to raddr, see IPIPTunnel
+func DialIPIP(laddr, raddr netip.Addr, opts ...rawsock.Option) (*Conn, error) {
+	return Dial(laddr, raddr, IPIPTunnel(), opts...)
+}
+
+// DialSIT create ipv6-in-ip tunnel from laddr to raddr, see SITTunnel
+func DialSIT(laddr, raddr netip.Addr, opts ...rawsock.Option) (*Conn, error) {
+	return Dial(laddr, raddr, SITTunnel(), opts...)
+}
+
+// Dial create tunnel from laddr to raddr, laddr can be unspecified
+func Dial(laddr, raddr netip.Addr, tunnel Tunnel, opts ...rawsock.Option) (c *Conn, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		c, err = dial(laddr, raddr, tunnel, cfg)
+		return err
+	})
+	return c, err
+}
+
+func dial(laddr, raddr netip.Addr, tunnel Tunnel, cfg *rawsock.Config) (*Conn, error) {
+	var err error
+	if laddr, raddr, err = helper.ZoneAddrs(laddr, raddr); err != nil {
+		return nil, err
+	}
+	if cfg.VRF != "" && laddr.WithZone("").IsUnspecified() {
+		laddr, err = vrf.DefaultLocal(cfg.VRF, raddr)
+	} else {
+		laddr, err = helper.DefaultLocal(laddr, raddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &Conn{laddr: laddr, raddr: raddr, tunnel: tunnel}
+	network := "ip4:" + strconv.Itoa(int(tunnel.Proto()))
+	if !raddr.Is4() {
+		network = "ip6:" + strconv.Itoa(int(tunnel.Proto()))
+	}
+	if c.raw, err = net.DialIP(
+		network,
+		&net.IPAddr{IP: laddr.AsSlice(), Zone: laddr.Zone()},
+		&net.IPAddr{IP: raddr.AsSlice(), Zone: raddr.Zone()},
+	); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	}
+	raw, err := c.raw.SyscallConn()
+	if err != nil {
+		return nil, c.close(errors.WithStack(err))
+	}
+	if cfg.VRF != "" {
+		if err = vrf.Bind(raw, cfg.VRF); err != nil {
+			return nil, c.close(err)
+		}
+	}
+
+	mtu := cfg.MTU
+	if mtu == 0 {
+		if mtu, err = helper.InterfaceMTU(laddr); err != nil {
+			return nil, c.close(err)
+		}
+	}
+	if laddr.Is4() {
+		// outer path mtu learned by kernel, see Write
+		if err = bind.EnablePMTUDisc(raw); err != nil {
+			return nil, c.close(err)
+		}
+		c.mtu = ipstack.NewPMTU4(mtu, cfg.PMTUNotify)
+	} else {
+		c.mtu = ipstack.NewPMTU(mtu, cfg.PMTUNotify)
+		if c.ptb, err = ipstack.WatchPTB(laddr, c.handlePTB); err != nil {
+			return nil, c.close(err)
+		}
+	}
+	return c, nil
+}
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		if c.raw != nil {
+			errs = append(errs, errors.WithStack(c.raw.Close()))
+		}
+		if c.ptb != nil {
+			errs = append(errs, errors.WithStack(c.ptb.Close()))
+		}
+		return errs
+	})
+}
+
+func (c *Conn) handlePTB(ptb ipstack.PTB) {
+	if ptb.Proto == c.tunnel.Proto() &&
+		ptb.Src.Addr() == c.laddr.WithZone("") && ptb.Dst.Addr() == c.raddr.WithZone("") {
+		c.mtu.Update(ptb.MTU)
+	}
+}
+
+// Read read decapsulated inner packet, packet not belong to the tunnel is
+// dropped, invalid packet return temporary error
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		n, err := c.raw.Read(pkt.Sets(head, data).Bytes())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pkt.SetData(n)
+
+		// ipv6 raw socket not recv ip header
+		if c.laddr.Is4() {
+			hdrLen, err := helper.IPCheck(pkt.Bytes())
+			if err != nil {
+				return errorx.WrapTemp(err)
+			}
+			pkt.DetachN(int(hdrLen))
+		}
+
+		if ok, err := c.tunnel.Decap(pkt); err != nil {
+			return errorx.WrapTemp(err)
+		} else if ok {
+			return nil
+		}
+	}
+}
+
+// Write encapsulate inner packet and send, pkt head section should not
+// less than tunnel's Overhead, otherwise alloc
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	if n := pkt.Data(); n > c.MTU() {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.MTU()})
+	}
+
+	n := pkt.Data()
+	if err = c.tunnel.Encap(pkt); err != nil {
+		return err
+	}
+	defer pkt.DetachN(pkt.Data() - n)
+	if _, err = c.raw.Write(pkt.Bytes()); errors.Is(err, unix.EMSGSIZE) && c.laddr.Is4() {
+		if raw, e := c.raw.SyscallConn(); e == nil {
+			if mtu, e := bind.PathMTU(raw, true); e == nil {
+				c.mtu.Update(mtu)
+			}
+		}
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.MTU()})
+	}
+	return errors.WithStack(err)
+}
+
+// MTU max inner packet size
+func (c *Conn) MTU() int {
+	hdr := header.IPv4MinimumSize
+	if !c.laddr.Is4() {
+		hdr = header.IPv6MinimumSize
+	}
+	return c.mtu.Load() - hdr - c.tunnel.Overhead()
+}
+
+func (c *Conn) LocalAddr() netip.Addr  { return c.laddr }
+func (c *Conn) RemoteAddr() netip.Addr { return c.raddr }
+func (c *Conn) Close() error           { return c.close(nil) }
@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+package encap_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/encap"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GRE_Conn(t *testing.T) {
+	var (
+		a = netip.MustParseAddr("127.0.0.1")
+		b = netip.MustParseAddr("127.0.0.2")
+	)
+	hdr := encap.GRE{Checksum: true, HasKey: true, Key: 0x1986}
+	c1, err := encap.DialGRE(a, b, hdr, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := encap.DialGRE(b, a, hdr, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c2.Close()
+	require.Equal(t, 1500-20-12, c1.MTU())
+
+	// key mismatch packet will be ignored
+	other, err := encap.DialGRE(a, b, encap.GRE{HasKey: true, Key: 1}, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer other.Close()
+
+	inner := test.RandUDP(t,
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+	)
+	require.NoError(t, other.Write(packet.Make(64, 0, len(inner)).Append(test.RandUDP(t,
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+	)...)))
+
+	pkt := packet.Make(64, 0, len(inner)).Append(inner...)
+	require.NoError(t, c1.Write(pkt))
+	require.Equal(t, inner, pkt.Bytes())
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, c2.Read(p))
+	require.Equal(t, inner, p.Bytes())
+
+	big := packet.Make(64, c1.MTU()+1)
+	err = c1.Write(big)
+	var e *rawsock.ErrPacketTooLarge
+	require.ErrorAs(t, err, &e)
+}
+
+func Test_IPIP_Conn(t *testing.T) {
+	var (
+		a = netip.MustParseAddr("127.0.0.1")
+		b = netip.MustParseAddr("127.0.0.2")
+	)
+	c1, err := encap.DialIPIP(a, b, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := encap.DialIPIP(b, a, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c2.Close()
+	require.Equal(t, 1500-20, c1.MTU())
+
+	inner := test.RandUDP(t,
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+	)
+	require.NoError(t, c1.Write(packet.Make(64, 0, len(inner)).Append(inner...)))
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, c2.Read(p))
+	require.Equal(t, inner, p.Bytes())
+
+	// sit tunnel not accept ipv4 inner packet
+	sit, err := encap.DialSIT(a, b)
+	require.NoError(t, err)
+	defer sit.Close()
+	require.Error(t, sit.Write(packet.Make(64, 0, len(inner)).Append(inner...)))
+}
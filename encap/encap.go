@@ -0,0 +1,33 @@
+// Package encap build/parse tunnel encapsulation headers, and point-to-point
+// tunnel Conn over raw ip socket of the tunnel protocol, Read/Write inner
+// packet, so tunnels can be built on sockit primitives without kernel
+// tunnel device. udp based tunnel, such as VXLAN, is layered on udp RawConn.
+package encap
+
+import (
+	"github.com/lysShub/netkit/packet"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// ether type of encapsulated payload
+const (
+	EtherTypeIPv4 uint16 = 0x0800
+	EtherTypeIPv6 uint16 = 0x86dd
+	EtherTypeTEB  uint16 = 0x6558 // transparent ethernet bridging, payload is ethernet frame
+)
+
+// Tunnel encapsulation of Conn
+type Tunnel interface {
+	// Proto outer ip protocol number
+	Proto() tcpip.TransportProtocolNumber
+
+	// Overhead max encapsulation header size
+	Overhead() int
+
+	// Encap prepend encapsulation header to inner packet
+	Encap(pkt *packet.Packet) error
+
+	// Decap remove encapsulation header, return false if packet not
+	// belong to the tunnel, such as key mismatch
+	Decap(pkt *packet.Packet) (bool, error)
+}
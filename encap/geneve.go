@@ -0,0 +1,217 @@
+package encap
+
+import (
+	"encoding/binary"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	GenevePort        = 6081 // IANA assigned udp port
+	GeneveMinimumSize = 8
+	GeneveMaximumSize = GeneveMinimumSize + 63*4
+
+	geneveFlagOAM      = 0x80
+	geneveFlagCritical = 0x40
+	geneveOptionSize   = 4
+)
+
+// GeneveOption option TLV, Data length is multiple of 4 and not greater
+// than 124
+type GeneveOption struct {
+	Class uint16
+	Type  uint8 // high bit is critical flag
+	Data  []byte
+}
+
+// Critical receiver must drop the packet if not support the option
+func (o GeneveOption) Critical() bool { return o.Type&0x80 != 0 }
+
+// Geneve header, RFC 8926
+type Geneve struct {
+	Protocol uint16 // ether type of payload
+	VNI      uint32 // 24 bits virtual network identifier
+	OAM      bool   // control packet
+	Critical bool   // with critical option, calculated by Encap
+	Options  []GeneveOption
+}
+
+// Size header size
+func (g Geneve) Size() int {
+	n := GeneveMinimumSize
+	for _, o := range g.Options {
+		n += geneveOptionSize + len(o.Data)
+	}
+	return n
+}
+
+// Encap prepend Geneve header to pkt, not alloc if pkt head section not less
+// than Size
+func (g Geneve) Encap(pkt *packet.Packet) error {
+	n := g.Size()
+	if n > GeneveMaximumSize {
+		return errors.Errorf("geneve options too long %d", n-GeneveMinimumSize)
+	} else if g.VNI >= 1<<24 {
+		return errors.Errorf("invalid vni %d", g.VNI)
+	}
+	for _, o := range g.Options {
+		if len(o.Data)%4 != 0 || len(o.Data) > 31*4 {
+			return errors.Errorf("invalid geneve option length %d", len(o.Data))
+		}
+	}
+
+	b := pkt.AttachN(n).Bytes()
+	b[0] = uint8((n - GeneveMinimumSize) / 4) // version 0
+	b[1] = 0
+	if g.OAM {
+		b[1] |= geneveFlagOAM
+	}
+	binary.BigEndian.PutUint16(b[2:], g.Protocol)
+	binary.BigEndian.PutUint32(b[4:], g.VNI<<8)
+
+	off := GeneveMinimumSize
+	for _, o := range g.Options {
+		if o.Critical() {
+			b[1] |= geneveFlagCritical
+		}
+		binary.BigEndian.PutUint16(b[off:], o.Class)
+		b[off+2] = o.Type
+		b[off+3] = uint8(len(o.Data) / 4)
+		off += geneveOptionSize + copy(b[off+geneveOptionSize:], o.Data)
+	}
+	return nil
+}
+
+// ParseGeneve parse Geneve header, return header size, options Data refer b
+func ParseGeneve(b []byte) (g Geneve, n int, err error) {
+	if len(b) < GeneveMinimumSize {
+		return Geneve{}, 0, errorx.ShortBuff(GeneveMinimumSize, len(b))
+	} else if v := b[0] >> 6; v != 0 {
+		return Geneve{}, 0, errors.Errorf("not support geneve version %d", v)
+	}
+	n = GeneveMinimumSize + int(b[0]&0x3f)*4
+	if len(b) < n {
+		return Geneve{}, 0, errorx.ShortBuff(n, len(b))
+	}
+	g = Geneve{
+		Protocol: binary.BigEndian.Uint16(b[2:]),
+		VNI:      binary.BigEndian.Uint32(b[4:]) >> 8,
+		OAM:      b[1]&geneveFlagOAM != 0,
+		Critical: b[1]&geneveFlagCritical != 0,
+	}
+
+	for off := GeneveMinimumSize; off < n; {
+		if off+geneveOptionSize > n {
+			return Geneve{}, 0, errors.New("invalid geneve option")
+		}
+		size := int(b[off+3]&0x1f) * 4
+		if off+geneveOptionSize+size > n {
+			return Geneve{}, 0, errors.New("invalid geneve option length")
+		}
+		g.Options = append(g.Options, GeneveOption{
+			Class: binary.BigEndian.Uint16(b[off:]),
+			Type:  b[off+2],
+			Data:  b[off+geneveOptionSize : off+geneveOptionSize+size],
+		})
+		off += geneveOptionSize + size
+	}
+	return g, n, nil
+}
+
+// DecapGeneve parse and remove Geneve header of pkt, options Data refer pkt
+func DecapGeneve(pkt *packet.Packet) (Geneve, error) {
+	g, n, err := ParseGeneve(pkt.Bytes())
+	if err != nil {
+		return Geneve{}, err
+	}
+	pkt.DetachN(n)
+	return g, nil
+}
+
+// GeneveConn Geneve tunnel over udp RawConn, packet of other VNI is dropped
+type GeneveConn struct {
+	udpConn
+	vni uint32
+}
+
+// NewGeneve layer Geneve on conn, conn is udp RawConn, such as created by
+// udp/raw Connect with remote port GenevePort
+func NewGeneve(conn rawsock.RawConn, vni uint32) (*GeneveConn, error) {
+	if vni >= 1<<24 {
+		return nil, errors.Errorf("invalid vni %d", vni)
+	}
+	return &GeneveConn{udpConn: newUDPConn(conn), vni: vni}, nil
+}
+
+// Read read payload, return Geneve header, options Data refer pkt
+func (c *GeneveConn) Read(pkt *packet.Packet) (Geneve, error) {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		if err := c.read(pkt.Sets(head, data)); err != nil {
+			return Geneve{}, err
+		}
+
+		g, err := DecapGeneve(pkt)
+		if err != nil {
+			return Geneve{}, errorx.WrapTemp(err)
+		} else if g.VNI != c.vni {
+			continue
+		}
+		return g, nil
+	}
+}
+
+// Write encapsulate payload with hdr, hdr's VNI is ignored, pkt head section
+// should not less than hdr.Size and udp header, otherwise alloc
+func (c *GeneveConn) Write(pkt *packet.Packet, hdr Geneve) error {
+	n := pkt.Data()
+	hdr.VNI = c.vni
+	if err := hdr.Encap(pkt); err != nil {
+		return err
+	}
+	defer pkt.DetachN(pkt.Data() - n)
+	return c.write(pkt)
+}
+
+// ReadFrame read inner ethernet frame's payload, return the frame header,
+// non-ethernet payload is dropped
+func (c *GeneveConn) ReadFrame(pkt *packet.Packet) (rawsock.Frame, error) {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		g, err := c.Read(pkt.Sets(head, data))
+		if err != nil {
+			return rawsock.Frame{}, err
+		} else if g.Protocol != EtherTypeTEB || g.OAM {
+			continue
+		}
+
+		frame, err := DecapFrame(pkt)
+		if err != nil {
+			return rawsock.Frame{}, errorx.WrapTemp(err)
+		}
+		return frame, nil
+	}
+}
+
+// WriteFrame encapsulate payload with frame header, and Geneve header
+// without options
+func (c *GeneveConn) WriteFrame(pkt *packet.Packet, frame rawsock.Frame) error {
+	n := pkt.Data()
+	if err := EncapFrame(pkt, frame); err != nil {
+		return err
+	}
+	defer pkt.DetachN(pkt.Data() - n)
+	return c.Write(pkt, Geneve{Protocol: EtherTypeTEB})
+}
+
+// Overhead encapsulation size of frame payload without options, include udp
+// header
+func (c *GeneveConn) Overhead() int {
+	return header.UDPMinimumSize + GeneveMinimumSize + EthernetSize + dot1QHeaderSize
+}
+
+func (c *GeneveConn) VNI() uint32 { return c.vni }
@@ -0,0 +1,105 @@
+package encap_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/encap"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Geneve(t *testing.T) {
+	for _, g := range []encap.Geneve{
+		{Protocol: encap.EtherTypeTEB, VNI: 1},
+		{Protocol: encap.EtherTypeIPv4, VNI: 0xffffff, OAM: true},
+		{
+			Protocol: encap.EtherTypeIPv6, VNI: 7, Critical: true,
+			Options: []encap.GeneveOption{
+				{Class: 0x0102, Type: 3, Data: []byte{1, 2, 3, 4}},
+				{Class: 0xffff, Type: 0x80 | 1, Data: []byte{}},
+				{Class: 0, Type: 2, Data: make([]byte, 124)},
+			},
+		},
+	} {
+		pkt := packet.Make(encap.GeneveMaximumSize, 0, 16).Append(1, 2, 3)
+		require.NoError(t, g.Encap(pkt))
+		require.Equal(t, g.Size()+3, pkt.Data())
+
+		got, err := encap.DecapGeneve(pkt)
+		require.NoError(t, err)
+		require.Equal(t, g, got)
+		require.Equal(t, []byte{1, 2, 3}, pkt.Bytes())
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		pkt := packet.Make(encap.GeneveMaximumSize, 0, 16)
+		require.Error(t, encap.Geneve{VNI: 1 << 24}.Encap(pkt))
+		require.Error(t, encap.Geneve{Options: []encap.GeneveOption{{Data: []byte{1}}}}.Encap(pkt))
+		require.Error(t, encap.Geneve{Options: []encap.GeneveOption{{Data: make([]byte, 128)}}}.Encap(pkt))
+
+		// option length exceed header
+		b := []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+		_, _, err := encap.ParseGeneve(b)
+		require.Error(t, err)
+
+		// version 1
+		_, _, err = encap.ParseGeneve([]byte{0x40, 0, 0, 0, 0, 0, 0, 0})
+		require.Error(t, err)
+	})
+}
+
+func Test_GeneveConn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), encap.GenevePort)
+		frame = rawsock.Frame{
+			Src:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			Dst:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+			EtherType: encap.EtherTypeIPv4,
+		}
+		inner = test.RandUDP(t,
+			netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+			netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		)
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	defer c.Close()
+
+	client, err := encap.NewGeneve(c, 100)
+	require.NoError(t, err)
+	other, err := encap.NewGeneve(c, 200)
+	require.NoError(t, err)
+	server, err := encap.NewGeneve(s, 100)
+	require.NoError(t, err)
+	defer server.Close()
+
+	// ip payload with option
+	hdr := encap.Geneve{
+		Protocol: encap.EtherTypeIPv4,
+		Options:  []encap.GeneveOption{{Class: 1, Type: 2, Data: []byte{1, 2, 3, 4}}},
+	}
+	require.NoError(t, other.Write(packet.Make(64, 0, len(inner)).Append(inner...), hdr))
+	pkt := packet.Make(64, 0, len(inner)).Append(inner...)
+	require.NoError(t, client.Write(pkt, hdr))
+	require.Equal(t, inner, pkt.Bytes())
+
+	var p = packet.Make(0, 1536)
+	g, err := server.Read(p)
+	require.NoError(t, err)
+	hdr.VNI = 100
+	require.Equal(t, hdr, g)
+	require.Equal(t, inner, p.Bytes())
+
+	// ethernet frame payload
+	require.NoError(t, client.WriteFrame(packet.Make(64, 0, len(inner)).Append(inner...), frame))
+	p = packet.Make(0, 1536)
+	got, err := server.ReadFrame(p)
+	require.NoError(t, err)
+	require.Equal(t, frame, got)
+	require.Equal(t, inner, p.Bytes())
+}
@@ -0,0 +1,174 @@
+package encap
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const GREProtocolNumber tcpip.TransportProtocolNumber = 47
+
+const (
+	greFlagChecksum = 0x8000
+	greFlagKey      = 0x2000
+	greFlagSeq      = 0x1000
+	greVersion      = 0x0007
+
+	GREMinimumSize = 4
+	GREMaximumSize = 16
+)
+
+// GRE header, RFC 2784 and key/sequence number extension RFC 2890
+type GRE struct {
+	Protocol uint16 // ether type of payload
+	Checksum bool   // with checksum field, calculated by Encap
+	HasKey   bool
+	Key      uint32
+	HasSeq   bool
+	Seq      uint32
+}
+
+// Size header size
+func (g GRE) Size() int {
+	n := GREMinimumSize
+	if g.Checksum {
+		n += 4
+	}
+	if g.HasKey {
+		n += 4
+	}
+	if g.HasSeq {
+		n += 4
+	}
+	return n
+}
+
+// Encap prepend GRE header to pkt, not alloc if pkt head section not less
+// than Size
+func (g GRE) Encap(pkt *packet.Packet) {
+	n := g.Size()
+	b := pkt.AttachN(n).Bytes()
+
+	var flags uint16
+	off := GREMinimumSize
+	if g.Checksum {
+		flags |= greFlagChecksum
+		binary.BigEndian.PutUint32(b[off:], 0)
+		off += 4
+	}
+	if g.HasKey {
+		flags |= greFlagKey
+		binary.BigEndian.PutUint32(b[off:], g.Key)
+		off += 4
+	}
+	if g.HasSeq {
+		flags |= greFlagSeq
+		binary.BigEndian.PutUint32(b[off:], g.Seq)
+	}
+	binary.BigEndian.PutUint16(b[0:], flags)
+	binary.BigEndian.PutUint16(b[2:], g.Protocol)
+	if g.Checksum {
+		binary.BigEndian.PutUint16(b[4:], ^checksum.Checksum(b, 0))
+	}
+}
+
+// ParseGRE parse GRE header, return header size, checksum is validated if present
+func ParseGRE(b []byte) (g GRE, n int, err error) {
+	if len(b) < GREMinimumSize {
+		return GRE{}, 0, errorx.ShortBuff(GREMinimumSize, len(b))
+	}
+	flags := binary.BigEndian.Uint16(b[0:])
+	if v := flags & greVersion; v != 0 {
+		return GRE{}, 0, errors.Errorf("not support gre version %d", v)
+	}
+	g = GRE{
+		Protocol: binary.BigEndian.Uint16(b[2:]),
+		Checksum: flags&greFlagChecksum != 0,
+		HasKey:   flags&greFlagKey != 0,
+		HasSeq:   flags&greFlagSeq != 0,
+	}
+	if n = g.Size(); len(b) < n {
+		return GRE{}, 0, errorx.ShortBuff(n, len(b))
+	}
+
+	off := GREMinimumSize
+	if g.Checksum {
+		if checksum.Checksum(b, 0) != 0xffff {
+			return GRE{}, 0, errors.New("invalid gre checksum")
+		}
+		off += 4
+	}
+	if g.HasKey {
+		g.Key = binary.BigEndian.Uint32(b[off:])
+		off += 4
+	}
+	if g.HasSeq {
+		g.Seq = binary.BigEndian.Uint32(b[off:])
+	}
+	return g, n, nil
+}
+
+// DecapGRE parse and remove GRE header of pkt
+func DecapGRE(pkt *packet.Packet) (GRE, error) {
+	g, n, err := ParseGRE(pkt.Bytes())
+	if err != nil {
+		return GRE{}, err
+	}
+	pkt.DetachN(n)
+	return g, nil
+}
+
+// GRETunnel GRE tunnel, outbound packet's header use template's Checksum
+// and Key, sequence number is increased if HasSeq. protocol is inferred
+// by inner ip version if template's Protocol is 0. inbound packet's key
+// should equal template's key.
+func GRETunnel(tmpl GRE) Tunnel {
+	return &greTunnel{tmpl: tmpl}
+}
+
+type greTunnel struct {
+	tmpl GRE
+	seq  atomic.Uint32
+}
+
+func (t *greTunnel) Proto() tcpip.TransportProtocolNumber { return GREProtocolNumber }
+func (t *greTunnel) Overhead() int                        { return t.tmpl.Size() }
+
+func (t *greTunnel) Encap(pkt *packet.Packet) error {
+	var g = t.tmpl
+	if g.Protocol == 0 {
+		switch header.IPVersion(pkt.Bytes()) {
+		case 4:
+			g.Protocol = EtherTypeIPv4
+		case 6:
+			g.Protocol = EtherTypeIPv6
+		default:
+			return errors.New("invalid inner ip packet")
+		}
+	}
+	if g.HasSeq {
+		g.Seq = t.seq.Add(1) - 1
+	}
+	g.Encap(pkt)
+	return nil
+}
+
+func (t *greTunnel) Decap(pkt *packet.Packet) (bool, error) {
+	g, err := DecapGRE(pkt)
+	if err != nil {
+		return false, err
+	}
+	if g.HasKey != t.tmpl.HasKey || g.Key != t.tmpl.Key {
+		return false, nil
+	}
+	if t.tmpl.Protocol != 0 && g.Protocol != t.tmpl.Protocol {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,81 @@
+package encap_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/encap"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GRE(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	for _, g := range []encap.GRE{
+		{Protocol: encap.EtherTypeIPv4},
+		{Protocol: encap.EtherTypeIPv4, Checksum: true},
+		{Protocol: encap.EtherTypeIPv4, HasKey: true, Key: 0x12345678},
+		{Protocol: encap.EtherTypeIPv6, Checksum: true, HasKey: true, Key: 1, HasSeq: true, Seq: 99},
+	} {
+		inner := test.RandUDP(t, src, dst)
+		pkt := packet.Make(encap.GREMaximumSize, 0, len(inner)).Append(inner...)
+
+		g.Encap(pkt)
+		require.Equal(t, g.Size(), pkt.Data()-len(inner))
+
+		got, err := encap.DecapGRE(pkt)
+		require.NoError(t, err)
+		require.Equal(t, g, got)
+		require.Equal(t, inner, pkt.Bytes())
+	}
+
+	t.Run("invalid-checksum", func(t *testing.T) {
+		pkt := packet.Make(encap.GREMaximumSize, 0, 64).Append(test.RandUDP(t, src, dst)...)
+		encap.GRE{Protocol: encap.EtherTypeIPv4, Checksum: true}.Encap(pkt)
+		pkt.Bytes()[pkt.Data()-1] ^= 0xff
+
+		_, err := encap.DecapGRE(pkt)
+		require.Error(t, err)
+	})
+
+	t.Run("short", func(t *testing.T) {
+		_, _, err := encap.ParseGRE([]byte{0x20, 0, 0x08, 0})
+		require.Error(t, err)
+	})
+}
+
+func Test_GRETunnel(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(netip.MustParseAddr("2001:db8::1"), test.RandPort())
+	)
+	tun := encap.GRETunnel(encap.GRE{HasKey: true, Key: 7, HasSeq: true})
+	require.Equal(t, encap.GREProtocolNumber, tun.Proto())
+
+	for i, inner := range [][]byte{test.RandTCP(t, src, src), test.RandTCP(t, dst, dst)} {
+		pkt := packet.Make(encap.GREMaximumSize, 0, len(inner)).Append(inner...)
+		require.NoError(t, tun.Encap(pkt))
+
+		g, _, err := encap.ParseGRE(pkt.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, uint32(i), g.Seq)
+		require.Equal(t, map[int]uint16{0: encap.EtherTypeIPv4, 1: encap.EtherTypeIPv6}[i], g.Protocol)
+
+		ok, err := tun.Decap(pkt)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, inner, pkt.Bytes())
+	}
+
+	// key mismatch
+	pkt := packet.Make(encap.GREMaximumSize, 0, 64).Append(test.RandUDP(t, src, src)...)
+	encap.GRE{Protocol: encap.EtherTypeIPv4, HasKey: true, Key: 8}.Encap(pkt)
+	ok, err := tun.Decap(pkt)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
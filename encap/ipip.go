@@ -0,0 +1,132 @@
+package encap
+
+import (
+	"net/netip"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	IPIPProtocolNumber tcpip.TransportProtocolNumber = 4  // ipv4 in ip, RFC 2003
+	SITProtocolNumber  tcpip.TransportProtocolNumber = 41 // ipv6 in ip, RFC 4213
+)
+
+// innerProto tunnel protocol number of inner ip packet
+func innerProto(ip []byte) (tcpip.TransportProtocolNumber, error) {
+	switch header.IPVersion(ip) {
+	case 4:
+		return IPIPProtocolNumber, nil
+	case 6:
+		return SITProtocolNumber, nil
+	default:
+		return 0, errors.New("invalid inner ip packet")
+	}
+}
+
+// EncapIPv4 prepend outer ipv4 header to inner ipv4/ipv6 packet, protocol is
+// 4 or 41 by inner ip version, TOS is copied from inner packet and DF is set.
+// not alloc if pkt head section not less than 20
+func EncapIPv4(pkt *packet.Packet, src, dst netip.Addr, id uint16) error {
+	if !src.Is4() || !dst.Is4() {
+		return errors.Errorf("invalid outer address %s and %s", src, dst)
+	}
+	proto, err := innerProto(pkt.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var tos uint8
+	if proto == IPIPProtocolNumber && pkt.Data() >= header.IPv4MinimumSize {
+		tos, _ = header.IPv4(pkt.Bytes()).TOS()
+	} else if proto == SITProtocolNumber && pkt.Data() >= header.IPv6MinimumSize {
+		tos, _ = header.IPv6(pkt.Bytes()).TOS()
+	}
+
+	n := pkt.Data()
+	hdr := header.IPv4(pkt.AttachN(header.IPv4MinimumSize).Bytes())
+	hdr.Encode(&header.IPv4Fields{
+		TOS:         tos,
+		TotalLength: uint16(header.IPv4MinimumSize + n),
+		ID:          id,
+		Flags:       header.IPv4FlagDontFragment,
+		TTL:         64,
+		Protocol:    uint8(proto),
+		SrcAddr:     tcpip.AddrFrom4(src.As4()),
+		DstAddr:     tcpip.AddrFrom4(dst.As4()),
+	})
+	hdr.SetChecksum(^hdr.CalculateChecksum())
+	return nil
+}
+
+// DecapIPv4 validate and remove outer ipv4 header of IPIP/SIT packet, return
+// outer address
+func DecapIPv4(pkt *packet.Packet) (src, dst netip.Addr, err error) {
+	hdrLen, err := helper.IPCheck(pkt.Bytes())
+	if err != nil {
+		return src, dst, err
+	} else if header.IPVersion(pkt.Bytes()) != 4 {
+		return src, dst, errors.New("not ipv4 packet")
+	}
+	hdr := header.IPv4(pkt.Bytes())
+	if !hdr.IsChecksumValid() {
+		return src, dst, errors.New("invalid ipv4 header checksum")
+	} else if hdr.More() || hdr.FragmentOffset() != 0 {
+		return src, dst, errors.New("fragmented ipv4 packet")
+	}
+
+	proto, err := innerProto(pkt.Bytes()[hdrLen:])
+	if err != nil {
+		return src, dst, err
+	} else if tcpip.TransportProtocolNumber(hdr.Protocol()) != proto {
+		return src, dst, errors.Errorf("protocol %d not match inner packet", hdr.Protocol())
+	}
+
+	src = netip.AddrFrom4(hdr.SourceAddress().As4())
+	dst = netip.AddrFrom4(hdr.DestinationAddress().As4())
+	pkt.DetachN(int(hdrLen))
+	return src, dst, nil
+}
+
+// IPIPTunnel ipv4-in-ip tunnel, protocol number 4
+func IPIPTunnel() Tunnel { return ipipTunnel(IPIPProtocolNumber) }
+
+// SITTunnel ipv6-in-ip tunnel, protocol number 41
+func SITTunnel() Tunnel { return ipipTunnel(SITProtocolNumber) }
+
+// ipipTunnel not any encapsulation header, inner ip packet follow outer
+// ip header directly
+type ipipTunnel tcpip.TransportProtocolNumber
+
+func (t ipipTunnel) Proto() tcpip.TransportProtocolNumber { return tcpip.TransportProtocolNumber(t) }
+func (t ipipTunnel) Overhead() int                        { return 0 }
+
+func (t ipipTunnel) Encap(pkt *packet.Packet) error {
+	if proto, err := innerProto(pkt.Bytes()); err != nil {
+		return err
+	} else if proto != t.Proto() {
+		return errors.Errorf("protocol %d tunnel not support ipv%d packet", t, header.IPVersion(pkt.Bytes()))
+	}
+	return nil
+}
+
+func (t ipipTunnel) Decap(pkt *packet.Packet) (bool, error) {
+	if proto, err := innerProto(pkt.Bytes()); err != nil {
+		return false, err
+	} else if proto != t.Proto() {
+		return false, nil
+	}
+
+	min := header.IPv4MinimumSize
+	if t.Proto() == SITProtocolNumber {
+		min = header.IPv6MinimumSize
+	}
+	if pkt.Data() < min {
+		return false, errorx.ShortBuff(min, pkt.Data())
+	}
+	return true, nil
+}
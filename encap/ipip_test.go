@@ -0,0 +1,74 @@
+package encap_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/encap"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_EncapIPv4(t *testing.T) {
+	var (
+		src = netip.MustParseAddr("10.0.0.1")
+		dst = netip.MustParseAddr("10.0.0.2")
+	)
+
+	for _, e := range []struct {
+		inner []byte
+		proto uint8
+	}{
+		{test.RandUDP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), netip.AddrPortFrom(test.RandIP(), test.RandPort())), 4},
+		{test.RandUDP(t, netip.MustParseAddrPort("[2001:db8::1]:80"), netip.MustParseAddrPort("[2001:db8::2]:80")), 41},
+	} {
+		pkt := packet.Make(0, 0, len(e.inner)).Append(e.inner...)
+		require.NoError(t, encap.EncapIPv4(pkt, src, dst, 1))
+
+		hdr := header.IPv4(pkt.Bytes())
+		require.Equal(t, e.proto, hdr.Protocol())
+		require.True(t, hdr.IsChecksumValid())
+		require.Equal(t, len(e.inner)+header.IPv4MinimumSize, int(hdr.TotalLength()))
+
+		s, d, err := encap.DecapIPv4(pkt)
+		require.NoError(t, err)
+		require.Equal(t, src, s)
+		require.Equal(t, dst, d)
+		require.Equal(t, e.inner, pkt.Bytes())
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		pkt := packet.Make(0, 0, 64).Append(test.RandUDP(t, netip.AddrPortFrom(test.RandIP(), 1), netip.AddrPortFrom(test.RandIP(), 2))...)
+		require.Error(t, encap.EncapIPv4(pkt, netip.IPv6Loopback(), dst, 1))
+
+		require.NoError(t, encap.EncapIPv4(pkt, src, dst, 1))
+		pkt.Bytes()[9] = 41 // protocol
+		_, _, err := encap.DecapIPv4(pkt)
+		require.Error(t, err)
+	})
+}
+
+func Test_IPIPTunnel(t *testing.T) {
+	var (
+		v4 = test.RandUDP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), netip.AddrPortFrom(test.RandIP(), test.RandPort()))
+		v6 = test.RandUDP(t, netip.MustParseAddrPort("[2001:db8::1]:80"), netip.MustParseAddrPort("[2001:db8::2]:80"))
+	)
+	ipip, sit := encap.IPIPTunnel(), encap.SITTunnel()
+	require.Equal(t, encap.IPIPProtocolNumber, ipip.Proto())
+	require.Equal(t, encap.SITProtocolNumber, sit.Proto())
+	require.Zero(t, ipip.Overhead())
+
+	require.NoError(t, ipip.Encap(packet.From(v4)))
+	require.Error(t, ipip.Encap(packet.From(v6)))
+	require.NoError(t, sit.Encap(packet.From(v6)))
+	require.Error(t, sit.Encap(packet.From(v4)))
+
+	ok, err := sit.Decap(packet.From(v6))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = sit.Decap(packet.From(v4))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,208 @@
+package encap
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	VXLANPort = 4789 // IANA assigned udp port
+	VXLANSize = 8
+
+	vxlanFlagVNI = 0x08
+
+	EthernetSize    = header.EthernetMinimumSize
+	etherTypeDot1Q  = 0x8100
+	dot1QHeaderSize = 4
+)
+
+// VXLAN header, RFC 7348
+type VXLAN struct {
+	VNI uint32 // 24 bits vxlan network identifier
+}
+
+// Encap prepend VXLAN header to pkt, not alloc if pkt head section not less
+// than VXLANSize
+func (v VXLAN) Encap(pkt *packet.Packet) {
+	b := pkt.AttachN(VXLANSize).Bytes()
+	binary.BigEndian.PutUint32(b[0:], vxlanFlagVNI<<24)
+	binary.BigEndian.PutUint32(b[4:], v.VNI<<8)
+}
+
+// ParseVXLAN parse VXLAN header, the I flag must be set
+func ParseVXLAN(b []byte) (VXLAN, error) {
+	if len(b) < VXLANSize {
+		return VXLAN{}, errorx.ShortBuff(VXLANSize, len(b))
+	} else if b[0]&vxlanFlagVNI == 0 {
+		return VXLAN{}, errors.Errorf("invalid vxlan flags 0x%02x", b[0])
+	}
+	return VXLAN{VNI: binary.BigEndian.Uint32(b[4:]) >> 8}, nil
+}
+
+// DecapVXLAN parse and remove VXLAN header of pkt
+func DecapVXLAN(pkt *packet.Packet) (VXLAN, error) {
+	v, err := ParseVXLAN(pkt.Bytes())
+	if err != nil {
+		return VXLAN{}, err
+	}
+	pkt.DetachN(VXLANSize)
+	return v, nil
+}
+
+// EncapFrame prepend ethernet header to pkt, with 802.1Q tag if frame's
+// VLAN not 0
+func EncapFrame(pkt *packet.Packet, frame rawsock.Frame) error {
+	if len(frame.Src) != header.EthernetAddressSize || len(frame.Dst) != header.EthernetAddressSize {
+		return errors.Errorf("invalid hardware address %s and %s", frame.Src, frame.Dst)
+	}
+
+	if frame.VLAN != 0 {
+		b := pkt.AttachN(dot1QHeaderSize).Bytes()
+		binary.BigEndian.PutUint16(b[0:], frame.VLAN)
+		binary.BigEndian.PutUint16(b[2:], frame.EtherType)
+	}
+	b := pkt.AttachN(EthernetSize).Bytes()
+	copy(b[0:], frame.Dst)
+	copy(b[6:], frame.Src)
+	if frame.VLAN != 0 {
+		binary.BigEndian.PutUint16(b[12:], etherTypeDot1Q)
+	} else {
+		binary.BigEndian.PutUint16(b[12:], frame.EtherType)
+	}
+	return nil
+}
+
+// DecapFrame parse and remove ethernet header of pkt, include 802.1Q tag
+func DecapFrame(pkt *packet.Packet) (frame rawsock.Frame, err error) {
+	b := pkt.Bytes()
+	if len(b) < EthernetSize {
+		return frame, errorx.ShortBuff(EthernetSize, len(b))
+	}
+	frame.Dst = append(net.HardwareAddr{}, b[0:6]...)
+	frame.Src = append(net.HardwareAddr{}, b[6:12]...)
+	frame.EtherType = binary.BigEndian.Uint16(b[12:])
+
+	n := EthernetSize
+	if frame.EtherType == etherTypeDot1Q {
+		if len(b) < n+dot1QHeaderSize {
+			return frame, errorx.ShortBuff(n+dot1QHeaderSize, len(b))
+		}
+		frame.VLAN = binary.BigEndian.Uint16(b[n:])
+		frame.EtherType = binary.BigEndian.Uint16(b[n+2:])
+		n += dot1QHeaderSize
+	}
+	pkt.DetachN(n)
+	return frame, nil
+}
+
+// VXLANConn VXLAN tunnel over udp RawConn, Read/Write ethernet frame
+// payload of the VNI, frame of other VNI is dropped
+type VXLANConn struct {
+	udpConn
+	vni uint32
+}
+
+// NewVXLAN layer VXLAN on conn, conn is udp RawConn, such as created by
+// udp/raw Connect with remote port VXLANPort
+func NewVXLAN(conn rawsock.RawConn, vni uint32) (*VXLANConn, error) {
+	if vni >= 1<<24 {
+		return nil, errors.Errorf("invalid vni %d", vni)
+	}
+	return &VXLANConn{udpConn: newUDPConn(conn), vni: vni}, nil
+}
+
+// ReadFrame read inner frame's payload, return the frame header
+func (c *VXLANConn) ReadFrame(pkt *packet.Packet) (rawsock.Frame, error) {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		if err := c.read(pkt.Sets(head, data)); err != nil {
+			return rawsock.Frame{}, err
+		}
+
+		v, err := DecapVXLAN(pkt)
+		if err != nil {
+			return rawsock.Frame{}, errorx.WrapTemp(err)
+		} else if v.VNI != c.vni {
+			continue
+		}
+		frame, err := DecapFrame(pkt)
+		if err != nil {
+			return rawsock.Frame{}, errorx.WrapTemp(err)
+		}
+		return frame, nil
+	}
+}
+
+// WriteFrame encapsulate payload with frame header, pkt head section should
+// not less than Overhead, otherwise alloc
+func (c *VXLANConn) WriteFrame(pkt *packet.Packet, frame rawsock.Frame) error {
+	n := pkt.Data()
+	if err := EncapFrame(pkt, frame); err != nil {
+		return err
+	}
+	VXLAN{VNI: c.vni}.Encap(pkt)
+	defer pkt.DetachN(pkt.Data() - n)
+	return c.write(pkt)
+}
+
+// Overhead max encapsulation size of frame payload, include udp header
+func (c *VXLANConn) Overhead() int {
+	return header.UDPMinimumSize + VXLANSize + EthernetSize + dot1QHeaderSize
+}
+
+func (c *VXLANConn) VNI() uint32 { return c.vni }
+
+// udpConn udp based tunnel's underlay
+type udpConn struct {
+	conn    rawsock.RawConn
+	psoSum1 uint16 // outbound pseudo header checksum without length
+}
+
+func newUDPConn(conn rawsock.RawConn) udpConn {
+	laddr, raddr := conn.LocalAddr().Addr(), conn.RemoteAddr().Addr()
+	return udpConn{
+		conn: conn,
+		psoSum1: header.PseudoHeaderChecksum(
+			header.UDPProtocolNumber,
+			tcpip.AddrFromSlice(laddr.Unmap().AsSlice()),
+			tcpip.AddrFromSlice(raddr.Unmap().AsSlice()), 0,
+		),
+	}
+}
+
+// read read udp payload
+func (c *udpConn) read(pkt *packet.Packet) error {
+	if err := c.conn.Read(pkt); err != nil {
+		return err
+	}
+	if pkt.Data() < header.UDPMinimumSize {
+		return errorx.WrapTemp(errorx.ShortBuff(header.UDPMinimumSize, pkt.Data()))
+	}
+	pkt.DetachN(header.UDPMinimumSize)
+	return nil
+}
+
+// write write udp payload, pkt is restored
+func (c *udpConn) write(pkt *packet.Packet) error {
+	udp := header.UDP(pkt.AttachN(header.UDPMinimumSize).Bytes())
+	defer pkt.DetachN(header.UDPMinimumSize)
+	udp.Encode(&header.UDPFields{
+		SrcPort: c.conn.LocalAddr().Port(),
+		DstPort: c.conn.RemoteAddr().Port(),
+	})
+	ipstack.Checksum(header.UDPProtocolNumber, udp, c.psoSum1)
+	return c.conn.Write(pkt)
+}
+
+func (c *udpConn) LocalAddr() netip.AddrPort  { return c.conn.LocalAddr() }
+func (c *udpConn) RemoteAddr() netip.AddrPort { return c.conn.RemoteAddr() }
+func (c *udpConn) Close() error               { return c.conn.Close() }
@@ -0,0 +1,97 @@
+package encap_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/encap"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_VXLAN(t *testing.T) {
+	pkt := packet.Make(encap.VXLANSize, 0, 16).Append(1, 2, 3)
+	encap.VXLAN{VNI: 0xabcdef}.Encap(pkt)
+	require.Equal(t, encap.VXLANSize+3, pkt.Data())
+
+	v, err := encap.DecapVXLAN(pkt)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xabcdef), v.VNI)
+	require.Equal(t, []byte{1, 2, 3}, pkt.Bytes())
+
+	_, err = encap.ParseVXLAN(make([]byte, encap.VXLANSize))
+	require.Error(t, err)
+}
+
+func Test_Frame(t *testing.T) {
+	for _, f := range []rawsock.Frame{
+		{
+			Src:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			Dst:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			EtherType: encap.EtherTypeIPv4,
+		},
+		{
+			Src:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			Dst:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+			EtherType: encap.EtherTypeIPv6,
+			VLAN:      5<<13 | 100,
+		},
+	} {
+		pkt := packet.Make(0, 0, 16).Append(1, 2, 3)
+		require.NoError(t, encap.EncapFrame(pkt, f))
+
+		got, err := encap.DecapFrame(pkt)
+		require.NoError(t, err)
+		require.Equal(t, f, got)
+		require.Equal(t, []byte{1, 2, 3}, pkt.Bytes())
+	}
+
+	require.Error(t, encap.EncapFrame(packet.Make(0, 0), rawsock.Frame{}))
+}
+
+func Test_VXLANConn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), encap.VXLANPort)
+		frame = rawsock.Frame{
+			Src:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			Dst:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+			EtherType: encap.EtherTypeIPv4,
+		}
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	defer c.Close()
+
+	_, err := encap.NewVXLAN(c, 1<<24)
+	require.Error(t, err)
+
+	client, err := encap.NewVXLAN(c, 100)
+	require.NoError(t, err)
+	other, err := encap.NewVXLAN(c, 200)
+	require.NoError(t, err)
+	server, err := encap.NewVXLAN(s, 100)
+	require.NoError(t, err)
+	defer server.Close()
+
+	inner := test.RandUDP(t,
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+	)
+
+	// other vni frame is dropped
+	require.NoError(t, other.WriteFrame(packet.Make(64, 0, len(inner)).Append(inner...), frame))
+
+	pkt := packet.Make(client.Overhead()+32, 0, len(inner)).Append(inner...)
+	require.NoError(t, client.WriteFrame(pkt, frame))
+	require.Equal(t, inner, pkt.Bytes())
+
+	var p = packet.Make(0, 1536)
+	got, err := server.ReadFrame(p)
+	require.NoError(t, err)
+	require.Equal(t, frame, got)
+	require.Equal(t, inner, p.Bytes())
+}
@@ -0,0 +1,32 @@
+package rawsock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotSupported feature not supported by backend, see Capabilities
+var ErrNotSupported = errors.New("not supported by backend")
+
+// ErrPacketTooLarge packet size exceed the mtu of egress interface
+type ErrPacketTooLarge struct {
+	Size int // ip packet size
+	MTU  int
+}
+
+func (e *ErrPacketTooLarge) Error() string {
+	return fmt.Sprintf("packet size %d exceed mtu %d", e.Size, e.MTU)
+}
+
+// ErrPartialWrite write failed after part of segments sent, such as TSO
+// segmented write, retry the whole packet will re-send the sent segments
+type ErrPartialWrite struct {
+	Sent int // sent segments
+	Err  error
+}
+
+func (e *ErrPartialWrite) Error() string {
+	return fmt.Sprintf("partial write after %d segments sent: %s", e.Sent, e.Err)
+}
+
+func (e *ErrPartialWrite) Unwrap() error { return e.Err }
@@ -0,0 +1,236 @@
+// Package failover switch RawConn's remote address between ordered
+// endpoints, when Write failed continuously or not recv any packet in idle
+// time, endpoint is re-resolved every switch, for anycast-like client
+// resilience.
+package failover
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/pkg/errors"
+)
+
+// Resolver lookup addresses of host, network is ip4 or ip6
+type Resolver func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+type Config struct {
+	MaxFailures int           // switch after continuous Write failures
+	Idle        time.Duration // switch if not recv any packet in Idle, 0 is disable
+	Resolver    Resolver
+	Timeout     time.Duration // resolve timeout
+
+	// called after switched
+	OnSwitch func(old, new netip.AddrPort)
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		MaxFailures: 3,
+		Resolver:    net.DefaultResolver.LookupNetIP,
+		Timeout:     time.Second * 5,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MaxFailures switch remote after n continuous Write failures, default 3
+func MaxFailures(n int) Option {
+	return func(c *Config) {
+		c.MaxFailures = max(n, 1)
+	}
+}
+
+// Idle switch remote if not recv any packet in d, default disable
+func Idle(d time.Duration) Option {
+	return func(c *Config) {
+		c.Idle = d
+	}
+}
+
+// WithResolver resolve endpoint host, default net.DefaultResolver
+func WithResolver(r Resolver, timeout time.Duration) Option {
+	return func(c *Config) {
+		c.Resolver, c.Timeout = r, timeout
+	}
+}
+
+// OnSwitch fn be called after remote address switched
+func OnSwitch(fn func(old, new netip.AddrPort)) Option {
+	return func(c *Config) {
+		c.OnSwitch = fn
+	}
+}
+
+type Conn struct {
+	rawsock.RoamConn
+	cfg       *Config
+	endpoints []string
+	network   string // ip4 or ip6, same as local address
+
+	mu       sync.Mutex
+	next     int // next endpoint index
+	idle     atomic.Pointer[idle.Timer]
+	closed   bool
+	failures atomic.Int32
+}
+
+var _ rawsock.RoamConn = (*Conn)(nil)
+
+// New switch conn's remote address to first resolvable endpoint, endpoints
+// is host:port or ip:port, host is resolved to address of local address
+// family.
+func New(conn rawsock.RoamConn, endpoints []string, opts ...Option) (*Conn, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("require endpoints")
+	}
+	var c = &Conn{
+		RoamConn:  conn,
+		cfg:       Options(opts...),
+		endpoints: endpoints,
+		network:   "ip4",
+	}
+	if !conn.LocalAddr().Addr().Is4() {
+		c.network = "ip6"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.failover(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// failover switch to next resolvable endpoint
+func (c *Conn) failover() (netip.AddrPort, error) {
+	var (
+		old  = c.RoamConn.RemoteAddr()
+		errs []error
+	)
+	for range c.endpoints {
+		endpoint := c.endpoints[c.next]
+		c.next = (c.next + 1) % len(c.endpoints)
+
+		raddr, err := c.resolve(endpoint)
+		if err == nil {
+			err = c.RoamConn.SetRemote(raddr)
+		}
+		if err != nil {
+			errs = append(errs, errors.WithMessage(err, endpoint))
+			continue
+		}
+
+		c.failures.Store(0)
+		c.resetIdle()
+		if c.cfg.OnSwitch != nil && old != raddr {
+			c.cfg.OnSwitch(old, raddr)
+		}
+		return raddr, nil
+	}
+	return netip.AddrPort{}, errors.Errorf("all endpoints failed: %v", errs)
+}
+
+func (c *Conn) resolve(endpoint string) (netip.AddrPort, error) {
+	if addr, err := netip.ParseAddrPort(endpoint); err == nil {
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return netip.AddrPort{}, errors.WithStack(err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, errors.WithStack(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	addrs, err := c.cfg.Resolver(ctx, c.network, host)
+	if err != nil {
+		return netip.AddrPort{}, errors.WithStack(err)
+	} else if len(addrs) == 0 {
+		return netip.AddrPort{}, errors.Errorf("not found address of %s", host)
+	}
+	return netip.AddrPortFrom(addrs[0].Unmap(), uint16(p)), nil
+}
+
+func (c *Conn) resetIdle() {
+	c.idle.Swap(idle.New(c.cfg.Idle, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.closed {
+			c.failover()
+		}
+	})).Stop()
+}
+
+func (c *Conn) Read(pkt *packet.Packet) error {
+	err := c.RoamConn.Read(pkt)
+	if err == nil {
+		c.idle.Load().Touch()
+	}
+	return err
+}
+
+// Write switch remote after MaxFailures continuous failures, the failed
+// packet is not re-sent
+func (c *Conn) Write(pkt *packet.Packet) error {
+	err := c.RoamConn.Write(pkt)
+	if err == nil {
+		c.failures.Store(0)
+		return nil
+	}
+
+	var tooLarge *rawsock.ErrPacketTooLarge
+	if errors.As(err, &tooLarge) || errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	if int(c.failures.Add(1)) >= c.cfg.MaxFailures {
+		c.mu.Lock()
+		if !c.closed {
+			c.failover()
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// SetRemote set remote address manually, not change endpoints order
+func (c *Conn) SetRemote(raddr netip.AddrPort) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures.Store(0)
+	c.idle.Load().Touch()
+	return c.RoamConn.SetRemote(raddr)
+}
+
+// Switch switch to next endpoint manually, return new remote address
+func (c *Conn) Switch() (netip.AddrPort, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return netip.AddrPort{}, errors.WithStack(net.ErrClosed)
+	}
+	return c.failover()
+}
+
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.idle.Load().Stop()
+	c.mu.Unlock()
+	return c.RoamConn.Close()
+}
@@ -0,0 +1,141 @@
+package failover_test
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/failover"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// roam fake RoamConn, Write fail if remote is down
+type roam struct {
+	rawsock.RawConn
+	local netip.AddrPort
+
+	mu     sync.Mutex
+	remote netip.AddrPort
+	down   map[netip.AddrPort]bool
+	reads  chan struct{}
+}
+
+func newRoam() *roam {
+	return &roam{
+		local: netip.MustParseAddrPort("10.0.0.1:19986"),
+		down:  map[netip.AddrPort]bool{},
+		reads: make(chan struct{}, 16),
+	}
+}
+
+func (r *roam) Read(pkt *packet.Packet) error {
+	if _, ok := <-r.reads; !ok {
+		return errors.New("closed")
+	}
+	return nil
+}
+func (r *roam) Write(pkt *packet.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down[r.remote] {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+func (r *roam) SetRemote(raddr netip.AddrPort) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remote = raddr
+	return nil
+}
+func (r *roam) RemoteAddr() netip.AddrPort {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remote
+}
+func (r *roam) LocalAddr() netip.AddrPort { return r.local }
+func (r *roam) Close() error              { return nil }
+
+var (
+	ep1 = netip.MustParseAddrPort("1.1.1.1:80")
+	ep2 = netip.MustParseAddrPort("2.2.2.2:80")
+)
+
+func resolver(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if host == "bad.example" || network != "ip4" {
+		return nil, errors.New("no such host")
+	}
+	return []netip.Addr{netip.MustParseAddr("3.3.3.3")}, nil
+}
+
+func Test_Failover_Write(t *testing.T) {
+	r := newRoam()
+	var switched []netip.AddrPort
+	c, err := failover.New(r, []string{ep1.String(), "bad.example:80", "good.example:443", ep2.String()},
+		failover.MaxFailures(2), failover.WithResolver(resolver, time.Second),
+		failover.OnSwitch(func(old, new netip.AddrPort) { switched = append(switched, new) }),
+	)
+	require.NoError(t, err)
+	require.Equal(t, ep1, c.RemoteAddr())
+
+	r.down[ep1] = true
+	require.Error(t, c.Write(packet.Make(0, 20)))
+	require.Equal(t, ep1, c.RemoteAddr())
+	require.Error(t, c.Write(packet.Make(0, 20)))
+
+	// skip unresolvable endpoint
+	require.Equal(t, netip.MustParseAddrPort("3.3.3.3:443"), c.RemoteAddr())
+	require.NoError(t, c.Write(packet.Make(0, 20)))
+
+	raddr, err := c.Switch()
+	require.NoError(t, err)
+	require.Equal(t, ep2, raddr)
+
+	// wrap around
+	raddr, err = c.Switch()
+	require.NoError(t, err)
+	require.Equal(t, ep1, raddr)
+	require.Equal(t, []netip.AddrPort{ep1, netip.MustParseAddrPort("3.3.3.3:443"), ep2, ep1}, switched)
+}
+
+func Test_Failover_Idle(t *testing.T) {
+	r := newRoam()
+	var switched = make(chan netip.AddrPort, 4)
+	c, err := failover.New(r, []string{ep1.String(), ep2.String()},
+		failover.Idle(time.Millisecond*100),
+		failover.OnSwitch(func(old, new netip.AddrPort) { switched <- new }),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, ep1, <-switched)
+
+	// recv packets keep remote
+	for i := 0; i < 4; i++ {
+		time.Sleep(time.Millisecond * 50)
+		r.reads <- struct{}{}
+		require.NoError(t, c.Read(packet.Make(0, 20)))
+	}
+	require.Empty(t, switched)
+
+	select {
+	case raddr := <-switched:
+		require.Equal(t, ep2, raddr)
+	case <-time.After(time.Second):
+		t.Fatal("not switched when idle")
+	}
+}
+
+func Test_Failover_AllFailed(t *testing.T) {
+	_, err := failover.New(newRoam(), []string{"bad.example:80", "invalid"},
+		failover.WithResolver(resolver, time.Second),
+	)
+	require.Error(t, err)
+
+	_, err = failover.New(newRoam(), nil)
+	require.Error(t, err)
+}
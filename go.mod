@@ -21,7 +21,6 @@ require (
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/mdlayher/ethernet v0.0.0-20220221185849-529eae5b6118 // indirect
 	github.com/mdlayher/socket v0.2.1 // indirect
-	golang.zx2c4.com/wireguard/windows v0.5.3 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
 
@@ -29,6 +28,7 @@ require (
 	github.com/lysShub/netkit v0.0.0-20240601172000-da71e39de8d5
 	github.com/lysShub/wintun-go v0.0.0-20240410130619-383598c11ea1
 	golang.org/x/sync v0.1.0
+	golang.zx2c4.com/wireguard/windows v0.5.3
 )
 
 require (
@@ -36,6 +36,6 @@ require (
 	github.com/google/btree v1.1.2 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/time v0.3.0 // indirect
+	golang.org/x/time v0.3.0
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,213 @@
+// Package aead per-packet AEAD encryption of RawConn, transport payload be
+// sealed as:
+//
+//	+------------------+-------+------------------------+
+//	| transport header | nonce | ciphertext(with tag)   |
+//	+------------------+-------+------------------------+
+//
+// transport header keep plaintext, only src/dst port be authenticated. peers
+// share the key, the highest bit of nonce is fixed by side, so the two
+// directions never use the same nonce, see Client.
+package aead
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/obfs"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type NonceStrategy uint8
+
+const (
+	// NonceCounter nonce is random salt with 8 bytes counter, the counter
+	// start with unix nano time, so replay window still valid after restart
+	NonceCounter NonceStrategy = iota
+	// NonceRandom nonce is random, not support replay window, should use with
+	// large nonce aead, such as XChaCha20-Poly1305
+	NonceRandom
+)
+
+type Config struct {
+	Nonce        NonceStrategy
+	ReplayWindow int  // 0 means disable, only valid for NonceCounter
+	Client       bool // side of conn, peers must be different side
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Nonce:        NonceCounter,
+		ReplayWindow: 1024,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Nonce set nonce strategy, default NonceCounter
+func Nonce(s NonceStrategy) Option {
+	return func(c *Config) {
+		c.Nonce = s
+	}
+}
+
+// ReplayWindow set replay window size, 0 disable, default 1024
+func ReplayWindow(size int) Option {
+	return func(c *Config) {
+		c.ReplayWindow = max(size, 0)
+	}
+}
+
+// Client set side of conn, default false, peers must be different side
+func Client(client bool) Option {
+	return func(c *Config) {
+		c.Client = client
+	}
+}
+
+// dirBit highest bit of nonce, set if sealed by client
+const dirBit = 0x80
+
+var (
+	ErrReplay = errors.New("replayed packet")
+	ErrAuth   = errors.New("message authentication failed")
+)
+
+// Crypter AEAD Obfuscator, Open return temporary error if packet is
+// invalid or replayed, caller should discard it.
+type Crypter struct {
+	aead  cipher.AEAD
+	proto tcpip.TransportProtocolNumber
+	cfg   *Config
+
+	dir     byte // dirBit of sealed packet
+	salt    []byte
+	counter atomic.Uint64
+	window  *window
+}
+
+var _ obfs.Obfuscator = (*Crypter)(nil)
+
+func New(aead cipher.AEAD, proto tcpip.TransportProtocolNumber, opts ...Option) (*Crypter, error) {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return nil, errors.Errorf("not support transport protocol %d", proto)
+	}
+
+	var c = &Crypter{aead: aead, proto: proto, cfg: Options(opts...)}
+	if c.cfg.Client {
+		c.dir = dirBit
+	}
+	if c.cfg.Nonce == NonceCounter {
+		if aead.NonceSize() < 8 {
+			return nil, errors.Errorf("nonce size %d too small", aead.NonceSize())
+		}
+		c.salt = make([]byte, aead.NonceSize()-8)
+		if _, err := rand.Read(c.salt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		c.counter.Store(uint64(time.Now().UnixNano()))
+		if c.cfg.ReplayWindow > 0 {
+			c.window = newWindow(c.cfg.ReplayWindow)
+		}
+	}
+	return c, nil
+}
+
+// Wrap encrypt RawConn, aead key should be shared by peers, and peers should
+// be different side, see Client
+func Wrap(child rawsock.RawConn, aead cipher.AEAD, proto tcpip.TransportProtocolNumber, opts ...Option) (*obfs.Conn, error) {
+	c, err := New(aead, proto, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return obfs.Wrap(child, proto, c), nil
+}
+
+// Overhead packet size increased by Seal
+func (c *Crypter) Overhead() int { return c.aead.NonceSize() + c.aead.Overhead() }
+
+func (c *Crypter) Seal(pkt *packet.Packet) error {
+	n, err := c.hdrLen(pkt.Bytes())
+	if err != nil {
+		return err
+	}
+	var (
+		ns   = c.aead.NonceSize()
+		size = pkt.Data() - n
+	)
+
+	b := pkt.AppendN(c.Overhead()).Bytes()
+	copy(b[n+ns:], b[n:n+size])
+
+	nonce := b[n : n+ns]
+	if c.cfg.Nonce == NonceCounter {
+		copy(nonce, c.salt)
+		binary.BigEndian.PutUint64(nonce[len(c.salt):], c.counter.Add(1))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return errors.WithStack(err)
+	}
+	// counter start with unix nano, highest bit is free if without salt
+	nonce[0] = nonce[0]&^dirBit | c.dir
+
+	plain := b[n+ns : n+ns+size]
+	c.aead.Seal(plain[:0], nonce, plain, b[:4])
+	return nil
+}
+
+func (c *Crypter) Open(pkt *packet.Packet) error {
+	b := pkt.Bytes()
+	n, err := c.hdrLen(b)
+	if err != nil {
+		return err
+	}
+	ns := c.aead.NonceSize()
+	if len(b) < n+c.Overhead() {
+		return errorx.WrapTemp(errors.Errorf("invalid sealed packet, bytes %d", len(b)))
+	}
+
+	nonce, sealed := b[n:n+ns], b[n+ns:]
+	if nonce[0]&dirBit == c.dir {
+		// reflected packet sealed by same side
+		return errorx.WrapTemp(errors.WithStack(ErrAuth))
+	}
+	plain, err := c.aead.Open(sealed[:0], nonce, sealed, b[:4])
+	if err != nil {
+		return errorx.WrapTemp(errors.WithStack(ErrAuth))
+	}
+	if c.window != nil && !c.window.check(binary.BigEndian.Uint64(nonce[ns-8:])&^(dirBit<<56)) {
+		return errorx.WrapTemp(errors.WithStack(ErrReplay))
+	}
+
+	copy(b[n:], plain)
+	pkt.SetData(n + len(plain))
+	return nil
+}
+
+func (c *Crypter) hdrLen(b []byte) (int, error) {
+	switch c.proto {
+	case header.TCPProtocolNumber:
+		if len(b) < header.TCPMinimumSize || len(b) < int(header.TCP(b).DataOffset()) {
+			return 0, errorx.WrapTemp(errors.Errorf("invalid tcp packet, bytes %d", len(b)))
+		}
+		return int(header.TCP(b).DataOffset()), nil
+	default:
+		if len(b) < header.UDPMinimumSize {
+			return 0, errorx.WrapTemp(errors.Errorf("invalid udp packet, bytes %d", len(b)))
+		}
+		return header.UDPMinimumSize, nil
+	}
+}
@@ -0,0 +1,106 @@
+package aead_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/aead"
+	"github.com/lysShub/rawsock/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func newGCM(t *testing.T) cipher.AEAD {
+	block, err := aes.NewCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	return gcm
+}
+
+func Test_Conn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	client, err := aead.Wrap(c, newGCM(t), header.UDPProtocolNumber, aead.Client(true))
+	require.NoError(t, err)
+	server, err := aead.Wrap(s, newGCM(t), header.UDPProtocolNumber)
+	require.NoError(t, err)
+
+	for i := 0; i < 8; i++ {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		require.NoError(t, client.Write(packet.Make(64).Append(udp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, server.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.UDPProtocolNumber, pkt.Bytes()))
+		require.Equal(t, []byte(udp.Payload()), []byte(header.UDP(pkt.Bytes()).Payload()))
+	}
+}
+
+func Test_Crypter(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	sender, err := aead.New(newGCM(t), header.UDPProtocolNumber, aead.Client(true))
+	require.NoError(t, err)
+	recver, err := aead.New(newGCM(t), header.UDPProtocolNumber, aead.ReplayWindow(64))
+	require.NoError(t, err)
+
+	udp := test.StripIP(test.RandUDP(t, caddr, saddr))
+	sealed := packet.Make(0).Append(udp...)
+	require.NoError(t, sender.Seal(sealed))
+	require.Equal(t, len(udp)+sender.Overhead(), sealed.Data())
+
+	t.Run("replay", func(t *testing.T) {
+		p := sealed.Clone()
+		require.NoError(t, recver.Open(p))
+		require.Equal(t, udp, p.Bytes())
+
+		err := recver.Open(sealed.Clone())
+		require.True(t, errors.Is(err, aead.ErrReplay))
+		require.True(t, errorx.Temporary(err))
+	})
+
+	t.Run("tamper", func(t *testing.T) {
+		p := sealed.Clone()
+		p.Bytes()[p.Data()-1] ^= 1
+		require.True(t, errors.Is(recver.Open(p), aead.ErrAuth))
+
+		p = sealed.Clone()
+		header.UDP(p.Bytes()).SetSourcePort(header.UDP(udp).SourcePort() + 1)
+		require.True(t, errors.Is(recver.Open(p), aead.ErrAuth))
+	})
+
+	t.Run("reflect", func(t *testing.T) {
+		p := packet.Make(0).Append(udp...)
+		require.NoError(t, recver.Seal(p))
+		require.True(t, errors.Is(recver.Open(p), aead.ErrAuth))
+
+		// client side not accept client packet
+		p = sealed.Clone()
+		require.True(t, errors.Is(sender.Open(p), aead.ErrAuth))
+	})
+
+	t.Run("window", func(t *testing.T) {
+		var old []*packet.Packet
+		for i := 0; i < 65; i++ {
+			p := packet.Make(0).Append(udp...)
+			require.NoError(t, sender.Seal(p))
+			old = append(old, p)
+		}
+		// out of order in window is accepted
+		require.NoError(t, recver.Open(old[64]))
+		require.NoError(t, recver.Open(old[63]))
+		// too old
+		require.True(t, errors.Is(recver.Open(old[0]), aead.ErrReplay))
+	})
+}
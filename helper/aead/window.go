@@ -0,0 +1,39 @@
+package aead
+
+import "sync"
+
+// window sliding replay window, refer RFC 6479
+type window struct {
+	mu   sync.Mutex
+	max  uint64
+	bits []uint64
+}
+
+func newWindow(size int) *window {
+	return &window{bits: make([]uint64, (size+63)/64)}
+}
+
+// check return false if seq is replayed or too old
+func (w *window) check(seq uint64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := uint64(len(w.bits) * 64)
+	if seq > w.max {
+		if seq-w.max >= n {
+			clear(w.bits)
+		} else {
+			for i := w.max + 1; i < seq; i++ {
+				w.bits[(i%n)/64] &^= 1 << (i % 64)
+			}
+		}
+		w.max = seq
+	} else if w.max-seq >= n {
+		return false
+	} else if w.bits[(seq%n)/64]&(1<<(seq%64)) != 0 {
+		return false
+	}
+
+	w.bits[(seq%n)/64] |= 1 << (seq % 64)
+	return true
+}
@@ -0,0 +1,134 @@
+//go:build linux
+// +build linux
+
+// Package arpd answer ARP requests for addresses not configured on host,
+// let rawsock own virtual ip on the LAN.
+package arpd
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/mdlayher/arp"
+	"github.com/pkg/errors"
+)
+
+// Responder reply ARP request of the addresses with interface hardware address
+type Responder struct {
+	ifi    *net.Interface
+	client *arp.Client
+
+	mu       sync.RWMutex
+	prefixes []netip.Prefix
+
+	closeErr errorx.CloseErr
+}
+
+// New start ARP responder on ifi for prefixes, and announce single ip prefix
+// by gratuitous ARP
+func New(ifi *net.Interface, prefixes ...netip.Prefix) (*Responder, error) {
+	client, err := arp.Dial(ifi)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r = &Responder{ifi: ifi, client: client}
+
+	for _, p := range prefixes {
+		if err := r.Add(p); err != nil {
+			return nil, r.close(err)
+		}
+	}
+	go r.serve()
+	return r, nil
+}
+
+// Add answer ARP for addresses in prefix
+func (r *Responder) Add(prefix netip.Prefix) error {
+	if !prefix.Addr().Is4() {
+		return errors.Errorf("ARP not support %s", prefix.String())
+	}
+	prefix = prefix.Masked()
+
+	r.mu.Lock()
+	r.prefixes = append(r.prefixes, prefix)
+	r.mu.Unlock()
+
+	if prefix.IsSingleIP() {
+		return r.announce(prefix.Addr())
+	}
+	return nil
+}
+
+// Remove stop answer ARP for prefix
+func (r *Responder) Remove(prefix netip.Prefix) {
+	prefix = prefix.Masked()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.prefixes {
+		if p == prefix {
+			r.prefixes = append(r.prefixes[:i], r.prefixes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Contains the addr is answered
+func (r *Responder) Contains(addr netip.Addr) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// announce gratuitous ARP, update neighbors' cache
+func (r *Responder) announce(addr netip.Addr) error {
+	pkt, err := arp.NewPacket(
+		arp.OperationReply,
+		r.ifi.HardwareAddr, addr,
+		ethernetBroadcast, addr,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(r.client.WriteTo(pkt, ethernetBroadcast))
+}
+
+var ethernetBroadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+func (r *Responder) serve() error {
+	for {
+		pkt, _, err := r.client.Read()
+		if err != nil {
+			if r.closeErr.Closed() || errors.Is(err, net.ErrClosed) {
+				return r.close(nil)
+			} else if e := (*net.OpError)(nil); errors.As(err, &e) {
+				return r.close(errors.WithStack(err))
+			}
+			continue // malformed packet
+		}
+		if pkt.Operation != arp.OperationRequest || !r.Contains(pkt.TargetIP) {
+			continue
+		}
+
+		if err := r.client.Reply(pkt, r.ifi.HardwareAddr, pkt.TargetIP); err != nil {
+			return r.close(errors.WithStack(err))
+		}
+	}
+}
+
+func (r *Responder) close(cause error) error {
+	return r.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		errs = append(errs, errors.WithStack(r.client.Close()))
+		return errs
+	})
+}
+
+func (r *Responder) Close() error { return r.close(nil) }
@@ -0,0 +1,32 @@
+//go:build linux
+// +build linux
+
+package arpd_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/arpd"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Responder(t *testing.T) {
+	ifi, err := net.InterfaceByName("eth0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	r, err := arpd.New(ifi, netip.MustParsePrefix("10.99.0.1/24"))
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.True(t, r.Contains(netip.MustParseAddr("10.99.0.9")))
+	require.False(t, r.Contains(netip.MustParseAddr("10.98.0.9")))
+
+	r.Remove(netip.MustParsePrefix("10.99.0.0/24"))
+	require.False(t, r.Contains(netip.MustParseAddr("10.99.0.9")))
+
+	require.Error(t, r.Add(netip.MustParsePrefix("fd00::/64")))
+}
@@ -0,0 +1,468 @@
+// Package arq lightweight reliability over udp RawConn, messages are sequenced,
+// cumulative acked, and retransmitted by RTO estimated as RFC 6298. every Write
+// is delivered exactly once and in order by peer's Read, no handshake, both
+// peers start from sequence 0.
+//
+//	+---------+--------+--------+-----------+
+//	| type(1) | seq(4) | ack(4) |  payload  |
+//	+---------+--------+--------+-----------+
+package arq
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	Window     int // max unacked messages
+	MinRTO     time.Duration
+	MaxRTO     time.Duration
+	MaxRetries int // retransmit times of a message before conn fail
+	MTU        int // ip packet size limit
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Window:     128,
+		MinRTO:     time.Millisecond * 200,
+		MaxRTO:     time.Second * 10,
+		MaxRetries: 8,
+		MTU:        1500,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Window max unacked messages, default 128, Write block when exceed
+func Window(n int) Option {
+	return func(c *Config) {
+		c.Window = max(n, 1)
+	}
+}
+
+// RTO set min and max retransmission timeout, default 200ms and 10s
+func RTO(min, max time.Duration) Option {
+	return func(c *Config) {
+		c.MinRTO, c.MaxRTO = min, max
+	}
+}
+
+// MaxRetries retransmit times of a message, default 8, conn fail with
+// ErrTimeout when exceed
+func MaxRetries(n int) Option {
+	return func(c *Config) {
+		c.MaxRetries = max(n, 0)
+	}
+}
+
+// MTU ip packet size limit, default 1500, Write message larger than
+// MaxPayload return error
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+const (
+	typeData = 0
+	typeAck  = 1
+
+	hdrSize = 9
+)
+
+var ErrTimeout = errors.New("arq message retransmit timeout")
+
+type Stats struct {
+	Sent          uint64 // messages sent
+	Retransmitted uint64 // segments retransmitted
+	Recved        uint64 // messages delivered to Read
+	Duplicated    uint64 // segments recved duplicated
+	SRTT          time.Duration
+	RTO           time.Duration
+}
+
+// Conn reliable message conn over udp RawConn, concurrent safe
+type Conn struct {
+	raw  rawsock.RawConn
+	cfg  *Config
+	psum uint16 // outbound pseudo header checksum without length
+
+	mu             sync.Mutex
+	cond           *sync.Cond // wait window
+	sndUna, sndNxt uint32
+	unacked        map[uint32]*segment
+	srtt, rttvar   time.Duration
+	rto            time.Duration
+	rcvNxt         uint32
+	ooo            map[uint32][]byte // out-of-order recved
+	err            error             // valid after done closed
+
+	rmu     sync.Mutex
+	pending []byte // recved message not read by short buffer
+	recvq   chan []byte
+	kick    chan struct{}
+
+	sent, retransmitted, recved, duplicated atomic.Uint64
+
+	done     chan struct{}
+	closeErr errorx.CloseErr
+}
+
+type segment struct {
+	data     []byte
+	sent     time.Time
+	deadline time.Time
+	retries  int
+}
+
+var _ interface {
+	Read([]byte) (int, error)
+	Write([]byte) (int, error)
+	Close() error
+} = (*Conn)(nil)
+
+// New wrap udp RawConn, the Conn own raw
+func New(raw rawsock.RawConn, opts ...Option) *Conn {
+	var c = &Conn{
+		raw: raw,
+		cfg: Options(opts...),
+		psum: header.PseudoHeaderChecksum(
+			header.UDPProtocolNumber,
+			tcpip.AddrFromSlice(raw.LocalAddr().Addr().AsSlice()),
+			tcpip.AddrFromSlice(raw.RemoteAddr().Addr().AsSlice()),
+			0,
+		),
+		unacked: map[uint32]*segment{},
+		ooo:     map[uint32][]byte{},
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.rto = max(c.cfg.MinRTO, min(time.Second, c.cfg.MaxRTO))
+	c.recvq = make(chan []byte, c.cfg.Window*2)
+
+	go c.recvService()
+	go c.retransService()
+	return c
+}
+
+// MaxPayload max message size
+func (c *Conn) MaxPayload() int {
+	n := c.cfg.MTU - header.UDPMinimumSize - hdrSize - header.IPv4MinimumSize
+	if c.raw.LocalAddr().Addr().Is6() {
+		n = c.cfg.MTU - header.UDPMinimumSize - hdrSize - header.IPv6MinimumSize
+	}
+	return n
+}
+
+// Write send a message, block when window full
+func (c *Conn) Write(b []byte) (int, error) {
+	if len(b) > c.MaxPayload() {
+		return 0, errors.Errorf("message size %d exceed %d", len(b), c.MaxPayload())
+	}
+
+	c.mu.Lock()
+	for int(c.sndNxt-c.sndUna) >= c.cfg.Window && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.err != nil {
+		c.mu.Unlock()
+		return 0, c.err
+	}
+	now := time.Now()
+	seq, ack := c.sndNxt, c.rcvNxt
+	c.unacked[seq] = &segment{
+		data:     append([]byte(nil), b...),
+		sent:     now,
+		deadline: now.Add(c.rto),
+	}
+	c.sndNxt++
+	c.mu.Unlock()
+
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+	c.sent.Add(1)
+	if err := c.send(typeData, seq, ack, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *Conn) send(typ uint8, seq, ack uint32, payload []byte) error {
+	n := header.UDPMinimumSize + hdrSize + len(payload)
+	pkt := packet.Make(64, 0, n)
+
+	udp := header.UDP(pkt.AppendN(n).Bytes())
+	udp.Encode(&header.UDPFields{
+		SrcPort: c.raw.LocalAddr().Port(),
+		DstPort: c.raw.RemoteAddr().Port(),
+		Length:  uint16(n),
+	})
+	hdr := udp.Payload()
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], seq)
+	binary.BigEndian.PutUint32(hdr[5:], ack)
+	copy(hdr[hdrSize:], payload)
+	udp.SetChecksum(^checksum.Checksum(udp, checksum.Combine(c.psum, uint16(n))))
+
+	if err := c.raw.Write(pkt); err != nil {
+		if errorx.Temporary(err) {
+			return nil // recovered by retransmit
+		}
+		return c.fail(err)
+	}
+	return nil
+}
+
+func (c *Conn) recvService() {
+	for {
+		var pkt = packet.Make(0, c.cfg.MTU)
+		if err := c.raw.Read(pkt); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			c.fail(err)
+			return
+		}
+		if pkt.Data() < header.UDPMinimumSize+hdrSize {
+			continue
+		}
+		b := header.UDP(pkt.Bytes()).Payload()
+		typ, seq, ack := b[0], binary.BigEndian.Uint32(b[1:]), binary.BigEndian.Uint32(b[5:])
+
+		c.mu.Lock()
+		c.handleAck(ack)
+		if typ != typeData {
+			c.mu.Unlock()
+			continue
+		}
+
+		if d := int32(seq - c.rcvNxt); d < 0 || d >= int32(c.cfg.Window) {
+			c.duplicated.Add(1)
+		} else if _, has := c.ooo[seq]; has {
+			c.duplicated.Add(1)
+		} else {
+			c.ooo[seq] = append([]byte(nil), b[hdrSize:]...)
+			c.deliver()
+		}
+		sndNxt, rcvNxt := c.sndNxt, c.rcvNxt
+		c.mu.Unlock()
+
+		if err := c.send(typeAck, sndNxt, rcvNxt, nil); err != nil {
+			return
+		}
+	}
+}
+
+// deliver move in-order messages to recvq, not block recvService when Read
+// slow, the undelivered message is not acked, so peer will retransmit and
+// Write block by window. require hold mu.
+func (c *Conn) deliver() (n int) {
+	for {
+		msg, has := c.ooo[c.rcvNxt]
+		if !has {
+			return n
+		}
+		select {
+		case c.recvq <- msg:
+			delete(c.ooo, c.rcvNxt)
+			c.rcvNxt++
+			c.recved.Add(1)
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+// handleAck release acked segments, require hold mu
+func (c *Conn) handleAck(ack uint32) {
+	if d := int32(ack - c.sndUna); d <= 0 || ack-c.sndUna > c.sndNxt-c.sndUna {
+		return
+	}
+	for ; c.sndUna != ack; c.sndUna++ {
+		seg := c.unacked[c.sndUna]
+		delete(c.unacked, c.sndUna)
+		if seg != nil && seg.retries == 0 {
+			c.sample(time.Since(seg.sent)) // Karn's algorithm
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// sample update rto by rtt sample, require hold mu
+func (c *Conn) sample(rtt time.Duration) {
+	if c.srtt == 0 {
+		c.srtt, c.rttvar = rtt, rtt/2
+	} else {
+		diff := c.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		c.rttvar = (c.rttvar*3 + diff) / 4
+		c.srtt = (c.srtt*7 + rtt) / 8
+	}
+	c.rto = min(max(c.srtt+4*c.rttvar, c.cfg.MinRTO), c.cfg.MaxRTO)
+}
+
+func (c *Conn) retransService() {
+	var timer = time.NewTimer(c.cfg.MaxRTO)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.kick:
+		case <-c.done:
+			return
+		}
+
+		type resend struct {
+			seq  uint32
+			data []byte
+		}
+		var (
+			now     = time.Now()
+			next    = now.Add(c.cfg.MaxRTO)
+			segs    []resend
+			expired []*segment
+			ack     uint32
+			timed   bool
+		)
+		c.mu.Lock()
+		for seq := c.sndUna; seq != c.sndNxt; seq++ {
+			seg := c.unacked[seq]
+			if !seg.deadline.After(now) {
+				if seg.retries >= c.cfg.MaxRetries {
+					timed = true
+					break
+				}
+				seg.retries++
+				expired = append(expired, seg)
+				segs = append(segs, resend{seq, seg.data})
+			} else if seg.deadline.Before(next) {
+				next = seg.deadline
+			}
+		}
+		if len(expired) > 0 {
+			// backoff once per timeout, not per segment, RFC 6298 5.5
+			c.rto = min(c.rto*2, c.cfg.MaxRTO)
+			for _, seg := range expired {
+				seg.deadline = now.Add(c.rto)
+			}
+			if d := now.Add(c.rto); d.Before(next) {
+				next = d
+			}
+		}
+		ack = c.rcvNxt
+		c.mu.Unlock()
+		if timed {
+			c.fail(errors.WithStack(ErrTimeout))
+			return
+		}
+
+		for _, s := range segs {
+			c.retransmitted.Add(1)
+			if err := c.send(typeData, s.seq, ack, s.data); err != nil {
+				return
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// Read read a message, return io.ErrShortBuffer if b too small, and the
+// message is kept for next Read
+func (c *Conn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if c.pending == nil {
+		select {
+		case c.pending = <-c.recvq:
+		case <-c.done:
+			select {
+			case c.pending = <-c.recvq:
+			default:
+				return 0, c.err
+			}
+		}
+	}
+	c.mu.Lock()
+	n := c.deliver() // recvq has space now
+	sndNxt, rcvNxt := c.sndNxt, c.rcvNxt
+	c.mu.Unlock()
+	if n > 0 {
+		c.send(typeAck, sndNxt, rcvNxt, nil)
+	}
+
+	if len(b) < len(c.pending) {
+		return 0, errorx.ShortBuff(len(c.pending), len(b))
+	}
+	n = copy(b, c.pending)
+	c.pending = nil
+	return n, nil
+}
+
+// fail close conn by cause, return cause
+func (c *Conn) fail(cause error) error {
+	c.close(cause)
+	return cause
+}
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		if cause == nil {
+			cause = errors.WithStack(net.ErrClosed)
+		}
+
+		c.mu.Lock()
+		c.err = cause
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		close(c.done)
+		return append(errs, c.raw.Close())
+	})
+}
+
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Sent:          c.sent.Load(),
+		Retransmitted: c.retransmitted.Load(),
+		Recved:        c.recved.Load(),
+		Duplicated:    c.duplicated.Load(),
+		SRTT:          c.srtt,
+		RTO:           c.rto,
+	}
+}
+
+func (c *Conn) LocalAddr() net.Addr  { return net.UDPAddrFromAddrPort(c.raw.LocalAddr()) }
+func (c *Conn) RemoteAddr() net.Addr { return net.UDPAddrFromAddrPort(c.raw.RemoteAddr()) }
+
+// Close close conn, the unacked messages are discarded
+func (c *Conn) Close() error { return c.close(nil) }
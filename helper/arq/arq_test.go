@@ -0,0 +1,108 @@
+package arq_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/arq"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_ARQ(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr,
+		test.PacketLoss(0.2), test.ValidChecksum,
+	)
+	opts := []arq.Option{arq.RTO(time.Millisecond*5, time.Millisecond*50), arq.Window(16), arq.MaxRetries(32)}
+	client, server := arq.New(c, opts...), arq.New(s, opts...)
+	defer client.Close()
+	defer server.Close()
+
+	const n = 256
+	go func() {
+		for i := 0; i < n; i++ {
+			_, err := client.Write([]byte(fmt.Sprintf("message %d", i)))
+			require.NoError(t, err)
+		}
+	}()
+	go func() {
+		// echo
+		var b = make([]byte, 1500)
+		for {
+			n, err := server.Read(b)
+			if err != nil {
+				return
+			}
+			if _, err = server.Write(b[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	var b = make([]byte, 1500)
+	for i := 0; i < n; i++ {
+		n, err := client.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("message %d", i), string(b[:n]))
+	}
+
+	st := client.Stats()
+	require.Equal(t, uint64(n), st.Sent)
+	require.Equal(t, uint64(n), st.Recved)
+	require.NotZero(t, st.Retransmitted)
+	require.NotZero(t, st.SRTT)
+
+	// short buffer keep the message
+	_, err := client.Write([]byte("short"))
+	require.NoError(t, err)
+	_, err = client.Read(b[:1])
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+	m, err := client.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "short", string(b[:m]))
+}
+
+func Test_ARQ_Timeout(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	s.Close()
+	client := arq.New(c, arq.RTO(time.Millisecond, time.Millisecond*4), arq.MaxRetries(2))
+
+	_, err := client.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = client.Read(make([]byte, 16))
+	require.ErrorIs(t, err, arq.ErrTimeout)
+	_, err = client.Write([]byte("hello"))
+	require.ErrorIs(t, err, arq.ErrTimeout)
+
+	require.Error(t, client.Close())
+}
+
+func Test_ARQ_Close(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, _ := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	client := arq.New(c)
+
+	var errs = make(chan error)
+	go func() {
+		_, err := client.Read(make([]byte, 16))
+		errs <- err
+	}()
+	require.NoError(t, client.Close())
+	require.ErrorIs(t, <-errs, net.ErrClosed)
+}
@@ -4,14 +4,21 @@
 package bind
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
+	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/lysShub/netkit/route"
 	netcall "github.com/lysShub/netkit/syscall"
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/rtnl"
 	"github.com/pkg/errors"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -23,7 +30,7 @@ import (
 // ListenTCPLocal occupy local tcp port, 1. alloc useable port for default-port, 2. avoid other process
 // use this port, 3. system tcp stack don't send RST automatically for this port request
 func ListenTCPLocal(laddr netip.AddrPort, usedPort bool) (*net.TCPListener, netip.AddrPort, error) {
-	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: laddr.Addr().AsSlice(), Port: int(laddr.Port())})
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: laddr.Addr().AsSlice(), Port: int(laddr.Port()), Zone: laddr.Addr().Zone()})
 	if err != nil {
 		if usedPort {
 			if errors.Is(err, unix.EADDRINUSE) {
@@ -85,7 +92,11 @@ func BindLocal(proto tcpip.TransportProtocolNumber, laddr netip.AddrPort, usedPo
 	if laddr.Addr().Is4() {
 		sa = &unix.SockaddrInet4{Addr: laddr.Addr().As4(), Port: int(laddr.Port())}
 	} else {
-		sa = &unix.SockaddrInet6{Addr: laddr.Addr().As16(), Port: int(laddr.Port())}
+		zone, err := ip6.ZoneIndex(laddr.Addr().Zone())
+		if err != nil {
+			return 0, netip.AddrPort{}, err
+		}
+		sa = &unix.SockaddrInet6{Addr: laddr.Addr().As16(), Port: int(laddr.Port()), ZoneId: uint32(zone)}
 		af = unix.AF_INET6
 	}
 	switch proto {
@@ -136,15 +147,29 @@ func BindLocal(proto tcpip.TransportProtocolNumber, laddr netip.AddrPort, usedPo
 // todo: 不需要这个cache, server直接在listen时就设置，accpet到conn时init传个flag
 var ethOffloadCache = struct {
 	sync.RWMutex
-	GRO map[netip.Addr]bool
+	GRO   map[netip.Addr]bool
+	watch sync.Once // invalidate when route/address/link changed
 }{
 	GRO: map[netip.Addr]bool{},
 }
 
 // todo: 还有 generic-segmentation-offload, large-receive-offload
 func SetGRO(local, remote netip.Addr, gro bool) error {
-	// get route table is expensive call, cache it.
-	if !remote.IsPrivate() {
+	// get route table is expensive call, cache it. global route cache watch
+	// the process's netns, not cache inside other netns
+	switched := netns.Switched()
+	if !switched {
+		ethOffloadCache.watch.Do(func() {
+			if c, err := rtnl.Default(); err == nil {
+				c.Subscribe(func(route.Table) {
+					ethOffloadCache.Lock()
+					clear(ethOffloadCache.GRO)
+					ethOffloadCache.Unlock()
+				})
+			}
+		})
+	}
+	if !remote.IsPrivate() && !switched {
 		ethOffloadCache.RLock()
 		old, has := ethOffloadCache.GRO[local]
 		ethOffloadCache.RUnlock()
@@ -160,7 +185,7 @@ func SetGRO(local, remote netip.Addr, gro bool) error {
 		}
 	}
 
-	table, err := route.GetTable()
+	table, err := rtnl.Table()
 	if err != nil {
 		return err
 	}
@@ -203,3 +228,139 @@ func SetGRO(local, remote netip.Addr, gro bool) error {
 
 	return nil
 }
+
+// SetBusyPoll set socket busy poll timeout, and prefer busy poll with budget
+// if budget not 0
+func SetBusyPoll(raw syscall.RawConn, timeout time.Duration, budget int) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BUSY_POLL, int(timeout.Microseconds()))
+		if e == nil && budget > 0 {
+			e = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PREFER_BUSY_POLL, 1)
+			if e == nil {
+				e = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BUSY_POLL_BUDGET, budget)
+			}
+		}
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// SetPriority set SO_PRIORITY of socket, used as skb priority of outbound
+// packets, vlan device map it to PCP by egress-qos-map
+func SetPriority(raw syscall.RawConn, prio int) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PRIORITY, prio)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// SetEgressQoS map skb priority prio to 802.1p pcp of vlan device, return
+// error if ifname is not vlan device
+func SetEgressQoS(ifname string, prio, pcp int) error {
+	if _, err := os.Stat("/proc/net/vlan/" + ifname); err != nil {
+		return errors.Errorf("%s is not vlan device", ifname)
+	}
+
+	cmd := exec.Command("ip", "link", "set", "dev", ifname, "type", "vlan",
+		"egress-qos-map", fmt.Sprintf("%d:%d", prio, pcp),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil || len(out) > 0 {
+		return errors.Errorf(`exec "%s", error: %s, message: %s`, cmd.String(), err, string(out))
+	}
+	return nil
+}
+
+// Reconnect re-connect raw ip socket to new remote address
+func Reconnect(raw syscall.RawConn, raddr netip.Addr) error {
+	var sa unix.Sockaddr
+	if raddr.Is4() {
+		sa = &unix.SockaddrInet4{Addr: raddr.As4()}
+	} else {
+		zone, err := ip6.ZoneIndex(raddr.Zone())
+		if err != nil {
+			return err
+		}
+		sa = &unix.SockaddrInet6{Addr: raddr.As16(), ZoneId: uint32(zone)}
+	}
+
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.Connect(int(fd), sa)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// DisablePMTUDisc not set DF flag, let kernel fragment oversize ipv4 packet, instead
+// of return EMSGSIZE
+func DisablePMTUDisc(raw syscall.RawConn) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DONT)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// SetHdrIncl set IP_HDRINCL/IPV6_HDRINCL, packet written to raw socket
+// include ip header
+func SetHdrIncl(raw syscall.RawConn, ipv4 bool) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		if ipv4 {
+			e = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_HDRINCL, 1)
+		} else {
+			e = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_HDRINCL, 1)
+		}
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// EnablePMTUDisc set DF flag, kernel return EMSGSIZE for ipv4 packet exceed
+// path mtu, which learned from ICMP fragmentation needed message, see PathMTU
+func EnablePMTUDisc(raw syscall.RawConn) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// PathMTU kernel cached path mtu of connected socket
+func PathMTU(raw syscall.RawConn, ipv4 bool) (mtu int, err error) {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		if ipv4 {
+			mtu, e = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU)
+		} else {
+			mtu, e = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU)
+		}
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return mtu, errors.WithStack(e)
+}
+
+// IgnoreOutgoing AF_PACKET socket not recv frames sent by host itself, return
+// ENOPROTOOPT if kernel not support, see bpf.WithInbound
+func IgnoreOutgoing(raw syscall.RawConn) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.SOL_PACKET, unix.PACKET_IGNORE_OUTGOING, 1)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
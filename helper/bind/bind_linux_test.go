@@ -7,14 +7,19 @@ import (
 	"context"
 	"net"
 	"net/netip"
+	"os/exec"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/nft"
 
 	"github.com/lysShub/rawsock/test"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func Test_ListenLocal(t *testing.T) {
@@ -103,3 +108,78 @@ func Test_SetGRO(t *testing.T) {
 func Test_SetGRO_Cache(t *testing.T) {
 	t.Skip("todo")
 }
+
+func Test_SetBusyPoll(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+
+	err = bind.SetBusyPoll(raw, time.Microsecond*50, 8)
+	require.NoError(t, err)
+
+	var timeout int
+	err = raw.Control(func(fd uintptr) {
+		timeout, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BUSY_POLL)
+		require.NoError(t, err)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 50, timeout)
+}
+
+func Test_DropRST(t *testing.T) {
+	if _, err := exec.LookPath("nft"); err != nil {
+		t.Skip("nft not found")
+	}
+
+	laddr := netip.AddrPortFrom(test.LocIP(), 0)
+	raddr := netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	rule, laddr, err := bind.DropRST("", laddr, raddr)
+	require.NoError(t, err)
+	require.NotZero(t, laddr.Port())
+
+	out, err := exec.Command("nft", "list", "table", "inet", nft.Table).CombinedOutput()
+	require.NoError(t, err)
+	require.Contains(t, string(out), strconv.Itoa(int(laddr.Port())))
+	require.NoError(t, rule.Remove())
+
+	t.Run("netns", func(t *testing.T) {
+		vt := test.CreateVethTuple(t)
+		defer vt.Close()
+
+		laddr := netip.AddrPortFrom(vt.Addr1, test.RandPort())
+		rule, _, err := bind.DropRST(netns.Path(vt.NS1), laddr, netip.AddrPort{})
+		require.NoError(t, err)
+
+		list := func() string {
+			out, _ := exec.Command("ip", "netns", "exec", vt.NS1, "nft", "list", "table", "inet", nft.Table).CombinedOutput()
+			return string(out)
+		}
+		require.Contains(t, list(), strconv.Itoa(int(laddr.Port())))
+
+		// removed inside the netns it was added
+		require.NoError(t, rule.Remove())
+		require.NotContains(t, list(), strconv.Itoa(int(laddr.Port())))
+	})
+}
+
+func Test_SetPriority(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+
+	require.NoError(t, bind.SetPriority(raw, 5))
+
+	var prio int
+	err = raw.Control(func(fd uintptr) {
+		prio, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PRIORITY)
+		require.NoError(t, err)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5, prio)
+
+	require.Error(t, bind.SetEgressQoS("lo", 5, 5), "not vlan device")
+}
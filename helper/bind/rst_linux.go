@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package bind
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/nft"
+	"github.com/pkg/errors"
+)
+
+// RSTRule nftables rule that drop outbound tcp RST, alternative of ListenTCPLocal
+// when binding the port conflicts with an existing service
+type RSTRule struct {
+	netns string // network namespace path the rule belong to
+	rule  *nft.Rule
+}
+
+var (
+	rulesMu sync.Mutex
+	rules   = map[string]*nft.Rules{} // netns path : rules
+)
+
+// nftRules rules of current process in netns, created at first use, stale rules
+// of crashed processes are garbage collected then. must call inside netns
+func nftRules(ns string) (*nft.Rules, error) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	if rules[ns] == nil {
+		r, err := nft.New()
+		if err != nil {
+			return nil, err
+		}
+		nft.GC()
+		rules[ns] = r
+	}
+	return rules[ns], nil
+}
+
+// DropRST add nftables rule drop outbound RST from laddr to raddr in network
+// namespace ns, empty ns means namespace of the process, invalid raddr means any
+// remote address. if laddr port is 0, alloc a useable port. the rule is tagged
+// with owner process, see nft.GC
+func DropRST(ns string, laddr, raddr netip.AddrPort) (r *RSTRule, addr netip.AddrPort, err error) {
+	err = netns.Do(ns, func() error {
+		r, addr, err = dropRST(ns, laddr, raddr)
+		return err
+	})
+	return r, addr, err
+}
+
+func dropRST(ns string, laddr, raddr netip.AddrPort) (*RSTRule, netip.AddrPort, error) {
+	if laddr.Port() == 0 {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: laddr.Addr().AsSlice(), Zone: laddr.Addr().Zone()})
+		if err != nil {
+			return nil, netip.AddrPort{}, errors.WithStack(err)
+		}
+		port := netip.MustParseAddrPort(l.Addr().String()).Port()
+		if err = l.Close(); err != nil {
+			return nil, netip.AddrPort{}, errors.WithStack(err)
+		}
+		laddr = netip.AddrPortFrom(laddr.Addr(), port)
+	}
+
+	rs, err := nftRules(ns)
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+	rule, err := rs.DropRST(laddr, raddr)
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+	return &RSTRule{netns: ns, rule: rule}, laddr, nil
+}
+
+// Remove delete the nftables rule, inside the network namespace it was added
+func (r *RSTRule) Remove() error {
+	if r == nil {
+		return nil
+	}
+	return netns.Do(r.netns, r.rule.Remove)
+}
@@ -11,26 +11,10 @@ import (
 
 // todo: general bpf
 
+// FilterDstPortAndTCPSyn accept tcp packet sent to port with SYN flag, see
+// FilterDstPortAndTCPFlags
 func FilterDstPortAndTCPSyn(port uint16) []bpf.Instruction {
-	var ins = iphdrLen()
-
-	const syn = uint32(header.TCPFlagSyn)
-	ins = append(ins, []bpf.Instruction{
-		// destination port
-		bpf.LoadIndirect{Off: header.TCPDstPortOffset, Size: 2},
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 1},
-		bpf.RetConstant{Val: 0},
-
-		// SYN flag
-		bpf.LoadIndirect{Off: header.TCPFlagsOffset, Size: 1},
-		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: syn},
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: syn, SkipTrue: 1},
-		bpf.RetConstant{Val: 0},
-
-		bpf.RetConstant{Val: 0xffff},
-	}...)
-
-	return ins
+	return FilterDstPortAndTCPFlags(port, header.TCPFlagSyn, header.TCPFlagSyn)
 }
 
 func FilterPorts(srcPort, dstPort uint16) []bpf.Instruction {
@@ -213,3 +197,33 @@ func iphdrLen() []bpf.Instruction {
 		bpf.LoadConstant{Dst: bpf.RegX, Val: 40},
 	}
 }
+
+// FilterDstPortAndTCPHandshake like FilterDstPortAndTCPSyn, also accept pure
+// ACK (maybe with PSH), that maybe the handshake final ACK of SYN cookie
+func FilterDstPortAndTCPHandshake(port uint16) []bpf.Instruction {
+	var ins = iphdrLen()
+
+	const (
+		syn  = uint32(header.TCPFlagSyn)
+		ack  = uint32(header.TCPFlagAck)
+		mask = uint32(header.TCPFlagFin | header.TCPFlagSyn | header.TCPFlagRst | header.TCPFlagAck)
+	)
+	ins = append(ins, []bpf.Instruction{
+		// destination port
+		bpf.LoadIndirect{Off: header.TCPDstPortOffset, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+
+		// pure ACK or SYN flag
+		bpf.LoadIndirect{Off: header.TCPFlagsOffset, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: ack, SkipTrue: 3},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: syn},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: syn, SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+
+		bpf.RetConstant{Val: 0xffff},
+	}...)
+
+	return ins
+}
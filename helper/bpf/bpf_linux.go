@@ -7,13 +7,24 @@ import (
 	"syscall"
 	"unsafe"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 )
 
+// SetRawBPF set program ins, ins of AF_INET6 raw socket is ip packet program
+// and relocated, because the socket not recv ip header, see LinkTransport
 func SetRawBPF(raw syscall.RawConn, ins []bpf.Instruction) error {
 	var e error
 	if err := raw.Control(func(fd uintptr) {
+		var link LinkType
+		if link, e = SockLinkType(fd); e != nil {
+			return
+		} else if link == LinkTransport {
+			if ins, e = Link(link, ins); e != nil {
+				return
+			}
+		}
 		e = SetBPF(fd, ins)
 	}); err != nil {
 		return err
@@ -21,6 +32,45 @@ func SetRawBPF(raw syscall.RawConn, ins []bpf.Instruction) error {
 	return e
 }
 
+// SetLinkBPF set ip packet program ins, relocated to link type of the socket,
+// see Link
+func SetLinkBPF(raw syscall.RawConn, ins []bpf.Instruction) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		var link LinkType
+		if link, e = SockLinkType(fd); e != nil {
+			return
+		}
+		var prog []bpf.Instruction
+		if prog, e = Link(link, ins); e == nil {
+			e = SetBPF(fd, prog)
+		}
+	}); err != nil {
+		return err
+	}
+	return e
+}
+
+// SockLinkType link type of packet seen by socket filter, AF_PACKET SOCK_RAW
+// socket is assumed bound to ethernet interface, AF_INET6 raw socket's packet
+// start with transport header
+func SockLinkType(fd uintptr) (LinkType, error) {
+	domain, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_DOMAIN)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	typ, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if domain == unix.AF_PACKET && typ == unix.SOCK_RAW {
+		return LinkEthernet, nil
+	} else if domain == unix.AF_INET6 && typ == unix.SOCK_RAW {
+		return LinkTransport, nil
+	}
+	return LinkIP, nil
+}
+
 func SetBPF(fd uintptr, ins []bpf.Instruction) error {
 	// drain buffered packet
 	// https://natanyellin.com/posts/ebpf-filtering-done-right/
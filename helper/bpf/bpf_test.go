@@ -44,6 +44,39 @@ func Test_FilterDstPortAndSynFlag(t *testing.T) {
 
 }
 
+func Test_FilterDstPortAndTCPHandshake(t *testing.T) {
+	vm, err := bpf.NewVM(FilterDstPortAndTCPHandshake(8080))
+	require.NoError(t, err)
+
+	for _, e := range []struct {
+		port  uint16
+		flags header.TCPFlags
+		ret   int
+	}{
+		{8080, header.TCPFlagSyn, 0xffff},
+		{8080, header.TCPFlagAck, 0xffff},
+		{8080, header.TCPFlagAck | header.TCPFlagPsh, 0xffff},
+		{8080, header.TCPFlagSyn | header.TCPFlagAck, 0xffff},
+		{8080, header.TCPFlagAck | header.TCPFlagFin, 0},
+		{8080, header.TCPFlagRst, 0},
+		{80, header.TCPFlagSyn, 0},
+	} {
+		var b = make(header.IPv4, 40)
+		b.Encode(&header.IPv4Fields{
+			Protocol: uint8(header.TCPProtocolNumber),
+			SrcAddr:  tcpip.AddrFromSlice([]byte{1, 2, 3, 4}),
+			DstAddr:  tcpip.AddrFromSlice([]byte{5, 6, 7, 8}),
+		})
+		header.TCP(b[20:]).Encode(&header.TCPFields{
+			SrcPort: 19986, DstPort: e.port, Flags: e.flags,
+		})
+
+		n, err := vm.Run(b)
+		require.NoError(t, err)
+		require.Equal(t, e.ret, n, e.flags.String())
+	}
+}
+
 func Test_iphdrLen(t *testing.T) {
 	var ips = [][]byte{
 		func() header.IPv4 {
@@ -0,0 +1,457 @@
+package bpf
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Compile compile pcap filter expression to cBPF program, the program run on ip
+// packet (start with ip header), see CompileLink for other link type. support
+// syntax:
+//
+//	ip, ip6, tcp, udp, icmp, icmp6
+//	[src|dst] host <addr>
+//	[src|dst] net <prefix>
+//	[src|dst] port <port>
+//	[src|dst] portrange <port>-<port>
+//	proto qualifier, such as: tcp dst port 443, ip6 host ::1
+//	and(&&), or(||), not(!), parentheses
+//
+// same as libpcap, "and" and "or" have same precedence and left associative.
+func Compile(expr string) ([]bpf.Instruction, error) {
+	n, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return compile(n, false)
+}
+
+// WithFilter prepend compiled expr to program ins, packet not matched expr will
+// be dropped, otherwise run ins. return ins directly if expr is empty.
+func WithFilter(expr string, ins []bpf.Instruction) ([]bpf.Instruction, error) {
+	if strings.TrimSpace(expr) == "" {
+		return ins, nil
+	}
+	n, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := compile(n, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, ins...), nil
+}
+
+type node interface{ node() }
+
+type (
+	and  struct{ a, b node }
+	or   struct{ a, b node }
+	not  struct{ a node }
+	test struct {
+		loads []bpf.Instruction // set reg A
+		cond  bpf.JumpTest
+		val   uint32
+	}
+)
+
+func (and) node()  {}
+func (or) node()   {}
+func (not) node()  {}
+func (test) node() {}
+
+type compiler struct {
+	ins    []bpf.Instruction
+	jumps  map[int][2]int // instruction index : true/false label
+	labels []int          // label : instruction index
+}
+
+// compile generate program, if fallthrough is true, matched packet will fall
+// through the end of program instead of return
+func compile(n node, prefix bool) ([]bpf.Instruction, error) {
+	var c = &compiler{jumps: map[int][2]int{}}
+
+	accept, reject := c.label(), c.label()
+	c.gen(n, accept, reject)
+	if prefix {
+		c.place(reject)
+		c.ins = append(c.ins, bpf.RetConstant{Val: 0})
+		c.place(accept)
+	} else {
+		c.place(accept)
+		c.ins = append(c.ins, bpf.RetConstant{Val: 0xffff})
+		c.place(reject)
+		c.ins = append(c.ins, bpf.RetConstant{Val: 0})
+	}
+
+	for i, ls := range c.jumps {
+		jmp := c.ins[i].(bpf.JumpIf)
+		t, f := c.labels[ls[0]]-i-1, c.labels[ls[1]]-i-1
+		if t > 0xff || f > 0xff {
+			return nil, errors.New("filter expression too complex")
+		}
+		jmp.SkipTrue, jmp.SkipFalse = uint8(t), uint8(f)
+		c.ins[i] = jmp
+	}
+	return c.ins, nil
+}
+
+func (c *compiler) label() int {
+	c.labels = append(c.labels, -1)
+	return len(c.labels) - 1
+}
+
+func (c *compiler) place(l int) { c.labels[l] = len(c.ins) }
+
+func (c *compiler) gen(n node, t, f int) {
+	switch n := n.(type) {
+	case and:
+		m := c.label()
+		c.gen(n.a, m, f)
+		c.place(m)
+		c.gen(n.b, t, f)
+	case or:
+		m := c.label()
+		c.gen(n.a, t, m)
+		c.place(m)
+		c.gen(n.b, t, f)
+	case not:
+		c.gen(n.a, f, t)
+	case test:
+		c.ins = append(c.ins, n.loads...)
+		c.jumps[len(c.ins)] = [2]int{t, f}
+		c.ins = append(c.ins, bpf.JumpIf{Cond: n.cond, Val: n.val})
+	default:
+		panic(n)
+	}
+}
+
+// parser
+
+type parser struct {
+	toks []string
+	i    int
+}
+
+func parse(expr string) (node, error) {
+	var p = &parser{toks: tokenize(expr)}
+	if len(p.toks) == 0 {
+		return nil, errors.New("empty filter expression")
+	}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	} else if p.i != len(p.toks) {
+		return nil, errors.Errorf("unexpected token %q", p.toks[p.i])
+	}
+	return n, nil
+}
+
+func tokenize(expr string) (toks []string) {
+	r := strings.NewReplacer("(", " ( ", ")", " ) ", "&&", " and ", "||", " or ", "!", " not ")
+	return strings.Fields(r.Replace(expr))
+}
+
+func (p *parser) peek() string {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.i++
+	return tok
+}
+
+func (p *parser) expr() (node, error) {
+	a, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "and":
+			p.next()
+			b, err := p.factor()
+			if err != nil {
+				return nil, err
+			}
+			a = and{a, b}
+		case "or":
+			p.next()
+			b, err := p.factor()
+			if err != nil {
+				return nil, err
+			}
+			a = or{a, b}
+		default:
+			return a, nil
+		}
+	}
+}
+
+func (p *parser) factor() (node, error) {
+	switch p.peek() {
+	case "not":
+		p.next()
+		a, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return not{a}, nil
+	case "(":
+		p.next()
+		a, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		return a, nil
+	default:
+		return p.primitive()
+	}
+}
+
+func (p *parser) primitive() (node, error) {
+	var proto node
+	switch tok := p.peek(); tok {
+	case "ip", "ip6", "tcp", "udp", "icmp", "icmp6":
+		p.next()
+		proto = protoNode(tok)
+		switch p.peek() {
+		case "src", "dst", "host", "net", "port", "portrange":
+		default:
+			return proto, nil
+		}
+	case "":
+		return nil, errors.New("unexpected end of filter expression")
+	}
+
+	var src, dst = true, true
+	switch p.peek() {
+	case "src":
+		p.next()
+		dst = false
+	case "dst":
+		p.next()
+		src = false
+	}
+
+	var n node
+	var err error
+	switch tok := p.next(); tok {
+	case "host":
+		n, err = hostNode(p.next(), src, dst)
+	case "net":
+		n, err = netNode(p.next(), src, dst)
+	case "port":
+		var port uint64
+		tok := p.next()
+		if port, err = strconv.ParseUint(tok, 10, 16); err != nil {
+			return nil, errors.Errorf("invalid port %q", tok)
+		}
+		n = portNode(uint16(port), uint16(port), src, dst)
+	case "portrange":
+		tok := p.next()
+		a, b, ok := strings.Cut(tok, "-")
+		start, err1 := strconv.ParseUint(a, 10, 16)
+		end, err2 := strconv.ParseUint(b, 10, 16)
+		if !ok || err1 != nil || err2 != nil || start > end {
+			return nil, errors.Errorf("invalid portrange %q", tok)
+		}
+		n = portNode(uint16(start), uint16(end), src, dst)
+	default:
+		if addr, e := netip.ParseAddr(tok); e == nil && (!src || !dst) {
+			n, err = hostNode(addr.String(), src, dst) // src/dst <addr>
+		} else {
+			return nil, errors.Errorf("unexpected token %q", tok)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if proto != nil {
+		return and{proto, n}, nil
+	}
+	return n, nil
+}
+
+// primitives
+
+var (
+	ip4 = test{
+		loads: []bpf.Instruction{
+			bpf.LoadAbsolute{Off: 0, Size: 1},
+			bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4},
+		},
+		cond: bpf.JumpEqual, val: 4,
+	}
+	ip6 = test{
+		loads: []bpf.Instruction{
+			bpf.LoadAbsolute{Off: 0, Size: 1},
+			bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4},
+		},
+		cond: bpf.JumpEqual, val: 6,
+	}
+	// ipv4 not fragment, or first fragment
+	ip4NotFrag = not{test{
+		loads: []bpf.Instruction{bpf.LoadAbsolute{Off: 6, Size: 2}},
+		cond:  bpf.JumpBitsSet, val: 0x1fff,
+	}}
+)
+
+func proto4(proto uint8) node {
+	return and{ip4, test{
+		loads: []bpf.Instruction{bpf.LoadAbsolute{Off: 9, Size: 1}},
+		cond:  bpf.JumpEqual, val: uint32(proto),
+	}}
+}
+
+func proto6(proto uint8) node {
+	return and{ip6, test{
+		loads: []bpf.Instruction{bpf.LoadAbsolute{Off: header.IPv6NextHeaderOffset, Size: 1}},
+		cond:  bpf.JumpEqual, val: uint32(proto),
+	}}
+}
+
+func protoNode(name string) node {
+	switch name {
+	case "ip":
+		return ip4
+	case "ip6":
+		return ip6
+	case "tcp":
+		return or{proto4(uint8(header.TCPProtocolNumber)), proto6(uint8(header.TCPProtocolNumber))}
+	case "udp":
+		return or{proto4(uint8(header.UDPProtocolNumber)), proto6(uint8(header.UDPProtocolNumber))}
+	case "icmp":
+		return proto4(uint8(header.ICMPv4ProtocolNumber))
+	case "icmp6":
+		return proto6(uint8(header.ICMPv6ProtocolNumber))
+	default:
+		panic(name)
+	}
+}
+
+func hostNode(tok string, src, dst bool) (node, error) {
+	addr, err := netip.ParseAddr(tok)
+	if err != nil {
+		return nil, errors.Errorf("invalid host %q", tok)
+	}
+	return netNode(netip.PrefixFrom(addr, addr.BitLen()).String(), src, dst)
+}
+
+func netNode(tok string, src, dst bool) (node, error) {
+	prefix, err := netip.ParsePrefix(tok)
+	if err != nil {
+		addr, err1 := netip.ParseAddr(tok)
+		if err1 != nil {
+			return nil, errors.Errorf("invalid net %q", tok)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	prefix = prefix.Masked()
+
+	var ver node = ip4
+	var srcOff, dstOff uint32 = 12, 16
+	if prefix.Addr().Is6() {
+		ver, srcOff, dstOff = ip6, 8, 24
+	}
+
+	var n node
+	if src {
+		n = matchPrefix(prefix, srcOff)
+	}
+	if dst {
+		if n == nil {
+			n = matchPrefix(prefix, dstOff)
+		} else {
+			n = or{n, matchPrefix(prefix, dstOff)}
+		}
+	}
+	return and{ver, n}, nil
+}
+
+// matchPrefix match address at offset off within prefix, by 4-bytes words
+func matchPrefix(prefix netip.Prefix, off uint32) node {
+	b, bits := prefix.Addr().AsSlice(), prefix.Bits()
+	if bits == 0 {
+		return test{loads: []bpf.Instruction{bpf.LoadConstant{Dst: bpf.RegA, Val: 0}}, cond: bpf.JumpEqual, val: 0}
+	}
+
+	var n node
+	for i := 0; i*32 < bits; i++ {
+		mask := ^uint32(0)
+		if remain := bits - i*32; remain < 32 {
+			mask = ^(mask >> remain)
+		}
+
+		loads := []bpf.Instruction{bpf.LoadAbsolute{Off: off + uint32(i*4), Size: 4}}
+		if mask != ^uint32(0) {
+			loads = append(loads, bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask})
+		}
+		t := test{loads: loads, cond: bpf.JumpEqual, val: binary.BigEndian.Uint32(b[i*4:]) & mask}
+
+		if n == nil {
+			n = t
+		} else {
+			n = and{n, t}
+		}
+	}
+	return n
+}
+
+func portNode(start, end uint16, src, dst bool) node {
+	var ports = func(ldx bpf.Instruction, base uint32) node {
+		var n node
+		for _, e := range []struct {
+			ok  bool
+			off uint32
+		}{{src, base}, {dst, base + 2}} {
+			if !e.ok {
+				continue
+			}
+
+			loads := []bpf.Instruction{ldx, bpf.LoadIndirect{Off: e.off, Size: 2}}
+			var t node
+			if start == end {
+				t = test{loads: loads, cond: bpf.JumpEqual, val: uint32(start)}
+			} else {
+				t = and{
+					test{loads: loads, cond: bpf.JumpGreaterOrEqual, val: uint32(start)},
+					test{loads: loads, cond: bpf.JumpLessOrEqual, val: uint32(end)},
+				}
+			}
+
+			if n == nil {
+				n = t
+			} else {
+				n = or{n, t}
+			}
+		}
+		return n
+	}
+
+	const tcp, udp = uint8(header.TCPProtocolNumber), uint8(header.UDPProtocolNumber)
+	v4 := and{
+		and{or{proto4(tcp), proto4(udp)}, ip4NotFrag},
+		ports(bpf.LoadMemShift{Off: 0}, 0),
+	}
+	v6 := and{
+		or{proto6(tcp), proto6(udp)},
+		ports(bpf.LoadConstant{Dst: bpf.RegX, Val: 0}, header.IPv6MinimumSize),
+	}
+	return or{v4, v6}
+}
@@ -0,0 +1,103 @@
+package bpf_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	netbpf "golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Compile(t *testing.T) {
+	var (
+		c4 = netip.MustParseAddrPort("10.1.2.3:1234")
+		s4 = netip.MustParseAddrPort("192.168.0.8:443")
+		c6 = netip.MustParseAddrPort("[2001:db8::1]:1234")
+		s6 = netip.MustParseAddrPort("[2001:db9::8]:443")
+
+		tcp4  = test.RandTCP(t, c4, s4)
+		udp4  = test.RandUDP(t, c4, s4)
+		icmp4 = test.RandICMP(t, c4.Addr(), s4.Addr())
+		tcp6  = test.RandTCP(t, c6, s6)
+		udp6  = test.RandUDP(t, c6, s6)
+		frag4 = test.Fragment(t, test.RandUDP(t, c4, netip.AddrPortFrom(s4.Addr(), 443)), 64)[1]
+	)
+	for len(test.StripIP(udp4)) < 64 {
+		udp4 = test.RandUDP(t, c4, s4)
+	}
+
+	for _, e := range []struct {
+		expr    string
+		match   [][]byte
+		unmatch [][]byte
+	}{
+		{"tcp", [][]byte{tcp4, tcp6}, [][]byte{udp4, udp6, icmp4}},
+		{"ip6 and udp", [][]byte{udp6}, [][]byte{udp4, tcp6}},
+		{"icmp", [][]byte{icmp4}, [][]byte{tcp4, udp6}},
+		{"tcp dst port 443", [][]byte{tcp4, tcp6}, [][]byte{udp4, udp6}},
+		{"src port 443", nil, [][]byte{tcp4, udp4, tcp6}},
+		{"port 1234 and not icmp", [][]byte{tcp4, udp4, tcp6, udp6}, [][]byte{icmp4}},
+		{"portrange 400-500", [][]byte{tcp4, udp6}, [][]byte{icmp4}},
+		{"dst port 443", nil, [][]byte{frag4}},
+		{"src net 10.0.0.0/8", [][]byte{tcp4, udp4, icmp4}, [][]byte{tcp6}},
+		{"dst host 192.168.0.8 && !udp", [][]byte{tcp4, icmp4}, [][]byte{udp4, tcp6}},
+		{"host 2001:db9::8", [][]byte{tcp6, udp6}, [][]byte{tcp4}},
+		{"net 2001:db8::/31", [][]byte{tcp6, udp6}, [][]byte{tcp4}},
+		{"net 2001:db8::/32 and dst net 2001:db9::/32", [][]byte{tcp6}, [][]byte{tcp4}},
+		{"(udp or icmp) and src 10.1.2.3", [][]byte{udp4, icmp4}, [][]byte{tcp4, udp6}},
+		{"not (tcp or udp)", [][]byte{icmp4}, [][]byte{tcp4, udp6}},
+	} {
+		ins, err := bpf.Compile(e.expr)
+		require.NoError(t, err, e.expr)
+		vm, err := netbpf.NewVM(ins)
+		require.NoError(t, err, e.expr)
+
+		for _, ip := range e.match {
+			n, err := vm.Run(ip)
+			require.NoError(t, err)
+			require.NotZero(t, n, "%s %d", e.expr, header.IPVersion(ip))
+		}
+		for _, ip := range e.unmatch {
+			n, err := vm.Run(ip)
+			require.NoError(t, err)
+			require.Zero(t, n, "%s %d", e.expr, header.IPVersion(ip))
+		}
+	}
+}
+
+func Test_Compile_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"", "tcp and", "port 99999", "host 1.2.3", "(tcp", "tcp)", "portrange 9-1", "foo",
+	} {
+		_, err := bpf.Compile(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func Test_WithFilter(t *testing.T) {
+	var (
+		c = netip.MustParseAddrPort("10.1.2.3:1234")
+		s = netip.MustParseAddrPort("192.168.0.8:443")
+	)
+
+	ins, err := bpf.WithFilter("src net 10.0.0.0/8", bpf.FilterPorts(c.Port(), s.Port()))
+	require.NoError(t, err)
+	vm, err := netbpf.NewVM(ins)
+	require.NoError(t, err)
+
+	n, err := vm.Run(test.RandTCP(t, c, s))
+	require.NoError(t, err)
+	require.Equal(t, 0xffff, n)
+
+	n, err = vm.Run(test.RandTCP(t, netip.MustParseAddrPort("172.16.0.1:1234"), s))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	raw := bpf.FilterPorts(c.Port(), s.Port())
+	ins, err = bpf.WithFilter(" ", raw)
+	require.NoError(t, err)
+	require.Equal(t, raw, ins)
+}
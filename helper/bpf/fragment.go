@@ -0,0 +1,43 @@
+package bpf
+
+import (
+	"net/netip"
+
+	"golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// WithFragment prepend ip fragment check to ins. port filters assume transport
+// header follow ip header, that is false for fragments, a non-first fragment's
+// payload can be mis-matched as ports, and a tiny first fragment can hide the
+// real ports, so fragments is dropped, or accepted if defrag (ipv4 only) and
+// match src/dst address, without run ins, the reassembler should re-check the
+// full packet. ipv6 fragment always be dropped.
+//
+// AF_INET raw socket recv packets reassembled by kernel, only AF_PACKET socket
+// need it.
+func WithFragment(defrag bool, src, dst netip.Addr, ins []bpf.Instruction) []bpf.Instruction {
+	var frag = []bpf.Instruction{bpf.RetConstant{Val: 0}}
+	if defrag && src.Is4() && dst.Is4() {
+		frag = append(filterAddrs(src, dst), bpf.RetConstant{Val: 0xffff})
+	}
+
+	var prefix = []bpf.Instruction{
+		// load ip version to A
+		bpf.LoadAbsolute{Off: 0, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 6, SkipTrue: 2 + uint8(len(frag))},
+
+		// ipv4 MF flag or fragment offset
+		bpf.LoadAbsolute{Off: 6, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x3fff, SkipFalse: uint8(len(frag)) + 3},
+	}
+	prefix = append(prefix, frag...)
+	prefix = append(prefix,
+		// ipv6 fragment header
+		bpf.LoadAbsolute{Off: header.IPv6NextHeaderOffset, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(header.IPv6FragmentHeader), SkipFalse: 1},
+		bpf.RetConstant{Val: 0},
+	)
+	return append(prefix, ins...)
+}
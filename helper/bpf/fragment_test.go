@@ -0,0 +1,61 @@
+package bpf_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	xbpf "golang.org/x/net/bpf"
+)
+
+func Test_WithFragment(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	ip := test.RandUDP(t, src, dst)
+	for len(ip) < 256 {
+		ip = test.RandUDP(t, src, dst)
+	}
+	frags := test.Fragment(t, ip, 100)
+
+	var run = func(ins []xbpf.Instruction, b []byte) int {
+		vm, err := xbpf.NewVM(ins)
+		require.NoError(t, err)
+		n, err := vm.Run(b)
+		require.NoError(t, err)
+		return n
+	}
+
+	ins := bpf.FilterDstPort(dst.Port())
+	require.NotZero(t, run(bpf.WithFragment(false, src.Addr(), dst.Addr(), ins), ip))
+	require.NotZero(t, run(bpf.WithFragment(true, src.Addr(), dst.Addr(), ins), ip))
+	for _, frag := range frags {
+		require.Zero(t, run(bpf.WithFragment(false, src.Addr(), dst.Addr(), ins), frag))
+		require.NotZero(t, run(bpf.WithFragment(true, src.Addr(), dst.Addr(), ins), frag))
+	}
+
+	// fragment from other host always dropped
+	other := netip.AddrPortFrom(test.RandIP(), src.Port())
+	ip = test.RandUDP(t, other, dst)
+	for len(ip) < 256 {
+		ip = test.RandUDP(t, other, dst)
+	}
+	for _, frag := range test.Fragment(t, ip, 100) {
+		require.Zero(t, run(bpf.WithFragment(true, src.Addr(), dst.Addr(), ins), frag))
+	}
+
+	// ipv6 fragment always dropped
+	src6 := netip.AddrPortFrom(netip.MustParseAddr("fd00::1"), src.Port())
+	dst6 := netip.AddrPortFrom(netip.MustParseAddr("fd00::2"), dst.Port())
+	ip6 := test.RandUDP(t, src6, dst6)
+	for len(ip6) < 256 {
+		ip6 = test.RandUDP(t, src6, dst6)
+	}
+	require.NotZero(t, run(bpf.WithFragment(true, src6.Addr(), dst6.Addr(), ins), ip6))
+	for _, frag := range test.Fragment(t, ip6, 128) {
+		require.Zero(t, run(bpf.WithFragment(true, src6.Addr(), dst6.Addr(), ins), frag))
+	}
+}
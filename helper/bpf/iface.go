@@ -0,0 +1,29 @@
+package bpf
+
+import (
+	"golang.org/x/net/bpf"
+)
+
+// loopbackIndex ifindex of loopback interface, fixed in every netns on linux
+const loopbackIndex = 1
+
+// WithInterface prepend interface check to ins, only accept packet received
+// by the interface, used by conn of zoned address (such as ipv6 link-local),
+// that same address maybe used on multiple interfaces. ifindex 0 is any.
+//
+// NOTICE: loopback (ifindex 1) always bypass the check, because packet sent
+// to local zoned address is looped back by it, so can't isolate traffic on
+// loopback.
+func WithInterface(ifindex int, ins []bpf.Instruction) []bpf.Instruction {
+	if ifindex <= 0 {
+		return ins
+	}
+
+	var prefix = []bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtInterfaceIndex},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(ifindex), SkipTrue: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: loopbackIndex, SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	}
+	return append(prefix, ins...)
+}
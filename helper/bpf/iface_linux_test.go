@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package bpf_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithInterface(t *testing.T) {
+	var recv = func(t *testing.T, ifindex int) int {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer conn.Close()
+		port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+		raw, err := net.ListenIP("ip4:udp", &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer raw.Close()
+		rc, err := raw.SyscallConn()
+		require.NoError(t, err)
+		require.NoError(t, bpf.SetRawBPF(rc, bpf.WithInterface(ifindex, bpf.FilterDstPort(port))))
+
+		_, err = conn.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+
+		var n int
+		require.NoError(t, raw.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+		for b := make([]byte, 1536); ; n++ {
+			if _, err := raw.Read(b); err != nil {
+				require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+				return n
+			}
+		}
+	}
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	require.Equal(t, 1, recv(t, 0))
+	require.Equal(t, 1, recv(t, lo.Index))
+	// packet looped back to local zoned address
+	require.Equal(t, 1, recv(t, lo.Index+1000))
+
+	t.Run("veth", func(t *testing.T) {
+		vt := test.CreateVethTuple(t)
+		defer vt.Close()
+
+		var recv = func(t *testing.T, ifindex func(veth int) int) int {
+			var raw *net.IPConn
+			var conn *net.UDPConn
+			require.NoError(t, vt.Do(vt.NS2, func() error {
+				ifi, err := net.InterfaceByName(vt.Name2)
+				if err != nil {
+					return err
+				}
+				if conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: vt.Addr2.AsSlice()}); err != nil {
+					return err
+				}
+				if raw, err = net.ListenIP("ip4:udp", &net.IPAddr{IP: vt.Addr2.AsSlice()}); err != nil {
+					return err
+				}
+				rc, err := raw.SyscallConn()
+				if err != nil {
+					return err
+				}
+				port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+				return bpf.SetRawBPF(rc, bpf.WithInterface(ifindex(ifi.Index), bpf.FilterDstPort(port)))
+			}))
+			defer raw.Close()
+			defer conn.Close()
+
+			require.NoError(t, vt.Do(vt.NS1, func() error {
+				c, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+				if err != nil {
+					return err
+				}
+				defer c.Close()
+				_, err = c.Write([]byte("hello"))
+				return err
+			}))
+
+			var n int
+			require.NoError(t, raw.SetReadDeadline(time.Now().Add(time.Millisecond*500)))
+			for b := make([]byte, 1536); ; n++ {
+				if _, err := raw.Read(b); err != nil {
+					require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+					return n
+				}
+			}
+		}
+
+		require.Equal(t, 1, recv(t, func(veth int) int { return veth }))
+		// received by other interface, rejected
+		require.Equal(t, 0, recv(t, func(veth int) int { return veth + 1000 }))
+	})
+}
@@ -0,0 +1,19 @@
+package bpf
+
+import (
+	"golang.org/x/net/bpf"
+)
+
+const packetOutgoing = 4 // PACKET_OUTGOING
+
+// WithInbound prepend packet type check to ins, drop frames sent by host
+// itself, that AF_PACKET socket recv if it's protocol is ETH_P_ALL. it is
+// fallback of PACKET_IGNORE_OUTGOING, that need linux 4.20+.
+func WithInbound(ins []bpf.Instruction) []bpf.Instruction {
+	var prefix = []bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtType},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: packetOutgoing, SkipFalse: 1},
+		bpf.RetConstant{Val: 0},
+	}
+	return append(prefix, ins...)
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package bpf_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/eth"
+	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_WithInbound(t *testing.T) {
+	// ETH_P_ALL socket capture loopback frame twice, as outgoing and host
+	var recv = func(t *testing.T, inbound, ignore bool) int {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer conn.Close()
+		port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+		lo, err := net.InterfaceByName("lo")
+		require.NoError(t, err)
+		proto := eth.Htons(unix.ETH_P_ALL)
+		fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, proto)
+		require.NoError(t, err)
+		f := os.NewFile(uintptr(fd), "")
+		defer f.Close()
+		raw, err := f.SyscallConn()
+		require.NoError(t, err)
+
+		ins := bpf.FilterDstPort(port)
+		if inbound {
+			ins = bpf.WithInbound(ins)
+		}
+		require.NoError(t, bpf.SetRawBPF(raw, ins))
+		if ignore {
+			require.NoError(t, bind.IgnoreOutgoing(raw))
+		}
+		require.NoError(t, unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: uint16(proto), Ifindex: lo.Index}))
+
+		_, err = conn.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+
+		var n int
+		require.NoError(t, f.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+		for b := make([]byte, 1536); ; n++ {
+			if _, err := f.Read(b); err != nil {
+				require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+				return n
+			}
+		}
+	}
+
+	require.Equal(t, 2, recv(t, false, false))
+	require.Equal(t, 1, recv(t, true, false))
+	require.Equal(t, 1, recv(t, false, true))
+}
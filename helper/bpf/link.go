@@ -0,0 +1,259 @@
+package bpf
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// LinkType layout of packet seen by socket filter. programs of this package
+// run on ip packet, Link relocate them to other link type.
+type LinkType int
+
+const (
+	// LinkIP packet start with ip header, AF_INET raw socket and AF_PACKET
+	// SOCK_DGRAM socket
+	LinkIP LinkType = iota
+
+	// LinkEthernet packet start with ethernet header, AF_PACKET SOCK_RAW
+	// socket. vlan tag usually stripped by kernel, see rawsock.Frame, but
+	// still present if vlan offload disabled or QinQ, up to two tags are
+	// skipped by relocated program
+	LinkEthernet
+
+	// LinkTransport packet start with transport header, AF_INET6 raw socket,
+	// ip header only reachable by load relative to SKF_NET_OFF
+	LinkTransport
+)
+
+const (
+	etherTypeDot1Q  = 0x8100
+	etherTypeDot1AD = 0x88a8
+
+	// scratch memory used by relocated program, the program to be relocated
+	// should not use them
+	scratchLink = 13 // link header size
+	scratchX    = 14 // saved regX
+	scratchA    = 15 // saved regA
+
+	// linux SKF_NET_OFF, load offset relative to network header
+	netOff = 0xfff00000
+)
+
+// HeaderLen link layer header size before ip header, without vlan tags
+func (l LinkType) HeaderLen() int {
+	switch l {
+	case LinkEthernet:
+		return header.EthernetMinimumSize
+	default:
+		return 0
+	}
+}
+
+func (l LinkType) String() string {
+	switch l {
+	case LinkIP:
+		return "ip"
+	case LinkEthernet:
+		return "ethernet"
+	case LinkTransport:
+		return "transport"
+	default:
+		return "unknown"
+	}
+}
+
+// Link relocate ip packet program ins to link type, packet loads are offset
+// by link header size, which detected per packet, so vlan tagged frame is
+// also matched. ethernet frame not carry ip packet is dropped.
+// regX used by LoadIndirect should be offset from ip header, such as set by
+// LoadMemShift or LoadConstant, same as programs of this package.
+func Link(link LinkType, ins []bpf.Instruction) ([]bpf.Instruction, error) {
+	switch link {
+	case LinkEthernet:
+	case LinkTransport:
+		return linkNet(ins)
+	default:
+		return ins, nil
+	}
+
+	var prefix = []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.LoadConstant{Dst: bpf.RegX, Val: header.EthernetMinimumSize},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypeDot1Q, SkipTrue: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypeDot1AD, SkipTrue: 1},
+		bpf.Jump{Skip: 5},
+
+		// outer tag
+		bpf.LoadAbsolute{Off: 16, Size: 2},
+		bpf.LoadConstant{Dst: bpf.RegX, Val: header.EthernetMinimumSize + 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: etherTypeDot1Q, SkipFalse: 2},
+
+		// inner tag
+		bpf.LoadAbsolute{Off: 20, Size: 2},
+		bpf.LoadConstant{Dst: bpf.RegX, Val: header.EthernetMinimumSize + 8},
+
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(header.IPv4ProtocolNumber), SkipTrue: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(header.IPv6ProtocolNumber), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.StoreScratch{Src: bpf.RegX, N: scratchLink},
+	}
+
+	// expand packet loads, jumps are fixed after
+	var (
+		exps = make([][]bpf.Instruction, len(ins))
+		idx  = make([]int, len(ins)+1) // new index of ins
+	)
+	for i, in := range ins {
+		switch in := in.(type) {
+		case bpf.LoadAbsolute:
+			// A = pkt[link+Off]
+			exps[i] = []bpf.Instruction{
+				bpf.StoreScratch{Src: bpf.RegX, N: scratchX},
+				bpf.LoadScratch{Dst: bpf.RegX, N: scratchLink},
+				bpf.LoadIndirect{Off: in.Off, Size: in.Size},
+				bpf.LoadScratch{Dst: bpf.RegX, N: scratchX},
+			}
+		case bpf.LoadIndirect:
+			// A = pkt[link+X+Off]
+			exps[i] = []bpf.Instruction{
+				bpf.StoreScratch{Src: bpf.RegX, N: scratchX},
+				bpf.TXA{},
+				bpf.LoadScratch{Dst: bpf.RegX, N: scratchLink},
+				bpf.ALUOpX{Op: bpf.ALUOpAdd},
+				bpf.TAX{},
+				bpf.LoadIndirect{Off: in.Off, Size: in.Size},
+				bpf.LoadScratch{Dst: bpf.RegX, N: scratchX},
+			}
+		case bpf.LoadMemShift:
+			// X = 4*(pkt[link+Off]&0xf)
+			exps[i] = []bpf.Instruction{
+				bpf.StoreScratch{Src: bpf.RegA, N: scratchA},
+				bpf.LoadScratch{Dst: bpf.RegX, N: scratchLink},
+				bpf.LoadIndirect{Off: in.Off, Size: 1},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xf},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 2},
+				bpf.TAX{},
+				bpf.LoadScratch{Dst: bpf.RegA, N: scratchA},
+			}
+		case bpf.StoreScratch:
+			if in.N >= scratchLink {
+				return nil, errors.Errorf("scratch memory %d is reserved", in.N)
+			}
+			exps[i] = []bpf.Instruction{in}
+		default:
+			exps[i] = []bpf.Instruction{in}
+		}
+		idx[i+1] = idx[i] + len(exps[i])
+	}
+
+	var skip = func(i int, old uint32) (uint32, error) {
+		t := i + 1 + int(old)
+		if t > len(ins) {
+			return 0, errors.Errorf("invalid jump at %d", i)
+		}
+		return uint32(idx[t] - idx[i] - 1), nil
+	}
+	var skip8 = func(i int, old uint8) (uint8, error) {
+		n, err := skip(i, uint32(old))
+		if err != nil {
+			return 0, err
+		} else if n > 0xff {
+			return 0, errors.Errorf("jump at %d out of range after relocate", i)
+		}
+		return uint8(n), nil
+	}
+
+	var dst = make([]bpf.Instruction, 0, len(prefix)+idx[len(ins)])
+	dst = append(dst, prefix...)
+	for i, exp := range exps {
+		var err error
+		switch in := exp[0].(type) {
+		case bpf.Jump:
+			in.Skip, err = skip(i, in.Skip)
+			exp = []bpf.Instruction{in}
+		case bpf.JumpIf:
+			if in.SkipTrue, err = skip8(i, in.SkipTrue); err == nil {
+				in.SkipFalse, err = skip8(i, in.SkipFalse)
+			}
+			exp = []bpf.Instruction{in}
+		case bpf.JumpIfX:
+			if in.SkipTrue, err = skip8(i, in.SkipTrue); err == nil {
+				in.SkipFalse, err = skip8(i, in.SkipFalse)
+			}
+			exp = []bpf.Instruction{in}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, exp...)
+	}
+	return dst, nil
+}
+
+// linkNet relocate packet loads relative to network header, instructions are
+// replaced one by one, so jumps are kept
+func linkNet(ins []bpf.Instruction) ([]bpf.Instruction, error) {
+	var relocate = func(i int, off uint32) (uint32, error) {
+		if off >= netOff {
+			return 0, errors.Errorf("invalid load offset %#x at %d", off, i)
+		}
+		return off + netOff, nil
+	}
+
+	var dst = make([]bpf.Instruction, len(ins))
+	for i, in := range ins {
+		var err error
+		switch in := in.(type) {
+		case bpf.LoadAbsolute:
+			in.Off, err = relocate(i, in.Off)
+			dst[i] = in
+		case bpf.LoadIndirect:
+			in.Off, err = relocate(i, in.Off)
+			dst[i] = in
+		case bpf.LoadMemShift:
+			in.Off, err = relocate(i, in.Off)
+			dst[i] = in
+		default:
+			dst[i] = in
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// CompileLink compile filter expression to program of link type, see Compile
+func CompileLink(expr string, link LinkType) ([]bpf.Instruction, error) {
+	ins, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return Link(link, ins)
+}
+
+// WithVLAN prepend vlan id check to ins, only accept frame tagged vid, vid 0
+// accept untagged frame. it check tag stripped by kernel (vlan offload),
+// see rawsock.Frame
+func WithVLAN(vid uint16, ins []bpf.Instruction) []bpf.Instruction {
+	var prefix []bpf.Instruction
+	if vid == 0 {
+		prefix = []bpf.Instruction{
+			bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipTrue: 1},
+			bpf.RetConstant{Val: 0},
+		}
+	} else {
+		prefix = []bpf.Instruction{
+			bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipFalse: 1},
+			bpf.RetConstant{Val: 0},
+			bpf.LoadExtension{Num: bpf.ExtVLANTag},
+			bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xfff},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(vid), SkipTrue: 1},
+			bpf.RetConstant{Val: 0},
+		}
+	}
+	return append(prefix, ins...)
+}
@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package bpf_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/eth"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_SetLinkBPF(t *testing.T) {
+	for _, typ := range []int{unix.SOCK_RAW, unix.SOCK_DGRAM} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer conn.Close()
+		port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+		lo, err := net.InterfaceByName("lo")
+		require.NoError(t, err)
+		proto := eth.Htons(unix.ETH_P_ALL)
+		fd, err := unix.Socket(unix.AF_PACKET, typ|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, proto)
+		require.NoError(t, err)
+		f := os.NewFile(uintptr(fd), "")
+		defer f.Close()
+		raw, err := f.SyscallConn()
+		require.NoError(t, err)
+
+		link, err := bpf.SockLinkType(uintptr(fd))
+		require.NoError(t, err)
+		if typ == unix.SOCK_RAW {
+			require.Equal(t, bpf.LinkEthernet, link)
+		} else {
+			require.Equal(t, bpf.LinkIP, link)
+		}
+
+		require.NoError(t, bpf.SetLinkBPF(raw, bpf.FilterDstPort(port)))
+		require.NoError(t, unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: uint16(proto), Ifindex: lo.Index}))
+
+		_, err = conn.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+
+		require.NoError(t, f.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+		var b = make([]byte, 1536)
+		n, err := f.Read(b)
+		require.NoError(t, err, link.String())
+		require.Equal(t, link.HeaderLen()+20+8+5, n)
+	}
+}
+
+func Test_WithVLAN(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, eth.Htons(unix.ETH_P_ALL))
+	require.NoError(t, err)
+	f := os.NewFile(uintptr(fd), "")
+	defer f.Close()
+	raw, err := f.SyscallConn()
+	require.NoError(t, err)
+
+	// kernel accept vlan extensions
+	for _, vid := range []uint16{0, 5} {
+		require.NoError(t, bpf.SetLinkBPF(raw, bpf.WithVLAN(vid, bpf.FilterDstPort(80))))
+	}
+}
+
+func Test_SetRawBPF_IPv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	require.NoError(t, err)
+	defer conn.Close()
+	other, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	require.NoError(t, err)
+	defer other.Close()
+	port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+	ip, err := net.ListenIP("ip6:udp", &net.IPAddr{IP: net.IPv6loopback})
+	require.NoError(t, err)
+	defer ip.Close()
+	raw, err := ip.SyscallConn()
+	require.NoError(t, err)
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		link, err := bpf.SockLinkType(fd)
+		require.NoError(t, err)
+		require.Equal(t, bpf.LinkTransport, link)
+	}))
+	require.NoError(t, bpf.SetRawBPF(raw, bpf.FilterDstPort(port)))
+
+	// ip header not recv, but filtered by relocated program
+	_, err = conn.WriteToUDP([]byte("drop"), other.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	_, err = other.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+
+	require.NoError(t, ip.SetReadDeadline(time.Now().Add(time.Millisecond*200)))
+	var b = make([]byte, 1536)
+	n, err := ip.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b[8:n]))
+}
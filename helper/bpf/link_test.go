@@ -0,0 +1,99 @@
+package bpf_test
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	xbpf "golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Link(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), 8080)
+	)
+	var frame = func(etherType uint16, ip []byte) []byte {
+		b := make([]byte, header.EthernetMinimumSize, header.EthernetMinimumSize+len(ip))
+		binary.BigEndian.PutUint16(b[12:], etherType)
+		return append(b, ip...)
+	}
+	var run = func(ins []xbpf.Instruction, pkt []byte) int {
+		vm, err := xbpf.NewVM(ins)
+		require.NoError(t, err)
+		n, err := vm.Run(pkt)
+		require.NoError(t, err)
+		return n
+	}
+
+	ins := bpf.FilterEndpoint(header.TCPProtocolNumber, src, dst)
+	ip := test.RandTCP(t, src, dst)
+	require.Equal(t, 0xffff, run(ins, ip))
+	link := func(l bpf.LinkType, ins []xbpf.Instruction) []xbpf.Instruction {
+		ins, err := bpf.Link(l, ins)
+		require.NoError(t, err)
+		return ins
+	}
+	require.Equal(t, ins, link(bpf.LinkIP, ins))
+
+	eth := link(bpf.LinkEthernet, ins)
+	require.Equal(t, 0xffff, run(eth, frame(0x0800, ip)))
+	require.Zero(t, run(eth, frame(0x0806, ip)), "not ip frame")
+	require.Zero(t, run(eth, frame(0x0800, test.RandTCP(t, dst, src))))
+
+	// not relocated program is off by link header
+	require.Zero(t, run(ins, frame(0x0800, ip)))
+
+	t.Run("ipv6", func(t *testing.T) {
+		src6 := netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+		dst6 := netip.AddrPortFrom(test.RandIP6(), 8080)
+		ins := link(bpf.LinkEthernet, bpf.FilterEndpoint(header.TCPProtocolNumber, src6, dst6))
+		require.Equal(t, 0xffff, run(ins, frame(0x86dd, test.RandTCP(t, src6, dst6))))
+		require.Zero(t, run(ins, frame(0x86dd, test.RandTCP(t, dst6, src6))))
+	})
+
+	t.Run("vlan", func(t *testing.T) {
+		var tag = func(tpid uint16, frame []byte) []byte {
+			b := append([]byte{}, frame[:12]...)
+			b = binary.BigEndian.AppendUint16(b, tpid)
+			b = binary.BigEndian.AppendUint16(b, 100) // tci
+			return append(b, frame[12:]...)
+		}
+
+		for _, ins := range [][]xbpf.Instruction{
+			eth,
+			link(bpf.LinkEthernet, bpf.FilterDstPort(dst.Port())),
+			link(bpf.LinkEthernet, bpf.FilterTCPFlags(0, 0)),
+		} {
+			untagged := frame(0x0800, ip)
+			require.Equal(t, 0xffff, run(ins, untagged))
+			require.Equal(t, 0xffff, run(ins, tag(0x8100, untagged)))
+			require.Equal(t, 0xffff, run(ins, tag(0x88a8, tag(0x8100, untagged))))
+			require.Zero(t, run(ins, tag(0x8100, frame(0x0806, ip))))
+		}
+
+		// ip header with options
+		opt := make([]byte, 0, len(ip)+4)
+		opt = append(opt, ip[:header.IPv4MinimumSize]...)
+		opt = append(opt, 1, 1, 1, 1) // nop options
+		opt = append(opt, ip[header.IPv4MinimumSize:]...)
+		opt[0] = 0x46
+		binary.BigEndian.PutUint16(opt[2:], uint16(len(opt)))
+		require.Equal(t, 0xffff, run(eth, tag(0x8100, frame(0x0800, opt))))
+
+		// reserved scratch memory
+		_, err := bpf.Link(bpf.LinkEthernet, []xbpf.Instruction{xbpf.StoreScratch{Src: xbpf.RegA, N: 15}})
+		require.Error(t, err)
+	})
+
+	t.Run("compile", func(t *testing.T) {
+		ins, err := bpf.CompileLink("tcp dst port 8080 and src host "+src.Addr().String(), bpf.LinkEthernet)
+		require.NoError(t, err)
+		require.Equal(t, 0xffff, run(ins, frame(0x0800, ip)))
+		require.Zero(t, run(ins, frame(0x0800, test.RandTCP(t, dst, src))))
+	})
+}
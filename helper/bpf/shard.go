@@ -0,0 +1,43 @@
+package bpf
+
+import (
+	"golang.org/x/net/bpf"
+)
+
+// WithShard prepend flow hash steering to ins, only accept packet that
+// hash(source address, source port) % shards == shard. every raw socket
+// recv a copy of packet, so sharded listeners use it to consistently
+// deliver a flow to one capture socket, like SO_ATTACH_REUSEPORT_CBPF.
+func WithShard(shard, shards int, ins []bpf.Instruction) []bpf.Instruction {
+	if shards <= 1 {
+		return ins
+	}
+
+	var prefix = iphdrLen()
+	prefix = append(prefix, []bpf.Instruction{
+		// source port
+		bpf.LoadIndirect{Off: 0, Size: 2},
+		bpf.StoreScratch{Src: bpf.RegA, N: 0},
+
+		// low 32 bits of source address
+		bpf.LoadAbsolute{Off: 0, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 6, SkipTrue: 2},
+		bpf.LoadAbsolute{Off: 12, Size: 4},
+		bpf.Jump{Skip: 1},
+		bpf.LoadAbsolute{Off: 20, Size: 4},
+
+		// hash = (addr ^ port) ^ ((addr ^ port) >> 16)
+		bpf.LoadScratch{Dst: bpf.RegX, N: 0},
+		bpf.ALUOpX{Op: bpf.ALUOpXor},
+		bpf.StoreScratch{Src: bpf.RegA, N: 0},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 16},
+		bpf.LoadScratch{Dst: bpf.RegX, N: 0},
+		bpf.ALUOpX{Op: bpf.ALUOpXor},
+
+		bpf.ALUOpConstant{Op: bpf.ALUOpMod, Val: uint32(shards)},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(shard), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	}...)
+	return append(prefix, ins...)
+}
@@ -0,0 +1,58 @@
+package bpf_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	xbpf "golang.org/x/net/bpf"
+)
+
+func Test_WithShard(t *testing.T) {
+	const shards = 4
+	var dst = netip.AddrPortFrom(test.RandIP(), 8080)
+
+	var vms []*xbpf.VM
+	for i := 0; i < shards; i++ {
+		vm, err := xbpf.NewVM(bpf.WithShard(i, shards, []xbpf.Instruction{xbpf.RetConstant{Val: 0xffff}}))
+		require.NoError(t, err)
+		vms = append(vms, vm)
+	}
+
+	var hits = make([]int, shards)
+	for i := 0; i < 256; i++ {
+		var ip []byte
+		if i%2 == 0 {
+			ip = test.RandTCP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), dst)
+		} else {
+			ip = test.RandTCP(t, netip.AddrPortFrom(test.RandIP6(), test.RandPort()), netip.AddrPortFrom(test.RandIP6(), dst.Port()))
+		}
+
+		var accepted []int
+		for s, vm := range vms {
+			n, err := vm.Run(ip)
+			require.NoError(t, err)
+			if n > 0 {
+				accepted = append(accepted, s)
+			}
+		}
+		require.Len(t, accepted, 1)
+		hits[accepted[0]]++
+	}
+	for _, h := range hits {
+		require.NotZero(t, h)
+	}
+
+	// same flow always same shard
+	ip := test.RandTCP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), dst)
+	for i := 0; i < 2; i++ {
+		var cnt int
+		for _, vm := range vms {
+			n, _ := vm.Run(ip)
+			cnt += n
+		}
+		require.Equal(t, 0xffff, cnt)
+	}
+}
@@ -0,0 +1,52 @@
+package bpf
+
+import (
+	"golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// TCPFlagsAll mask of all tcp flags, match exact flags combination
+const TCPFlagsAll header.TCPFlags = 0xff
+
+// WithTCPFlags prepend tcp flags check to ins, only accept packet that
+// flags&mask == value. such as:
+//
+//	SYN only:     mask TCPFlagsAll, value SYN
+//	SYN+ACK only: mask TCPFlagsAll, value SYN|ACK
+//	with RST:     mask RST, value RST
+//	null scan:    mask TCPFlagsAll, value 0
+//	Xmas scan:    mask FIN|PSH|URG, value FIN|PSH|URG
+func WithTCPFlags(mask, value header.TCPFlags, ins []bpf.Instruction) []bpf.Instruction {
+	var prefix = iphdrLen()
+	prefix = append(prefix, filterTCPFlags(mask, value)...)
+	return append(prefix, ins...)
+}
+
+// FilterTCPFlags accept tcp packet that flags&mask == value, see WithTCPFlags
+func FilterTCPFlags(mask, value header.TCPFlags) []bpf.Instruction {
+	return WithTCPFlags(mask, value, []bpf.Instruction{
+		bpf.RetConstant{Val: 0xffff},
+	})
+}
+
+// FilterDstPortAndTCPFlags accept tcp packet sent to port, that flags&mask
+// == value, see WithTCPFlags
+func FilterDstPortAndTCPFlags(port uint16, mask, value header.TCPFlags) []bpf.Instruction {
+	var ins = iphdrLen()
+	ins = append(ins, filterDstPort(port)...)
+	ins = append(ins, filterTCPFlags(mask, value)...)
+	ins = append(ins,
+		bpf.RetConstant{Val: 0xffff},
+	)
+	return ins
+}
+
+// filterTCPFlags require regX stored iphdr length
+func filterTCPFlags(mask, value header.TCPFlags) []bpf.Instruction {
+	return []bpf.Instruction{
+		bpf.LoadIndirect{Off: header.TCPFlagsOffset, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: uint32(mask)},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(value & mask), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	}
+}
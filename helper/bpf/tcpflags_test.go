@@ -0,0 +1,92 @@
+package bpf_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	xbpf "golang.org/x/net/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_TCPFlags(t *testing.T) {
+	const (
+		fin = header.TCPFlagFin
+		syn = header.TCPFlagSyn
+		rst = header.TCPFlagRst
+		psh = header.TCPFlagPsh
+		ack = header.TCPFlagAck
+		urg = header.TCPFlagUrg
+	)
+	var dst = netip.AddrPortFrom(test.RandIP(), 8080)
+	var tcp = func(flags header.TCPFlags, v6 bool) []byte {
+		var ip []byte
+		if v6 {
+			ip = test.RandTCP(t, netip.AddrPortFrom(test.RandIP6(), test.RandPort()), netip.AddrPortFrom(test.RandIP6(), dst.Port()))
+			header.TCP(ip[header.IPv6MinimumSize:]).SetFlags(uint8(flags))
+		} else {
+			ip = test.RandTCP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), dst)
+			header.TCP(ip[header.IPv4(ip).HeaderLength():]).SetFlags(uint8(flags))
+		}
+		return ip
+	}
+
+	for _, e := range []struct {
+		name        string
+		mask, value header.TCPFlags
+		accept      []header.TCPFlags
+		drop        []header.TCPFlags
+	}{
+		{"syn", bpf.TCPFlagsAll, syn, []header.TCPFlags{syn}, []header.TCPFlags{syn | ack, ack, 0}},
+		{"syn-ack", bpf.TCPFlagsAll, syn | ack, []header.TCPFlags{syn | ack}, []header.TCPFlags{syn, ack, syn | ack | psh}},
+		{"rst", rst, rst, []header.TCPFlags{rst, rst | ack}, []header.TCPFlags{ack, fin}},
+		{"null", bpf.TCPFlagsAll, 0, []header.TCPFlags{0}, []header.TCPFlags{ack, fin, syn}},
+		{"xmas", fin | psh | urg, fin | psh | urg, []header.TCPFlags{fin | psh | urg, fin | psh | urg | ack}, []header.TCPFlags{fin, fin | psh}},
+	} {
+		t.Run(e.name, func(t *testing.T) {
+			vm, err := xbpf.NewVM(bpf.FilterTCPFlags(e.mask, e.value))
+			require.NoError(t, err)
+			for _, v6 := range []bool{false, true} {
+				for _, f := range e.accept {
+					n, err := vm.Run(tcp(f, v6))
+					require.NoError(t, err)
+					require.Equal(t, 0xffff, n, f.String())
+				}
+				for _, f := range e.drop {
+					n, err := vm.Run(tcp(f, v6))
+					require.NoError(t, err)
+					require.Zero(t, n, f.String())
+				}
+			}
+		})
+	}
+
+	t.Run("dst-port", func(t *testing.T) {
+		vm, err := xbpf.NewVM(bpf.FilterDstPortAndTCPFlags(dst.Port(), bpf.TCPFlagsAll, syn|ack))
+		require.NoError(t, err)
+
+		n, err := vm.Run(tcp(syn|ack, false))
+		require.NoError(t, err)
+		require.Equal(t, 0xffff, n)
+
+		ip := test.RandTCP(t, netip.AddrPortFrom(test.RandIP(), test.RandPort()), netip.AddrPortFrom(test.RandIP(), 80))
+		header.TCP(ip[header.IPv4(ip).HeaderLength():]).SetFlags(uint8(syn | ack))
+		n, err = vm.Run(ip)
+		require.NoError(t, err)
+		require.Zero(t, n)
+	})
+
+	t.Run("with", func(t *testing.T) {
+		vm, err := xbpf.NewVM(bpf.WithTCPFlags(rst, 0, bpf.FilterDstPort(dst.Port())))
+		require.NoError(t, err)
+
+		n, err := vm.Run(tcp(ack, false))
+		require.NoError(t, err)
+		require.Equal(t, 0xffff, n)
+		n, err = vm.Run(tcp(rst, false))
+		require.NoError(t, err)
+		require.Zero(t, n)
+	})
+}
@@ -0,0 +1,54 @@
+// Package bufpool fixed size packet buffers, preallocated at init and
+// reused by Put, unlike sync.Pool, buffers are not released by GC, so the
+// hot path never allocate after warm up.
+package bufpool
+
+import (
+	"github.com/lysShub/netkit/packet"
+)
+
+type Pool struct {
+	head, size int
+	free       chan *packet.Packet
+}
+
+// New preallocate n buffers, every buffer has head bytes headroom and
+// size bytes data section.
+func New(head, size, n int) *Pool {
+	var p = &Pool{
+		head: head,
+		size: size,
+		free: make(chan *packet.Packet, n),
+	}
+	for i := 0; i < n; i++ {
+		p.free <- packet.Make(head, size)
+	}
+	return p
+}
+
+// Get get a buffer with data section size bytes, alloc if no free buffer
+func (p *Pool) Get() *packet.Packet {
+	select {
+	case pkt := <-p.free:
+		return pkt.Sets(p.head, p.size)
+	default:
+		return packet.Make(p.head, p.size)
+	}
+}
+
+// Put return buffer, it's dropped if pool full or it's not come from Get
+func (p *Pool) Put(pkt *packet.Packet) {
+	if pkt == nil || pkt.Head()+pkt.Data()+pkt.Tail() < p.head+p.size {
+		return
+	}
+	select {
+	case p.free <- pkt:
+	default:
+	}
+}
+
+// Size data section size of buffer
+func (p *Pool) Size() int { return p.size }
+
+// Free buffers can be got without alloc
+func (p *Pool) Free() int { return len(p.free) }
@@ -0,0 +1,37 @@
+package bufpool_test
+
+import (
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Pool(t *testing.T) {
+	p := bufpool.New(64, 1500, 2)
+	require.Equal(t, 2, p.Free())
+
+	a, b, c := p.Get(), p.Get(), p.Get()
+	require.Zero(t, p.Free())
+	for _, pkt := range []*packet.Packet{a, b, c} {
+		require.Equal(t, 64, pkt.Head())
+		require.Equal(t, 1500, pkt.Data())
+	}
+
+	a.SetHead(84).SetData(100)
+	p.Put(a)
+	p.Put(b)
+	p.Put(c) // pool full
+	require.Equal(t, 2, p.Free())
+
+	pkt := p.Get()
+	require.Equal(t, 64, pkt.Head())
+	require.Equal(t, 1500, pkt.Data())
+
+	p.Put(packet.Make(64, 100)) // too small
+	require.Equal(t, 1, p.Free())
+
+	allocs := testing.AllocsPerRun(100, func() { p.Put(p.Get()) })
+	require.Zero(t, allocs)
+}
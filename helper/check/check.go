@@ -0,0 +1,204 @@
+// Package check validate ip packet and it's transport, the same checks used
+// by this module's tests, so application layered on RawConn can reuse them.
+package check
+
+import (
+	"fmt"
+
+	"github.com/lysShub/rawsock/helper/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Reason uint8
+
+const (
+	_ Reason = iota
+	Version
+	HeaderLength      // ip header or extension header truncated/invalid
+	TotalLength       // ip total length not equal packet length
+	IPChecksum        // ipv4 header checksum
+	TransportLength   // transport header truncated/invalid
+	TransportChecksum // transport checksum with pseudo header
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Version:
+		return "version"
+	case HeaderLength:
+		return "header length"
+	case TotalLength:
+		return "total length"
+	case IPChecksum:
+		return "ip checksum"
+	case TransportLength:
+		return "transport length"
+	case TransportChecksum:
+		return "transport checksum"
+	default:
+		return fmt.Sprintf("reason(%d)", uint8(r))
+	}
+}
+
+// Error what failed, Want and Got is length or checksum of the field
+type Error struct {
+	Reason    Reason
+	Want, Got int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s, want %d, got %d", e.Reason, e.Want, e.Got)
+}
+
+type Result struct {
+	Version   int
+	HeaderLen int // ip header length, include ipv6 extension headers
+	TotalLen  int
+	Proto     tcpip.TransportProtocolNumber
+
+	// fragment packet, transport of non-first fragment not validated
+	Fragment bool
+	// first fragment or not fragment, transport header start at HeaderLen
+	First bool
+}
+
+// IP validate ip header, the ipv6 extension headers are skipped
+func IP(ip []byte) (Result, error) {
+	var r = Result{Version: header.IPVersion(ip)}
+	switch r.Version {
+	case 4:
+		if len(ip) < header.IPv4MinimumSize {
+			return r, &Error{HeaderLength, header.IPv4MinimumSize, len(ip)}
+		}
+		hdr := header.IPv4(ip)
+		r.HeaderLen, r.TotalLen = int(hdr.HeaderLength()), int(hdr.TotalLength())
+		if r.HeaderLen < header.IPv4MinimumSize || r.HeaderLen > len(ip) {
+			return r, &Error{HeaderLength, r.HeaderLen, len(ip)}
+		} else if r.TotalLen != len(ip) {
+			return r, &Error{TotalLength, r.TotalLen, len(ip)}
+		} else if !hdr.IsChecksumValid() {
+			return r, &Error{IPChecksum, 0xffff, int(checksum.Checksum(hdr[:r.HeaderLen], 0))}
+		}
+		r.Proto = hdr.TransportProtocol()
+		r.Fragment = hdr.More() || hdr.FragmentOffset() != 0
+		r.First = hdr.FragmentOffset() == 0
+		return r, nil
+	case 6:
+		if len(ip) < header.IPv6MinimumSize {
+			return r, &Error{HeaderLength, header.IPv6MinimumSize, len(ip)}
+		}
+		hdr := header.IPv6(ip)
+		r.TotalLen = int(hdr.PayloadLength()) + header.IPv6MinimumSize
+		if r.TotalLen != len(ip) {
+			return r, &Error{TotalLength, r.TotalLen, len(ip)}
+		}
+		return r, skipExtHdrs(hdr, &r)
+	default:
+		return r, &Error{Version, 4, r.Version}
+	}
+}
+
+func skipExtHdrs(ip header.IPv6, r *Result) error {
+	var (
+		proto   = ip.TransportProtocol()
+		payload = ip.Payload()
+	)
+	r.HeaderLen, r.First = header.IPv6MinimumSize, true
+	for {
+		switch header.IPv6ExtensionHeaderIdentifier(proto) {
+		case header.IPv6HopByHopOptionsExtHdrIdentifier,
+			header.IPv6RoutingExtHdrIdentifier,
+			header.IPv6DestinationOptionsExtHdrIdentifier:
+
+			if len(payload) < 8 {
+				return &Error{HeaderLength, r.HeaderLen + 8, len(ip)}
+			}
+			n := (int(payload[1]) + 1) * 8
+			if len(payload) < n {
+				return &Error{HeaderLength, r.HeaderLen + n, len(ip)}
+			}
+			proto, payload = tcpip.TransportProtocolNumber(payload[0]), payload[n:]
+			r.HeaderLen += n
+		case header.IPv6FragmentExtHdrIdentifier:
+			const n = header.IPv6FragmentExtHdrLength
+			if len(payload) < n {
+				return &Error{HeaderLength, r.HeaderLen + n, len(ip)}
+			}
+			frag := header.IPv6FragmentExtHdr(payload[2:n])
+			r.Fragment = r.Fragment || frag.More() || frag.FragmentOffset() != 0
+			r.First = frag.FragmentOffset() == 0
+			proto, payload = tcpip.TransportProtocolNumber(payload[0]), payload[n:]
+			r.HeaderLen += n
+			if !r.First {
+				// only contain upper-layer data
+				r.Proto = proto
+				return nil
+			}
+		default:
+			r.Proto = proto
+			return nil
+		}
+	}
+}
+
+// Packet validate ip packet and it's transport checksum, transport of
+// fragment packet is not validated, unknown transport only validate ip.
+func Packet(ip []byte) (Result, error) {
+	r, err := IP(ip)
+	if err != nil || r.Fragment {
+		return r, err
+	}
+
+	var src, dst tcpip.Address
+	if r.Version == 4 {
+		src, dst = header.IPv4(ip).SourceAddress(), header.IPv4(ip).DestinationAddress()
+	} else {
+		src, dst = header.IPv6(ip).SourceAddress(), header.IPv6(ip).DestinationAddress()
+	}
+	pseudoSum1 := header.PseudoHeaderChecksum(r.Proto, src, dst, 0)
+	return r, Transport(r.Proto, ip[r.HeaderLen:], pseudoSum1)
+}
+
+// Transport validate transport header and checksum, pseudoSum1 is pseudo
+// header checksum without length, ignored by ICMPv4. unknown proto is valid.
+func Transport(proto tcpip.TransportProtocolNumber, b []byte, pseudoSum1 uint16) error {
+	var min int
+	switch proto {
+	case header.TCPProtocolNumber:
+		if len(b) >= header.TCPMinimumSize {
+			if off := int(header.TCP(b).DataOffset()); off < header.TCPMinimumSize || off > len(b) {
+				return &Error{TransportLength, off, len(b)}
+			}
+		}
+		min = header.TCPMinimumSize
+	case header.UDPProtocolNumber:
+		if len(b) >= header.UDPMinimumSize {
+			if n := int(header.UDP(b).Length()); n != len(b) {
+				return &Error{TransportLength, n, len(b)}
+			}
+		}
+		min = header.UDPMinimumSize
+	case header.ICMPv4ProtocolNumber:
+		if len(b) < header.ICMPv4MinimumSize {
+			return &Error{TransportLength, header.ICMPv4MinimumSize, len(b)}
+		}
+		if sum := checksum.Checksum(b, 0); sum != 0xffff {
+			return &Error{TransportChecksum, 0xffff, int(sum)}
+		}
+		return nil
+	case header.ICMPv6ProtocolNumber:
+		min = header.ICMPv6MinimumSize
+	default:
+		return nil
+	}
+	if len(b) < min {
+		return &Error{TransportLength, min, len(b)}
+	}
+
+	psum := checksum.Combine(pseudoSum1, uint16(len(b)))
+	if sum := checksum.Checksum(b, psum); sum != 0xffff {
+		return &Error{TransportChecksum, 0xffff, int(sum)}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package check_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/check"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Packet(t *testing.T) {
+	var (
+		src  = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst  = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		src6 = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+		dst6 = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+	)
+
+	t.Run("valid", func(t *testing.T) {
+		r, err := check.Packet(test.RandTCP(t, src, dst))
+		require.NoError(t, err)
+		require.Equal(t, check.Result{
+			Version: 4, HeaderLen: header.IPv4MinimumSize, TotalLen: r.TotalLen,
+			Proto: header.TCPProtocolNumber, First: true,
+		}, r)
+
+		ip := test.RandUDP(t, src6, dst6, header.IPv6DestinationOptionsExtHdrIdentifier)
+		r, err = check.Packet(ip)
+		require.NoError(t, err)
+		require.Equal(t, 6, r.Version)
+		require.Equal(t, header.UDPProtocolNumber, r.Proto)
+		require.Greater(t, r.HeaderLen, header.IPv6MinimumSize)
+		require.Equal(t, len(ip), r.TotalLen)
+
+		_, err = check.Packet(test.RandICMP(t, src.Addr(), dst.Addr()))
+		require.NoError(t, err)
+	})
+
+	t.Run("fragment", func(t *testing.T) {
+		ip := test.RandUDP(t, src, dst)
+		for len(ip) < 256 {
+			ip = test.RandUDP(t, src, dst)
+		}
+		frags := test.Fragment(t, ip, 100)
+		for i, frag := range frags {
+			r, err := check.Packet(frag)
+			require.NoError(t, err)
+			require.True(t, r.Fragment)
+			require.Equal(t, i == 0, r.First)
+		}
+	})
+
+	var reason = func(t *testing.T, err error) check.Reason {
+		e, ok := err.(*check.Error)
+		require.True(t, ok, err)
+		return e.Reason
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := check.Packet([]byte{0x50, 0, 0, 0})
+		require.Equal(t, check.Version, reason(t, err))
+
+		ip := header.IPv4(test.RandTCP(t, src, dst))
+		_, err = check.Packet(ip[:len(ip)-1])
+		require.Equal(t, check.TotalLength, reason(t, err))
+
+		_, err = check.Packet(ip[:10])
+		require.Equal(t, check.HeaderLength, reason(t, err))
+
+		ip.SetTTL(ip.TTL() + 1)
+		_, err = check.Packet(ip)
+		require.Equal(t, check.IPChecksum, reason(t, err))
+
+		ip = header.IPv4(test.RandTCP(t, src, dst))
+		ip.Payload()[header.TCPDataOffset] = 0x40 // 16 bytes
+		_, err = check.Packet(ip)
+		require.Equal(t, check.TransportLength, reason(t, err))
+
+		ip = header.IPv4(test.RandUDP(t, src, dst))
+		header.UDP(ip.Payload()).SetChecksum(header.UDP(ip.Payload()).Checksum() + 1)
+		_, err = check.Packet(ip)
+		require.Equal(t, check.TransportChecksum, reason(t, err))
+	})
+}
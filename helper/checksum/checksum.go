@@ -0,0 +1,67 @@
+// Package checksum RFC 1071 internet checksum, result same as gvisor
+// checksum.Checksum, but sum 32 bytes per loop by two independent carry
+// chains, it's faster than gvisor's ADC assembly on amd64 and it's noasm
+// loop on other archs, see Benchmark_Checksum.
+package checksum
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Combine one's complement add
+func Combine(a, b uint16) uint16 {
+	v := uint32(a) + uint32(b)
+	return uint16(v + v>>16)
+}
+
+// Checksum one's complement sum of b (not inverted), initial must be sum of
+// even number of bytes. utilize byte order independence of RFC 1071 1.2:
+// sum little endian words and swap the folded result.
+func Checksum(b []byte, initial uint16) uint16 {
+	var (
+		s0, s1 = uint64(bits.ReverseBytes16(initial)), uint64(0)
+		c0, c1 uint64
+	)
+	for len(b) >= 32 {
+		s0, c0 = bits.Add64(s0, binary.LittleEndian.Uint64(b[0:]), c0)
+		s1, c1 = bits.Add64(s1, binary.LittleEndian.Uint64(b[8:]), c1)
+		s0, c0 = bits.Add64(s0, binary.LittleEndian.Uint64(b[16:]), c0)
+		s1, c1 = bits.Add64(s1, binary.LittleEndian.Uint64(b[24:]), c1)
+		b = b[32:]
+	}
+	for len(b) >= 8 {
+		s0, c0 = bits.Add64(s0, binary.LittleEndian.Uint64(b), c0)
+		b = b[8:]
+	}
+	if len(b) >= 4 {
+		s1, c1 = bits.Add64(s1, uint64(binary.LittleEndian.Uint32(b)), c1)
+		b = b[4:]
+	}
+	if len(b) >= 2 {
+		s1, c1 = bits.Add64(s1, uint64(binary.LittleEndian.Uint16(b)), c1)
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		// odd last byte is high byte in network order
+		s1, c1 = bits.Add64(s1, uint64(b[0]), c1)
+	}
+
+	var c uint64
+	s0, c = bits.Add64(s0, s1, c0)
+	s0, c = bits.Add64(s0, c1, c)
+	s0 += c // can't overflow again
+
+	// fold to 16 bits
+	s := (s0 >> 32) + (s0 & 0xffffffff)
+	s = (s >> 16) + (s & 0xffff)
+	s = (s >> 16) + (s & 0xffff)
+	s = (s >> 16) + (s & 0xffff)
+	return bits.ReverseBytes16(uint16(s))
+}
+
+// IPv4 header checksum helper: sum of template header (zero total length,
+// id and checksum), then per packet only combine the dynamic fields
+func IPv4(static, totalLen, id uint16) uint16 {
+	return Combine(Combine(static, totalLen), id)
+}
@@ -0,0 +1,72 @@
+package checksum_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/stretchr/testify/require"
+	gchecksum "gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Checksum(t *testing.T) {
+	var r = rand.New(rand.NewSource(1))
+	var b = make([]byte, 9100)
+
+	for n := 0; n < 300; n++ {
+		r.Read(b)
+		for _, off := range []int{0, 1, 3} {
+			initial := uint16(r.Uint32())
+			expect := gchecksum.Checksum(b[off:off+n], initial)
+			require.Equal(t, expect, checksum.Checksum(b[off:off+n], initial), n)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		n := r.Intn(len(b))
+		r.Read(b[:n])
+		initial := uint16(r.Uint32())
+		require.Equal(t, gchecksum.Checksum(b[:n], initial), checksum.Checksum(b[:n], initial), n)
+	}
+
+	// all ones, carry overflow
+	for i := range b {
+		b[i] = 0xff
+	}
+	require.Equal(t, gchecksum.Checksum(b, 0xffff), checksum.Checksum(b, 0xffff))
+}
+
+func Test_IPv4(t *testing.T) {
+	var hdr = header.IPv4(make([]byte, header.IPv4MinimumSize))
+	hdr.Encode(&header.IPv4Fields{
+		TTL: 64, Protocol: 6,
+		SrcAddr: header.IPv4Any, DstAddr: header.IPv4Broadcast,
+	})
+	static := checksum.Checksum(hdr, 0)
+
+	hdr.SetTotalLength(1234)
+	hdr.SetID(0xfedc)
+	hdr.SetChecksum(^checksum.IPv4(static, 1234, 0xfedc))
+	require.True(t, hdr.IsChecksumValid())
+}
+
+func Benchmark_Checksum(b *testing.B) {
+	for _, n := range []int{20, 64, 576, 1500, 9000} {
+		var data = make([]byte, n)
+		rand.New(rand.NewSource(1)).Read(data)
+
+		b.Run(fmt.Sprintf("gvisor/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				gchecksum.Checksum(data, 0)
+			}
+		})
+		b.Run(fmt.Sprintf("unrolled/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				checksum.Checksum(data, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+//go:build linux
+// +build linux
+
+package cmsg
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Size oob buffer size for read control messages
+const Size = 256
+
+// SetTimestamp enable receive timestamp, hardware timestamp need nic
+// support and enabled by SIOCSHWTSTAMP, otherwise fallback to software
+func SetTimestamp(raw syscall.RawConn, hardware bool) error {
+	flags := unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE
+	if hardware {
+		flags |= unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+	}
+
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPING, flags)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// SetAncillary enable receive ttl, tos and pktinfo control messages
+func SetAncillary(raw syscall.RawConn, ipv4 bool) error {
+	var opts = [][2]int{
+		{unix.IPPROTO_IP, unix.IP_RECVTTL},
+		{unix.IPPROTO_IP, unix.IP_RECVTOS},
+		{unix.IPPROTO_IP, unix.IP_PKTINFO},
+	}
+	if !ipv4 {
+		opts = [][2]int{
+			{unix.IPPROTO_IPV6, unix.IPV6_RECVHOPLIMIT},
+			{unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS},
+			{unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO},
+		}
+	}
+
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		for _, opt := range opts {
+			if e = unix.SetsockoptInt(int(fd), opt[0], opt[1], 1); e != nil {
+				return
+			}
+		}
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// SetAuxData enable receive PACKET_AUXDATA control message of AF_PACKET
+// socket, carry vlan tag stripped by kernel
+func SetAuxData(raw syscall.RawConn) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.SetsockoptInt(int(fd), unix.SOL_PACKET, unix.PACKET_AUXDATA, 1)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
+
+// ParseFrame parse PACKET_AUXDATA control message into frame
+func ParseFrame(oob []byte, frame *rawsock.Frame) error {
+	if len(oob) == 0 {
+		return nil
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, msg := range msgs {
+		if msg.Header.Level != unix.SOL_PACKET || msg.Header.Type != unix.PACKET_AUXDATA ||
+			len(msg.Data) < int(unsafe.Sizeof(unix.TpacketAuxdata{})) {
+			continue
+		}
+		aux := (*unix.TpacketAuxdata)(unsafe.Pointer(&msg.Data[0]))
+		frame.VLAN = 0
+		if aux.Status&unix.TP_STATUS_VLAN_VALID != 0 {
+			frame.VLAN = aux.Vlan_tci
+		}
+	}
+	return nil
+}
+
+// Parse parse socket control messages into meta
+func Parse(oob []byte, meta *rawsock.Meta) error {
+	if len(oob) == 0 {
+		return nil
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, msg := range msgs {
+		switch msg.Header.Level {
+		case unix.SOL_SOCKET:
+			if msg.Header.Type == unix.SCM_TIMESTAMPING {
+				meta.Time = timestamping(msg.Data)
+			}
+		case unix.IPPROTO_IP:
+			switch msg.Header.Type {
+			case unix.IP_TTL:
+				meta.TTL = uint8(integer(msg.Data))
+			case unix.IP_TOS:
+				if len(msg.Data) > 0 {
+					meta.TOS = msg.Data[0]
+				}
+			case unix.IP_PKTINFO:
+				if len(msg.Data) >= unix.SizeofInet4Pktinfo {
+					info := (*unix.Inet4Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+					meta.Dst = netip.AddrFrom4(info.Addr)
+					meta.Ifidx = int(info.Ifindex)
+				}
+			}
+		case unix.IPPROTO_IPV6:
+			switch msg.Header.Type {
+			case unix.IPV6_HOPLIMIT:
+				meta.TTL = uint8(integer(msg.Data))
+			case unix.IPV6_TCLASS:
+				meta.TOS = uint8(integer(msg.Data))
+			case unix.IPV6_PKTINFO:
+				if len(msg.Data) >= unix.SizeofInet6Pktinfo {
+					info := (*unix.Inet6Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+					meta.Dst = netip.AddrFrom16(info.Addr)
+					meta.Ifidx = int(info.Ifindex)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// integer parse native endian int control message
+func integer(data []byte) uint32 {
+	if len(data) < 4 {
+		return 0
+	}
+	return binary.NativeEndian.Uint32(data)
+}
+
+// timestamping parse struct scm_timestamping, prefer hardware timestamp
+func timestamping(data []byte) time.Time {
+	const size = int(unsafe.Sizeof(unix.Timespec{}))
+	if len(data) < size*3 {
+		return time.Time{}
+	}
+
+	ts := (*[3]unix.Timespec)(unsafe.Pointer(&data[0]))
+	for _, i := range []int{2, 0} {
+		if ts[i].Sec != 0 || ts[i].Nsec != 0 {
+			return time.Unix(ts[i].Unix())
+		}
+	}
+	return time.Time{}
+}
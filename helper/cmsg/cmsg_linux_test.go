@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+package cmsg_test
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/lysShub/netkit/eth"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/cmsg"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_Timestamp(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+	require.NoError(t, cmsg.SetTimestamp(raw, false))
+
+	start := time.Now()
+	_, err = conn.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+
+	var b, oob = make([]byte, 64), make([]byte, cmsg.Size)
+	_, oobn, _, _, err := conn.ReadMsgUDP(b, oob)
+	require.NoError(t, err)
+
+	var meta rawsock.Meta
+	require.NoError(t, cmsg.Parse(oob[:oobn], &meta))
+	require.False(t, meta.Time.Before(start.Add(-time.Millisecond)))
+	require.Less(t, meta.Time.Sub(start), time.Second)
+}
+
+func Test_Ancillary(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+	require.NoError(t, cmsg.SetAncillary(raw, true))
+
+	_, err = conn.WriteToUDP([]byte("hello"), conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+
+	var b, oob = make([]byte, 64), make([]byte, cmsg.Size)
+	_, oobn, _, _, err := conn.ReadMsgUDP(b, oob)
+	require.NoError(t, err)
+
+	var meta rawsock.Meta
+	require.NoError(t, cmsg.Parse(oob[:oobn], &meta))
+	require.Equal(t, uint8(64), meta.TTL)
+	require.Equal(t, uint8(0), meta.TOS)
+	require.Equal(t, netip.MustParseAddr("127.0.0.1"), meta.Dst)
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	require.Equal(t, lo.Index, meta.Ifidx)
+}
+
+func Test_ParseFrame(t *testing.T) {
+	t.Run("vlan", func(t *testing.T) {
+		var aux = unix.TpacketAuxdata{
+			Status:   unix.TP_STATUS_VLAN_VALID,
+			Vlan_tci: 0x2064, // priority 1, vid 100
+		}
+		size := int(unsafe.Sizeof(aux))
+		oob := make([]byte, unix.CmsgSpace(size))
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		h.Level, h.Type = unix.SOL_PACKET, unix.PACKET_AUXDATA
+		h.SetLen(unix.CmsgLen(size))
+		copy(oob[unix.CmsgLen(0):], unsafe.Slice((*byte)(unsafe.Pointer(&aux)), size))
+
+		var frame rawsock.Frame
+		require.NoError(t, cmsg.ParseFrame(oob, &frame))
+		require.Equal(t, uint16(0x2064), frame.VLAN)
+		require.Equal(t, uint16(100), frame.VID())
+	})
+
+	t.Run("untagged", func(t *testing.T) {
+		lo, err := net.InterfaceByName("lo")
+		require.NoError(t, err)
+		proto := eth.Htons(unix.ETH_P_IP)
+		fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+		require.NoError(t, err)
+		defer unix.Close(fd)
+		require.NoError(t, unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: uint16(proto), Ifindex: lo.Index}))
+		require.NoError(t, unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1}))
+		f := os.NewFile(uintptr(fd), "")
+		raw, err := f.SyscallConn()
+		require.NoError(t, err)
+		require.NoError(t, cmsg.SetAuxData(raw))
+
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9})
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+
+		var b, oob = make([]byte, 1536), make([]byte, cmsg.Size)
+		_, oobn, _, _, err := unix.Recvmsg(fd, b, oob, 0)
+		require.NoError(t, err)
+		require.NotZero(t, oobn)
+
+		var frame = rawsock.Frame{VLAN: 1}
+		require.NoError(t, cmsg.ParseFrame(oob[:oobn], &frame))
+		require.Zero(t, frame.VLAN)
+	})
+}
@@ -0,0 +1,218 @@
+package coalesce
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	MaxSize int // max merged tcp packet size
+	MaxSegs int // max segments merged into a packet
+	Queue   int // received but not read packets
+	MTU     int // read buffer size of every segment
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		MaxSize: 0xffff,
+		MaxSegs: 64,
+		Queue:   128,
+		MTU:     1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MaxSize max merged tcp packet size, default 65535
+func MaxSize(size int) Option {
+	return func(c *Config) {
+		c.MaxSize = size
+	}
+}
+
+// MaxSegs max segments merged into a packet, default 64
+func MaxSegs(n int) Option {
+	return func(c *Config) {
+		c.MaxSegs = max(n, 1)
+	}
+}
+
+// Queue received but not read packets queue size, default 128
+func Queue(n int) Option {
+	return func(c *Config) {
+		c.Queue = max(n, 0)
+	}
+}
+
+// MTU read buffer size of every segment, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+type Stats struct {
+	Packets  uint64 // packets returned by Read
+	Segments uint64 // segments received from child
+}
+
+// Conn merge consecutive in-order tcp segments into one larger packet when
+// Read, like GRO. Only merge segments that already received, never wait for
+// next segment. Read isn't concurrent safe.
+type Conn struct {
+	rawsock.RawConn
+	cfg *Config
+
+	psum    uint16
+	bufs    *bufpool.Pool // segment buffers, recycled after merged
+	buff    chan *packet.Packet
+	pending *packet.Packet
+	err     error // valid after buff closed
+
+	packets, segments atomic.Uint64
+
+	done     chan struct{}
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, opts ...Option) *Conn {
+	var c = &Conn{
+		RawConn: child,
+		cfg:     Options(opts...),
+		psum: header.PseudoHeaderChecksum(
+			header.TCPProtocolNumber,
+			addr(child.RemoteAddr().Addr()), addr(child.LocalAddr().Addr()), 0,
+		),
+		done: make(chan struct{}),
+	}
+	c.buff = make(chan *packet.Packet, c.cfg.Queue)
+	// queued, pending and the one being read
+	c.bufs = bufpool.New(0, c.cfg.MTU, c.cfg.Queue+2)
+
+	go c.recvService()
+	return c
+}
+
+func addr(a netip.Addr) tcpip.Address { return tcpip.AddrFromSlice(a.AsSlice()) }
+
+func (c *Conn) recvService() {
+	defer close(c.buff)
+	for {
+		var pkt = c.bufs.Get()
+		if err := c.RawConn.Read(pkt); err != nil {
+			c.bufs.Put(pkt)
+			c.err = err
+			return
+		}
+		c.segments.Add(1)
+
+		select {
+		case c.buff <- pkt:
+		case <-c.done:
+			c.bufs.Put(pkt)
+			c.err = errors.WithStack(net.ErrClosed)
+			return
+		}
+	}
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	var seg = c.pending
+	c.pending = nil
+	if seg == nil {
+		var ok bool
+		if seg, ok = <-c.buff; !ok {
+			return c.err
+		}
+	}
+
+	size := min(pkt.Data(), c.cfg.MaxSize)
+	if pkt.Data() < seg.Data() {
+		c.bufs.Put(seg)
+		return errorx.ShortBuff(seg.Data(), pkt.Data())
+	}
+	pkt.SetData(0).Append(seg.Bytes()...)
+	c.bufs.Put(seg)
+	c.packets.Add(1)
+
+	var merged bool
+loop:
+	for i := 1; i < c.cfg.MaxSegs; i++ {
+		select {
+		case seg, ok := <-c.buff:
+			if !ok {
+				break loop
+			} else if !mergeable(pkt.Bytes(), seg.Bytes(), size) {
+				c.pending = seg
+				break loop
+			}
+
+			tcp, next := header.TCP(pkt.Bytes()), header.TCP(seg.Bytes())
+			tcp.SetFlags(uint8(tcp.Flags() | next.Flags()))
+			tcp.SetWindowSize(next.WindowSize())
+			pkt.Append(next.Payload()...)
+			c.bufs.Put(seg)
+			merged = true
+		default:
+			break loop
+		}
+	}
+
+	if merged {
+		tcp := header.TCP(pkt.Bytes())
+		tcp.SetChecksum(0)
+		tcp.SetChecksum(^checksum.Checksum(tcp, checksum.Combine(c.psum, uint16(len(tcp)))))
+	}
+	return nil
+}
+
+// mergeable next segment can be appended to tcp, refer linux tcp_gro_receive
+func mergeable(tcp, next header.TCP, size int) bool {
+	const flush = header.TCPFlagSyn | header.TCPFlagFin | header.TCPFlagRst |
+		header.TCPFlagUrg | header.TCPFlagPsh | header.TCPFlagCwr | header.TCPFlagEce
+
+	if len(tcp)+len(next.Payload()) > size {
+		return false
+	} else if len(tcp.Payload()) == 0 || len(next.Payload()) == 0 {
+		return false
+	} else if tcp.Flags()&flush != 0 || next.Flags()&^(header.TCPFlagAck|header.TCPFlagPsh) != 0 {
+		return false
+	}
+
+	return tcp.SourcePort() == next.SourcePort() &&
+		tcp.DestinationPort() == next.DestinationPort() &&
+		tcp.AckNumber() == next.AckNumber() &&
+		tcp.SequenceNumber()+uint32(len(tcp.Payload())) == next.SequenceNumber() &&
+		bytes.Equal(tcp[header.TCPMinimumSize:tcp.DataOffset()], next[header.TCPMinimumSize:next.DataOffset()])
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		Packets:  c.packets.Load(),
+		Segments: c.segments.Load(),
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		close(c.done)
+		return []error{c.RawConn.Close()}
+	})
+}
@@ -0,0 +1,85 @@
+package coalesce_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/coalesce"
+	"github.com/lysShub/rawsock/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type mockConn struct {
+	rawsock.RawConn
+	local, remote netip.AddrPort
+	segs          chan []byte
+}
+
+func (m *mockConn) Read(pkt *packet.Packet) error {
+	seg, ok := <-m.segs
+	if !ok {
+		return errors.WithStack(net.ErrClosed)
+	}
+	pkt.SetData(0).Append(seg...)
+	return nil
+}
+func (m *mockConn) LocalAddr() netip.AddrPort  { return m.local }
+func (m *mockConn) RemoteAddr() netip.AddrPort { return m.remote }
+func (m *mockConn) Close() error               { return nil }
+
+func Test_Coalesce(t *testing.T) {
+	var m = &mockConn{
+		local:  netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		remote: netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		segs:   make(chan []byte, 16),
+	}
+	var seq uint32 = 1234
+	seg := func(flags header.TCPFlags, n int) []byte {
+		tcp := header.TCP(make([]byte, header.TCPMinimumSize+n))
+		tcp.Encode(&header.TCPFields{
+			SrcPort:    m.remote.Port(),
+			DstPort:    m.local.Port(),
+			SeqNum:     seq,
+			AckNum:     1,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      flags,
+			WindowSize: 1024,
+		})
+		copy(tcp.Payload(), test.RandPayload(n))
+		seq += uint32(n)
+		return tcp
+	}
+
+	m.segs <- seg(header.TCPFlagAck, 100)
+	m.segs <- seg(header.TCPFlagAck, 100)
+	m.segs <- seg(header.TCPFlagAck|header.TCPFlagPsh, 100)
+	m.segs <- seg(header.TCPFlagAck, 100)
+	m.segs <- seg(header.TCPFlagAck|header.TCPFlagFin, 0)
+
+	c := coalesce.Wrap(m)
+	defer c.Close()
+	require.Eventually(t, func() bool { return c.Stats().Segments == 5 }, time.Second, time.Millisecond)
+
+	var pkt = packet.Make(0, 1536)
+	require.NoError(t, c.Read(pkt))
+	tcp := header.TCP(pkt.Bytes())
+	require.Equal(t, 300, len(tcp.Payload()))
+	require.Equal(t, header.TCPFlagAck|header.TCPFlagPsh, tcp.Flags())
+	test.ValidIP(t, test.BuildIP(t, m.remote.Addr(), m.local.Addr(), header.TCPProtocolNumber, tcp))
+
+	require.NoError(t, c.Read(pkt.Sets(0, 1536)))
+	require.Equal(t, 100, len(header.TCP(pkt.Bytes()).Payload()))
+
+	require.NoError(t, c.Read(pkt.Sets(0, 1536)))
+	require.Equal(t, header.TCPFlagAck|header.TCPFlagFin, header.TCP(pkt.Bytes()).Flags())
+
+	close(m.segs)
+	require.True(t, errors.Is(c.Read(pkt.Sets(0, 1536)), net.ErrClosed))
+	require.Equal(t, coalesce.Stats{Packets: 3, Segments: 5}, c.Stats())
+}
@@ -0,0 +1,215 @@
+// Package cork queue small outbound packets, and flush them together, like
+// TCP_CORK. Consecutive tcp segments are merged into one super-packet, the
+// child RawConn should enable TSO (or MaxSize not exceed MTU).
+package cork
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	Delay      time.Duration // auto flush delay after first packet queued
+	MaxSize    int           // max merged tcp packet size
+	MaxPackets int           // max queued packets before flush
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Delay:      time.Millisecond,
+		MaxSize:    0xffff,
+		MaxPackets: 64,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Delay auto flush delay after first packet queued, default 1ms, 0 means
+// only flush manually or by limit
+func Delay(d time.Duration) Option {
+	return func(c *Config) {
+		c.Delay = d
+	}
+}
+
+// MaxSize max merged tcp packet size, default 65535
+func MaxSize(size int) Option {
+	return func(c *Config) {
+		c.MaxSize = size
+	}
+}
+
+// MaxPackets max queued packets before flush, default 64
+func MaxPackets(n int) Option {
+	return func(c *Config) {
+		c.MaxPackets = max(n, 1)
+	}
+}
+
+type Stats struct {
+	Packets uint64 // packets written by Write
+	Flushed uint64 // packets written to child
+}
+
+// Conn cork RawConn, Write queue packet copy, queued packets be written when
+// Flush called, auto flush timeout, or reach limit. Auto flush error will be
+// returned by next Write or Flush.
+type Conn struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	cfg   *Config
+	psum  uint16
+
+	mu    sync.Mutex
+	queue []*packet.Packet
+	timer *time.Timer
+	err   error
+
+	packets, flushed atomic.Uint64
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, opts ...Option) *Conn {
+	var c = &Conn{
+		RawConn: child,
+		proto:   proto,
+		cfg:     Options(opts...),
+		psum: header.PseudoHeaderChecksum(
+			proto,
+			addr(child.LocalAddr().Addr()), addr(child.RemoteAddr().Addr()), 0,
+		),
+	}
+	return c
+}
+
+func addr(a netip.Addr) tcpip.Address { return tcpip.AddrFromSlice(a.AsSlice()) }
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.packets.Add(1)
+
+	if n := len(c.queue); n > 0 && c.proto == header.TCPProtocolNumber &&
+		mergeable(c.queue[n-1].Bytes(), pkt.Bytes(), c.cfg.MaxSize) {
+
+		last := c.queue[n-1]
+		tcp, next := header.TCP(last.Bytes()), header.TCP(pkt.Bytes())
+		tcp.SetFlags(uint8(tcp.Flags() | next.Flags()))
+		tcp.SetWindowSize(next.WindowSize())
+		last.Append(next.Payload()...)
+	} else {
+		c.queue = append(c.queue, pkt.Clone())
+	}
+
+	if len(c.queue) >= c.cfg.MaxPackets {
+		return c.flushLocked()
+	} else if c.cfg.Delay > 0 && c.timer == nil {
+		c.timer = time.AfterFunc(c.cfg.Delay, c.autoFlush)
+	}
+	return nil
+}
+
+// mergeable next segment can be appended to tcp
+func mergeable(tcp, next header.TCP, size int) bool {
+	const flush = header.TCPFlagSyn | header.TCPFlagFin | header.TCPFlagRst |
+		header.TCPFlagUrg | header.TCPFlagCwr | header.TCPFlagEce
+
+	if len(tcp) < header.TCPMinimumSize || len(next) < header.TCPMinimumSize {
+		return false
+	} else if len(tcp)+len(next.Payload()) > size {
+		return false
+	} else if len(tcp.Payload()) == 0 || len(next.Payload()) == 0 {
+		return false
+	} else if tcp.Flags()&flush != 0 || next.Flags()&flush != 0 {
+		return false
+	}
+
+	return tcp.SourcePort() == next.SourcePort() &&
+		tcp.DestinationPort() == next.DestinationPort() &&
+		tcp.AckNumber() == next.AckNumber() &&
+		tcp.SequenceNumber()+uint32(len(tcp.Payload())) == next.SequenceNumber() &&
+		bytes.Equal(tcp[header.TCPMinimumSize:tcp.DataOffset()], next[header.TCPMinimumSize:next.DataOffset()])
+}
+
+func (c *Conn) autoFlush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer = nil
+	if c.err == nil {
+		c.err = c.flushLocked()
+	}
+}
+
+// Flush write all queued packets
+func (c *Conn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.flushLocked()
+}
+
+func (c *Conn) flushLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	for i, pkt := range c.queue {
+		c.queue[i] = nil
+		if c.proto == header.TCPProtocolNumber && len(pkt.Bytes()) >= header.TCPMinimumSize {
+			ipstack.Checksum(c.proto, pkt.Bytes(), c.psum)
+		}
+		if err := c.RawConn.Write(pkt); err != nil {
+			c.queue = c.queue[:0]
+			return err
+		}
+		c.flushed.Add(1)
+	}
+	c.queue = c.queue[:0]
+	return nil
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		Packets: c.packets.Load(),
+		Flushed: c.flushed.Load(),
+	}
+}
+
+// Close flush queued packets and close
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, c.Flush())
+
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = errors.WithStack(net.ErrClosed)
+		}
+		c.mu.Unlock()
+		return append(errs, c.RawConn.Close())
+	})
+}
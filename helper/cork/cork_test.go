@@ -0,0 +1,70 @@
+package cork_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/cork"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Cork(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	t.Run("merge", func(t *testing.T) {
+		c, s := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+		conn := cork.Wrap(c, header.TCPProtocolNumber, cork.Delay(0))
+		defer conn.Close()
+
+		var seq uint32 = 1000
+		for _, payload := range []string{"hello", " ", "world"} {
+			tcp := header.TCP(make([]byte, header.TCPMinimumSize+len(payload)))
+			tcp.Encode(&header.TCPFields{
+				SrcPort:    caddr.Port(),
+				DstPort:    saddr.Port(),
+				SeqNum:     seq,
+				AckNum:     1,
+				DataOffset: header.TCPMinimumSize,
+				Flags:      header.TCPFlagAck | header.TCPFlagPsh,
+				WindowSize: 1024,
+			})
+			copy(tcp.Payload(), payload)
+			seq += uint32(len(payload))
+			require.NoError(t, conn.Write(packet.Make(64).Append(tcp...)))
+		}
+		require.NoError(t, conn.Flush())
+		require.Equal(t, cork.Stats{Packets: 3, Flushed: 1}, conn.Stats())
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, s.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.TCPProtocolNumber, pkt.Bytes()))
+		tcp := header.TCP(pkt.Bytes())
+		require.Equal(t, uint32(1000), tcp.SequenceNumber())
+		require.Equal(t, "hello world", string(tcp.Payload()))
+	})
+
+	t.Run("auto flush", func(t *testing.T) {
+		c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		conn := cork.Wrap(c, header.UDPProtocolNumber, cork.Delay(time.Millisecond*50))
+		defer conn.Close()
+
+		for i := 0; i < 2; i++ {
+			udp := test.StripIP(test.RandUDP(t, caddr, saddr))
+			require.NoError(t, conn.Write(packet.Make(64).Append(udp...)))
+		}
+		require.Zero(t, conn.Stats().Flushed)
+
+		time.Sleep(time.Millisecond * 100)
+		require.Equal(t, uint64(2), conn.Stats().Flushed)
+		for i := 0; i < 2; i++ {
+			require.NoError(t, s.Read(packet.Make(0, 1536)))
+		}
+	})
+}
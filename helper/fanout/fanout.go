@@ -0,0 +1,209 @@
+// Package fanout share a RawConn by multiple readers, in Broadcast mode every
+// reader get every packet, in Shared mode readers share a queue, every packet
+// is delivered to one of them.
+package fanout
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+)
+
+type Mode uint8
+
+const (
+	Broadcast Mode = iota
+	Shared
+)
+
+type Config struct {
+	Mode  Mode
+	Queue int // queue size of every reader, or the shared queue
+	MTU   int // read buffer size
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Mode:  Broadcast,
+		Queue: 64,
+		MTU:   1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithMode fanout mode, default Broadcast
+func WithMode(mode Mode) Option {
+	return func(c *Config) {
+		c.Mode = mode
+	}
+}
+
+// Queue queue size, default 64, when a Broadcast reader's queue is full,
+// packet is dropped for it, not block other readers
+func Queue(n int) Option {
+	return func(c *Config) {
+		c.Queue = max(n, 1)
+	}
+}
+
+// MTU read buffer size, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+type Fanout struct {
+	child rawsock.RawConn
+	cfg   *Config
+
+	mu      sync.RWMutex
+	readers map[*Reader]struct{}
+	shared  chan *packet.Packet // Shared mode queue
+	err     error               // valid after done closed
+
+	closing  chan struct{}
+	done     chan struct{} // recvService exited
+	closeErr errorx.CloseErr
+}
+
+func New(child rawsock.RawConn, opts ...Option) *Fanout {
+	var f = &Fanout{
+		child:   child,
+		cfg:     Options(opts...),
+		readers: map[*Reader]struct{}{},
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if f.cfg.Mode == Shared {
+		f.shared = make(chan *packet.Packet, f.cfg.Queue)
+	}
+	go f.recvService()
+	return f
+}
+
+func (f *Fanout) recvService() {
+	var err error
+	defer func() {
+		f.mu.Lock()
+		f.err = err
+		close(f.done)
+		f.mu.Unlock()
+	}()
+
+	for {
+		var pkt = packet.Make(0, f.cfg.MTU)
+		if err = f.child.Read(pkt); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			return
+		}
+
+		if f.shared != nil {
+			select {
+			case f.shared <- pkt:
+			case <-f.closing:
+				err = errors.WithStack(net.ErrClosed)
+				return
+			}
+			continue
+		}
+
+		f.mu.RLock()
+		for r := range f.readers {
+			select {
+			case r.queue <- pkt: // readers only read the packet
+			default:
+				r.dropped.Add(1)
+			}
+		}
+		f.mu.RUnlock()
+	}
+}
+
+// Reader new reader, it's Write/Inject is passed to underlying conn, Close
+// only detach the reader.
+func (f *Fanout) Reader() *Reader {
+	var r = &Reader{
+		RawConn: f.child,
+		f:       f,
+		closed:  make(chan struct{}),
+	}
+	if f.shared != nil {
+		r.queue = f.shared
+	} else {
+		r.queue = make(chan *packet.Packet, f.cfg.Queue)
+	}
+
+	f.mu.Lock()
+	f.readers[r] = struct{}{}
+	f.mu.Unlock()
+	return r
+}
+
+// Close close underlying conn and all readers
+func (f *Fanout) Close() error {
+	return f.closeErr.Close(func() (errs []error) {
+		close(f.closing)
+		errs = append(errs, f.child.Close())
+		<-f.done
+		return errs
+	})
+}
+
+type Reader struct {
+	rawsock.RawConn
+	f       *Fanout
+	queue   chan *packet.Packet
+	dropped atomic.Uint64
+
+	closed   chan struct{}
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Reader)(nil)
+
+func (r *Reader) Read(pkt *packet.Packet) (err error) {
+	var p *packet.Packet
+	select {
+	case p = <-r.queue:
+	case <-r.closed:
+		return errors.WithStack(net.ErrClosed)
+	case <-r.f.done:
+		select {
+		case p = <-r.queue: // drain queued packets
+		default:
+			return r.f.err
+		}
+	}
+
+	if pkt.Data() < p.Data() {
+		return errorx.ShortBuff(p.Data(), pkt.Data())
+	}
+	pkt.SetData(0).Append(p.Bytes()...)
+	return nil
+}
+
+// Dropped packets dropped for queue full, always 0 in Shared mode
+func (r *Reader) Dropped() uint64 { return r.dropped.Load() }
+
+func (r *Reader) Close() error {
+	return r.closeErr.Close(func() (errs []error) {
+		r.f.mu.Lock()
+		delete(r.f.readers, r)
+		r.f.mu.Unlock()
+		close(r.closed)
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package fanout_test
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/fanout"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Fanout(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	const n = 32
+
+	var run = func(t *testing.T, mode fanout.Mode) (recved [2][]string) {
+		c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		f := fanout.New(s, fanout.WithMode(mode))
+		readers := [2]*fanout.Reader{f.Reader(), f.Reader()}
+
+		var sent = map[string]bool{}
+		for i := 0; i < n; i++ {
+			udp := test.StripIP(test.RandUDP(t, caddr, saddr))
+			sent[string(udp)] = true
+			require.NoError(t, c.Write(packet.Make(64).Append(udp...)))
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for i, r := range readers {
+			wg.Add(1)
+			go func(i int, r *fanout.Reader) {
+				defer wg.Done()
+				var pkt = packet.Make(0, 1536)
+				for {
+					if err := r.Read(pkt.Sets(0, 1536)); err != nil {
+						require.ErrorIs(t, err, net.ErrClosed)
+						return
+					}
+					require.True(t, sent[string(pkt.Bytes())])
+					mu.Lock()
+					recved[i] = append(recved[i], string(pkt.Bytes()))
+					total := len(recved[0]) + len(recved[1])
+					mu.Unlock()
+					if mode == fanout.Shared && total == n {
+						readers[0].Close()
+						readers[1].Close()
+					} else if mode == fanout.Broadcast && len(recved[i]) == n {
+						r.Close()
+					}
+				}
+			}(i, r)
+		}
+		wg.Wait()
+		require.NoError(t, f.Close())
+		return recved
+	}
+
+	t.Run("broadcast", func(t *testing.T) {
+		recved := run(t, fanout.Broadcast)
+		require.Equal(t, recved[0], recved[1])
+		require.Len(t, recved[0], n)
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		recved := run(t, fanout.Shared)
+		all := append(recved[0], recved[1]...)
+		require.Len(t, all, n)
+		var uniq = map[string]bool{}
+		for _, e := range all {
+			uniq[e] = true
+		}
+		require.Len(t, uniq, n)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		_, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		f := fanout.New(s)
+		r := f.Reader()
+		var errs = make(chan error)
+		go func() { errs <- r.Read(packet.Make(0, 1536)) }()
+		require.NoError(t, f.Close())
+		require.ErrorIs(t, <-errs, net.ErrClosed)
+	})
+}
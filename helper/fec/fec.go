@@ -0,0 +1,315 @@
+// Package fec forward error correction of RawConn, every data shards packets
+// be followed by parity shards packets, lost packets can be recovered if
+// received any data shards packets of the group.
+//
+// data packet:   | transport packet | trailer |
+// parity packet: | transport header | parity  | trailer |
+package fec
+
+import (
+	"encoding/binary"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	Data, Parity int // shards of a group
+	Groups       int // max groups cached for recover
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Data:   10,
+		Parity: 3,
+		Groups: 32,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Shards set data and parity shards of a group, default 10 and 3, can
+// recover parity lost packets in a group
+func Shards(data, parity int) Option {
+	return func(c *Config) {
+		c.Data, c.Parity = data, parity
+	}
+}
+
+// Groups max groups cached for recover, default 32
+func Groups(n int) Option {
+	return func(c *Config) {
+		c.Groups = max(n, 1)
+	}
+}
+
+const trailerSize = 8 // group(4) | index(1) | data(1) | parity(1) | reserved(1)
+
+type Stats struct {
+	Recovered uint64 // recovered packets
+}
+
+// Conn fec RawConn, Write will modify the pkt, Read isn't concurrent safe. Peers
+// should use same shards config. Incomplete group's parity not be sent.
+type Conn struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	cfg   *Config
+	rs    *rs
+
+	inSum, outSum uint16 // pseudo header checksum without length
+
+	// encoder
+	wmu    sync.Mutex
+	group  uint32
+	shards [][]byte
+	hdr    []byte // last transport header of group
+
+	// decoder
+	groups    map[uint32]*group
+	order     []uint32
+	pending   [][]byte // recovered packets
+	recovered atomic.Uint64
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+type group struct {
+	shards [][]byte
+	size   int // parity shard size, 0 means not recved parity
+	done   bool
+}
+
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, opts ...Option) (*Conn, error) {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return nil, errors.Errorf("not support transport protocol %d", proto)
+	}
+
+	var c = &Conn{
+		RawConn: child,
+		proto:   proto,
+		cfg:     Options(opts...),
+		groups:  map[uint32]*group{},
+	}
+	var err error
+	if c.rs, err = newRS(c.cfg.Data, c.cfg.Parity); err != nil {
+		return nil, err
+	}
+
+	var (
+		laddr = tcpip.AddrFromSlice(child.LocalAddr().Addr().AsSlice())
+		raddr = tcpip.AddrFromSlice(child.RemoteAddr().Addr().AsSlice())
+	)
+	c.inSum = header.PseudoHeaderChecksum(proto, raddr, laddr, 0)
+	c.outSum = header.PseudoHeaderChecksum(proto, laddr, raddr, 0)
+	return c, nil
+}
+
+func (c *Conn) hdrLen(b []byte) (int, error) {
+	switch c.proto {
+	case header.TCPProtocolNumber:
+		if len(b) < header.TCPMinimumSize || len(b) < int(header.TCP(b).DataOffset()) {
+			return 0, errorx.WrapTemp(errors.Errorf("invalid tcp packet, bytes %d", len(b)))
+		}
+		return int(header.TCP(b).DataOffset()), nil
+	default:
+		if len(b) < header.UDPMinimumSize {
+			return 0, errorx.WrapTemp(errors.Errorf("invalid udp packet, bytes %d", len(b)))
+		}
+		return header.UDPMinimumSize, nil
+	}
+}
+
+func (c *Conn) trailer(idx int) []byte {
+	var t = make([]byte, trailerSize)
+	binary.BigEndian.PutUint32(t, c.group)
+	t[4], t[5], t[6] = byte(idx), byte(c.cfg.Data), byte(c.cfg.Parity)
+	return t
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	b := pkt.Bytes()
+	n, err := c.hdrLen(b)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	shard := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(b)), uint16(len(b)))
+	c.shards = append(c.shards, append(shard, b...))
+	c.hdr = append(c.hdr[:0], b[:n]...)
+
+	pkt.Append(c.trailer(len(c.shards) - 1)...)
+	ipstack.Checksum(c.proto, pkt.Bytes(), c.outSum)
+	if err = c.RawConn.Write(pkt); err != nil {
+		return err
+	}
+
+	if len(c.shards) == c.cfg.Data {
+		err = c.flush()
+	}
+	return err
+}
+
+func (c *Conn) flush() error {
+	defer func() { c.shards, c.group = c.shards[:0], c.group+1 }()
+
+	var size int
+	for _, s := range c.shards {
+		size = max(size, len(s))
+	}
+	for i, s := range c.shards {
+		c.shards[i] = append(s, make([]byte, size-len(s))...)
+	}
+	var parity = make([][]byte, c.cfg.Parity)
+	for i := range parity {
+		parity[i] = make([]byte, size)
+	}
+	c.rs.encode(c.shards, parity)
+
+	for i, p := range parity {
+		pkt := packet.Make(64, 0, len(c.hdr)+size+trailerSize)
+		pkt.Append(c.hdr...).Append(p...).Append(c.trailer(c.cfg.Data + i)...)
+		ipstack.Checksum(c.proto, pkt.Bytes(), c.outSum)
+		if err := c.RawConn.Write(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		pkt.Sets(head, data)
+		if len(c.pending) > 0 {
+			p := c.pending[0]
+			if pkt.Data() < len(p) {
+				return errorx.ShortBuff(len(p), pkt.Data())
+			}
+			c.pending = c.pending[1:]
+			pkt.SetData(0).Append(p...)
+			ipstack.Checksum(c.proto, pkt.Bytes(), c.inSum)
+			return nil
+		}
+
+		if err = c.RawConn.Read(pkt); err != nil {
+			return err
+		}
+		b := pkt.Bytes()
+		if len(b) < trailerSize {
+			return errorx.WrapTemp(errors.Errorf("invalid fec packet, bytes %d", len(b)))
+		}
+		t, body := b[len(b)-trailerSize:], b[:len(b)-trailerSize]
+		if int(t[5]) != c.cfg.Data || int(t[6]) != c.cfg.Parity {
+			return errorx.WrapTemp(errors.Errorf("fec shards %d:%d not match", t[5], t[6]))
+		}
+		gid, idx := binary.BigEndian.Uint32(t), int(t[4])
+		if idx >= c.cfg.Data+c.cfg.Parity {
+			return errorx.WrapTemp(errors.Errorf("invalid fec index %d", idx))
+		}
+		g := c.getGroup(gid)
+
+		if idx < c.cfg.Data {
+			if g.shards[idx] == nil {
+				shard := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(body)), uint16(len(body)))
+				g.shards[idx] = append(shard, body...)
+			}
+			c.recover(g)
+
+			pkt.SetData(len(body))
+			ipstack.Checksum(c.proto, pkt.Bytes(), c.inSum)
+			return nil
+		} else {
+			n, err := c.hdrLen(body)
+			if err != nil {
+				return err
+			}
+			if g.shards[idx] == nil {
+				g.shards[idx] = slices.Clone(body[n:])
+				g.size = len(body) - n
+			}
+			c.recover(g)
+		}
+	}
+}
+
+func (c *Conn) getGroup(gid uint32) *group {
+	g, has := c.groups[gid]
+	if !has {
+		g = &group{shards: make([][]byte, c.cfg.Data+c.cfg.Parity)}
+		c.groups[gid] = g
+		c.order = append(c.order, gid)
+		if len(c.order) > c.cfg.Groups {
+			delete(c.groups, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	return g
+}
+
+func (c *Conn) recover(g *group) {
+	if g.done {
+		return
+	}
+
+	var present, missing int
+	for i, s := range g.shards {
+		if s != nil {
+			present++
+		} else if i < c.cfg.Data {
+			missing++
+		}
+	}
+	if missing == 0 {
+		g.done = true
+		return
+	} else if present < c.cfg.Data || g.size == 0 {
+		return
+	}
+
+	var shards = make([][]byte, len(g.shards))
+	for i, s := range g.shards {
+		if s != nil {
+			if len(s) > g.size {
+				return // invalid
+			}
+			shards[i] = append(slices.Clone(s), make([]byte, g.size-len(s))...)
+		}
+	}
+	if err := c.rs.reconstruct(shards, g.size); err != nil {
+		return
+	}
+
+	g.done = true
+	for i := 0; i < c.cfg.Data; i++ {
+		if g.shards[i] != nil {
+			continue
+		}
+		s := shards[i]
+		if n := int(binary.BigEndian.Uint16(s)); n+2 <= len(s) {
+			c.pending = append(c.pending, s[2:2+n])
+			c.recovered.Add(1)
+		}
+	}
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{Recovered: c.recovered.Load()}
+}
@@ -0,0 +1,63 @@
+package fec_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/fec"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type dropConn struct {
+	rawsock.RawConn
+	n    int
+	drop map[int]bool
+}
+
+func (d *dropConn) Write(pkt *packet.Packet) error {
+	d.n++
+	if d.drop[d.n-1] {
+		return nil
+	}
+	return d.RawConn.Write(pkt)
+}
+
+func Test_Conn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+
+	// group of 4 data + 2 parity, lose 2 data packets
+	client, err := fec.Wrap(
+		&dropConn{RawConn: c, drop: map[int]bool{1: true, 2: true}},
+		header.UDPProtocolNumber, fec.Shards(4, 2),
+	)
+	require.NoError(t, err)
+	server, err := fec.Wrap(s, header.UDPProtocolNumber, fec.Shards(4, 2))
+	require.NoError(t, err)
+
+	var sent = map[string]bool{}
+	for i := 0; i < 4; i++ {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		sent[string(udp.Payload())] = true
+		require.NoError(t, client.Write(packet.Make(64).Append(udp...)))
+	}
+
+	for i := 0; i < 4; i++ {
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, server.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.UDPProtocolNumber, pkt.Bytes()))
+
+		payload := string(header.UDP(pkt.Bytes()).Payload())
+		require.True(t, sent[payload])
+		delete(sent, payload)
+	}
+	require.Empty(t, sent)
+	require.Equal(t, uint64(2), server.Stats().Recovered)
+}
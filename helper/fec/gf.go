@@ -0,0 +1,80 @@
+package fec
+
+import "github.com/pkg/errors"
+
+// galois field GF(2^8), polynomial x^8+x^4+x^3+x^2+1
+var expTbl, logTbl = func() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], log[x] = byte(x), byte(i)
+		if x <<= 1; x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTbl[int(logTbl[a])+int(logTbl[b])]
+}
+
+func gfInv(a byte) byte {
+	return expTbl[255-int(logTbl[a])]
+}
+
+// mulAdd dst ^= c * src
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := int(logTbl[c])
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= expTbl[lc+int(logTbl[s])]
+		}
+	}
+}
+
+// invert invert square matrix by gauss-jordan elimination
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	var a = make([][]byte, n)
+	for i := range a {
+		a[i] = make([]byte, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1
+	}
+
+	for c := 0; c < n; c++ {
+		p := c
+		for p < n && a[p][c] == 0 {
+			p++
+		}
+		if p == n {
+			return nil, errors.New("singular matrix")
+		}
+		a[c], a[p] = a[p], a[c]
+
+		if inv := gfInv(a[c][c]); inv != 1 {
+			for j := range a[c] {
+				a[c][j] = gfMul(a[c][j], inv)
+			}
+		}
+		for r := 0; r < n; r++ {
+			if r != c && a[r][c] != 0 {
+				mulAdd(a[r], a[c], a[r][c])
+			}
+		}
+	}
+
+	for i := range a {
+		a[i] = a[i][n:]
+	}
+	return a, nil
+}
@@ -0,0 +1,77 @@
+package fec
+
+import "github.com/pkg/errors"
+
+// rs systematic reed-solomon code, parity coefficient is cauchy matrix,
+// any data shards of k rows in [I; C] is invertible
+type rs struct {
+	data, parity int
+	cauchy       [][]byte // parity x data
+}
+
+func newRS(data, parity int) (*rs, error) {
+	if data <= 0 || parity <= 0 || data+parity > 256 {
+		return nil, errors.Errorf("invalid shards data %d parity %d", data, parity)
+	}
+
+	var r = &rs{data: data, parity: parity, cauchy: make([][]byte, parity)}
+	for j := range r.cauchy {
+		r.cauchy[j] = make([]byte, data)
+		for i := range r.cauchy[j] {
+			r.cauchy[j][i] = gfInv(byte(data+j) ^ byte(i))
+		}
+	}
+	return r, nil
+}
+
+// row coefficient row of shard idx
+func (r *rs) row(idx int) []byte {
+	if idx >= r.data {
+		return r.cauchy[idx-r.data]
+	}
+	row := make([]byte, r.data)
+	row[idx] = 1
+	return row
+}
+
+// encode calculate parity shards, all shards have same size
+func (r *rs) encode(data, parity [][]byte) {
+	for j, p := range parity {
+		clear(p)
+		for i, d := range data {
+			mulAdd(p, d, r.cauchy[j][i])
+		}
+	}
+}
+
+// reconstruct missing data shards, nil shard is missing, need at least
+// data shards present
+func (r *rs) reconstruct(shards [][]byte, size int) error {
+	var (
+		rows [][]byte
+		subs [][]byte
+	)
+	for i, s := range shards {
+		if s != nil && len(rows) < r.data {
+			rows, subs = append(rows, r.row(i)), append(subs, s)
+		}
+	}
+	if len(rows) < r.data {
+		return errors.Errorf("too few shards %d, need %d", len(rows), r.data)
+	}
+
+	dec, err := invert(rows)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < r.data; i++ {
+		if shards[i] != nil {
+			continue
+		}
+		shards[i] = make([]byte, size)
+		for j, s := range subs {
+			mulAdd(shards[i], s, dec[i][j])
+		}
+	}
+	return nil
+}
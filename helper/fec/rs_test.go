@@ -0,0 +1,41 @@
+package fec
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RS(t *testing.T) {
+	const data, parity, size = 10, 4, 64
+	rs, err := newRS(data, parity)
+	require.NoError(t, err)
+
+	for i := 0; i < 64; i++ {
+		var shards = make([][]byte, data+parity)
+		for j := range shards {
+			shards[j] = make([]byte, size)
+			if j < data {
+				rand.Read(shards[j])
+			}
+		}
+		rs.encode(shards[:data], shards[data:])
+
+		var lost = slices.Clone(shards)
+		for _, j := range rand.Perm(data + parity)[:parity] {
+			lost[j] = nil
+		}
+		require.NoError(t, rs.reconstruct(lost, size))
+		require.Equal(t, shards[:data], lost[:data])
+	}
+
+	t.Run("too many lost", func(t *testing.T) {
+		var shards = make([][]byte, data+parity)
+		for j := parity + 1; j < len(shards); j++ {
+			shards[j] = make([]byte, size)
+		}
+		require.Error(t, rs.reconstruct(shards, size))
+	})
+}
@@ -0,0 +1,198 @@
+// Package firewall user-space packet filter of RawConn, ordered rules match
+// on direction/address/port/tcp flags, the first matched rule's verdict is
+// applied, rules can be modified at runtime.
+package firewall
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Verdict uint8
+
+const (
+	Accept Verdict = iota
+	Drop
+)
+
+type Direction uint8
+
+const (
+	Both Direction = iota
+	In             // Read
+	Out            // Write
+)
+
+// Ports port range [Lo, Hi], zero value match any port
+type Ports struct{ Lo, Hi uint16 }
+
+func Port(port uint16) Ports { return Ports{port, port} }
+
+func (p Ports) match(port uint16) bool {
+	return p == Ports{} || (p.Lo <= port && port <= p.Hi)
+}
+
+// Rule zero value field match any
+type Rule struct {
+	Dir      Direction
+	Src, Dst netip.Prefix
+	SrcPorts Ports
+	DstPorts Ports
+
+	// tcp flags masked by Mask equal Flags, such as Flags=SYN Mask=SYN|ACK
+	// match handshake request, ignored by udp
+	Flags, Mask header.TCPFlags
+
+	Verdict Verdict
+}
+
+func (r *Rule) match(dir Direction, tcp bool, src, dst netip.AddrPort, flags header.TCPFlags) bool {
+	if r.Dir != Both && r.Dir != dir {
+		return false
+	}
+	if (r.Src.IsValid() && !r.Src.Contains(src.Addr())) ||
+		(r.Dst.IsValid() && !r.Dst.Contains(dst.Addr())) {
+		return false
+	}
+	if !r.SrcPorts.match(src.Port()) || !r.DstPorts.match(dst.Port()) {
+		return false
+	}
+	if r.Mask != 0 && (!tcp || flags&r.Mask != r.Flags) {
+		return false
+	}
+	return true
+}
+
+// Chain ordered rules, concurrent safe, can be shared by conns
+type Chain struct {
+	mu     sync.RWMutex
+	rules  []Rule
+	policy Verdict // verdict of no rule matched
+}
+
+func NewChain(policy Verdict, rules ...Rule) *Chain {
+	return &Chain{rules: rules, policy: policy}
+}
+
+// Set replace all rules
+func (c *Chain) Set(rules ...Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append([]Rule(nil), rules...)
+}
+
+// Insert insert rule at index i, i out of range append to tail
+func (c *Chain) Insert(i int, rule Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i < 0 || i > len(c.rules) {
+		i = len(c.rules)
+	}
+	c.rules = append(c.rules[:i], append([]Rule{rule}, c.rules[i:]...)...)
+}
+
+// Delete delete rule at index i
+func (c *Chain) Delete(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i < 0 || i >= len(c.rules) {
+		return errors.Errorf("rule index %d out of range %d", i, len(c.rules))
+	}
+	c.rules = append(c.rules[:i], c.rules[i+1:]...)
+	return nil
+}
+
+func (c *Chain) Rules() []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Rule(nil), c.rules...)
+}
+
+func (c *Chain) SetPolicy(policy Verdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+// Match verdict of transport packet
+func (c *Chain) Match(dir Direction, proto tcpip.TransportProtocolNumber, src, dst netip.AddrPort, transport []byte) Verdict {
+	var (
+		tcp   = proto == header.TCPProtocolNumber
+		flags header.TCPFlags
+	)
+	if tcp && len(transport) >= header.TCPMinimumSize {
+		flags = header.TCP(transport).Flags()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.rules {
+		if c.rules[i].match(dir, tcp, src, dst, flags) {
+			return c.rules[i].Verdict
+		}
+	}
+	return c.policy
+}
+
+type Stats struct {
+	InDropped  uint64
+	OutDropped uint64
+}
+
+// Conn filter RawConn's Read/Write by chain, dropped Write return nil
+type Conn struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	chain *Chain
+
+	inDropped, outDropped atomic.Uint64
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, chain *Chain) (*Conn, error) {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return nil, errors.Errorf("not support transport protocol %d", proto)
+	}
+	return &Conn{RawConn: child, proto: proto, chain: chain}, nil
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	head, n := pkt.Head(), pkt.Data()
+	for {
+		if err = c.RawConn.Read(pkt.Sets(head, n)); err != nil {
+			return err
+		}
+		// remote address maybe roamed, get every time
+		v := c.chain.Match(In, c.proto, c.RemoteAddr(), c.LocalAddr(), pkt.Bytes())
+		if v == Accept {
+			return nil
+		}
+		c.inDropped.Add(1)
+	}
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	v := c.chain.Match(Out, c.proto, c.LocalAddr(), c.RemoteAddr(), pkt.Bytes())
+	if v == Accept {
+		return c.RawConn.Write(pkt)
+	}
+	c.outDropped.Add(1)
+	return nil
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		InDropped:  c.inDropped.Load(),
+		OutDropped: c.outDropped.Load(),
+	}
+}
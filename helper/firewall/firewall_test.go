@@ -0,0 +1,91 @@
+package firewall_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/firewall"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Chain(t *testing.T) {
+	var (
+		src = netip.MustParseAddrPort("10.0.0.1:19986")
+		dst = netip.MustParseAddrPort("10.0.1.1:80")
+		syn = make(header.TCP, header.TCPMinimumSize)
+		ack = make(header.TCP, header.TCPMinimumSize)
+	)
+	syn.Encode(&header.TCPFields{DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagSyn})
+	ack.Encode(&header.TCPFields{DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagAck})
+
+	chain := firewall.NewChain(firewall.Accept,
+		firewall.Rule{Dir: firewall.In, Flags: header.TCPFlagSyn, Mask: header.TCPFlagSyn | header.TCPFlagAck, Verdict: firewall.Drop},
+		firewall.Rule{Dst: netip.MustParsePrefix("10.0.1.0/24"), DstPorts: firewall.Ports{Lo: 1, Hi: 1024}, Verdict: firewall.Drop},
+	)
+
+	require.Equal(t, firewall.Drop, chain.Match(firewall.In, header.TCPProtocolNumber, src, netip.MustParseAddrPort("10.0.2.1:8080"), syn))
+	require.Equal(t, firewall.Accept, chain.Match(firewall.In, header.TCPProtocolNumber, src, netip.MustParseAddrPort("10.0.2.1:8080"), ack))
+	require.Equal(t, firewall.Accept, chain.Match(firewall.Out, header.TCPProtocolNumber, src, netip.MustParseAddrPort("10.0.2.1:8080"), syn))
+	require.Equal(t, firewall.Drop, chain.Match(firewall.Out, header.TCPProtocolNumber, src, dst, ack))
+	require.Equal(t, firewall.Accept, chain.Match(firewall.Out, header.TCPProtocolNumber, src, netip.MustParseAddrPort("10.0.1.1:8080"), ack))
+
+	// flags rule not match udp
+	require.Equal(t, firewall.Accept, chain.Match(firewall.In, header.UDPProtocolNumber, src, netip.MustParseAddrPort("10.0.2.1:53"), syn))
+
+	chain.Insert(0, firewall.Rule{Src: netip.MustParsePrefix("10.0.0.1/32"), Verdict: firewall.Accept})
+	require.Equal(t, firewall.Accept, chain.Match(firewall.Out, header.TCPProtocolNumber, src, dst, ack))
+	require.NoError(t, chain.Delete(0))
+	require.Error(t, chain.Delete(2))
+	require.Len(t, chain.Rules(), 2)
+
+	chain.Set()
+	chain.SetPolicy(firewall.Drop)
+	require.Equal(t, firewall.Drop, chain.Match(firewall.Out, header.TCPProtocolNumber, src, dst, ack))
+}
+
+func Test_Conn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	chain := firewall.NewChain(firewall.Accept)
+	client, err := firewall.Wrap(c, header.UDPProtocolNumber, chain)
+	require.NoError(t, err)
+	server, err := firewall.Wrap(s, header.UDPProtocolNumber, chain)
+	require.NoError(t, err)
+
+	var pingpong = func(t *testing.T) bool {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		require.NoError(t, client.Write(packet.Make(64).Append(udp...)))
+
+		var (
+			pkt  = packet.Make(0, 1536)
+			recv = make(chan error, 1)
+		)
+		go func() { recv <- server.Read(pkt) }()
+		select {
+		case err := <-recv:
+			require.NoError(t, err)
+			require.Equal(t, []byte(udp.Payload()), []byte(header.UDP(pkt.Bytes()).Payload()))
+			return true
+		case <-time.After(time.Millisecond * 100):
+			return false
+		}
+	}
+	require.True(t, pingpong(t))
+
+	// drop by server inbound
+	chain.Set(firewall.Rule{Dir: firewall.In, Src: netip.PrefixFrom(caddr.Addr(), 32), Verdict: firewall.Drop})
+	require.False(t, pingpong(t))
+	require.Equal(t, uint64(1), server.Stats().InDropped)
+
+	// drop by client outbound
+	chain.Set(firewall.Rule{Dir: firewall.Out, DstPorts: firewall.Port(saddr.Port()), Verdict: firewall.Drop})
+	require.False(t, pingpong(t))
+	require.Equal(t, uint64(1), client.Stats().OutDropped)
+}
@@ -0,0 +1,97 @@
+// Package frame length-prefixed framing, used to carry packets over stream
+// transport, such as tcp, tls, websocket.
+//
+//	+--------+-----------------+
+//	| len(2) |  packet(len)    |
+//	+--------+-----------------+
+package frame
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/pkg/errors"
+)
+
+const (
+	HdrSize = 2
+	MaxSize = 0xffff // max frame payload size
+)
+
+// Writer encode frames to stream, concurrent safe
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	buff []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, buff: make([]byte, 0, 4096)}
+}
+
+// Write write frame
+func (w *Writer) Write(frame []byte) error {
+	return w.WriteFrames(frame)
+}
+
+// WriteFrames coalesce multiple frames into one stream write
+func (w *Writer) WriteFrames(frames ...[]byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buff = w.buff[:0]
+	for _, f := range frames {
+		if len(f) > MaxSize {
+			return errors.Errorf("frame size %d exceed %d", len(f), MaxSize)
+		}
+		w.buff = binary.BigEndian.AppendUint16(w.buff, uint16(len(f)))
+		w.buff = append(w.buff, f...)
+	}
+
+	_, err := w.w.Write(w.buff)
+	return errors.WithStack(err)
+}
+
+// Reader decode frames from stream, support resume from partial read, such
+// as read deadline exceeded, the received bytes will not be lost. Not
+// concurrent safe.
+type Reader struct {
+	r    io.Reader
+	buff []byte
+	n    int // valid bytes in buff
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, buff: make([]byte, HdrSize+MaxSize)}
+}
+
+// Read read a frame into pkt, if pkt too small return io.ErrShortBuffer, and
+// the frame is kept for next read.
+func (r *Reader) Read(pkt *packet.Packet) error {
+	for {
+		if r.n >= HdrSize {
+			size := int(binary.BigEndian.Uint16(r.buff))
+			if r.n >= HdrSize+size {
+				if pkt.Data() < size {
+					return errorx.ShortBuff(size, pkt.Data())
+				}
+				pkt.SetData(0).Append(r.buff[HdrSize : HdrSize+size]...)
+
+				r.n = copy(r.buff, r.buff[HdrSize+size:r.n])
+				return nil
+			}
+		}
+
+		n, err := r.r.Read(r.buff[r.n:])
+		r.n += n
+		if err != nil {
+			if errors.Is(err, io.EOF) && r.n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return errors.WithStack(err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package frame_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/frame"
+	"github.com/lysShub/rawsock/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkReader return data by step bytes, and return deadline exceeded
+// every other read
+type chunkReader struct {
+	data    []byte
+	step    int
+	timeout bool
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	if c.timeout = !c.timeout; c.timeout {
+		return 0, os.ErrDeadlineExceeded
+	} else if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b[:min(len(b), c.step)], c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func Test_Frame(t *testing.T) {
+	var frames = [][]byte{[]byte("hello world")}
+	for i := 0; i < 8; i++ {
+		frames = append(frames, test.RandPayload(1536))
+	}
+	frames = append(frames, []byte{})
+
+	var buff = &bytes.Buffer{}
+	w := frame.NewWriter(buff)
+	require.NoError(t, w.WriteFrames(frames[:4]...))
+	for _, f := range frames[4:] {
+		require.NoError(t, w.Write(f))
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		r := frame.NewReader(&chunkReader{data: slices.Clone(buff.Bytes()), step: 7})
+
+		var pkt = packet.Make(0, 1536)
+		for i := 0; i < len(frames); {
+			err := r.Read(pkt.Sets(0, 1536))
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, frames[i], pkt.Bytes())
+			i++
+		}
+		for {
+			err := r.Read(pkt.Sets(0, 1536))
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				require.True(t, errors.Is(err, io.EOF))
+				break
+			}
+		}
+	})
+
+	t.Run("short-buffer", func(t *testing.T) {
+		r := frame.NewReader(bytes.NewReader(buff.Bytes()))
+
+		var pkt = packet.Make(0, 1)
+		require.True(t, errors.Is(r.Read(pkt), io.ErrShortBuffer))
+		pkt = packet.Make(0, 1536)
+		require.NoError(t, r.Read(pkt))
+		require.Equal(t, frames[0], pkt.Bytes())
+	})
+
+	t.Run("oversize", func(t *testing.T) {
+		require.Error(t, w.Write(make([]byte, frame.MaxSize+1)))
+	})
+}
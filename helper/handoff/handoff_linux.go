@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+// Package handoff send sockets with state between processes by unix domain
+// socket (SCM_RIGHTS), such as a privileged process create conn's sockets,
+// and an unprivileged process use them.
+package handoff
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// MaxFiles max files of once Send
+const MaxFiles = 8
+
+// Send send json encoded state and files, files can be closed after return
+func Send(uc *net.UnixConn, state any, files ...*os.File) error {
+	if len(files) > MaxFiles {
+		return errors.Errorf("too many files %d", len(files))
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var b = binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(len(data)))
+	b = append(b, data...)
+
+	var fds = make([]int, 0, len(files))
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	n, _, err := uc.WriteMsgUnix(b, unix.UnixRights(fds...), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n < len(b) {
+		_, err = uc.Write(b[n:])
+	}
+	return errors.WithStack(err)
+}
+
+// Recv recv state and files sent by Send, caller own the files
+func Recv(uc *net.UnixConn, state any) (files []*os.File, err error) {
+	var (
+		b   = make([]byte, 4096)
+		oob = make([]byte, unix.CmsgSpace(MaxFiles*4))
+	)
+	n, oobn, _, _, err := uc.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if files, err = parseRights(oob[:oobn]); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			files = nil
+		}
+	}()
+
+	// stream socket maybe recv partial message
+	if n < 4 {
+		if _, err = io.ReadFull(uc, b[n:4]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		n = 4
+	}
+	size := 4 + int(binary.BigEndian.Uint32(b))
+	if size > len(b) {
+		b = append(b[:n], make([]byte, size-n)...)
+	}
+	if n < size {
+		if _, err = io.ReadFull(uc, b[n:size]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if err = json.Unmarshal(b[4:size], state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return files, nil
+}
+
+func parseRights(oob []byte) ([]*os.File, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var files []*os.File
+	for i := range msgs {
+		fds, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			unix.CloseOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), "handoff"))
+		}
+	}
+	return files, nil
+}
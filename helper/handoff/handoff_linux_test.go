@@ -0,0 +1,75 @@
+//go:build linux
+// +build linux
+
+package handoff_test
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/handoff"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func pair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.NoError(t, err)
+
+	var ucs [2]*net.UnixConn
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "pair")
+		conn, err := net.FileConn(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		ucs[i] = conn.(*net.UnixConn)
+		t.Cleanup(func() { conn.Close() })
+	}
+	return ucs[0], ucs[1]
+}
+
+type state struct {
+	Name string
+	Data []byte
+}
+
+func Test_Handoff(t *testing.T) {
+	a, b := pair(t)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	var s = state{Name: "pipe", Data: make([]byte, 8192)}
+	require.NoError(t, handoff.Send(a, s, w))
+	require.NoError(t, w.Close())
+
+	var got state
+	files, err := handoff.Recv(b, &got)
+	require.NoError(t, err)
+	require.Equal(t, s, got)
+	require.Len(t, files, 1)
+	defer files[0].Close()
+
+	// received fd refer to same pipe
+	_, err = files[0].Write([]byte("hello"))
+	require.NoError(t, err)
+	var buf = make([]byte, 16)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf[:n]))
+}
+
+func Test_Handoff_NoFiles(t *testing.T) {
+	a, b := pair(t)
+
+	require.NoError(t, handoff.Send(a, state{Name: "empty"}))
+	var got state
+	files, err := handoff.Recv(b, &got)
+	require.NoError(t, err)
+	require.Empty(t, files)
+	require.Equal(t, "empty", got.Name)
+
+	require.Error(t, handoff.Send(a, nil, make([]*os.File, handoff.MaxFiles+1)...))
+}
@@ -1,12 +1,15 @@
 package helper
 
 import (
+	"net"
 	"net/netip"
 	"syscall"
 
 	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/errorx"
-	"github.com/lysShub/netkit/route"
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/rtnl"
 	"github.com/pkg/errors"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -15,12 +18,20 @@ import (
 func IPCheck(ip []byte) (iphdrsize uint8, err error) {
 	switch header.IPVersion(ip) {
 	case 4:
+		if len(ip) < header.IPv4MinimumSize {
+			return 0, errorx.ShortBuff(header.IPv4MinimumSize, len(ip))
+		}
 		hdr := header.IPv4(ip)
 		if tn := int(hdr.TotalLength()); tn != len(ip) {
 			return 0, errorx.ShortBuff(int(tn), len(ip))
+		} else if n := int(hdr.HeaderLength()); n < header.IPv4MinimumSize || n > tn {
+			return 0, errors.Errorf("invalid ip header length %d", n)
 		}
 		return hdr.HeaderLength(), nil
 	case 6:
+		if len(ip) < header.IPv6MinimumSize {
+			return 0, errorx.ShortBuff(header.IPv6MinimumSize, len(ip))
+		}
 		hdr := header.IPv6(ip)
 		tn := int(hdr.PayloadLength()) + header.IPv6MinimumSize
 		if tn != len(ip) {
@@ -37,15 +48,15 @@ func IPCheck(ip []byte) (iphdrsize uint8, err error) {
 
 // DefaultLocal alloc deault local-addr by remote-addr
 func DefaultLocal(laddr, raddr netip.Addr) (netip.Addr, error) {
-	if !laddr.IsUnspecified() {
+	if !laddr.WithZone("").IsUnspecified() {
 		return laddr, nil
 	}
 
-	table, err := route.GetTable()
+	table, err := rtnl.Table()
 	if err != nil {
 		return netip.Addr{}, errors.WithStack(err)
 	}
-	entry := table.Match(raddr)
+	entry := rtnl.Match(table, raddr)
 	if !entry.Valid() {
 		err = errors.WithMessagef(
 			syscall.ENETUNREACH,
@@ -54,8 +65,13 @@ func DefaultLocal(laddr, raddr netip.Addr) (netip.Addr, error) {
 		return netip.Addr{}, errors.WithStack(err)
 	}
 
-	if laddr.IsUnspecified() {
-		laddr = entry.Addr
+	if laddr.WithZone("").IsUnspecified() {
+		laddr = ip6.Zone(entry.Addr, int(entry.Interface))
+		if raddr.Is6() && !raddr.Is4In6() {
+			if a, ok := selectIPv6(raddr, int(entry.Interface)); ok {
+				laddr = a
+			}
+		}
 	} else {
 		if laddr != entry.Addr {
 			err = errors.WithMessagef(
@@ -66,3 +82,160 @@ func DefaultLocal(laddr, raddr netip.Addr) (netip.Addr, error) {
 	}
 	return laddr, nil
 }
+
+// ZoneAddrs complete zone of conn's address pair, zoned address (such as
+// ipv6 link-local) need zone to select interface, the pair is on same
+// interface, so zone of one side is shared with other side, unspecified
+// laddr can carry the zone (such as [::%eth0]). zone of not zoned address
+// is removed, consistent with address parsed from packet.
+func ZoneAddrs(laddr, raddr netip.Addr) (netip.Addr, netip.Addr, error) {
+	unspecified := laddr.WithZone("").IsUnspecified()
+	if !ip6.Zoned(laddr) && !ip6.Zoned(raddr) {
+		if !unspecified {
+			laddr = laddr.WithZone("")
+		}
+		return laddr, raddr.WithZone(""), nil
+	}
+
+	lidx, err := ip6.ZoneIndex(laddr.Zone())
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+	ridx, err := ip6.ZoneIndex(raddr.Zone())
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+	switch {
+	case lidx == 0 && ridx == 0:
+		return netip.Addr{}, netip.Addr{}, errors.WithStack(errors.WithMessagef(
+			syscall.EINVAL, "%s -> %s need zone", laddr.String(), raddr.String(),
+		))
+	case lidx != 0 && ridx != 0 && lidx != ridx:
+		return netip.Addr{}, netip.Addr{}, errors.WithStack(errors.WithMessagef(
+			syscall.EINVAL, "%s -> %s zone mismatch", laddr.String(), raddr.String(),
+		))
+	}
+
+	idx := max(lidx, ridx)
+	if unspecified {
+		laddr = laddr.WithZone(ip6.Zone(raddr, idx).Zone())
+	} else {
+		laddr = ip6.Zone(laddr, idx)
+	}
+	return laddr, ip6.Zone(raddr, idx), nil
+}
+
+// selectIPv6 select source address of outgoing interface by RFC 6724, route
+// entry only record one address, that maybe deprecated or temporary
+func selectIPv6(raddr netip.Addr, ifindex int) (netip.Addr, bool) {
+	addrs, err := ip6.Addrs()
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	a, ok := ip6.Select(raddr, ifindex, ip6.Filter(addrs, ifindex, 0), false)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return a.Prefix.Addr(), true
+}
+
+// InterfaceMTU get mtu of the interface which own addr
+func InterfaceMTU(addr netip.Addr) (int, error) {
+	ifi, err := InterfaceByAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+	return ifi.MTU, nil
+}
+
+// MTU get mtu of interface ifname
+func MTU(ifname string) (int, error) {
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return ifi.MTU, nil
+}
+
+// WatchMTU fn be called with new mtu when mtu of interface ifname changed,
+// notified by rtnl link change, watchers of the same interface share one
+// subscription, call cancel to stop. not support inside other netns, global
+// rtnl cache watch the process's netns
+func WatchMTU(ifname string, fn func(mtu int)) (cancel func(), err error) {
+	if netns.Switched() {
+		return nil, errors.New("not support watch mtu inside other netns")
+	}
+	cache, err := rtnl.Default()
+	if err != nil {
+		return nil, err
+	}
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cache.SubscribeLink(ifi.Index, ifi.MTU, fn), nil
+}
+
+// InterfaceByAddr get the interface which own addr, zoned addr only match
+// the zone's interface
+func InterfaceByAddr(addr netip.Addr) (*net.Interface, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	idx, err := ip6.ZoneIndex(addr.Zone())
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range ifs {
+		if idx != 0 && i.Index != idx {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, a := range addrs {
+			if a, ok := a.(*net.IPNet); ok {
+				if ip, ok := netip.AddrFromSlice(a.IP); ok && ip.Unmap() == addr.Unmap().WithZone("") {
+					return &i, nil
+				}
+			}
+		}
+	}
+	return nil, errors.WithStack(
+		errors.WithMessagef(syscall.EADDRNOTAVAIL, addr.String()),
+	)
+}
+
+// LoopbackInterface get name of loopback interface, such as "lo" on linux,
+// "lo0" on darwin, "Loopback Pseudo-Interface 1" on windows
+func LoopbackInterface() (string, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// interface that flagged loopback and up is preferred
+	var name string
+	for _, i := range ifs {
+		if i.Flags&net.FlagLoopback != 0 {
+			if i.Flags&net.FlagUp != 0 {
+				return i.Name, nil
+			} else if name == "" {
+				name = i.Name
+			}
+		}
+	}
+	if name != "" {
+		return name, nil
+	}
+
+	// some virtual environment not set loopback flag
+	for _, addr := range []netip.Addr{netip.AddrFrom4([4]byte{127, 0, 0, 1}), netip.IPv6Loopback()} {
+		if ifi, err := InterfaceByAddr(addr); err == nil {
+			return ifi.Name, nil
+		}
+	}
+	return "", errors.New("not found loopback interface")
+}
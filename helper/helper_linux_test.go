@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package helper_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_WatchMTU(t *testing.T) {
+	const name = "rawsock-mtu"
+	tun, err := createTun(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer tun.Close()
+
+	var mtus = make(chan int, 4)
+	cancel, err := helper.WatchMTU(name, func(mtu int) { mtus <- mtu })
+	require.NoError(t, err)
+	defer cancel()
+
+	require.NoError(t, setMTU(name, 1280))
+	select {
+	case mtu := <-mtus:
+		require.Equal(t, 1280, mtu)
+	case <-time.After(time.Second * 3):
+		t.Fatal("not notified")
+	}
+
+	cancel()
+	require.NoError(t, setMTU(name, 1400))
+	time.Sleep(time.Millisecond * 100)
+	require.Len(t, mtus, 0)
+}
+
+func createTun(name string) (*os.File, error) {
+	f, err := os.OpenFile("/dev/net/tun", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ifr.SetUint16(unix.IFF_TUN | unix.IFF_NO_PI)
+	if err = unix.IoctlIfreq(int(f.Fd()), unix.TUNSETIFF, ifr); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func setMTU(name string, mtu int) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint32(uint32(mtu))
+	return unix.IoctlIfreq(fd, unix.SIOCSIFMTU, ifr)
+}
@@ -0,0 +1,72 @@
+package helper_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MTU(t *testing.T) {
+	name, err := helper.LoopbackInterface()
+	require.NoError(t, err)
+	ifi, err := net.InterfaceByName(name)
+	require.NoError(t, err)
+
+	mtu, err := helper.MTU(name)
+	require.NoError(t, err)
+	require.Equal(t, ifi.MTU, mtu)
+
+	_, err = helper.MTU("not-exist-ifi")
+	require.Error(t, err)
+}
+
+func Test_LoopbackInterface(t *testing.T) {
+	name, err := helper.LoopbackInterface()
+	require.NoError(t, err)
+
+	ifi, err := net.InterfaceByName(name)
+	require.NoError(t, err)
+	require.NotZero(t, ifi.Flags&net.FlagLoopback)
+}
+
+func Test_InterfaceByAddr(t *testing.T) {
+	ifi, err := helper.InterfaceByAddr(netip.MustParseAddr("127.0.0.1"))
+	require.NoError(t, err)
+	require.NotZero(t, ifi.Flags&net.FlagLoopback)
+
+	_, err = helper.InterfaceByAddr(netip.MustParseAddr("192.0.2.255"))
+	require.Error(t, err)
+}
+
+func Test_ZoneAddrs(t *testing.T) {
+	var a = netip.MustParseAddr
+
+	l, r, err := helper.ZoneAddrs(a("fe80::1%7"), a("fe80::2"))
+	require.NoError(t, err)
+	require.Equal(t, "7", r.Zone())
+	require.Equal(t, l.Zone(), r.Zone())
+
+	l, r, err = helper.ZoneAddrs(a("::%7"), a("fe80::2"))
+	require.NoError(t, err)
+	require.True(t, l.WithZone("").IsUnspecified())
+	require.Equal(t, "7", l.Zone())
+	require.Equal(t, "7", r.Zone())
+
+	l, r, err = helper.ZoneAddrs(a("2001:db8::1%7"), a("2001:db8::2"))
+	require.NoError(t, err)
+	require.Equal(t, a("2001:db8::1"), l)
+	require.Equal(t, a("2001:db8::2"), r)
+
+	l, r, err = helper.ZoneAddrs(a("1.2.3.4"), a("5.6.7.8"))
+	require.NoError(t, err)
+	require.Equal(t, a("1.2.3.4"), l)
+	require.Equal(t, a("5.6.7.8"), r)
+
+	_, _, err = helper.ZoneAddrs(a("::"), a("fe80::2"))
+	require.Error(t, err, "need zone")
+	_, _, err = helper.ZoneAddrs(a("fe80::1%7"), a("fe80::2%8"))
+	require.Error(t, err, "zone mismatch")
+}
@@ -0,0 +1,60 @@
+// Package idle call fn once when not touched in timeout, conn touch it
+// every packet read or written, and close self when idle.
+package idle
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+type Timer struct {
+	timeout time.Duration
+	start   time.Time    // monotonic base
+	last    atomic.Int64 // last touched, duration since start
+	timer   *time.Timer
+	stopped atomic.Bool
+	fn      func()
+}
+
+// New start timer, return nil if timeout <= 0, all methods of nil Timer
+// are no-op
+func New(timeout time.Duration, fn func()) *Timer {
+	if timeout <= 0 {
+		return nil
+	}
+	var t = &Timer{timeout: timeout, start: time.Now(), fn: fn}
+	// arm after assigned, check use t.timer
+	t.timer = time.AfterFunc(math.MaxInt64, t.check)
+	t.timer.Reset(timeout)
+	return t
+}
+
+func (t *Timer) check() {
+	if t.stopped.Load() {
+		return
+	}
+	idle := time.Since(t.start) - time.Duration(t.last.Load())
+	if idle >= t.timeout {
+		t.fn()
+		return
+	}
+	t.timer.Reset(t.timeout - idle)
+}
+
+// Touch record activity, cheap enough for every packet
+func (t *Timer) Touch() {
+	if t == nil {
+		return
+	}
+	t.last.Store(int64(time.Since(t.start)))
+}
+
+// Stop stop timer, fn will not be called after return, unless it is calling
+func (t *Timer) Stop() {
+	if t == nil {
+		return
+	}
+	t.stopped.Store(true)
+	t.timer.Stop()
+}
@@ -0,0 +1,53 @@
+package idle_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Timer(t *testing.T) {
+	t.Run("idle", func(t *testing.T) {
+		var fired = make(chan time.Time, 1)
+		start := time.Now()
+		idle.New(time.Millisecond*50, func() { fired <- time.Now() })
+
+		select {
+		case at := <-fired:
+			require.GreaterOrEqual(t, at.Sub(start), time.Millisecond*50)
+		case <-time.After(time.Second):
+			t.Fatal("not fired")
+		}
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		var fired atomic.Bool
+		timer := idle.New(time.Millisecond*100, func() { fired.Store(true) })
+		for i := 0; i < 6; i++ {
+			time.Sleep(time.Millisecond * 40)
+			timer.Touch()
+		}
+		require.False(t, fired.Load())
+
+		time.Sleep(time.Millisecond * 200)
+		require.True(t, fired.Load())
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		var fired atomic.Bool
+		timer := idle.New(time.Millisecond*20, func() { fired.Store(true) })
+		timer.Stop()
+		time.Sleep(time.Millisecond * 60)
+		require.False(t, fired.Load())
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		timer := idle.New(0, func() { panic("") })
+		require.Nil(t, timer)
+		timer.Touch()
+		timer.Stop()
+	})
+}
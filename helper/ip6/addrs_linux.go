@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package ip6
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Addrs get IPv6 addresses of all interfaces
+func Addrs() ([]Addr, error) {
+	rib, err := syscall.NetlinkRIB(unix.RTM_GETADDR, unix.AF_INET6)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var addrs []Addr
+	for _, m := range msgs {
+		if m.Header.Type != unix.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		if ifa.Family != unix.AF_INET6 {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var (
+			addr  netip.Addr
+			flags = uint32(ifa.Flags)
+		)
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case unix.IFA_ADDRESS:
+				addr, _ = netip.AddrFromSlice(a.Value)
+			case unix.IFA_FLAGS:
+				if len(a.Value) >= 4 {
+					flags = binary.NativeEndian.Uint32(a.Value)
+				}
+			}
+		}
+		if !addr.IsValid() {
+			continue
+		}
+		if addr.IsLinkLocalUnicast() {
+			addr = addr.WithZone(zone(int(ifa.Index)))
+		}
+
+		addrs = append(addrs, Addr{
+			Prefix:     netip.PrefixFrom(addr, int(ifa.Prefixlen)),
+			Interface:  int(ifa.Index),
+			Scope:      ScopeOf(addr),
+			Temporary:  flags&unix.IFA_F_TEMPORARY != 0,
+			Deprecated: flags&unix.IFA_F_DEPRECATED != 0,
+			Tentative:  flags&(unix.IFA_F_TENTATIVE|unix.IFA_F_DADFAILED) != 0,
+		})
+	}
+	return addrs, nil
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package ip6_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Addrs(t *testing.T) {
+	addrs, err := ip6.Addrs()
+	require.NoError(t, err)
+
+	var has bool
+	for _, a := range addrs {
+		if a.Prefix.Addr() == netip.IPv6Loopback() {
+			has = true
+			require.Equal(t, ip6.LinkLocal, a.Scope)
+		}
+	}
+	if !has {
+		t.Skip("IPv6 disabled")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package ip6
+
+import (
+	"net/netip"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+// Addrs get IPv6 addresses of all interfaces
+func Addrs() ([]Addr, error) {
+	rows, err := winipcfg.GetUnicastIPAddressTable(windows.AF_INET6)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var addrs []Addr
+	for _, r := range rows {
+		addr := r.Address.Addr()
+		if !addr.IsValid() || r.SkipAsSource {
+			continue
+		}
+		if addr.IsLinkLocalUnicast() {
+			addr = addr.WithZone(zone(int(r.InterfaceIndex)))
+		}
+
+		addrs = append(addrs, Addr{
+			Prefix:     netip.PrefixFrom(addr, int(r.OnLinkPrefixLength)),
+			Interface:  int(r.InterfaceIndex),
+			Scope:      ScopeOf(addr),
+			Temporary:  r.SuffixOrigin == winipcfg.SuffixOriginRandom,
+			Deprecated: r.DadState == winipcfg.DadStateDeprecated,
+			Tentative:  r.DadState == winipcfg.DadStateTentative || r.DadState == winipcfg.DadStateDuplicate,
+		})
+	}
+	return addrs, nil
+}
@@ -0,0 +1,222 @@
+// Package ip6 enumerate interface IPv6 addresses and select source address
+// by RFC 6724.
+package ip6
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Scope multicast/unicast address scope, RFC 4291 2.7
+type Scope uint8
+
+const (
+	InterfaceLocal Scope = 0x1
+	LinkLocal      Scope = 0x2
+	SiteLocal      Scope = 0x5
+	Global         Scope = 0xe
+)
+
+func (s Scope) String() string {
+	switch s {
+	case InterfaceLocal:
+		return "interface-local"
+	case LinkLocal:
+		return "link-local"
+	case SiteLocal:
+		return "site-local"
+	case Global:
+		return "global"
+	default:
+		return "unknown"
+	}
+}
+
+// ScopeOf get scope of addr, RFC 6724 3.1
+func ScopeOf(addr netip.Addr) Scope {
+	addr = addr.Unmap()
+	switch {
+	case addr.IsLoopback():
+		return LinkLocal
+	case addr.IsInterfaceLocalMulticast():
+		return InterfaceLocal
+	case addr.IsMulticast():
+		return Scope(addr.As16()[1] & 0xf)
+	case addr.IsLinkLocalUnicast():
+		return LinkLocal
+	case addr.Is6() && addr.As16()[0] == 0xfe && addr.As16()[1]&0xc0 == 0xc0:
+		return SiteLocal // deprecated fec0::/10
+	default:
+		return Global
+	}
+}
+
+// Addr interface IPv6 address
+type Addr struct {
+	Prefix     netip.Prefix
+	Interface  int
+	Scope      Scope
+	Temporary  bool // privacy extension address, RFC 8981
+	Deprecated bool // preferred lifetime expired
+	Tentative  bool // duplicate address detection not finished or failed, can't be used
+}
+
+// Filter return addresses of interface, scope 0 means any scope
+func Filter(addrs []Addr, ifindex int, scope Scope) []Addr {
+	var res []Addr
+	for _, a := range addrs {
+		if ifindex != 0 && a.Interface != ifindex {
+			continue
+		} else if scope != 0 && a.Scope != scope {
+			continue
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+// Select choose source address for dst from candidates by RFC 6724 section 5,
+// outgoing interface ifindex is preferred, and public address is preferred
+// than temporary address unless preferTemporary.
+func Select(dst netip.Addr, ifindex int, candidates []Addr, preferTemporary bool) (Addr, bool) {
+	var cands []Addr
+	for _, c := range candidates {
+		if !c.Tentative && c.Prefix.Addr().Is6() {
+			cands = append(cands, c)
+		}
+	}
+	if len(cands) == 0 {
+		return Addr{}, false
+	}
+
+	dstScope, dstLabel := ScopeOf(dst), label(dst)
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		sa, sb := a.Prefix.Addr(), b.Prefix.Addr()
+
+		// rule 1: prefer same address
+		if (sa == dst) != (sb == dst) {
+			return sa == dst
+		}
+		// rule 2: prefer appropriate scope
+		if a.Scope != b.Scope {
+			if a.Scope < b.Scope {
+				return a.Scope >= dstScope
+			}
+			return b.Scope < dstScope
+		}
+		// rule 3: avoid deprecated addresses
+		if a.Deprecated != b.Deprecated {
+			return !a.Deprecated
+		}
+		// rule 5: prefer outgoing interface
+		if ifindex != 0 && (a.Interface == ifindex) != (b.Interface == ifindex) {
+			return a.Interface == ifindex
+		}
+		// rule 6: prefer matching label
+		if la, lb := label(sa) == dstLabel, label(sb) == dstLabel; la != lb {
+			return la
+		}
+		// rule 7: prefer temporary addresses
+		if a.Temporary != b.Temporary {
+			return a.Temporary == preferTemporary
+		}
+		// rule 8: use longest matching prefix
+		return commonPrefixLen(sa, dst) > commonPrefixLen(sb, dst)
+	})
+	return cands[0], true
+}
+
+// policy table, RFC 6724 2.1
+var policy = []struct {
+	prefix netip.Prefix
+	label  uint8
+}{
+	{netip.MustParsePrefix("::1/128"), 0},
+	{netip.MustParsePrefix("::ffff:0:0/96"), 4},
+	{netip.MustParsePrefix("::/96"), 3},
+	{netip.MustParsePrefix("2001::/32"), 5},
+	{netip.MustParsePrefix("2002::/16"), 2},
+	{netip.MustParsePrefix("fc00::/7"), 13},
+	{netip.MustParsePrefix("fec0::/10"), 11},
+	{netip.MustParsePrefix("3ffe::/16"), 12},
+	{netip.MustParsePrefix("::/0"), 1},
+}
+
+func label(addr netip.Addr) uint8 {
+	if addr.Is4() {
+		addr = netip.AddrFrom16(addr.As16())
+	}
+	for _, p := range policy {
+		if p.prefix.Contains(addr) {
+			return p.label
+		}
+	}
+	return 1
+}
+
+func commonPrefixLen(a, b netip.Addr) int {
+	// RFC 6724 only compare first 64 bits
+	x, y := a.As16(), b.As16()
+	var n int
+	for i := 0; i < 8; i++ {
+		d := x[i] ^ y[i]
+		if d == 0 {
+			n += 8
+			continue
+		}
+		for d&0x80 == 0 {
+			n++
+			d <<= 1
+		}
+		break
+	}
+	return n
+}
+
+// Zoned addr need zone (scope id) to be routed, such as link-local address
+func Zoned(addr netip.Addr) bool {
+	if !addr.Is6() || addr.Is4In6() {
+		return false
+	}
+	switch ScopeOf(addr) {
+	case InterfaceLocal, LinkLocal:
+		return !addr.IsLoopback()
+	default:
+		return false
+	}
+}
+
+// Zone set interface zone of zoned addr, others zone is removed
+func Zone(addr netip.Addr, ifindex int) netip.Addr {
+	if !Zoned(addr) || ifindex == 0 {
+		return addr.WithZone("")
+	}
+	return addr.WithZone(zone(ifindex))
+}
+
+// ZoneIndex get interface index of zone, zone is interface name or index
+// string, return 0 if zone is empty
+func ZoneIndex(zone string) (int, error) {
+	if zone == "" {
+		return 0, nil
+	} else if idx, err := strconv.Atoi(zone); err == nil {
+		return idx, nil
+	}
+	ifi, err := net.InterfaceByName(zone)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return ifi.Index, nil
+}
+
+func zone(ifindex int) string {
+	if ifi, err := net.InterfaceByIndex(ifindex); err == nil {
+		return ifi.Name
+	}
+	return strconv.Itoa(ifindex)
+}
@@ -0,0 +1,125 @@
+package ip6_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/stretchr/testify/require"
+)
+
+func addr(s string, opts ...func(*ip6.Addr)) ip6.Addr {
+	p := netip.MustParsePrefix(s)
+	a := ip6.Addr{Prefix: p, Interface: 1, Scope: ip6.ScopeOf(p.Addr())}
+	for _, o := range opts {
+		o(&a)
+	}
+	return a
+}
+
+func temporary(a *ip6.Addr)  { a.Temporary = true }
+func deprecated(a *ip6.Addr) { a.Deprecated = true }
+func tentative(a *ip6.Addr)  { a.Tentative = true }
+
+func Test_ScopeOf(t *testing.T) {
+	for s, scope := range map[string]ip6.Scope{
+		"::1":         ip6.LinkLocal,
+		"fe80::1":     ip6.LinkLocal,
+		"fec0::1":     ip6.SiteLocal,
+		"2001:db8::1": ip6.Global,
+		"fd00::1":     ip6.Global,
+		"ff02::1":     ip6.LinkLocal,
+		"ff05::1":     ip6.SiteLocal,
+		"ff01::1":     ip6.InterfaceLocal,
+	} {
+		require.Equal(t, scope, ip6.ScopeOf(netip.MustParseAddr(s)), s)
+	}
+}
+
+func Test_Zone(t *testing.T) {
+	for s, zoned := range map[string]bool{
+		"::1":                false,
+		"fe80::1":            true,
+		"ff02::1":            true,
+		"ff01::1":            true,
+		"ff05::1":            false,
+		"2001:db8::1":        false,
+		"1.2.3.4":            false,
+		"::ffff:169.254.0.1": false,
+	} {
+		a := netip.MustParseAddr(s)
+		require.Equal(t, zoned, ip6.Zoned(a), s)
+
+		z := ip6.Zone(a, 1)
+		require.Equal(t, zoned, z.Zone() != "", s)
+		require.Equal(t, a, z.WithZone(""))
+		if zoned {
+			idx, err := ip6.ZoneIndex(z.Zone())
+			require.NoError(t, err)
+			require.Equal(t, 1, idx)
+		}
+	}
+
+	idx, err := ip6.ZoneIndex("")
+	require.NoError(t, err)
+	require.Zero(t, idx)
+	idx, err = ip6.ZoneIndex("3")
+	require.NoError(t, err)
+	require.Equal(t, 3, idx)
+}
+
+func Test_Select(t *testing.T) {
+	var dst = netip.MustParseAddr("2001:db8:1::1")
+
+	t.Run("same address", func(t *testing.T) {
+		a, ok := ip6.Select(dst, 0, []ip6.Addr{addr("2001:db8:1::2/64"), addr("2001:db8:1::1/64")}, false)
+		require.True(t, ok)
+		require.Equal(t, dst, a.Prefix.Addr())
+	})
+
+	t.Run("scope", func(t *testing.T) {
+		a, ok := ip6.Select(dst, 0, []ip6.Addr{addr("fe80::1/64"), addr("2001:db8:2::1/64")}, false)
+		require.True(t, ok)
+		require.Equal(t, "2001:db8:2::1", a.Prefix.Addr().String())
+
+		a, ok = ip6.Select(netip.MustParseAddr("fe80::9"), 0, []ip6.Addr{addr("2001:db8:2::1/64"), addr("fe80::1/64")}, false)
+		require.True(t, ok)
+		require.Equal(t, "fe80::1", a.Prefix.Addr().String())
+	})
+
+	t.Run("deprecated", func(t *testing.T) {
+		a, ok := ip6.Select(dst, 0, []ip6.Addr{addr("2001:db8:1::2/64", deprecated), addr("2001:db8:2::1/64")}, false)
+		require.True(t, ok)
+		require.Equal(t, "2001:db8:2::1", a.Prefix.Addr().String())
+	})
+
+	t.Run("tentative", func(t *testing.T) {
+		_, ok := ip6.Select(dst, 0, []ip6.Addr{addr("2001:db8:1::2/64", tentative)}, false)
+		require.False(t, ok)
+	})
+
+	t.Run("temporary", func(t *testing.T) {
+		cands := []ip6.Addr{addr("2001:db8:1::2/64", temporary), addr("2001:db8:1::3/64")}
+		a, _ := ip6.Select(dst, 0, cands, false)
+		require.False(t, a.Temporary)
+		a, _ = ip6.Select(dst, 0, cands, true)
+		require.True(t, a.Temporary)
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		b := addr("2001:db8:2::1/64")
+		b.Interface = 2
+		a, _ := ip6.Select(dst, 2, []ip6.Addr{addr("2001:db8:3::1/64"), b}, false)
+		require.Equal(t, 2, a.Interface)
+	})
+
+	t.Run("label", func(t *testing.T) {
+		a, _ := ip6.Select(netip.MustParseAddr("fd01::1"), 0, []ip6.Addr{addr("2001:db8:2::1/64"), addr("fd02::1/64")}, false)
+		require.Equal(t, "fd02::1", a.Prefix.Addr().String())
+	})
+
+	t.Run("longest prefix", func(t *testing.T) {
+		a, _ := ip6.Select(dst, 0, []ip6.Addr{addr("2001:db8:ff::1/64"), addr("2001:db8:1:0:1::1/64")}, false)
+		require.Equal(t, "2001:db8:1:0:1::1", a.Prefix.Addr().String())
+	})
+}
@@ -0,0 +1,144 @@
+package ipstack
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// IsFragment ipv4 packet is fragment, MF flag set or offset not zero
+func IsFragment(ip []byte) bool {
+	if header.IPVersion(ip) != 4 || len(ip) < header.IPv4MinimumSize {
+		return false
+	}
+	hdr := header.IPv4(ip)
+	return hdr.More() || hdr.FragmentOffset() != 0
+}
+
+// Defrag reassemble ipv4 fragments. datagram with overlapped fragments is
+// dropped (avoid overlap evasion), incomplete datagram expire after timeout.
+type Defrag struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	max     int // max pending datagrams
+	pending map[fragKey]*datagram
+}
+
+type fragKey struct {
+	src, dst [4]byte
+	id       uint16
+	proto    uint8
+}
+
+type datagram struct {
+	hdr   []byte // ip header of first fragment
+	frags []frag
+	total int // payload length, -1 unknown before last fragment
+	size  int
+	first time.Time
+}
+
+type frag struct {
+	off  int
+	data []byte
+}
+
+func NewDefrag(timeout time.Duration, max int) *Defrag {
+	return &Defrag{
+		timeout: timeout,
+		max:     max,
+		pending: map[fragKey]*datagram{},
+	}
+}
+
+// Push push a fragment, return reassembled packet if datagram complete.
+// ip is not referenced after return.
+func (d *Defrag) Push(ip header.IPv4) (header.IPv4, bool) {
+	if !IsFragment(ip) || !ip.IsValid(len(ip)) {
+		return nil, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.expire(now)
+
+	var (
+		key = fragKey{
+			src:   ip.SourceAddress().As4(),
+			dst:   ip.DestinationAddress().As4(),
+			id:    ip.ID(),
+			proto: ip.Protocol(),
+		}
+		hdrLen  = int(ip.HeaderLength())
+		payload = ip[hdrLen:ip.TotalLength()]
+		off     = int(ip.FragmentOffset())
+		end     = off + len(payload)
+	)
+	if end+hdrLen > 0xffff || (ip.More() && len(payload)%8 != 0) || len(payload) == 0 {
+		return nil, false
+	}
+
+	dg, has := d.pending[key]
+	if !has {
+		if len(d.pending) >= d.max {
+			return nil, false
+		}
+		dg = &datagram{total: -1, first: now}
+		d.pending[key] = dg
+	}
+	var maxEnd int
+	for _, f := range dg.frags {
+		if off < f.off+len(f.data) && f.off < end {
+			delete(d.pending, key)
+			return nil, false
+		}
+		maxEnd = max(maxEnd, f.off+len(f.data))
+	}
+	if !ip.More() {
+		if dg.total >= 0 || end < maxEnd {
+			delete(d.pending, key)
+			return nil, false
+		}
+		dg.total = end
+	} else if dg.total >= 0 && end > dg.total {
+		delete(d.pending, key)
+		return nil, false
+	}
+	if off == 0 {
+		dg.hdr = append([]byte(nil), ip[:hdrLen]...)
+	}
+	dg.frags = append(dg.frags, frag{off: off, data: append([]byte(nil), payload...)})
+	dg.size += len(payload)
+
+	if dg.total < 0 || dg.size != dg.total || dg.hdr == nil {
+		return nil, false
+	}
+	delete(d.pending, key)
+
+	var pkt = make(header.IPv4, len(dg.hdr)+dg.total)
+	copy(pkt, dg.hdr)
+	for _, f := range dg.frags {
+		copy(pkt[len(dg.hdr)+f.off:], f.data)
+	}
+	pkt.SetTotalLength(uint16(len(pkt)))
+	pkt.SetFlagsFragmentOffset(pkt.Flags()&^header.IPv4FlagMoreFragments, 0)
+	pkt.SetChecksum(0)
+	pkt.SetChecksum(^pkt.CalculateChecksum())
+	return pkt, true
+}
+
+func (d *Defrag) expire(now time.Time) {
+	for k, dg := range d.pending {
+		if now.Sub(dg.first) > d.timeout {
+			delete(d.pending, k)
+		}
+	}
+}
+
+// Pending incomplete datagrams
+func (d *Defrag) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
@@ -0,0 +1,84 @@
+package ipstack_test
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Defrag(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	var randIP = func() []byte {
+		ip := test.RandUDP(t, src, dst)
+		for len(ip) < 256 {
+			ip = test.RandUDP(t, src, dst)
+		}
+		return ip
+	}
+
+	t.Run("reassemble", func(t *testing.T) {
+		ip := randIP()
+		frags := test.Fragment(t, ip, 100)
+		require.Greater(t, len(frags), 2)
+		require.False(t, ipstack.IsFragment(ip))
+		rand.Shuffle(len(frags), func(i, j int) { frags[i], frags[j] = frags[j], frags[i] })
+
+		d := ipstack.NewDefrag(time.Second, 8)
+		for i, frag := range frags {
+			require.True(t, ipstack.IsFragment(frag))
+			pkt, ok := d.Push(frag)
+			if i < len(frags)-1 {
+				require.False(t, ok)
+				continue
+			}
+			require.True(t, ok)
+			test.ValidIP(t, pkt)
+			require.Equal(t, ip, []byte(pkt))
+		}
+		require.Zero(t, d.Pending())
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		ip := randIP()
+		frags := test.Fragment(t, ip, 100)
+
+		// rewrite second fragment's offset, overlap first
+		evil := header.IPv4(append([]byte{}, frags[1]...))
+		evil.SetFlagsFragmentOffset(header.IPv4FlagMoreFragments, 8)
+		evil.SetChecksum(0)
+		evil.SetChecksum(^evil.CalculateChecksum())
+
+		d := ipstack.NewDefrag(time.Second, 8)
+		_, ok := d.Push(frags[0])
+		require.False(t, ok)
+		_, ok = d.Push(evil)
+		require.False(t, ok)
+		require.Zero(t, d.Pending())
+		for _, frag := range frags[1:] {
+			_, ok = d.Push(frag)
+			require.False(t, ok)
+		}
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		frags := test.Fragment(t, randIP(), 100)
+
+		d := ipstack.NewDefrag(time.Millisecond*10, 8)
+		_, ok := d.Push(frags[0])
+		require.False(t, ok)
+		time.Sleep(time.Millisecond * 20)
+		for _, frag := range frags[1:] {
+			_, ok = d.Push(frag)
+			require.False(t, ok)
+		}
+	})
+}
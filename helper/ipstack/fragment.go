@@ -0,0 +1,59 @@
+package ipstack
+
+import (
+	"sync"
+
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// frags reused fragment buffers
+var frags = sync.Pool{New: func() any { return new([]byte) }}
+
+// Fragment split ipv4 packet to fragments that not exceed mtu, fn be called
+// with every fragment, the frag only valid during the call.
+func Fragment(ip header.IPv4, mtu int, fn func(frag header.IPv4) error) error {
+	if len(ip) <= mtu {
+		return fn(ip)
+	} else if ip.Flags()&header.IPv4FlagDontFragment != 0 {
+		return errors.New("fragment packet with DF flag")
+	}
+
+	hdrLen := int(ip.HeaderLength())
+	size := (mtu - hdrLen) &^ 7
+	if size <= 0 {
+		return errors.Errorf("mtu %d too small", mtu)
+	}
+
+	buf := frags.Get().(*[]byte)
+	defer frags.Put(buf)
+	if cap(*buf) < hdrLen+size {
+		*buf = make([]byte, hdrLen+size)
+	}
+
+	var (
+		payload = ip.Payload()
+		frag    = header.IPv4((*buf)[:hdrLen+size])
+	)
+	copy(frag, ip[:hdrLen])
+	for off := 0; off < len(payload); off += size {
+		n := min(size, len(payload)-off)
+		f := frag[:hdrLen+n]
+		copy(f[hdrLen:], payload[off:off+n])
+
+		var flags uint8
+		if off+n < len(payload) || ip.More() {
+			flags = header.IPv4FlagMoreFragments
+		}
+		f.SetFlagsFragmentOffset(flags, ip.FragmentOffset()+uint16(off))
+		f.SetTotalLength(uint16(len(f)))
+		f.SetChecksum(0)
+		f.SetChecksum(^checksum.Checksum(f[:hdrLen], 0))
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package ipstack_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Fragment(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	t.Run("not-fragment", func(t *testing.T) {
+		ip := test.RandUDP(t, src, dst)
+
+		var n int
+		err := ipstack.Fragment(ip, len(ip), func(frag header.IPv4) error {
+			n++
+			require.Equal(t, header.IPv4(ip), frag)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("fragment", func(t *testing.T) {
+		ip := test.RandUDP(t, src, dst)
+		for len(ip) < 256 {
+			ip = test.RandUDP(t, src, dst)
+		}
+
+		const mtu = 100
+		var payload []byte
+		err := ipstack.Fragment(ip, mtu, func(frag header.IPv4) error {
+			require.LessOrEqual(t, len(frag), mtu)
+			require.True(t, frag.IsValid(len(frag)))
+			require.Equal(t, int(frag.FragmentOffset()), len(payload))
+			test.ValidIP(t, frag)
+
+			payload = append(payload, frag.Payload()...)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, test.StripIP(ip), payload)
+	})
+
+	t.Run("DF", func(t *testing.T) {
+		ip := header.IPv4(test.RandUDP(t, src, dst))
+		ip.SetFlagsFragmentOffset(header.IPv4FlagDontFragment, 0)
+		err := ipstack.Fragment(ip, header.IPv4MinimumSize+8, func(header.IPv4) error { return nil })
+		require.Error(t, err)
+	})
+}
+
+func Test_Fragment_Allocs(t *testing.T) {
+	ip := header.IPv4(make([]byte, 4000))
+	ip.Encode(&header.IPv4Fields{TotalLength: 4000, TTL: 64, Protocol: uint8(header.UDPProtocolNumber)})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		require.NoError(t, ipstack.Fragment(ip, 1500, func(header.IPv4) error { return nil }))
+	})
+	require.Zero(t, allocs)
+}
@@ -7,8 +7,8 @@ import (
 	"sync/atomic"
 
 	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/checksum"
 	"gvisor.dev/gvisor/pkg/tcpip"
-	"gvisor.dev/gvisor/pkg/tcpip/checksum"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
@@ -20,42 +20,64 @@ type IPStack struct {
 	network   tcpip.NetworkProtocolNumber
 	transport tcpip.TransportProtocolNumber
 
+	laddr netip.Addr
+	hdrs  atomic.Pointer[hdrs]
+
+	// next outbound/inbound ip4 id
+	outId atomic.Uint32
+	inId  atomic.Uint32
+}
+
+type hdrs struct {
 	// init ip header
 	in, out []byte
 
+	// ip4 header checksum of init header, only need combine dynamic
+	// fields for every packet
+	inSum, outSum uint16
+
 	// pseudo header checksum without totalLen
 	psoSum1 uint16
-
-	// next outbound/inbound ip4 id
-	outId atomic.Uint32
-	inId  atomic.Uint32
 }
 
+// New create IPStack of ip protocol proto, transport checksum only be
+// calculated for tcp/udp, other protocol's payload is attached as is
 func New(laddr, raddr netip.Addr, proto tcpip.TransportProtocolNumber, opts ...Option) (*IPStack, error) {
-
-	switch proto {
-	case header.TCPProtocolNumber, header.UDPProtocolNumber:
-	default:
+	if proto == 0 || proto > 0xff {
 		return nil, fmt.Errorf("not support transport protocol number %d", proto)
 	}
 
 	var s = &IPStack{
 		option:    Options(opts...),
 		transport: proto,
+		laddr:     laddr,
 	}
 
 	if laddr.Is4() {
 		s.network = header.IPv4ProtocolNumber
-		s.in, s.psoSum1 = initHdr(raddr, laddr, proto)
-		s.out, s.psoSum1 = initHdr(laddr, raddr, proto)
 		s.outId.Store(rand.Uint32())
 		s.inId.Store(rand.Uint32())
 	} else {
 		s.network = header.IPv6ProtocolNumber
-		s.in, s.psoSum1 = initHdr6(raddr, laddr, proto)
-		s.out, s.psoSum1 = initHdr6(laddr, raddr, proto)
 	}
-	return s, nil
+	return s, s.SetRemote(raddr)
+}
+
+// SetRemote update remote address atomically, used when peer roaming
+func (i *IPStack) SetRemote(raddr netip.Addr) error {
+	var h = &hdrs{}
+	if i.laddr.Is4() != raddr.Is4() {
+		return fmt.Errorf("address family not match %s and %s", i.laddr, raddr)
+	} else if i.laddr.Is4() {
+		h.in, h.psoSum1 = initHdr(raddr, i.laddr, i.transport)
+		h.out, h.psoSum1 = initHdr(i.laddr, raddr, i.transport)
+		h.inSum, h.outSum = checksum.Checksum(h.in, 0), checksum.Checksum(h.out, 0)
+	} else {
+		h.in, h.psoSum1 = initHdr6(raddr, i.laddr, i.transport)
+		h.out, h.psoSum1 = initHdr6(i.laddr, raddr, i.transport)
+	}
+	i.hdrs.Store(h)
+	return nil
 }
 
 func initHdr(src, dst netip.Addr, proto tcpip.TransportProtocolNumber) ([]byte, uint16) {
@@ -102,13 +124,21 @@ func (i *IPStack) Size() int {
 	}
 }
 
+// PseudoChecksum pseudo header checksum without length
+func (i *IPStack) PseudoChecksum() uint16 { return i.hdrs.Load().psoSum1 }
+
+// Pseudo transport checksum of attached packet should include pseudo header,
+// that is NotCalcChecksum, otherwise is without-pseudo-checksum or ignored
+func (i *IPStack) Pseudo() bool { return i.option.checksum == notCalcChecksum }
+
 func (i *IPStack) IPv4() bool {
 	return i.network == header.IPv4ProtocolNumber
 }
 
 func (i *IPStack) AttachInbound(pkt *packet.Packet) {
-	pkt.Attach(i.in...)
-	i.calcTransportChecksum(pkt.Bytes())
+	h := i.hdrs.Load()
+	pkt.Attach(h.in...)
+	i.calcTransportChecksum(pkt.Bytes(), h.psoSum1, h.inSum)
 }
 
 func (i *IPStack) UpdateInbound(ip header.IPv4) {
@@ -125,10 +155,12 @@ func (i *IPStack) UpdateInbound(ip header.IPv4) {
 	}
 }
 
-// AttachOutbound attach a ip header for outbound address
+// AttachOutbound attach a ip header for outbound address, not alloc if pkt
+// head section not less than Size
 func (i *IPStack) AttachOutbound(pkt *packet.Packet) {
-	pkt.Attach(i.out...)
-	i.calcTransportChecksum(pkt.Bytes())
+	h := i.hdrs.Load()
+	pkt.Attach(h.out...)
+	i.calcTransportChecksum(pkt.Bytes(), h.psoSum1, h.outSum)
 }
 
 // UpdateOutbound update outbound ip id field
@@ -146,8 +178,8 @@ func (i *IPStack) UpdateOutbound(ip header.IPv4) {
 	}
 }
 
-func (i *IPStack) calcTransportChecksum(ip []byte) {
-	psosum, p := i.checksum(ip)
+func (i *IPStack) calcTransportChecksum(ip []byte, psoSum1, ipSum uint16) {
+	psosum, p := i.checksum(ip, psoSum1, ipSum)
 
 	switch i.transport {
 	case header.TCPProtocolNumber:
@@ -183,18 +215,19 @@ func (i *IPStack) calcTransportChecksum(ip []byte) {
 	}
 }
 
-func (i *IPStack) checksum(ip []byte) (psosum uint16, transport []byte) {
+func (i *IPStack) checksum(ip []byte, psoSum1, ipSum uint16) (psosum uint16, transport []byte) {
 	if i.network == header.IPv4ProtocolNumber {
 		iphdr := header.IPv4(ip)
-		iphdr.SetTotalLength(uint16(len(iphdr)))
-		iphdr.SetID(uint16(i.outId.Add(1)))
+		n, id := uint16(len(iphdr)), uint16(i.outId.Add(1))
+		iphdr.SetTotalLength(n)
+		iphdr.SetID(id)
 		if i.option.calcIPChecksum {
-			iphdr.SetChecksum(^iphdr.CalculateChecksum())
+			iphdr.SetChecksum(^checksum.IPv4(ipSum, n, id))
 		}
 
 		switch i.option.checksum {
 		case reCalcChecksum, updateChecksumWithoutPseudo:
-			psosum = checksum.Combine(i.psoSum1, uint16(len(iphdr.Payload())))
+			psosum = checksum.Combine(psoSum1, uint16(len(iphdr.Payload())))
 		case notCalcChecksum:
 		default:
 			panic("")
@@ -208,7 +241,7 @@ func (i *IPStack) checksum(ip []byte) (psosum uint16, transport []byte) {
 		var psosum uint16
 		switch i.option.checksum {
 		case reCalcChecksum, updateChecksumWithoutPseudo:
-			psosum = checksum.Combine(i.psoSum1, n)
+			psosum = checksum.Combine(psoSum1, n)
 		case notCalcChecksum:
 		default:
 			panic("")
@@ -216,3 +249,20 @@ func (i *IPStack) checksum(ip []byte) (psosum uint16, transport []byte) {
 		return psosum, iphdr.Payload()
 	}
 }
+
+// Checksum set tcp/udp checksum of transport packet, psoSum1 is pseudo header
+// checksum without length
+func Checksum(proto tcpip.TransportProtocolNumber, transport []byte, psoSum1 uint16) {
+	psum := checksum.Combine(psoSum1, uint16(len(transport)))
+	switch proto {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(transport)
+		tcp.SetChecksum(0)
+		tcp.SetChecksum(^checksum.Checksum(tcp, psum))
+	case header.UDPProtocolNumber:
+		udp := header.UDP(transport)
+		udp.SetLength(uint16(len(udp)))
+		udp.SetChecksum(0)
+		udp.SetChecksum(^checksum.Checksum(udp, psum))
+	}
+}
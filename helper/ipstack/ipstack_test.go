@@ -155,3 +155,38 @@ func Test_IP_Stack_UDP(t *testing.T) {
 	}
 
 }
+
+func Test_IP_Stack_Allocs(t *testing.T) {
+	for _, suit := range suits[:2] {
+		s, err := ipstack.New(suit.src, suit.dst, header.UDPProtocolNumber)
+		require.NoError(t, err)
+
+		var pkt = packet.Make(64, 1200)
+		allocs := testing.AllocsPerRun(100, func() {
+			s.AttachOutbound(pkt)
+			pkt.DetachN(s.Size())
+			s.AttachInbound(pkt)
+			pkt.DetachN(s.Size())
+		})
+		require.Zero(t, allocs)
+	}
+}
+
+func Benchmark_AttachOutbound(b *testing.B) {
+	for _, suit := range suits[:2] {
+		s, err := ipstack.New(suit.src, suit.dst, header.TCPProtocolNumber)
+		require.NoError(b, err)
+
+		var pkt = packet.Make(64, 1460)
+		header.TCP(pkt.Bytes()).Encode(&header.TCPFields{DataOffset: header.TCPMinimumSize})
+
+		b.Run(suit.src.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(pkt.Data()))
+			for i := 0; i < b.N; i++ {
+				s.AttachOutbound(pkt)
+				pkt.DetachN(s.Size())
+			}
+		})
+	}
+}
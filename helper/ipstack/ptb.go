@@ -0,0 +1,134 @@
+package ipstack
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// PTB ICMPv6 packet too big message, Src/Dst is address of the original
+// oversize packet
+type PTB struct {
+	MTU      int
+	Proto    tcpip.TransportProtocolNumber
+	Src, Dst netip.AddrPort
+}
+
+// ParsePTB parse ICMPv6 packet too big message, icmp not include ip header
+func ParsePTB(icmp []byte) (PTB, error) {
+	hdr := header.ICMPv6(icmp)
+	if len(hdr) < header.ICMPv6PacketTooBigMinimumSize {
+		return PTB{}, errors.Errorf("short icmpv6 message %d", len(hdr))
+	} else if hdr.Type() != header.ICMPv6PacketTooBig {
+		return PTB{}, errors.Errorf("not packet too big message, type %d", hdr.Type())
+	}
+
+	inner := header.IPv6(hdr.Payload())
+	if len(inner) < header.IPv6MinimumSize {
+		return PTB{}, errors.New("short original packet")
+	}
+	var ptb = PTB{
+		MTU:   int(hdr.MTU()),
+		Proto: inner.TransportProtocol(),
+	}
+	src := netip.AddrFrom16(inner.SourceAddress().As16())
+	dst := netip.AddrFrom16(inner.DestinationAddress().As16())
+
+	// original packet with extension header not supported, port is unknown
+	var payload = inner[header.IPv6MinimumSize:]
+	switch ptb.Proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+		if len(payload) < 4 {
+			return PTB{}, errors.New("short original packet")
+		}
+		// tcp/udp both start with src and dst port
+		ptb.Src = netip.AddrPortFrom(src, header.UDP(payload).SourcePort())
+		ptb.Dst = netip.AddrPortFrom(dst, header.UDP(payload).DestinationPort())
+	default:
+		ptb.Src, ptb.Dst = netip.AddrPortFrom(src, 0), netip.AddrPortFrom(dst, 0)
+	}
+	return ptb, nil
+}
+
+// PMTU path mtu, only shrink by packet too big message
+type PMTU struct {
+	mtu atomic.Int64
+	min int
+	fn  func(mtu int)
+}
+
+// NewPMTU fn be called when path mtu shrink, can be nil
+func NewPMTU(mtu int, fn func(mtu int)) *PMTU {
+	var p = &PMTU{min: header.IPv6MinimumMTU, fn: fn}
+	p.mtu.Store(int64(mtu))
+	return p
+}
+
+// NewPMTU4 path mtu of ipv4 only path, such as ipv4 tunnel outer path,
+// which not less than ipv4 minimum mtu
+func NewPMTU4(mtu int, fn func(mtu int)) *PMTU {
+	var p = &PMTU{min: header.IPv4MinimumMTU, fn: fn}
+	p.mtu.Store(int64(mtu))
+	return p
+}
+
+func (p *PMTU) Load() int { return int(p.mtu.Load()) }
+
+// Update shrink path mtu, ipv6 mtu not less than 1280, RFC 8201
+func (p *PMTU) Update(mtu int) bool {
+	mtu = max(mtu, p.min)
+	for {
+		old := p.mtu.Load()
+		if int64(mtu) >= old {
+			return false
+		} else if p.mtu.CompareAndSwap(old, int64(mtu)) {
+			break
+		}
+	}
+	if p.fn != nil {
+		p.fn(mtu)
+	}
+	return true
+}
+
+// WatchPTB recv ICMPv6 packet too big message sent to laddr, fn be called
+// with every message. close returned conn to stop
+func WatchPTB(laddr netip.Addr, fn func(ptb PTB)) (net.PacketConn, error) {
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", laddr.String())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var f ipv6.ICMPFilter
+	f.SetAll(true)
+	f.Accept(ipv6.ICMPTypePacketTooBig)
+	if err = conn.IPv6PacketConn().SetICMPFilter(&f); err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	ServePTB(conn, fn)
+	return conn, nil
+}
+
+// ServePTB call fn with every packet too big message recved by conn, conn
+// is created by WatchPTB, maybe in other process
+func ServePTB(conn net.PacketConn, fn func(ptb PTB)) {
+	go func() {
+		var b = make([]byte, header.IPv6MinimumMTU)
+		for {
+			n, _, err := conn.ReadFrom(b)
+			if err != nil {
+				return // closed
+			}
+			if ptb, err := ParsePTB(b[:n]); err == nil {
+				fn(ptb)
+			}
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package ipstack_test
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func buildPTB(mtu uint32, orig []byte) []byte {
+	var b = make([]byte, header.ICMPv6PacketTooBigMinimumSize+len(orig))
+	b[0] = byte(header.ICMPv6PacketTooBig)
+	binary.BigEndian.PutUint32(b[4:], mtu)
+	copy(b[header.ICMPv6PacketTooBigMinimumSize:], orig)
+	return b
+}
+
+func Test_ParsePTB(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+	)
+
+	t.Run("tcp", func(t *testing.T) {
+		ptb, err := ipstack.ParsePTB(buildPTB(1400, test.RandTCP(t, src, dst)))
+		require.NoError(t, err)
+		require.Equal(t, ipstack.PTB{MTU: 1400, Proto: header.TCPProtocolNumber, Src: src, Dst: dst}, ptb)
+	})
+
+	t.Run("truncated original packet", func(t *testing.T) {
+		ip := test.RandUDP(t, src, dst)
+		ptb, err := ipstack.ParsePTB(buildPTB(1300, ip[:header.IPv6MinimumSize+4]))
+		require.NoError(t, err)
+		require.Equal(t, ipstack.PTB{MTU: 1300, Proto: header.UDPProtocolNumber, Src: src, Dst: dst}, ptb)
+	})
+
+	t.Run("not ptb", func(t *testing.T) {
+		b := buildPTB(1400, test.RandTCP(t, src, dst))
+		b[0] = byte(header.ICMPv6DstUnreachable)
+		_, err := ipstack.ParsePTB(b)
+		require.Error(t, err)
+	})
+
+	t.Run("short", func(t *testing.T) {
+		_, err := ipstack.ParsePTB(buildPTB(1400, nil))
+		require.Error(t, err)
+	})
+}
+
+func Test_PMTU(t *testing.T) {
+	var notified []int
+	p := ipstack.NewPMTU(1500, func(mtu int) { notified = append(notified, mtu) })
+
+	require.False(t, p.Update(1600))
+	require.True(t, p.Update(1400))
+	require.Equal(t, 1400, p.Load())
+	require.False(t, p.Update(1400))
+
+	// not less than ipv6 minimum mtu
+	require.True(t, p.Update(576))
+	require.Equal(t, header.IPv6MinimumMTU, p.Load())
+	require.Equal(t, []int{1400, header.IPv6MinimumMTU}, notified)
+}
+
+func Test_PMTU4(t *testing.T) {
+	p := ipstack.NewPMTU4(1500, nil)
+
+	require.True(t, p.Update(576))
+	require.Equal(t, 576, p.Load())
+	require.True(t, p.Update(0))
+	require.Equal(t, header.IPv4MinimumMTU, p.Load())
+}
@@ -0,0 +1,181 @@
+// Package mss rewrite MSS option of forwarded SYN/SYN-ACK, relays that
+// encapsulate traffic should clamp the MSS to tunnel's mtu, otherwise
+// full-sized segments are dropped silently (PMTU blackhole).
+package mss
+
+import (
+	"encoding/binary"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// default MSS if SYN not carry MSS option, RFC 9293 3.7.1
+const (
+	Default4 = 536
+	Default6 = 1220
+)
+
+// FromMTU max MSS of path mtu, without tcp options
+func FromMTU(mtu int, ipv4 bool) uint16 {
+	if ipv4 {
+		return uint16(mtu - header.IPv4MinimumSize - header.TCPMinimumSize)
+	}
+	return uint16(mtu - header.IPv6MinimumSize - header.TCPMinimumSize)
+}
+
+// Clamp clamp MSS option of SYN/SYN-ACK ip packet not exceed mss, if
+// the option not exist and default MSS exceed mss, MSS option is inserted
+// into option padding or ahead header section of pkt, tcp header length,
+// ip length and checksums are updated. return true if rewritten, other
+// packets are not changed.
+func Clamp(pkt *packet.Packet, mss uint16) (bool, error) {
+	ip := pkt.Bytes()
+	hdrLen, ipv4, err := parse(ip)
+	if err != nil {
+		return false, err
+	}
+	tcp := header.TCP(ip[hdrLen:])
+	if !tcp.Flags().Contains(header.TCPFlagSyn) {
+		return false, nil
+	}
+
+	opts := tcp[header.TCPMinimumSize:tcp.DataOffset()]
+	off, eol := find(opts)
+	if off >= 0 {
+		if binary.BigEndian.Uint16(opts[off+2:]) <= mss {
+			return false, nil
+		}
+		binary.BigEndian.PutUint16(opts[off+2:], mss)
+		fix(ip, hdrLen, ipv4)
+		return true, nil
+	}
+
+	def := uint16(Default6)
+	if ipv4 {
+		def = Default4
+	}
+	if def <= mss {
+		return false, nil
+	}
+
+	if eol >= 0 && len(opts)-eol >= header.TCPOptionMSSLength {
+		// reuse padding after end of option list
+		header.EncodeMSSOption(uint32(mss), opts[eol:])
+		fix(ip, hdrLen, ipv4)
+		return true, nil
+	}
+
+	n := int(tcp.DataOffset())
+	if n+header.TCPOptionMSSLength > header.TCPHeaderMaximumSize {
+		return false, errors.New("tcp header not enough space for MSS option")
+	}
+	if eol >= 0 {
+		// option list end early, replace padding, inserted option is after
+		for i := eol; i < len(opts); i++ {
+			opts[i] = header.TCPOptionNOP
+		}
+	}
+
+	// move headers ahead, insert option at end of tcp header
+	hdrs := hdrLen + n
+	ip = pkt.AttachN(header.TCPOptionMSSLength).Bytes()
+	copy(ip, ip[header.TCPOptionMSSLength:header.TCPOptionMSSLength+hdrs])
+	header.EncodeMSSOption(uint32(mss), ip[hdrs:])
+
+	tcp = header.TCP(ip[hdrLen:])
+	tcp[header.TCPDataOffset] = uint8((n+header.TCPOptionMSSLength)/4) << 4
+	if ipv4 {
+		iphdr := header.IPv4(ip)
+		iphdr.SetTotalLength(iphdr.TotalLength() + header.TCPOptionMSSLength)
+	} else {
+		iphdr := header.IPv6(ip)
+		iphdr.SetPayloadLength(iphdr.PayloadLength() + header.TCPOptionMSSLength)
+	}
+	fix(ip, hdrLen, ipv4)
+	return true, nil
+}
+
+// parse validate ip packet carry a complete tcp header
+func parse(ip []byte) (hdrLen int, ipv4 bool, err error) {
+	switch header.IPVersion(ip) {
+	case 4:
+		if len(ip) < header.IPv4MinimumSize {
+			return 0, false, errors.New("invalid ipv4 packet")
+		}
+		iphdr := header.IPv4(ip)
+		hdrLen = int(iphdr.HeaderLength())
+		if iphdr.TransportProtocol() != header.TCPProtocolNumber ||
+			iphdr.More() || iphdr.FragmentOffset() != 0 {
+			return 0, false, errors.New("not tcp packet")
+		} else if int(iphdr.TotalLength()) != len(ip) || hdrLen < header.IPv4MinimumSize {
+			return 0, false, errors.New("invalid ipv4 packet")
+		}
+		ipv4 = true
+	case 6:
+		if len(ip) < header.IPv6MinimumSize {
+			return 0, false, errors.New("invalid ipv6 packet")
+		}
+		iphdr := header.IPv6(ip)
+		hdrLen = header.IPv6MinimumSize
+		if iphdr.TransportProtocol() != header.TCPProtocolNumber {
+			return 0, false, errors.New("not tcp packet, or with extension header")
+		} else if int(iphdr.PayloadLength())+hdrLen != len(ip) {
+			return 0, false, errors.New("invalid ipv6 packet")
+		}
+	default:
+		return 0, false, errors.New("invalid ip packet")
+	}
+
+	if len(ip) < hdrLen+header.TCPMinimumSize {
+		return 0, false, errors.New("invalid tcp packet")
+	}
+	tcp := header.TCP(ip[hdrLen:])
+	if n := int(tcp.DataOffset()); n < header.TCPMinimumSize || n > len(tcp) {
+		return 0, false, errors.New("invalid tcp packet")
+	}
+	return hdrLen, ipv4, nil
+}
+
+// find offset of MSS option and end of option list, -1 if not found
+func find(opts []byte) (mss, eol int) {
+	mss, eol = -1, -1
+	for i := 0; i < len(opts); {
+		switch opts[i] {
+		case header.TCPOptionEOL:
+			return mss, i
+		case header.TCPOptionNOP:
+			i++
+			continue
+		}
+		if i+1 >= len(opts) || opts[i+1] < 2 || i+int(opts[i+1]) > len(opts) {
+			return mss, eol // malformed
+		}
+		if opts[i] == header.TCPOptionMSS && opts[i+1] == header.TCPOptionMSSLength {
+			mss = i
+		}
+		i += int(opts[i+1])
+	}
+	return mss, eol
+}
+
+// fix recalculate checksums
+func fix(ip []byte, hdrLen int, ipv4 bool) {
+	var (
+		tcp  = header.TCP(ip[hdrLen:])
+		psum uint16
+	)
+	if ipv4 {
+		iphdr := header.IPv4(ip)
+		iphdr.SetChecksum(0)
+		iphdr.SetChecksum(^checksum.Checksum(iphdr[:hdrLen], 0))
+		psum = header.PseudoHeaderChecksum(header.TCPProtocolNumber, iphdr.SourceAddress(), iphdr.DestinationAddress(), uint16(len(tcp)))
+	} else {
+		iphdr := header.IPv6(ip)
+		psum = header.PseudoHeaderChecksum(header.TCPProtocolNumber, iphdr.SourceAddress(), iphdr.DestinationAddress(), uint16(len(tcp)))
+	}
+	tcp.SetChecksum(0)
+	tcp.SetChecksum(^checksum.Checksum(tcp, psum))
+}
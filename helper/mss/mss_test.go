@@ -0,0 +1,102 @@
+package mss_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/mss"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func build(t *testing.T, src, dst netip.Addr, flags header.TCPFlags, opts []byte, payload string) *packet.Packet {
+	n := header.TCPMinimumSize + len(opts)
+	pkt := packet.Make(64, n)
+	header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+		SrcPort: 19986, DstPort: 443, SeqNum: 1234, DataOffset: uint8(n),
+		Flags: flags, WindowSize: 1024,
+	})
+	copy(pkt.Bytes()[header.TCPMinimumSize:], opts)
+	pkt.Append([]byte(payload)...)
+
+	s, err := ipstack.New(src, dst, header.TCPProtocolNumber)
+	require.NoError(t, err)
+	s.AttachOutbound(pkt)
+	return pkt
+}
+
+func Test_Clamp(t *testing.T) {
+	var (
+		src4, dst4 = netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")
+		src6, dst6 = netip.MustParseAddr("fd00::1"), netip.MustParseAddr("fd00::2")
+	)
+	tcp := func(ip []byte) header.TCP {
+		if header.IPVersion(ip) == 4 {
+			return header.IPv4(ip).Payload()
+		}
+		return header.IPv6(ip).Payload()
+	}
+	mssOf := func(ip []byte) uint16 {
+		return header.ParseSynOptions(tcp(ip).Options(), false).MSS
+	}
+
+	for _, e := range []struct {
+		name     string
+		src, dst netip.Addr
+		flags    header.TCPFlags
+		opts     []byte
+		clamp    uint16
+		changed  bool
+		mss      uint16
+		hdrLen   int
+	}{
+		{"clamp", src4, dst4, header.TCPFlagSyn, []byte{2, 4, 0x05, 0xb4}, 1400, true, 1400, 24},
+		{"smaller", src4, dst4, header.TCPFlagSyn, []byte{2, 4, 0x05, 0x14}, 1400, false, 1300, 24},
+		{"syn-ack", src6, dst6, header.TCPFlagSyn | header.TCPFlagAck, []byte{1, 1, 2, 4, 0x05, 0xa0, 0, 0}, 1300, true, 1300, 28},
+		{"default", src4, dst4, header.TCPFlagSyn, nil, 1400, false, 536, 20},
+		{"insert", src4, dst4, header.TCPFlagSyn, nil, 500, true, 500, 24},
+		{"insert6", src6, dst6, header.TCPFlagSyn, nil, 1200, true, 1200, 24},
+		{"padding", src4, dst4, header.TCPFlagSyn, []byte{1, 1, 0, 0, 0, 0, 0, 0}, 500, true, 500, 28},
+		{"grow", src4, dst4, header.TCPFlagSyn, []byte{3, 3, 7, 0}, 500, true, 500, 28},
+		{"not-syn", src4, dst4, header.TCPFlagAck, []byte{2, 4, 0x05, 0xb4}, 1400, false, 1460, 24},
+	} {
+		t.Run(e.name, func(t *testing.T) {
+			pkt := build(t, e.src, e.dst, e.flags, e.opts, "hello")
+
+			changed, err := mss.Clamp(pkt, e.clamp)
+			require.NoError(t, err)
+			require.Equal(t, e.changed, changed)
+
+			ip := pkt.Bytes()
+			test.ValidIP(t, ip)
+			require.Equal(t, e.hdrLen, int(tcp(ip).DataOffset()))
+			require.Equal(t, "hello", string(tcp(ip).Payload()))
+			require.Equal(t, uint16(19986), tcp(ip).SourcePort())
+			if e.flags.Contains(header.TCPFlagSyn) {
+				require.Equal(t, e.mss, mssOf(ip))
+			}
+		})
+	}
+
+	t.Run("full", func(t *testing.T) {
+		var opts = make([]byte, header.TCPHeaderMaximumSize-header.TCPMinimumSize)
+		for i := range opts {
+			opts[i] = header.TCPOptionNOP
+		}
+		pkt := build(t, src4, dst4, header.TCPFlagSyn, opts, "")
+		_, err := mss.Clamp(pkt, 500)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		pkt := build(t, src4, dst4, header.TCPFlagSyn, nil, "")
+		_, err := mss.Clamp(pkt.SetData(30), 500)
+		require.Error(t, err)
+	})
+
+	require.Equal(t, uint16(1460), mss.FromMTU(1500, true))
+	require.Equal(t, uint16(1440), mss.FromMTU(1500, false))
+}
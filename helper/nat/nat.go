@@ -0,0 +1,174 @@
+package nat
+
+import (
+	"net/netip"
+
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Rewrite rewrite source and destination of ip packet in place, and incremental
+// update ip/tcp/udp/icmp checksums. Invalid address or zero port means not change,
+// the identifier of icmp echo be treated as port, prefer src port.
+//
+// for not first fragment, only rewrite address, and first fragment's transport
+// checksum still be updated correctly.
+func Rewrite(ip []byte, src, dst netip.AddrPort) error {
+	var (
+		oldSrc, oldDst tcpip.Address
+		newSrc, newDst tcpip.Address
+		proto          tcpip.TransportProtocolNumber
+		payload        []byte
+		first          bool
+	)
+
+	switch header.IPVersion(ip) {
+	case 4:
+		hdr := header.IPv4(ip)
+		if !hdr.IsValid(len(ip)) {
+			return errors.New("invalid ipv4 packet")
+		} else if (src.Addr().IsValid() && !src.Addr().Is4()) || (dst.Addr().IsValid() && !dst.Addr().Is4()) {
+			return errors.Errorf("can't rewrite ipv4 packet to %s->%s", src, dst)
+		}
+
+		oldSrc, oldDst = hdr.SourceAddress(), hdr.DestinationAddress()
+		newSrc, newDst = oldSrc, oldDst
+		if src.Addr().IsValid() {
+			newSrc = tcpip.AddrFrom4(src.Addr().As4())
+			hdr.SetSourceAddressWithChecksumUpdate(newSrc)
+		}
+		if dst.Addr().IsValid() {
+			newDst = tcpip.AddrFrom4(dst.Addr().As4())
+			hdr.SetDestinationAddressWithChecksumUpdate(newDst)
+		}
+		proto, payload, first = hdr.TransportProtocol(), hdr.Payload(), hdr.FragmentOffset() == 0
+	case 6:
+		hdr := header.IPv6(ip)
+		if !hdr.IsValid(len(ip)) {
+			return errors.New("invalid ipv6 packet")
+		} else if (src.Addr().IsValid() && !src.Addr().Is6()) || (dst.Addr().IsValid() && !dst.Addr().Is6()) {
+			return errors.Errorf("can't rewrite ipv6 packet to %s->%s", src, dst)
+		}
+
+		oldSrc, oldDst = hdr.SourceAddress(), hdr.DestinationAddress()
+		newSrc, newDst = oldSrc, oldDst
+		if src.Addr().IsValid() {
+			newSrc = tcpip.AddrFrom16(src.Addr().As16())
+			hdr.SetSourceAddress(newSrc)
+		}
+		if dst.Addr().IsValid() {
+			newDst = tcpip.AddrFrom16(dst.Addr().As16())
+			hdr.SetDestinationAddress(newDst)
+		}
+
+		var err error
+		if proto, payload, first, err = skipExtHdrs(hdr); err != nil {
+			return err
+		}
+	default:
+		return errors.New("invalid ip packet")
+	}
+	if !first {
+		return nil
+	}
+
+	switch proto {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(payload)
+		if len(tcp) < header.TCPMinimumSize {
+			return errors.New("invalid tcp packet")
+		}
+		tcp.UpdateChecksumPseudoHeaderAddress(oldSrc, newSrc, true)
+		tcp.UpdateChecksumPseudoHeaderAddress(oldDst, newDst, true)
+		if src.Port() != 0 {
+			tcp.SetSourcePortWithChecksumUpdate(src.Port())
+		}
+		if dst.Port() != 0 {
+			tcp.SetDestinationPortWithChecksumUpdate(dst.Port())
+		}
+	case header.UDPProtocolNumber:
+		udp := header.UDP(payload)
+		if len(udp) < header.UDPMinimumSize {
+			return errors.New("invalid udp packet")
+		}
+		if udp.Checksum() == 0 && header.IPVersion(ip) == 4 {
+			// ipv4 udp without checksum
+			if src.Port() != 0 {
+				udp.SetSourcePort(src.Port())
+			}
+			if dst.Port() != 0 {
+				udp.SetDestinationPort(dst.Port())
+			}
+			return nil
+		}
+		udp.UpdateChecksumPseudoHeaderAddress(oldSrc, newSrc, true)
+		udp.UpdateChecksumPseudoHeaderAddress(oldDst, newDst, true)
+		if src.Port() != 0 {
+			udp.SetSourcePortWithChecksumUpdate(src.Port())
+		}
+		if dst.Port() != 0 {
+			udp.SetDestinationPortWithChecksumUpdate(dst.Port())
+		}
+	case header.ICMPv4ProtocolNumber:
+		icmp := header.ICMPv4(payload)
+		if len(icmp) < header.ICMPv4MinimumSize {
+			return errors.New("invalid icmp packet")
+		}
+		switch icmp.Type() {
+		case header.ICMPv4Echo, header.ICMPv4EchoReply:
+			if id := ident(src, dst); id != 0 {
+				icmp.SetIdentWithChecksumUpdate(id)
+			}
+		}
+	case header.ICMPv6ProtocolNumber:
+		icmp := header.ICMPv6(payload)
+		if len(icmp) < header.ICMPv6MinimumSize {
+			return errors.New("invalid icmpv6 packet")
+		}
+		icmp.UpdateChecksumPseudoHeaderAddress(oldSrc, newSrc)
+		icmp.UpdateChecksumPseudoHeaderAddress(oldDst, newDst)
+		switch icmp.Type() {
+		case header.ICMPv6EchoRequest, header.ICMPv6EchoReply:
+			if id := ident(src, dst); id != 0 {
+				icmp.SetIdentWithChecksumUpdate(id)
+			}
+		}
+	}
+	return nil
+}
+
+func ident(src, dst netip.AddrPort) uint16 {
+	if src.Port() != 0 {
+		return src.Port()
+	}
+	return dst.Port()
+}
+
+func skipExtHdrs(ip header.IPv6) (proto tcpip.TransportProtocolNumber, payload []byte, first bool, err error) {
+	proto, payload = ip.TransportProtocol(), ip.Payload()
+	for {
+		switch header.IPv6ExtensionHeaderIdentifier(proto) {
+		case header.IPv6HopByHopOptionsExtHdrIdentifier,
+			header.IPv6RoutingExtHdrIdentifier,
+			header.IPv6DestinationOptionsExtHdrIdentifier:
+
+			if len(payload) < 8 || len(payload) < (int(payload[1])+1)*8 {
+				return 0, nil, false, errors.New("invalid ipv6 extension header")
+			}
+			n := (int(payload[1]) + 1) * 8
+			proto, payload = tcpip.TransportProtocolNumber(payload[0]), payload[n:]
+		case header.IPv6FragmentExtHdrIdentifier:
+			if len(payload) < header.IPv6FragmentExtHdrLength {
+				return 0, nil, false, errors.New("invalid ipv6 fragment header")
+			}
+			frag := header.IPv6FragmentExtHdr(payload[2:header.IPv6FragmentExtHdrLength])
+			proto, payload = tcpip.TransportProtocolNumber(payload[0]), payload[header.IPv6FragmentExtHdrLength:]
+			if frag.FragmentOffset() != 0 {
+				return proto, payload, false, nil
+			}
+		default:
+			return proto, payload, true, nil
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package nat_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/nat"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Rewrite(t *testing.T) {
+	randAddr := func(v4 bool) netip.AddrPort {
+		if v4 {
+			return netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		}
+		return netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+	}
+
+	for _, v4 := range []bool{true, false} {
+		var (
+			src, dst       = randAddr(v4), randAddr(v4)
+			newSrc, newDst = randAddr(v4), randAddr(v4)
+		)
+		var exts []header.IPv6ExtensionHeaderIdentifier
+		if !v4 {
+			exts = append(exts, header.IPv6HopByHopOptionsExtHdrIdentifier)
+		}
+
+		for name, ip := range map[string][]byte{
+			"tcp":  test.RandTCP(t, src, dst, exts...),
+			"udp":  test.RandUDP(t, src, dst, exts...),
+			"icmp": test.RandICMP(t, src.Addr(), dst.Addr(), exts...),
+		} {
+			t.Run(name, func(t *testing.T) {
+				require.NoError(t, nat.Rewrite(ip, newSrc, newDst))
+				test.ValidIP(t, ip)
+
+				if v4 {
+					hdr := header.IPv4(ip)
+					require.Equal(t, tcpip.AddrFromSlice(newSrc.Addr().AsSlice()), hdr.SourceAddress())
+					require.Equal(t, tcpip.AddrFromSlice(newDst.Addr().AsSlice()), hdr.DestinationAddress())
+				} else {
+					hdr := header.IPv6(ip)
+					require.Equal(t, tcpip.AddrFromSlice(newSrc.Addr().AsSlice()), hdr.SourceAddress())
+					require.Equal(t, tcpip.AddrFromSlice(newDst.Addr().AsSlice()), hdr.DestinationAddress())
+				}
+				switch name {
+				case "tcp":
+					tcp := header.TCP(test.StripIP(ip)[len(exts)*8:])
+					require.Equal(t, newSrc.Port(), tcp.SourcePort())
+					require.Equal(t, newDst.Port(), tcp.DestinationPort())
+				case "udp":
+					udp := header.UDP(test.StripIP(ip)[len(exts)*8:])
+					require.Equal(t, newSrc.Port(), udp.SourcePort())
+					require.Equal(t, newDst.Port(), udp.DestinationPort())
+				}
+			})
+		}
+	}
+
+	t.Run("only-port", func(t *testing.T) {
+		src, dst := randAddr(true), randAddr(true)
+		ip := test.RandUDP(t, src, dst)
+
+		port := test.RandPort()
+		require.NoError(t, nat.Rewrite(ip, netip.AddrPortFrom(netip.Addr{}, port), netip.AddrPort{}))
+		test.ValidIP(t, ip)
+
+		hdr := header.IPv4(ip)
+		require.Equal(t, tcpip.AddrFromSlice(src.Addr().AsSlice()), hdr.SourceAddress())
+		require.Equal(t, port, header.UDP(hdr.Payload()).SourcePort())
+		require.Equal(t, dst.Port(), header.UDP(hdr.Payload()).DestinationPort())
+	})
+
+	t.Run("fragment", func(t *testing.T) {
+		src, dst := randAddr(true), randAddr(true)
+		ip := test.RandTCP(t, src, dst)
+		for len(ip) < 256 {
+			ip = test.RandTCP(t, src, dst)
+		}
+
+		newSrc := randAddr(true)
+		for _, frag := range test.Fragment(t, ip, 128) {
+			require.NoError(t, nat.Rewrite(frag, newSrc, netip.AddrPort{}))
+			test.ValidIP(t, frag)
+			require.Equal(t, tcpip.AddrFromSlice(newSrc.Addr().AsSlice()), header.IPv4(frag).SourceAddress())
+		}
+	})
+
+	t.Run("family-mismatch", func(t *testing.T) {
+		ip := test.RandUDP(t, randAddr(true), randAddr(true))
+		require.Error(t, nat.Rewrite(ip, randAddr(false), netip.AddrPort{}))
+	})
+}
@@ -0,0 +1,35 @@
+package netns
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotSupport network namespace only supported on linux
+var ErrNotSupport = errors.New("not support network namespace")
+
+// NamedDir directory of named network namespace, same as iproute2
+const NamedDir = "/var/run/netns"
+
+// Path resolve network namespace file path, name is a named netns
+// (ip netns add <name>) or a file path, such as /proc/<pid>/ns/net
+func Path(name string) string {
+	if name == "" || strings.ContainsRune(name, '/') {
+		return name
+	}
+	return filepath.Join(NamedDir, name)
+}
+
+// FdPath get file path of opened netns fd, Do with it return ErrNotSupport
+// on other platform
+func FdPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+// PidPath get netns file path of process
+func PidPath(pid int) string {
+	return fmt.Sprintf("/proc/%d/ns/net", pid)
+}
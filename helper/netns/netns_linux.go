@@ -0,0 +1,125 @@
+//go:build linux
+// +build linux
+
+package netns
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Container get netns file path of container, id is the container id (or
+// unique prefix, at least 12 characters) of docker, containerd, cri-o or
+// podman. find the container's process by it's cgroup path.
+func Container(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if len(id) < 12 {
+		return "", errors.Errorf("invalid container id %q", id)
+	}
+
+	dirs, err := os.ReadDir("/proc")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for _, e := range dirs {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if ok, err := inCgroup(pid, id); err != nil || !ok {
+			continue // process exited
+		}
+		return PidPath(pid), nil
+	}
+	return "", errors.Errorf("not found container %s", id)
+}
+
+func inCgroup(pid int, id string) (bool, error) {
+	fh, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	// format: hierarchy-ID:controller-list:cgroup-path
+	s := bufio.NewScanner(fh)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, name := range strings.Split(fields[2], "/") {
+			// such as docker-<id>.scope, cri-containerd-<id>.scope, libpod-<id>
+			name = strings.TrimSuffix(name, ".scope")
+			if i := strings.LastIndexAny(name, "-:"); i >= 0 {
+				name = name[i+1:]
+			}
+			if len(name) >= len(id) && strings.HasPrefix(name, id) {
+				return true, nil
+			}
+		}
+	}
+	return false, s.Err()
+}
+
+// process's network namespace, recorded at init
+var proc unix.Stat_t
+var procErr = unix.Stat("/proc/self/ns/net", &proc)
+
+// Switched current os thread in different network namespace with process,
+// that is, called inside Do
+func Switched() bool {
+	var cur unix.Stat_t
+	if procErr != nil || unix.Stat("/proc/thread-self/ns/net", &cur) != nil {
+		return false
+	}
+	return cur.Ino != proc.Ino || cur.Dev != proc.Dev
+}
+
+// Do call fn inside the network namespace path, sockets created
+// by fn belong to that namespace. if path is empty, call fn directly.
+//
+// NOTICE: fn must not start new goroutine that create socket, because
+// only current os thread switched.
+func Do(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+
+	runtime.LockOSThread()
+
+	cur, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return errors.WithStack(err)
+	}
+	defer unix.Close(cur)
+
+	ns, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return errors.WithMessage(err, path)
+	}
+	defer unix.Close(ns)
+
+	if err := unix.Setns(ns, unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return errors.WithMessagef(err, "setns %s", path)
+	}
+	defer func() {
+		// if restore failed, keep thread locked, the thread will be
+		// terminated when goroutine exit
+		if e := unix.Setns(cur, unix.CLONE_NEWNET); e == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,149 @@
+//go:build linux
+// +build linux
+
+package netns_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_Path(t *testing.T) {
+	require.Equal(t, "", netns.Path(""))
+	require.Equal(t, "/var/run/netns/ns1", netns.Path("ns1"))
+	require.Equal(t, "/proc/1/ns/net", netns.Path("/proc/1/ns/net"))
+}
+
+func Test_Do(t *testing.T) {
+	inode := func() uint64 {
+		var st unix.Stat_t
+		require.NoError(t, unix.Stat("/proc/thread-self/ns/net", &st))
+		return st.Ino
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		var called bool
+		err := netns.Do("", func() error { called = true; return nil })
+		require.NoError(t, err)
+		require.True(t, called)
+	})
+
+	t.Run("not-exist", func(t *testing.T) {
+		err := netns.Do(netns.Path("not-exist-netns"), func() error {
+			t.Fatal("should not be called")
+			return nil
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("fd", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("require root")
+		}
+		f, err := os.Open("/proc/self/ns/net")
+		require.NoError(t, err)
+		defer f.Close()
+
+		old := inode()
+		err = netns.Do(netns.FdPath(int(f.Fd())), func() error {
+			require.Equal(t, old, inode())
+			return nil
+		})
+		require.NoError(t, err)
+	})
+}
+
+func Test_PidPath(t *testing.T) {
+	require.Equal(t, "/proc/1/ns/net", netns.PidPath(1))
+}
+
+func Test_Container(t *testing.T) {
+	_, err := netns.Container("abc")
+	require.Error(t, err)
+
+	_, err = netns.Container("0123456789abcdef0123456789abcdef")
+	require.Error(t, err)
+}
+
+func Test_Switched(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("require root")
+	}
+	require.False(t, netns.Switched())
+
+	// create new netns, keep it by fd
+	ns := func() *os.File {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		cur, err := os.Open("/proc/thread-self/ns/net")
+		require.NoError(t, err)
+		defer cur.Close()
+
+		require.NoError(t, unix.Unshare(unix.CLONE_NEWNET))
+		ns, err := os.Open("/proc/thread-self/ns/net")
+		require.NoError(t, err)
+		require.NoError(t, unix.Setns(int(cur.Fd()), unix.CLONE_NEWNET))
+		return ns
+	}()
+	defer ns.Close()
+
+	var l net.Listener
+	err := netns.Do(netns.FdPath(int(ns.Fd())), func() (err error) {
+		require.True(t, netns.Switched())
+		if err = loUp(); err != nil {
+			return err
+		}
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		return err
+	})
+	require.NoError(t, err)
+	defer l.Close()
+	require.False(t, netns.Switched())
+
+	// socket created inside netns usable from host process
+	go func() {
+		err := netns.Do(netns.FdPath(int(ns.Fd())), func() error {
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = conn.Write([]byte("hello"))
+			return err
+		})
+		if err != nil {
+			l.Close()
+		}
+	}()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	b, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+}
+
+func loUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package netns
+
+import (
+	"github.com/pkg/errors"
+)
+
+func Switched() bool { return false }
+
+func Container(id string) (string, error) {
+	return "", errors.WithStack(ErrNotSupport)
+}
+
+// Do call fn directly, only linux support network namespace, return
+// ErrNotSupport if path not empty
+func Do(path string, fn func() error) error {
+	if path != "" {
+		return errors.WithStack(ErrNotSupport)
+	}
+	return fn()
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package netns_test
+
+import (
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Do(t *testing.T) {
+	require.ErrorIs(t, netns.Do(netns.FdPath(3), func() error { return nil }), netns.ErrNotSupport)
+	require.NoError(t, netns.Do("", func() error { return nil }))
+}
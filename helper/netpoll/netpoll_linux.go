@@ -0,0 +1,361 @@
+//go:build linux
+// +build linux
+
+// Package netpoll service many RawConns by a few epoll driven goroutines,
+// received packets are delivered to per-conn queue, instead of one blocked
+// Read goroutine per conn, reduce memory and scheduler overhead when there
+// are thousands of conns.
+//
+// the epoll goroutine never block, it recv from conn's fd by non-blocking
+// recvmsg directly, instead of conn's Read that maybe wait internally, so
+// packet is queued as recved from fd, use Filter to post-process it.
+package netpoll
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+type Config struct {
+	Loops  int                           // epoll goroutines
+	Queue  int                           // per-conn received packets queue size
+	MTU    int                           // read buffer size
+	Filter func(pkt *packet.Packet) bool // post-process recved packet, see Filter
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Loops: 2,
+		Queue: 64,
+		MTU:   1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Loops epoll goroutines, default 2
+func Loops(n int) Option {
+	return func(c *Config) {
+		c.Loops = max(n, 1)
+	}
+}
+
+// Queue per-conn received packets queue size, default 64, packet is dropped
+// when queue is full
+func Queue(n int) Option {
+	return func(c *Config) {
+		c.Queue = max(n, 1)
+	}
+}
+
+// MTU read buffer size, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+// Filter fn be called on epoll goroutine with every recved packet, it can
+// modify pkt, return false to drop it. fn must not block
+func Filter(fn func(pkt *packet.Packet) bool) Option {
+	return func(c *Config) {
+		c.Filter = fn
+	}
+}
+
+// StripIP Filter strip ip header, for ipv4 raw socket that recved packet
+// with ip header, drop invalid packet
+func StripIP(pkt *packet.Packet) bool {
+	n, err := helper.IPCheck(pkt.Bytes())
+	if err != nil {
+		return false
+	}
+	pkt.SetHead(pkt.Head() + int(n))
+	return true
+}
+
+type Poller struct {
+	cfg   *Config
+	loops []*loop
+	next  atomic.Uint32
+	pool  sync.Pool
+
+	closeErr errorx.CloseErr
+}
+
+func New(opts ...Option) (*Poller, error) {
+	var p = &Poller{cfg: Options(opts...)}
+	p.pool.New = func() any { return packet.Make(64, p.cfg.MTU) }
+
+	for i := 0; i < p.cfg.Loops; i++ {
+		l, err := newLoop(p)
+		if err != nil {
+			return nil, p.close(err)
+		}
+		p.loops = append(p.loops, l)
+		go l.run()
+	}
+	return p, nil
+}
+
+// Add register conn to poller, conn must implement syscall.Conn, after that
+// the returned Conn should be used instead of conn, conn's Read is not used.
+func (p *Poller) Add(conn rawsock.RawConn) (*Conn, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.Errorf("%T not implement syscall.Conn", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var fd = -1
+	if err = raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var c = &Conn{
+		RawConn: conn,
+		fd:      fd,
+		loop:    p.loops[p.next.Add(1)%uint32(len(p.loops))],
+		queue:   make(chan *packet.Packet, p.cfg.Queue),
+		done:    make(chan struct{}),
+	}
+	if err := c.loop.add(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *Poller) close(cause error) error {
+	return p.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		for _, l := range p.loops {
+			errs = append(errs, l.close())
+		}
+		return errs
+	})
+}
+
+// Close stop poller, registered conns will Read fail, but not closed
+func (p *Poller) Close() error { return p.close(nil) }
+
+type loop struct {
+	p    *Poller
+	epfd int
+	wake int // eventfd, wakeup epoll_wait when close
+
+	mu    sync.RWMutex
+	conns map[int32]*Conn
+
+	closed atomic.Bool
+}
+
+func newLoop(p *Poller) (*loop, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, errors.WithStack(err)
+	}
+	var l = &loop{p: p, epfd: epfd, wake: wake, conns: map[int32]*Conn{}}
+
+	if err = unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, wake, &unix.EpollEvent{
+		Events: unix.EPOLLIN, Fd: int32(wake),
+	}); err != nil {
+		unix.Close(wake)
+		unix.Close(epfd)
+		return nil, errors.WithStack(err)
+	}
+	return l, nil
+}
+
+func (l *loop) add(c *Conn) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed.Load() {
+		return errors.WithStack(net.ErrClosed)
+	}
+
+	err := unix.EpollCtl(l.epfd, unix.EPOLL_CTL_ADD, c.fd, &unix.EpollEvent{
+		Events: unix.EPOLLIN, Fd: int32(c.fd),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	l.conns[int32(c.fd)] = c
+	return nil
+}
+
+func (l *loop) del(c *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[int32(c.fd)] == c {
+		delete(l.conns, int32(c.fd))
+		unix.EpollCtl(l.epfd, unix.EPOLL_CTL_DEL, c.fd, nil)
+	}
+}
+
+func (l *loop) run() {
+	var events = make([]unix.EpollEvent, 128)
+	for {
+		n, err := unix.EpollWait(l.epfd, events, -1)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			l.fail(errors.WithStack(err))
+			return
+		}
+
+		for _, e := range events[:n] {
+			if e.Fd == int32(l.wake) {
+				l.fail(errors.WithStack(net.ErrClosed))
+				return
+			}
+
+			l.mu.RLock()
+			c := l.conns[e.Fd]
+			l.mu.RUnlock()
+			if c != nil {
+				c.recv()
+			}
+		}
+	}
+}
+
+// fail stop all conns of the loop
+func (l *loop) fail(err error) {
+	l.mu.Lock()
+	l.closed.Store(true)
+	conns := l.conns
+	l.conns = map[int32]*Conn{}
+	unix.Close(l.wake)
+	unix.Close(l.epfd)
+	l.mu.Unlock()
+
+	for _, c := range conns {
+		c.fail(err)
+	}
+}
+
+func (l *loop) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed.Swap(true) {
+		return nil
+	}
+	var b = make([]byte, 8)
+	binary.NativeEndian.PutUint64(b, 1)
+	_, err := unix.Write(l.wake, b)
+	return errors.WithStack(err)
+}
+
+// Conn RawConn serviced by Poller, Read from queue
+type Conn struct {
+	rawsock.RawConn
+	fd   int
+	loop *loop
+
+	queue chan *packet.Packet
+
+	errOnce sync.Once
+	err     error // valid after done closed
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+// recv read pending packets without wait, called by loop when fd readable,
+// epoll is level triggered, remain packets will be read in next round
+func (c *Conn) recv() {
+	var cfg = c.loop.p.cfg
+	for i := 0; i < cfg.Queue; i++ {
+		pkt := c.loop.p.pool.Get().(*packet.Packet).Sets(64, cfg.MTU)
+		n, _, err := unix.Recvfrom(c.fd, pkt.Bytes(), unix.MSG_DONTWAIT|unix.MSG_TRUNC)
+		if err != nil {
+			c.loop.p.pool.Put(pkt)
+			switch err {
+			case unix.EAGAIN, unix.EINTR: // spurious wakeup or drained
+			default:
+				c.loop.del(c)
+				c.fail(errors.WithStack(err))
+			}
+			return
+		} else if n > pkt.Data() {
+			c.loop.p.pool.Put(pkt)
+			c.dropped.Add(1) // truncated
+			continue
+		}
+		pkt.SetData(n)
+		if cfg.Filter != nil && !cfg.Filter(pkt) {
+			c.loop.p.pool.Put(pkt)
+			continue
+		}
+
+		select {
+		case c.queue <- pkt:
+		default:
+			c.loop.p.pool.Put(pkt)
+			c.dropped.Add(1)
+		}
+	}
+}
+
+func (c *Conn) fail(err error) {
+	c.errOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	var p *packet.Packet
+	select {
+	case p = <-c.queue:
+	default:
+		select {
+		case p = <-c.queue:
+		case <-c.done:
+			return c.err
+		}
+	}
+	defer c.loop.p.pool.Put(p)
+
+	if pkt.Data() < p.Data() {
+		return errorx.ShortBuff(p.Data(), pkt.Data())
+	}
+	pkt.SetData(0).Append(p.Bytes()...)
+	return nil
+}
+
+// Dropped packets count for queue is full or exceed MTU
+func (c *Conn) Dropped() uint64 { return c.dropped.Load() }
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		c.loop.del(c)
+		c.fail(errors.WithStack(net.ErrClosed))
+		return []error{c.RawConn.Close()}
+	})
+}
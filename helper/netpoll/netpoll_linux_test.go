@@ -0,0 +1,191 @@
+//go:build linux
+// +build linux
+
+package netpoll_test
+
+import (
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/netpoll"
+	"github.com/stretchr/testify/require"
+)
+
+// udpConn RawConn over udp socket, payload as packet
+type udpConn struct{ *net.UDPConn }
+
+func (c *udpConn) Read(pkt *packet.Packet) error {
+	n, err := c.UDPConn.Read(pkt.Bytes())
+	if err != nil {
+		return err
+	}
+	pkt.SetData(n)
+	return nil
+}
+func (c *udpConn) Write(pkt *packet.Packet) error {
+	_, err := c.UDPConn.Write(pkt.Bytes())
+	return err
+}
+func (c *udpConn) Inject(pkt *packet.Packet) error { return nil }
+func (c *udpConn) LocalAddr() netip.AddrPort {
+	return c.UDPConn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+func (c *udpConn) RemoteAddr() netip.AddrPort {
+	return c.UDPConn.RemoteAddr().(*net.UDPAddr).AddrPort()
+}
+func (c *udpConn) SyscallConn() (syscall.RawConn, error) { return c.UDPConn.SyscallConn() }
+
+// blockConn Read wait forever, such as drop every packet internally
+type blockConn struct{ *udpConn }
+
+func (c *blockConn) Read(pkt *packet.Packet) error { select {} }
+
+func pair(t *testing.T) (*udpConn, *udpConn) {
+	a, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	b, err := net.DialUDP("udp4", nil, a.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	a.Close()
+	a, err = net.DialUDP("udp4", a.LocalAddr().(*net.UDPAddr), b.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	return &udpConn{a}, &udpConn{b}
+}
+
+func Test_Poller(t *testing.T) {
+	p, err := netpoll.New(netpoll.Loops(2))
+	require.NoError(t, err)
+	defer p.Close()
+
+	t.Run("many conns", func(t *testing.T) {
+		const n = 32
+		var conns, peers = make([]*netpoll.Conn, n), make([]*udpConn, n)
+		for i := range conns {
+			a, b := pair(t)
+			conns[i], err = p.Add(a)
+			require.NoError(t, err)
+			peers[i] = b
+		}
+
+		for i, peer := range peers {
+			_, err := peer.UDPConn.Write([]byte{byte(i)})
+			require.NoError(t, err)
+		}
+		for i, c := range conns {
+			pkt := packet.Make(0, 64)
+			require.NoError(t, c.Read(pkt))
+			require.Equal(t, []byte{byte(i)}, pkt.Bytes())
+		}
+
+		for i := range conns {
+			require.NoError(t, conns[i].Close())
+			peers[i].Close()
+		}
+	})
+
+	t.Run("close unblock read", func(t *testing.T) {
+		a, b := pair(t)
+		defer b.Close()
+		c, err := p.Add(a)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			c.Close()
+		}()
+		require.ErrorIs(t, c.Read(packet.Make(0, 64)), net.ErrClosed)
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		p, err := netpoll.New(netpoll.Queue(2), netpoll.Loops(1))
+		require.NoError(t, err)
+		defer p.Close()
+
+		a, b := pair(t)
+		defer b.Close()
+		c, err := p.Add(a)
+		require.NoError(t, err)
+		defer c.Close()
+
+		for i := 0; i < 4; i++ {
+			_, err := b.UDPConn.Write([]byte{byte(i)})
+			require.NoError(t, err)
+		}
+		require.Eventually(t, func() bool { return c.Dropped() == 2 }, time.Second, time.Millisecond*10)
+
+		pkt := packet.Make(0, 64)
+		require.NoError(t, c.Read(pkt))
+		require.Equal(t, []byte{0}, pkt.Bytes())
+	})
+
+	t.Run("not call blocking read", func(t *testing.T) {
+		p, err := netpoll.New(netpoll.Loops(1))
+		require.NoError(t, err)
+		defer p.Close()
+
+		a1, b1 := pair(t)
+		defer b1.Close()
+		c1, err := p.Add(&blockConn{a1})
+		require.NoError(t, err)
+		defer c1.Close()
+		a2, b2 := pair(t)
+		defer b2.Close()
+		c2, err := p.Add(a2)
+		require.NoError(t, err)
+		defer c2.Close()
+
+		_, err = b1.UDPConn.Write([]byte{1})
+		require.NoError(t, err)
+		_, err = b2.UDPConn.Write([]byte{2})
+		require.NoError(t, err)
+
+		for _, c := range []*netpoll.Conn{c1, c2} {
+			pkt := packet.Make(0, 64)
+			require.NoError(t, c.Read(pkt))
+			require.Len(t, pkt.Bytes(), 1)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		p, err := netpoll.New(netpoll.Filter(func(pkt *packet.Packet) bool {
+			pkt.SetHead(pkt.Head() + 1)
+			return pkt.Data() > 0
+		}))
+		require.NoError(t, err)
+		defer p.Close()
+
+		a, b := pair(t)
+		defer b.Close()
+		c, err := p.Add(a)
+		require.NoError(t, err)
+		defer c.Close()
+
+		for _, msg := range [][]byte{{1}, {1, 2, 3}} {
+			_, err := b.UDPConn.Write(msg)
+			require.NoError(t, err)
+		}
+		pkt := packet.Make(0, 64)
+		require.NoError(t, c.Read(pkt))
+		require.Equal(t, []byte{2, 3}, pkt.Bytes())
+	})
+
+	t.Run("poller close", func(t *testing.T) {
+		p, err := netpoll.New()
+		require.NoError(t, err)
+
+		a, b := pair(t)
+		defer b.Close()
+		c, err := p.Add(a)
+		require.NoError(t, err)
+		defer c.Close()
+
+		require.NoError(t, p.Close())
+		require.ErrorIs(t, c.Read(packet.Make(0, 64)), net.ErrClosed)
+
+		_, err = p.Add(a)
+		require.Error(t, err)
+	})
+}
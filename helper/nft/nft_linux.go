@@ -0,0 +1,242 @@
+//go:build linux
+// +build linux
+
+// Package nft manage the small nftables rule set rawsock needs (RST drop,
+// redirect, mark) by nft command. Every rule is tagged with owner process
+// id and start time, rules of crashed processes can be garbage collected by
+// GC, even if the pid is reused.
+package nft
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	Table       = "sockit" // inet family table
+	ownerPrefix = "sockit:"
+
+	chainOutput     = "output"
+	chainPrerouting = "prerouting"
+)
+
+// run exec nft command, return stdout
+var run = func(args ...string) (string, error) {
+	cmd := exec.Command("nft", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Errorf(`exec "%s", error: %s, message: %s`, cmd.String(), err, string(out))
+	}
+	return string(out), nil
+}
+
+// Rules rules added by current process, removed when Close
+type Rules struct {
+	owner string
+
+	mu    sync.Mutex
+	rules map[*Rule]struct{}
+}
+
+type Rule struct {
+	rules  *Rules
+	chain  string
+	handle int
+}
+
+// New create table and chains if not exist
+func New() (*Rules, error) {
+	for _, args := range [][]string{
+		{"add", "table", "inet", Table},
+		{"add", "chain", "inet", Table, chainOutput, "{ type filter hook output priority 0 ; }"},
+		{"add", "chain", "inet", Table, chainPrerouting, "{ type nat hook prerouting priority -100 ; }"},
+	} {
+		if _, err := run(args...); err != nil {
+			return nil, err
+		}
+	}
+
+	pid := os.Getpid()
+	start, ok := started(pid)
+	if !ok {
+		return nil, errors.Errorf("can't get start time of process %d", pid)
+	}
+	return &Rules{
+		owner: ownerPrefix + strconv.Itoa(pid) + ":" + strconv.FormatUint(start, 10),
+		rules: map[*Rule]struct{}{},
+	}, nil
+}
+
+// DropRST drop outbound tcp RST from laddr to raddr, invalid raddr means any
+// remote address, unspecified laddr address means any local address
+func (r *Rules) DropRST(laddr, raddr netip.AddrPort) (*Rule, error) {
+	expr := match(header.TCPProtocolNumber, laddr, raddr)
+	expr = append(expr, "tcp", "flags", "&", "rst", "==", "rst", "drop")
+	return r.add(chainOutput, expr)
+}
+
+// Redirect redirect inbound packet to dst to local port, unspecified dst
+// address means any local address
+func (r *Rules) Redirect(proto tcpip.TransportProtocolNumber, dst netip.AddrPort, port uint16) (*Rule, error) {
+	expr := match(proto, netip.AddrPort{}, dst)
+	expr = append(expr, "redirect", "to", ":"+strconv.Itoa(int(port)))
+	return r.add(chainPrerouting, expr)
+}
+
+// Mark set fwmark of outbound packet from laddr to raddr
+func (r *Rules) Mark(proto tcpip.TransportProtocolNumber, laddr, raddr netip.AddrPort, mark uint32) (*Rule, error) {
+	expr := match(proto, laddr, raddr)
+	expr = append(expr, "meta", "mark", "set", fmt.Sprintf("0x%x", mark))
+	return r.add(chainOutput, expr)
+}
+
+// match packet from src to dst, ignore invalid or unspecified address, and zero port,
+// zone of address is stripped, nft not accept it
+func match(proto tcpip.TransportProtocolNumber, src, dst netip.AddrPort) (expr []string) {
+	var p = "tcp"
+	if proto == header.UDPProtocolNumber {
+		p = "udp"
+	}
+	var addr = func(a netip.Addr, dir string) {
+		if a.IsValid() && !a.IsUnspecified() {
+			if a.Is4() {
+				expr = append(expr, "ip", dir, a.String())
+			} else {
+				expr = append(expr, "ip6", dir, a.WithZone("").String())
+			}
+		}
+	}
+	addr(src.Addr(), "saddr")
+	addr(dst.Addr(), "daddr")
+
+	expr = append(expr, "meta", "l4proto", p)
+	if src.Port() != 0 {
+		expr = append(expr, p, "sport", strconv.Itoa(int(src.Port())))
+	}
+	if dst.Port() != 0 {
+		expr = append(expr, p, "dport", strconv.Itoa(int(dst.Port())))
+	}
+	return expr
+}
+
+var handleExpr = regexp.MustCompile(`# handle (\d+)`)
+
+func (r *Rules) add(chain string, expr []string) (*Rule, error) {
+	args := append([]string{"--echo", "--handle", "add", "rule", "inet", Table, chain}, expr...)
+	args = append(args, "comment", strconv.Quote(r.owner))
+
+	out, err := run(args...)
+	if err != nil {
+		return nil, err
+	}
+	m := handleExpr.FindStringSubmatch(out)
+	if m == nil {
+		return nil, errors.Errorf("can't get rule handle: %s", out)
+	}
+	handle, _ := strconv.Atoi(m[1])
+
+	var rule = &Rule{rules: r, chain: chain, handle: handle}
+	r.mu.Lock()
+	r.rules[rule] = struct{}{}
+	r.mu.Unlock()
+	return rule, nil
+}
+
+// Remove delete the rule
+func (r *Rule) Remove() error {
+	if r == nil {
+		return nil
+	}
+	r.rules.mu.Lock()
+	_, has := r.rules.rules[r]
+	delete(r.rules.rules, r)
+	r.rules.mu.Unlock()
+	if !has {
+		return nil
+	}
+	return remove(r.chain, r.handle)
+}
+
+func remove(chain string, handle int) error {
+	_, err := run("delete", "rule", "inet", Table, chain, "handle", strconv.Itoa(handle))
+	return err
+}
+
+// Close delete all rules added by Rules
+func (r *Rules) Close() (err error) {
+	r.mu.Lock()
+	rules := r.rules
+	r.rules = map[*Rule]struct{}{}
+	r.mu.Unlock()
+
+	for rule := range rules {
+		if e := remove(rule.chain, rule.handle); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+var (
+	chainExpr = regexp.MustCompile(`^\s*chain (\S+) \{`)
+	ownerExpr = regexp.MustCompile(`comment "` + ownerPrefix + `(\d+)(?::(\d+))?" # handle (\d+)`)
+)
+
+// GC delete stale rules that owner process not exist, or the pid is reused by
+// other process, return deleted rules count
+func GC() (n int, err error) {
+	out, err := run("--handle", "list", "table", "inet", Table)
+	if err != nil {
+		return 0, err
+	}
+
+	var chain string
+	for _, line := range strings.Split(out, "\n") {
+		if m := chainExpr.FindStringSubmatch(line); m != nil {
+			chain = m[1]
+			continue
+		}
+		m := ownerExpr.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		pid, _ := strconv.Atoi(m[1])
+		if start, ok := started(pid); ok && (m[2] == "" || m[2] == strconv.FormatUint(start, 10)) {
+			continue
+		}
+
+		handle, _ := strconv.Atoi(m[3])
+		if err := remove(chain, handle); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// started get start time of process since boot in clock ticks, ok is false if
+// process not exist
+var started = func(pid int) (start uint64, ok bool) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	// comm maybe contain space, starttime is 20th field after it
+	fields := strings.Fields(string(b[bytes.LastIndexByte(b, ')')+1:]))
+	if len(fields) < 20 {
+		return 0, false
+	}
+	start, err = strconv.ParseUint(fields[19], 10, 64)
+	return start, err == nil
+}
@@ -0,0 +1,130 @@
+//go:build linux
+// +build linux
+
+package nft
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type fakeNft struct {
+	cmds   []string
+	handle int
+	list   string
+}
+
+func (f *fakeNft) run(args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	f.cmds = append(f.cmds, cmd)
+	switch {
+	case strings.HasPrefix(cmd, "--echo"):
+		f.handle++
+		return fmt.Sprintf("add rule inet sockit output %s # handle %d\n", cmd, f.handle), nil
+	case strings.HasPrefix(cmd, "--handle list"):
+		return f.list, nil
+	default:
+		return "", nil
+	}
+}
+
+func mockNft(t *testing.T) *fakeNft {
+	var f = &fakeNft{}
+	old := run
+	run = f.run
+	t.Cleanup(func() { run = old })
+	return f
+}
+
+func Test_Rules(t *testing.T) {
+	f := mockNft(t)
+
+	r, err := New()
+	require.NoError(t, err)
+	require.Len(t, f.cmds, 3)
+	f.cmds = f.cmds[:0]
+
+	rule, err := r.DropRST(
+		netip.MustParseAddrPort("10.0.0.1:8080"),
+		netip.MustParseAddrPort("10.0.0.2:1234"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1, rule.handle)
+	require.Contains(t, f.cmds[0],
+		"add rule inet sockit output ip saddr 10.0.0.1 ip daddr 10.0.0.2 meta l4proto tcp tcp sport 8080 tcp dport 1234 tcp flags & rst == rst drop comment",
+	)
+	require.Contains(t, f.cmds[0], r.owner)
+
+	_, err = r.Redirect(header.UDPProtocolNumber, netip.MustParseAddrPort("[::]:53"), 5353)
+	require.NoError(t, err)
+	require.Contains(t, f.cmds[1], "add rule inet sockit prerouting meta l4proto udp udp dport 53 redirect to :5353")
+
+	_, err = r.Mark(header.TCPProtocolNumber, netip.MustParseAddrPort("[fe80::1%eth0]:80"), netip.AddrPort{}, 0x10)
+	require.NoError(t, err)
+	require.Contains(t, f.cmds[2], "ip6 saddr fe80::1 meta l4proto tcp tcp sport 80 meta mark set 0x10")
+
+	require.NoError(t, rule.Remove())
+	require.Equal(t, "delete rule inet sockit output handle 1", f.cmds[3])
+	require.NoError(t, rule.Remove())
+	require.Len(t, f.cmds, 4)
+
+	require.NoError(t, r.Close())
+	require.Len(t, f.cmds, 6)
+}
+
+func Test_GC(t *testing.T) {
+	f := mockNft(t)
+	f.list = `table inet sockit {
+	chain output {
+		type filter hook output priority filter; policy accept;
+		ip saddr 10.0.0.1 meta l4proto tcp tcp sport 8080 tcp flags & rst == rst drop comment "sockit:100:5" # handle 4
+		ip saddr 10.0.0.1 meta l4proto tcp tcp sport 8081 tcp flags & rst == rst drop comment "sockit:200:7" # handle 5
+		ip saddr 10.0.0.1 meta l4proto tcp tcp sport 8082 tcp flags & rst == rst drop comment "sockit:200:3" # handle 7
+		ip saddr 10.0.0.1 meta l4proto tcp tcp sport 8083 tcp flags & rst == rst drop comment "sockit:300" # handle 8
+	}
+	chain prerouting {
+		type nat hook prerouting priority dstnat; policy accept;
+		meta l4proto udp udp dport 53 redirect to :5353 comment "sockit:100:5" # handle 6
+	}
+}
+`
+	// pid 200 is reused after rule handle 7 added, rule without start time
+	// only check pid
+	old := started
+	started = func(pid int) (uint64, bool) {
+		switch pid {
+		case 200:
+			return 7, true
+		case 300:
+			return 1, true
+		default:
+			return 0, false
+		}
+	}
+	defer func() { started = old }()
+
+	n, err := GC()
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, []string{
+		"--handle list table inet sockit",
+		"delete rule inet sockit output handle 4",
+		"delete rule inet sockit output handle 7",
+		"delete rule inet sockit prerouting handle 6",
+	}, f.cmds)
+}
+
+func Test_Started(t *testing.T) {
+	start, ok := started(os.Getpid())
+	require.True(t, ok)
+	require.NotZero(t, start)
+
+	_, ok = started(-1)
+	require.False(t, ok)
+}
@@ -0,0 +1,83 @@
+package obfs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// XOR xor transport payload with key stream derived from key, the packet
+// size not changed
+type XOR struct {
+	proto tcpip.TransportProtocolNumber
+	pad   [sha256.Size]byte
+}
+
+var _ Obfuscator = (*XOR)(nil)
+
+func NewXOR(proto tcpip.TransportProtocolNumber, key []byte) (*XOR, error) {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return nil, errors.Errorf("not support transport protocol %d", proto)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty xor key")
+	}
+	return &XOR{proto: proto, pad: sha256.Sum256(key)}, nil
+}
+
+func (x *XOR) Seal(pkt *packet.Packet) error { return x.xor(pkt.Bytes()) }
+func (x *XOR) Open(pkt *packet.Packet) error { return x.xor(pkt.Bytes()) }
+
+func (x *XOR) xor(b []byte) error {
+	n, err := hdrLen(x.proto, b)
+	if err != nil {
+		return err
+	}
+	for i, payload := 0, b[n:]; i < len(payload); i++ {
+		payload[i] ^= x.pad[i%len(x.pad)]
+	}
+	return nil
+}
+
+// Scramble scramble tcp header's sequence, acknowledgment, window and urgent
+// fields with key, hide tcp session features from middlebox
+type Scramble struct {
+	seq, ack    uint32
+	wnd, urgent uint16
+}
+
+var _ Obfuscator = (*Scramble)(nil)
+
+func NewScramble(key []byte) (*Scramble, error) {
+	if len(key) == 0 {
+		return nil, errors.New("empty scramble key")
+	}
+	h := sha256.Sum256(key)
+	return &Scramble{
+		seq:    binary.BigEndian.Uint32(h[0:]),
+		ack:    binary.BigEndian.Uint32(h[4:]),
+		wnd:    binary.BigEndian.Uint16(h[8:]),
+		urgent: binary.BigEndian.Uint16(h[10:]),
+	}, nil
+}
+
+func (s *Scramble) Seal(pkt *packet.Packet) error { return s.scramble(pkt.Bytes()) }
+func (s *Scramble) Open(pkt *packet.Packet) error { return s.scramble(pkt.Bytes()) }
+
+func (s *Scramble) scramble(b []byte) error {
+	if len(b) < header.TCPMinimumSize {
+		return errors.Errorf("invalid tcp packet, bytes %d", len(b))
+	}
+	tcp := header.TCP(b)
+	tcp.SetSequenceNumber(tcp.SequenceNumber() ^ s.seq)
+	tcp.SetAckNumber(tcp.AckNumber() ^ s.ack)
+	tcp.SetWindowSize(tcp.WindowSize() ^ s.wnd)
+	tcp.SetUrgentPointer(tcp.UrgentPointer() ^ s.urgent)
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package obfs pluggable obfuscation layer of RawConn
+package obfs
+
+import (
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Obfuscator obfuscate transport packet, the pkt start with transport header
+type Obfuscator interface {
+	// Seal obfuscate pkt in place, can attach/append bytes, but should
+	// keep src/dst port unchanged, otherwise can't be received by peer.
+	Seal(pkt *packet.Packet) error
+
+	// Open restore pkt sealed by peer in place
+	Open(pkt *packet.Packet) error
+}
+
+// Chain combine obfuscators, Seal in order and Open in reverse order
+func Chain(obfs ...Obfuscator) Obfuscator { return chain(obfs) }
+
+type chain []Obfuscator
+
+func (c chain) Seal(pkt *packet.Packet) error {
+	for _, o := range c {
+		if err := o.Seal(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c chain) Open(pkt *packet.Packet) error {
+	for i := len(c) - 1; i >= 0; i-- {
+		if err := c[i].Open(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Conn apply Obfuscator on Write/Read, and re-calculate transport checksum,
+// Inject not be obfuscated. Write will modify the pkt.
+type Conn struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	obfs  Obfuscator
+
+	inSum, outSum uint16 // pseudo header checksum without length
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, obfs Obfuscator) *Conn {
+	var (
+		laddr = tcpip.AddrFromSlice(child.LocalAddr().Addr().AsSlice())
+		raddr = tcpip.AddrFromSlice(child.RemoteAddr().Addr().AsSlice())
+	)
+	return &Conn{
+		RawConn: child,
+		proto:   proto,
+		obfs:    obfs,
+		inSum:   header.PseudoHeaderChecksum(proto, raddr, laddr, 0),
+		outSum:  header.PseudoHeaderChecksum(proto, laddr, raddr, 0),
+	}
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	if err = c.RawConn.Read(pkt); err != nil {
+		return err
+	}
+	if err = c.obfs.Open(pkt); err != nil {
+		return err
+	}
+	return c.checksum(pkt.Bytes(), c.inSum)
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	if err = c.obfs.Seal(pkt); err != nil {
+		return err
+	}
+	if err = c.checksum(pkt.Bytes(), c.outSum); err != nil {
+		return err
+	}
+	return c.RawConn.Write(pkt)
+}
+
+func (c *Conn) checksum(b []byte, psum uint16) error {
+	switch c.proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+		if _, err := hdrLen(c.proto, b); err != nil {
+			return err
+		}
+		ipstack.Checksum(c.proto, b, psum)
+	}
+	return nil
+}
+
+// hdrLen transport header length
+func hdrLen(proto tcpip.TransportProtocolNumber, b []byte) (int, error) {
+	switch proto {
+	case header.TCPProtocolNumber:
+		if len(b) < header.TCPMinimumSize || len(b) < int(header.TCP(b).DataOffset()) {
+			return 0, errors.Errorf("invalid tcp packet, bytes %d", len(b))
+		}
+		return int(header.TCP(b).DataOffset()), nil
+	case header.UDPProtocolNumber:
+		if len(b) < header.UDPMinimumSize {
+			return 0, errors.Errorf("invalid udp packet, bytes %d", len(b))
+		}
+		return header.UDPMinimumSize, nil
+	default:
+		return 0, errors.Errorf("not support transport protocol %d", proto)
+	}
+}
@@ -0,0 +1,69 @@
+package obfs_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/obfs"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Obfs(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		key   = []byte("secret")
+	)
+	newObfs := func() obfs.Obfuscator {
+		x, err := obfs.NewXOR(header.TCPProtocolNumber, key)
+		require.NoError(t, err)
+		s, err := obfs.NewScramble(key)
+		require.NoError(t, err)
+		return obfs.Chain(x, s)
+	}
+	randTCP := func() header.TCP {
+		for {
+			tcp := header.TCP(test.StripIP(test.RandTCP(t, caddr, saddr)))
+			if len(tcp.Payload()) > 16 {
+				return tcp
+			}
+		}
+	}
+
+	t.Run("pingpong", func(t *testing.T) {
+		c, s := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+		client := obfs.Wrap(c, header.TCPProtocolNumber, newObfs())
+		server := obfs.Wrap(s, header.TCPProtocolNumber, newObfs())
+
+		tcp := randTCP()
+		require.NoError(t, client.Write(packet.Make(64).Append(tcp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, server.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.TCPProtocolNumber, pkt.Bytes()))
+		got := header.TCP(pkt.Bytes())
+		require.Equal(t, tcp.SequenceNumber(), got.SequenceNumber())
+		require.Equal(t, tcp.AckNumber(), got.AckNumber())
+		require.Equal(t, []byte(tcp.Payload()), []byte(got.Payload()))
+	})
+
+	t.Run("obfuscated", func(t *testing.T) {
+		c, server := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+		client := obfs.Wrap(c, header.TCPProtocolNumber, newObfs())
+
+		tcp := randTCP()
+		require.NoError(t, client.Write(packet.Make(64).Append(tcp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, server.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.TCPProtocolNumber, pkt.Bytes()))
+		got := header.TCP(pkt.Bytes())
+		require.Equal(t, tcp.SourcePort(), got.SourcePort())
+		require.Equal(t, tcp.DestinationPort(), got.DestinationPort())
+		require.NotEqual(t, tcp.SequenceNumber(), got.SequenceNumber())
+		require.NotEqual(t, []byte(tcp.Payload()), []byte(got.Payload()))
+	})
+}
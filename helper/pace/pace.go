@@ -0,0 +1,155 @@
+// Package pace outbound pacing of RawConn by token bucket, relays can
+// enforce bandwidth caps without external tc setup.
+package pace
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// Shaper token bucket limit bytes/sec, can be shared across conns as a global shaper
+type Shaper struct {
+	l *rate.Limiter
+}
+
+// NewShaper create shaper, limit bytes per second, allow burst bytes at once,
+// bytes <= 0 means no limit
+func NewShaper(bytes, burst int) *Shaper {
+	limit := rate.Limit(bytes)
+	if bytes <= 0 {
+		limit = rate.Inf
+	}
+	return &Shaper{l: rate.NewLimiter(limit, max(burst, 1))}
+}
+
+// SetRate update limit, take effect immediately
+func (s *Shaper) SetRate(bytes, burst int) {
+	limit := rate.Limit(bytes)
+	if bytes <= 0 {
+		limit = rate.Inf
+	}
+	s.l.SetLimit(limit)
+	s.l.SetBurst(max(burst, 1))
+}
+
+// Wait wait n bytes tokens
+func (s *Shaper) Wait(ctx context.Context, n int) error {
+	for n > 0 {
+		// WaitN not allow n exceed burst, wait by burst pieces
+		m := min(n, s.l.Burst())
+		if err := s.l.WaitN(ctx, m); err != nil {
+			if ctx.Err() == nil && m > s.l.Burst() {
+				continue // burst shrunk by SetRate
+			}
+			return errors.WithStack(err)
+		}
+		n -= m
+	}
+	return nil
+}
+
+type Config struct {
+	Shapers []*Shaper
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Rate limit the conn bytes per second, allow burst bytes at once
+func Rate(bytes, burst int) Option {
+	return func(c *Config) {
+		c.Shapers = append(c.Shapers, NewShaper(bytes, burst))
+	}
+}
+
+// Shared limit the conn by shaper shared with other conns
+func Shared(s *Shaper) Option {
+	return func(c *Config) {
+		c.Shapers = append(c.Shapers, s)
+	}
+}
+
+type Stats struct {
+	Bytes   uint64 // written bytes
+	Packets uint64 // written packets
+}
+
+// Conn pacing RawConn, Write blocked until all shapers allow
+type Conn struct {
+	rawsock.RawConn
+	cfg *Config
+
+	bytes, packets atomic.Uint64
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, opts ...Option) *Conn {
+	var c = &Conn{
+		RawConn: child,
+		cfg:     Options(opts...),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	if err = c.wait(pkt.Data()); err != nil {
+		return err
+	}
+	if err = c.RawConn.Write(pkt); err == nil {
+		c.bytes.Add(uint64(pkt.Data()))
+		c.packets.Add(1)
+	}
+	return err
+}
+
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	if err = c.wait(pkt.Data()); err != nil {
+		return err
+	}
+	return c.RawConn.Inject(pkt)
+}
+
+func (c *Conn) wait(n int) error {
+	for _, s := range c.cfg.Shapers {
+		if err := s.Wait(c.ctx, n); err != nil {
+			if c.closeErr.Closed() {
+				return c.closeErr.Close(nil) // closed error
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		Bytes:   c.bytes.Load(),
+		Packets: c.packets.Load(),
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		c.cancel()
+		return []error{c.RawConn.Close()}
+	})
+}
@@ -0,0 +1,63 @@
+package pace_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/pace"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Pace(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	t.Run("rate", func(t *testing.T) {
+		c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		defer s.Close()
+		conn := pace.Wrap(c, pace.Rate(1024*10, 1024))
+		defer conn.Close()
+
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, conn.Write(packet.Make(0, 1024)))
+		}
+		// first burst is free
+		require.Greater(t, time.Since(start), time.Millisecond*800)
+		require.Equal(t, uint64(1024*10), conn.Stats().Bytes)
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		shaper := pace.NewShaper(1024*10, 2048)
+		c1, s1 := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		defer s1.Close()
+		c2, s2 := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		defer s2.Close()
+		conn1, conn2 := pace.Wrap(c1, pace.Shared(shaper)), pace.Wrap(c2, pace.Shared(shaper))
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			require.NoError(t, conn1.Write(packet.Make(0, 1024)))
+			require.NoError(t, conn2.Write(packet.Make(0, 1024)))
+		}
+		require.Greater(t, time.Since(start), time.Millisecond*700)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		defer s.Close()
+		conn := pace.Wrap(c, pace.Rate(1, 1))
+
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			conn.Close()
+		}()
+		require.Error(t, conn.Write(packet.Make(0, 1024)))
+	})
+}
@@ -0,0 +1,175 @@
+package pconn
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// PacketConn adapt RawConn to net.PacketConn, so that can be used by
+// third-party libraries, such as quic-go, kcp-go.
+//
+// if proto is udp, ReadFrom/WriteTo read/write udp payload, otherwise
+// read/write transport packet with header.
+type PacketConn struct {
+	raw   rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	psum  uint16 // outbound pseudo header checksum without length
+
+	pool sync.Pool
+	buff chan *packet.Packet
+	err  error // valid after buff closed
+
+	rd, wd *deadline
+
+	done     chan struct{}
+	closeErr errorx.CloseErr
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+func New(raw rawsock.RawConn, proto tcpip.TransportProtocolNumber) *PacketConn {
+	var c = &PacketConn{
+		raw:   raw,
+		proto: proto,
+		psum: header.PseudoHeaderChecksum(
+			proto, addr(raw.LocalAddr().Addr()), addr(raw.RemoteAddr().Addr()), 0,
+		),
+		pool: sync.Pool{New: func() any { return packet.Make(0, 0xffff) }},
+		buff: make(chan *packet.Packet, 16),
+		rd:   newDeadline(),
+		wd:   newDeadline(),
+		done: make(chan struct{}),
+	}
+
+	go c.recvService()
+	return c
+}
+
+func addr(a netip.Addr) tcpip.Address { return tcpip.AddrFromSlice(a.AsSlice()) }
+
+func (c *PacketConn) recvService() {
+	defer close(c.buff)
+	for {
+		pkt := c.pool.Get().(*packet.Packet).Sets(0, 0xffff)
+		if err := c.raw.Read(pkt); err != nil {
+			c.err = err
+			return
+		}
+
+		select {
+		case c.buff <- pkt:
+		case <-c.done:
+			c.err = errors.WithStack(net.ErrClosed)
+			return
+		}
+	}
+}
+
+func (c *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	var pkt *packet.Packet
+	select {
+	case <-c.rd.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	default:
+	}
+	select {
+	case <-c.rd.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	case p, ok := <-c.buff:
+		if !ok {
+			return 0, nil, c.err
+		}
+		pkt = p
+	}
+	defer c.pool.Put(pkt)
+
+	if c.proto == header.UDPProtocolNumber {
+		if pkt.Data() < header.UDPMinimumSize {
+			return 0, nil, errors.Errorf("recved invalid udp packet, bytes %d", pkt.Data())
+		}
+		pkt.DetachN(header.UDPMinimumSize)
+	}
+
+	// same as udp, discard excess bytes
+	n = copy(b, pkt.Bytes())
+	return n, c.RemoteAddr(), nil
+}
+
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.wd.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	if a, err := addrPort(addr); err != nil {
+		return 0, err
+	} else if a != c.raw.RemoteAddr() {
+		return 0, errors.Errorf("not support write to %s, only %s", a, c.raw.RemoteAddr())
+	}
+
+	pkt := packet.Make(64, 0, header.UDPMinimumSize+len(b))
+	if c.proto == header.UDPProtocolNumber {
+		udp := header.UDP(pkt.AppendN(header.UDPMinimumSize).Append(b...).Bytes())
+		udp.Encode(&header.UDPFields{
+			SrcPort: c.raw.LocalAddr().Port(),
+			DstPort: c.raw.RemoteAddr().Port(),
+			Length:  uint16(len(udp)),
+		})
+		udp.SetChecksum(^checksum.Checksum(udp, checksum.Combine(c.psum, uint16(len(udp)))))
+	} else {
+		pkt.Append(b...)
+	}
+
+	if err := c.raw.Write(pkt); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func addrPort(addr net.Addr) (netip.AddrPort, error) {
+	var a netip.AddrPort
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		a = addr.AddrPort()
+	case *net.TCPAddr:
+		a = addr.AddrPort()
+	default:
+		return a, errors.Errorf("not support address type %T", addr)
+	}
+	return netip.AddrPortFrom(a.Addr().Unmap(), a.Port()), nil
+}
+
+func (c *PacketConn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		close(c.done)
+		return []error{c.raw.Close()}
+	})
+}
+
+func (c *PacketConn) LocalAddr() net.Addr  { return c.netAddr(c.raw.LocalAddr()) }
+func (c *PacketConn) RemoteAddr() net.Addr { return c.netAddr(c.raw.RemoteAddr()) }
+func (c *PacketConn) netAddr(a netip.AddrPort) net.Addr {
+	if c.proto == header.UDPProtocolNumber {
+		return net.UDPAddrFromAddrPort(a)
+	}
+	return net.TCPAddrFromAddrPort(a)
+}
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+func (c *PacketConn) SetReadDeadline(t time.Time) error  { c.rd.set(t); return nil }
+func (c *PacketConn) SetWriteDeadline(t time.Time) error { c.wd.set(t); return nil }
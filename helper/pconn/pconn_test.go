@@ -0,0 +1,68 @@
+package pconn_test
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/pconn"
+	"github.com/lysShub/rawsock/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_PacketConn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	craw, sraw := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr, test.ValidAddr, test.ValidChecksum)
+	client := pconn.New(craw, header.UDPProtocolNumber)
+	defer client.Close()
+	server := pconn.New(sraw, header.UDPProtocolNumber)
+	defer server.Close()
+
+	t.Run("ReadFrom/WriteTo", func(t *testing.T) {
+		msg := []byte("hello world")
+		n, err := client.WriteTo(msg, net.UDPAddrFromAddrPort(saddr))
+		require.NoError(t, err)
+		require.Equal(t, len(msg), n)
+
+		var b = make([]byte, 1536)
+		n, addr, err := server.ReadFrom(b)
+		require.NoError(t, err)
+		require.Equal(t, msg, b[:n])
+		require.Equal(t, caddr, addr.(*net.UDPAddr).AddrPort())
+	})
+
+	t.Run("WriteTo/invalid-addr", func(t *testing.T) {
+		addr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(test.RandIP(), test.RandPort()))
+		_, err := client.WriteTo([]byte("hello"), addr)
+		require.Error(t, err)
+	})
+
+	t.Run("ReadDeadline", func(t *testing.T) {
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Millisecond*50)))
+
+		s := time.Now()
+		_, _, err := server.ReadFrom(make([]byte, 1536))
+		require.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+		require.Less(t, time.Since(s), time.Second)
+
+		require.NoError(t, server.SetReadDeadline(time.Time{}))
+		_, err = client.WriteTo([]byte("hello"), net.UDPAddrFromAddrPort(saddr))
+		require.NoError(t, err)
+		_, _, err = server.ReadFrom(make([]byte, 1536))
+		require.NoError(t, err)
+	})
+
+	t.Run("WriteDeadline", func(t *testing.T) {
+		require.NoError(t, client.SetWriteDeadline(time.Now().Add(-time.Second)))
+		_, err := client.WriteTo([]byte("hello"), net.UDPAddrFromAddrPort(saddr))
+		require.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+		require.NoError(t, client.SetWriteDeadline(time.Time{}))
+	})
+}
@@ -0,0 +1,108 @@
+// Package pkt bounds-checked accessors of packet.Packet, packet.Packet
+// silently clamp or re-alloc when out of bounds, which maybe corrupt
+// adjacent headers.
+package pkt
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lysShub/netkit/debug"
+	"github.com/lysShub/netkit/packet"
+	"github.com/pkg/errors"
+)
+
+// ErrOutOfBounds operate packet out of bounds
+type ErrOutOfBounds struct {
+	Op   string
+	Want int // require size
+	Max  int // max valid size
+}
+
+func (e *ErrOutOfBounds) Error() string {
+	return fmt.Sprintf("packet %s %d out of bounds %d", e.Op, e.Want, e.Max)
+}
+
+// SetHead set head section size, head can't exceed head+data section
+func SetHead(p *packet.Packet, head int) error {
+	if max := p.Head() + p.Data(); head < 0 || head > max {
+		return fail(&ErrOutOfBounds{Op: "SetHead", Want: head, Max: max})
+	}
+	p.SetHead(head)
+	return nil
+}
+
+// SetData set data section size, data can't exceed data+tail section
+func SetData(p *packet.Packet, data int) error {
+	if max := p.Data() + p.Tail(); data < 0 || data > max {
+		return fail(&ErrOutOfBounds{Op: "SetData", Want: data, Max: max})
+	}
+	p.SetData(data)
+	return nil
+}
+
+// Sets set head and data section size
+func Sets(p *packet.Packet, head, data int) error {
+	if err := SetHead(p, head); err != nil {
+		return err
+	}
+	return SetData(p, data)
+}
+
+// TryAttach attach b ahead data section, return error instead of re-alloc
+// if head section too short
+func TryAttach(p *packet.Packet, b ...byte) error {
+	if len(b) > p.Head() {
+		return fail(&ErrOutOfBounds{Op: "Attach", Want: len(b), Max: p.Head()})
+	}
+	p.Attach(b...)
+	return nil
+}
+
+// TryAppend append b after data section, return error instead of re-alloc
+// if tail section too short
+func TryAppend(p *packet.Packet, b ...byte) error {
+	if len(b) > p.Tail() {
+		return fail(&ErrOutOfBounds{Op: "Append", Want: len(b), Max: p.Tail()})
+	}
+	p.Append(b...)
+	return nil
+}
+
+// Push in-place push n bytes header ahead data section, return the header
+// for fill, it's zero-alloc if head section enough
+func Push(p *packet.Packet, n int) []byte {
+	return p.AttachN(n).Bytes()[:n:n]
+}
+
+// AppendUint16 append big endian v after data section
+func AppendUint16(p *packet.Packet, v uint16) *packet.Packet {
+	b := p.AppendN(2).Bytes()
+	binary.BigEndian.PutUint16(b[len(b)-2:], v)
+	return p
+}
+
+// AppendUint32 append big endian v after data section
+func AppendUint32(p *packet.Packet, v uint32) *packet.Packet {
+	b := p.AppendN(4).Bytes()
+	binary.BigEndian.PutUint32(b[len(b)-4:], v)
+	return p
+}
+
+// ReserveTail ensure tail section at least n bytes, re-alloc at most once,
+// so following Append not alloc
+func ReserveTail(p *packet.Packet, n int) *packet.Packet {
+	if p.Tail() < n {
+		data := p.Data()
+		p.AppendN(n).SetData(data)
+	}
+	return p
+}
+
+// fail panic in debug mode, for find bug early
+func fail(e *ErrOutOfBounds) error {
+	if debug.Debug() {
+		panic(errors.WithStack(e))
+	}
+	return errors.WithStack(e)
+}
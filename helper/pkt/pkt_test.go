@@ -0,0 +1,61 @@
+package pkt_test
+
+import (
+	"testing"
+
+	"github.com/lysShub/netkit/debug"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/pkt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bounds(t *testing.T) {
+	if debug.Debug() {
+		t.Skip("panic in debug mode")
+	}
+
+	var p = packet.Make(4, 8, 2)
+	var e *pkt.ErrOutOfBounds
+
+	require.NoError(t, pkt.SetHead(p, 12))
+	require.Equal(t, 0, p.Data())
+	require.True(t, errors.As(pkt.SetHead(p, 13), &e))
+	require.Equal(t, pkt.ErrOutOfBounds{Op: "SetHead", Want: 13, Max: 12}, *e)
+
+	require.NoError(t, pkt.Sets(p, 4, 10))
+	require.True(t, errors.As(pkt.SetData(p, 11), &e))
+	require.Equal(t, 10, p.Data())
+
+	require.NoError(t, pkt.Sets(p, 4, 8))
+	require.NoError(t, pkt.TryAttach(p, 1, 2, 3, 4))
+	require.Error(t, pkt.TryAttach(p, 1))
+	require.NoError(t, pkt.TryAppend(p, 1, 2))
+	require.Error(t, pkt.TryAppend(p, 1))
+	require.Equal(t, 14, p.Data())
+	require.Equal(t, []byte{1, 2, 3, 4}, p.Bytes()[:4])
+}
+
+func Test_Append(t *testing.T) {
+	var p = packet.Make(20, 0, 0)
+
+	pkt.ReserveTail(p, 6)
+	require.GreaterOrEqual(t, p.Tail(), 6)
+	require.Equal(t, 20, p.Head())
+	require.Zero(t, p.Data())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		p.SetData(0)
+		pkt.AppendUint16(p, 0x0102)
+		pkt.AppendUint32(p, 0x03040506)
+		copy(pkt.Push(p, 4), []byte{7, 8, 9, 10})
+		p.DetachN(4)
+	})
+	require.Zero(t, allocs)
+	require.Equal(t, []byte{1, 2, 3, 4, 5, 6}, p.Bytes())
+	require.Equal(t, 20, p.Head())
+
+	hdr := pkt.Push(p, 2)
+	require.Equal(t, 2, cap(hdr))
+	require.Equal(t, 8, p.Data())
+}
@@ -0,0 +1,227 @@
+// Package qos outbound priority queues of RawConn, packets written with
+// priority class, and drained strictly or weighted, so control/keepalive
+// packets aren't starved behind bulk data on congested uplinks.
+package qos
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+)
+
+// default classes, smaller value has higher priority
+const (
+	Control = 0
+	Normal  = 1
+	Bulk    = 2
+)
+
+type Config struct {
+	Weights []int // weight of every class, nil means strict priority
+	Classes int   // classes count
+	Default int   // class of Write
+	Queue   int   // queue size of every class
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Classes: 3,
+		Default: Normal,
+		Queue:   128,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Weights != nil {
+		cfg.Classes = len(cfg.Weights)
+	}
+	cfg.Default = min(max(cfg.Default, 0), cfg.Classes-1)
+	return cfg
+}
+
+// Strict drain classes strictly by priority, default with 3 classes
+func Strict(classes int) Option {
+	return func(c *Config) {
+		c.Classes, c.Weights = max(classes, 1), nil
+	}
+}
+
+// Weighted drain classes by weighted round-robin, class i send up to weights[i]
+// packets per round, weight <= 0 is taken as 1, so every class can be drained
+func Weighted(weights ...int) Option {
+	return func(c *Config) {
+		if len(weights) > 0 {
+			c.Weights = make([]int, len(weights))
+			for i, w := range weights {
+				c.Weights[i] = max(w, 1)
+			}
+		}
+	}
+}
+
+// Default class of Write, default Normal
+func Default(class int) Option {
+	return func(c *Config) {
+		c.Default = class
+	}
+}
+
+// Queue queue size of every class, default 128
+func Queue(n int) Option {
+	return func(c *Config) {
+		c.Queue = max(n, 1)
+	}
+}
+
+type Stats struct {
+	Sent []uint64 // sent packets of every class
+}
+
+// Conn qos RawConn, Write enqueue packet copy and return, send error will
+// be returned by next write.
+type Conn struct {
+	rawsock.RawConn
+	cfg *Config
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  [][]*packet.Packet
+	credits []int
+	next    int
+	err     error
+
+	sent []atomic.Uint64
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, opts ...Option) *Conn {
+	var c = &Conn{
+		RawConn: child,
+		cfg:     Options(opts...),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.queues = make([][]*packet.Packet, c.cfg.Classes)
+	c.credits = make([]int, c.cfg.Classes)
+	c.sent = make([]atomic.Uint64, c.cfg.Classes)
+
+	go c.sendService()
+	return c
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	return c.WritePriority(pkt, c.cfg.Default)
+}
+
+// WritePriority write packet with priority class, block when the class queue is full
+func (c *Conn) WritePriority(pkt *packet.Packet, class int) error {
+	if class < 0 || class >= c.cfg.Classes {
+		return errors.Errorf("invalid class %d", class)
+	}
+	pkt = pkt.Clone()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queues[class]) >= c.cfg.Queue && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.err != nil {
+		return c.err
+	}
+	c.queues[class] = append(c.queues[class], pkt)
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *Conn) sendService() {
+	for {
+		c.mu.Lock()
+		class := c.pick()
+		for class < 0 && c.err == nil {
+			c.cond.Wait()
+			class = c.pick()
+		}
+		if c.err != nil {
+			c.mu.Unlock()
+			return
+		}
+		pkt := c.queues[class][0]
+		c.queues[class][0] = nil
+		c.queues[class] = c.queues[class][1:]
+		c.cond.Broadcast()
+		c.mu.Unlock()
+
+		if err := c.RawConn.Write(pkt); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.cond.Broadcast()
+			c.mu.Unlock()
+			return
+		}
+		c.sent[class].Add(1)
+	}
+}
+
+// pick next send class, return -1 if all queues empty
+func (c *Conn) pick() int {
+	if c.cfg.Weights == nil {
+		for i, q := range c.queues {
+			if len(q) > 0 {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for refill := 0; refill < 2; refill++ {
+		for i := 0; i < len(c.queues); i++ {
+			class := (c.next + i) % len(c.queues)
+			if len(c.queues[class]) > 0 && c.credits[class] > 0 {
+				c.credits[class]--
+				if c.credits[class] == 0 {
+					c.next = class + 1
+				} else {
+					c.next = class
+				}
+				return class
+			}
+		}
+		copy(c.credits, c.cfg.Weights)
+		c.next = 0
+	}
+	return -1
+}
+
+func (c *Conn) Stats() Stats {
+	var s = Stats{Sent: make([]uint64, len(c.sent))}
+	for i := range c.sent {
+		s.Sent[i] = c.sent[i].Load()
+	}
+	return s
+}
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = errors.WithStack(net.ErrClosed)
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		return []error{c.RawConn.Close()}
+	})
+}
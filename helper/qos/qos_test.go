@@ -0,0 +1,98 @@
+package qos_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/qos"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// blockConn block first Write until released
+type blockConn struct {
+	rawsock.RawConn
+	entered, release chan struct{}
+}
+
+func (b *blockConn) Write(pkt *packet.Packet) error {
+	if b.entered != nil {
+		close(b.entered)
+		b.entered = nil
+		<-b.release
+	}
+	return b.RawConn.Write(pkt)
+}
+
+func Test_QoS(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	var run = func(t *testing.T, writes []int, opts ...qos.Option) (order []int) {
+		c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		entered, release := make(chan struct{}), make(chan struct{})
+		conn := qos.Wrap(&blockConn{RawConn: c, entered: entered, release: release}, opts...)
+		defer conn.Close()
+
+		var udp = func(class int) *packet.Packet {
+			b := header.UDP(make([]byte, header.UDPMinimumSize+1))
+			b.SetSourcePort(caddr.Port())
+			b.SetDestinationPort(saddr.Port())
+			b.Payload()[0] = byte(class)
+			return packet.Make(64).Append(b...)
+		}
+
+		// first packet block the sender, let others queued
+		require.NoError(t, conn.Write(udp(0xff)))
+		<-entered
+		for _, class := range writes {
+			require.NoError(t, conn.WritePriority(udp(class), class))
+		}
+		close(release)
+
+		for i := 0; i < len(writes)+1; i++ {
+			var pkt = packet.Make(0, 64)
+			require.NoError(t, s.Read(pkt))
+			if i > 0 {
+				order = append(order, int(header.UDP(pkt.Bytes()).Payload()[0]))
+			}
+		}
+		return order
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		order := run(t,
+			[]int{qos.Bulk, qos.Bulk, qos.Normal, qos.Control, qos.Bulk, qos.Control},
+		)
+		require.Equal(t, []int{0, 0, 1, 2, 2, 2}, order)
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		order := run(t,
+			[]int{1, 1, 1, 0, 0, 0, 0, 0},
+			qos.Weighted(2, 1), qos.Default(0),
+		)
+		// blocked packet used a class 0 credit of first round
+		require.Equal(t, []int{0, 1, 0, 0, 1, 0, 0, 1}, order)
+	})
+
+	t.Run("zero weight", func(t *testing.T) {
+		order := run(t,
+			[]int{1, 1, 0},
+			qos.Weighted(1, 0), qos.Default(0),
+		)
+		require.Equal(t, []int{1, 0, 1}, order)
+	})
+
+	t.Run("invalid class", func(t *testing.T) {
+		c, _ := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+		conn := qos.Wrap(c)
+		defer conn.Close()
+		require.Error(t, conn.WritePriority(packet.Make(0, 8), 3))
+	})
+}
@@ -0,0 +1,290 @@
+// Package reorder wrap RawConn, buffer out-of-order packets briefly, drop
+// duplicate packets, and release packets by sending order. Useful when the
+// underlying path (or multipath bonding) reorders traffic.
+//
+// Write append a 4 bytes sequence trailer to every packet:
+//
+//	| transport packet | seq |
+package reorder
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	Window int           // max out-of-order packets buffered
+	Delay  time.Duration // max time a packet wait for the gap before it
+	MTU    int           // read buffer size
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Window: 64,
+		Delay:  time.Millisecond * 20,
+		MTU:    1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Window max out-of-order packets buffered, default 64, when exceed, treat
+// the gap as lost
+func Window(n int) Option {
+	return func(c *Config) {
+		c.Window = max(n, 1)
+	}
+}
+
+// Delay max time a buffered packet wait for the gap, default 20ms
+func Delay(d time.Duration) Option {
+	return func(c *Config) {
+		c.Delay = d
+	}
+}
+
+// MTU read buffer size, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+const trailerSize = 4
+
+type Stats struct {
+	Reordered  uint64 // packets buffered for arrive early
+	Duplicated uint64 // packets dropped for duplicate or arrive too late
+	Lost       uint64 // sequences skipped
+}
+
+// Conn reorder RawConn, peers should both use Conn. Read isn't concurrent safe.
+type Conn struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	cfg   *Config
+
+	inSum, outSum uint16 // pseudo header checksum without length
+	seq           atomic.Uint32
+
+	in  chan *segment
+	out chan *packet.Packet
+	err error // valid after out closed
+
+	reordered, duplicated, lost atomic.Uint64
+
+	done     chan struct{}
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+type segment struct {
+	seq  uint32
+	pkt  *packet.Packet
+	time time.Time
+}
+
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, opts ...Option) (*Conn, error) {
+	switch proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+	default:
+		return nil, errors.Errorf("not support transport protocol %d", proto)
+	}
+
+	var c = &Conn{
+		RawConn: child,
+		proto:   proto,
+		cfg:     Options(opts...),
+		in:      make(chan *segment, 64),
+		out:     make(chan *packet.Packet, 64),
+		done:    make(chan struct{}),
+	}
+	var (
+		laddr = tcpip.AddrFromSlice(child.LocalAddr().Addr().AsSlice())
+		raddr = tcpip.AddrFromSlice(child.RemoteAddr().Addr().AsSlice())
+	)
+	c.inSum = header.PseudoHeaderChecksum(proto, raddr, laddr, 0)
+	c.outSum = header.PseudoHeaderChecksum(proto, laddr, raddr, 0)
+
+	go c.recvService()
+	go c.sortService()
+	return c, nil
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	pkt.Append(binary.BigEndian.AppendUint32(nil, c.seq.Add(1)-1)...)
+	ipstack.Checksum(c.proto, pkt.Bytes(), c.outSum)
+	return c.RawConn.Write(pkt)
+}
+
+func (c *Conn) recvService() (err error) {
+	defer func() {
+		c.err = err
+		close(c.in)
+	}()
+
+	for {
+		var pkt = packet.Make(0, c.cfg.MTU)
+		if err = c.RawConn.Read(pkt); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			}
+			return err
+		}
+		if pkt.Data() < trailerSize {
+			continue
+		}
+		b := pkt.Bytes()
+		seg := &segment{
+			seq:  binary.BigEndian.Uint32(b[len(b)-trailerSize:]),
+			pkt:  pkt.SetData(len(b) - trailerSize),
+			time: time.Now(),
+		}
+		ipstack.Checksum(c.proto, pkt.Bytes(), c.inSum)
+
+		select {
+		case c.in <- seg:
+		case <-c.done:
+			return errors.WithStack(net.ErrClosed)
+		}
+	}
+}
+
+func (c *Conn) sortService() {
+	defer close(c.out)
+
+	var (
+		next  uint32
+		buff  = map[uint32]*segment{}
+		timer = time.NewTimer(time.Hour)
+	)
+	defer timer.Stop()
+
+	// release in-order packets from next
+	var release = func() bool {
+		for {
+			seg, has := buff[next]
+			if !has {
+				return true
+			}
+			delete(buff, next)
+			next++
+			select {
+			case c.out <- seg.pkt:
+			case <-c.done:
+				return false
+			}
+		}
+	}
+	// skip the gap before oldest buffered packet
+	var skip = func() bool {
+		var (
+			min  uint32
+			has  bool
+			diff int32
+		)
+		for seq := range buff {
+			if d := int32(seq - next); !has || d < diff {
+				min, diff, has = seq, d, true
+			}
+		}
+		if has {
+			c.lost.Add(uint64(min - next))
+			next = min
+		}
+		return release()
+	}
+	var reset = func() {
+		timer.Stop()
+		var oldest time.Time
+		for _, seg := range buff {
+			if oldest.IsZero() || seg.time.Before(oldest) {
+				oldest = seg.time
+			}
+		}
+		if !oldest.IsZero() {
+			timer.Reset(time.Until(oldest.Add(c.cfg.Delay)))
+		}
+	}
+
+	for {
+		select {
+		case seg, ok := <-c.in:
+			if !ok {
+				return
+			}
+			if _, has := buff[seg.seq]; has || int32(seg.seq-next) < 0 {
+				c.duplicated.Add(1)
+				continue
+			} else if seg.seq != next {
+				c.reordered.Add(1)
+			}
+			buff[seg.seq] = seg
+
+			if !release() {
+				return
+			}
+			if len(buff) > c.cfg.Window {
+				if !skip() {
+					return
+				}
+			}
+			reset()
+		case <-timer.C:
+			if !skip() {
+				return
+			}
+			reset()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	p, ok := <-c.out
+	if !ok {
+		select {
+		case <-c.done:
+			return errors.WithStack(net.ErrClosed)
+		default:
+			return c.err
+		}
+	}
+
+	if pkt.Data() < p.Data() {
+		return errorx.ShortBuff(p.Data(), pkt.Data())
+	}
+	pkt.SetData(0).Append(p.Bytes()...)
+	return nil
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		Reordered:  c.reordered.Load(),
+		Duplicated: c.duplicated.Load(),
+		Lost:       c.lost.Load(),
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		close(c.done)
+		return []error{c.RawConn.Close()}
+	})
+}
@@ -0,0 +1,66 @@
+package reorder_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/reorder"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// holdConn hold written packets, send them by specified order
+type holdConn struct {
+	rawsock.RawConn
+	pkts []*packet.Packet
+}
+
+func (h *holdConn) Write(pkt *packet.Packet) error {
+	h.pkts = append(h.pkts, pkt.Clone())
+	return nil
+}
+
+func (h *holdConn) flush(t *testing.T, order ...int) {
+	for _, i := range order {
+		require.NoError(t, h.RawConn.Write(h.pkts[i].Clone()))
+	}
+}
+
+func Test_Reorder(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	hold := &holdConn{RawConn: c}
+	client, err := reorder.Wrap(hold, header.UDPProtocolNumber)
+	require.NoError(t, err)
+	server, err := reorder.Wrap(s, header.UDPProtocolNumber, reorder.Delay(time.Millisecond*50))
+	require.NoError(t, err)
+	defer server.Close()
+
+	var payloads [][]byte
+	for i := 0; i < 6; i++ {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		payloads = append(payloads, udp.Payload())
+		require.NoError(t, client.Write(packet.Make(64).Append(udp...)))
+	}
+
+	// reorder, duplicate, and lose 4
+	hold.flush(t, 1, 0, 2, 2, 0, 5, 3)
+
+	for _, i := range []int{0, 1, 2, 3, 5} {
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, server.Read(pkt))
+		test.ValidIP(t, test.BuildIP(t, caddr.Addr(), saddr.Addr(), header.UDPProtocolNumber, pkt.Bytes()))
+		require.Equal(t, payloads[i], []byte(header.UDP(pkt.Bytes()).Payload()))
+	}
+
+	stats := server.Stats()
+	require.Equal(t, uint64(2), stats.Duplicated)
+	require.Equal(t, uint64(1), stats.Lost)
+}
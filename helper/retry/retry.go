@@ -0,0 +1,122 @@
+package retry
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+)
+
+type Policy struct {
+	Retries    int           // max retry times
+	Backoff    time.Duration // first backoff, double every retry
+	MaxBackoff time.Duration
+}
+
+type Option func(*Policy)
+
+func Options(opts ...Option) *Policy {
+	var p = &Policy{
+		Retries:    3,
+		Backoff:    time.Microsecond * 50,
+		MaxBackoff: time.Millisecond * 10,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Retries max retry times for a packet
+func Retries(n int) Option {
+	return func(p *Policy) {
+		p.Retries = max(n, 0)
+	}
+}
+
+// Backoff set first and max backoff, the backoff double every retry
+func Backoff(first, max time.Duration) Option {
+	return func(p *Policy) {
+		p.Backoff, p.MaxBackoff = first, max
+	}
+}
+
+type Stats struct {
+	Retries  uint64 // total retry times
+	Recovers uint64 // packets sent succeed after retry
+	Drops    uint64 // packets dropped after all retry failed
+}
+
+// Conn retry Write/Inject when transient error occur, such as ENOBUFS, TSO
+// write failed after some segments sent is not retried
+type Conn struct {
+	rawsock.RawConn
+	policy *Policy
+
+	retries, recovers, drops atomic.Uint64
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Wrap(child rawsock.RawConn, opts ...Option) *Conn {
+	return &Conn{
+		RawConn: child,
+		policy:  Options(opts...),
+	}
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	return c.do(func() error { return c.RawConn.Write(pkt) })
+}
+
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	return c.do(func() error { return c.RawConn.Inject(pkt) })
+}
+
+func (c *Conn) do(fn func() error) (err error) {
+	backoff := c.policy.Backoff
+	for i := 0; ; i++ {
+		err = fn()
+		if err == nil {
+			if i > 0 {
+				c.recovers.Add(1)
+			}
+			return nil
+		} else if !Temporary(err) {
+			return err
+		} else if i >= c.policy.Retries {
+			c.drops.Add(1)
+			return err
+		}
+
+		c.retries.Add(1)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, c.policy.MaxBackoff)
+	}
+}
+
+func (c *Conn) Stats() Stats {
+	return Stats{
+		Retries:  c.retries.Load(),
+		Recovers: c.recovers.Load(),
+		Drops:    c.drops.Load(),
+	}
+}
+
+// Temporary transient write error, retry later maybe succeed. partial write
+// is not, retry will re-send the sent segments
+func Temporary(err error) bool {
+	var partial *rawsock.ErrPartialWrite
+	if err == nil || errors.As(err, &partial) {
+		return false
+	}
+	for _, e := range tempErrs {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return errorx.Temporary(err)
+}
@@ -0,0 +1,8 @@
+//go:build linux
+// +build linux
+
+package retry
+
+import "golang.org/x/sys/unix"
+
+var tempErrs = []error{unix.ENOBUFS, unix.EAGAIN, unix.ENOMEM}
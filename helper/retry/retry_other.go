@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package retry
+
+import "syscall"
+
+var tempErrs = []error{syscall.ENOBUFS, syscall.EAGAIN, syscall.ENOMEM}
@@ -0,0 +1,52 @@
+package retry_test
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/retry"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type mockConn struct {
+	rawsock.RawConn
+	errs []error
+}
+
+func (m *mockConn) Write(pkt *packet.Packet) error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func Test_Retry(t *testing.T) {
+	var temp = errors.WithStack(syscall.ENOBUFS)
+
+	m := &mockConn{errs: []error{temp, temp, nil, temp, temp, temp, net.ErrClosed}}
+	c := retry.Wrap(m, retry.Retries(2), retry.Backoff(time.Microsecond, time.Millisecond))
+
+	require.NoError(t, c.Write(packet.Make(0, 16)))
+	require.True(t, errors.Is(c.Write(packet.Make(0, 16)), syscall.ENOBUFS))
+	require.True(t, errors.Is(c.Write(packet.Make(0, 16)), net.ErrClosed))
+
+	require.Equal(t, retry.Stats{Retries: 4, Recovers: 1, Drops: 1}, c.Stats())
+}
+
+func Test_Retry_PartialWrite(t *testing.T) {
+	var partial = &rawsock.ErrPartialWrite{Sent: 2, Err: errors.WithStack(syscall.ENOBUFS)}
+
+	m := &mockConn{errs: []error{partial, nil}}
+	c := retry.Wrap(m, retry.Backoff(time.Microsecond, time.Millisecond))
+
+	require.True(t, errors.Is(c.Write(packet.Make(0, 16)), syscall.ENOBUFS))
+	require.Equal(t, retry.Stats{}, c.Stats())
+	require.False(t, retry.Temporary(partial))
+}
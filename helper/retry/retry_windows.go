@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package retry
+
+import "golang.org/x/sys/windows"
+
+var tempErrs = []error{windows.WSAENOBUFS, windows.WSAEWOULDBLOCK, windows.ERROR_NOT_ENOUGH_MEMORY}
@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+// Package rstwatch detect tcp RST emitted by system tcp stack (or other
+// process) for conn's 4-tuple, despite the guards (bind.ListenTCPLocal,
+// rawsock.SuppressRST), such RST silently kills session.
+package rstwatch
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Callback be called with captured RST ip packet
+type Callback func(ip []byte)
+
+// Conn watch outbound RST of the conn, RST written by Conn self is ignored
+type Conn struct {
+	rawsock.RawConn
+	fn Callback
+
+	sock *os.File // AF_PACKET socket
+	raw  syscall.RawConn
+
+	mu  sync.Mutex
+	own map[uint32]time.Time // sequence of RST written by self
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+// Wrap start watch RST of child's 4-tuple, child should be tcp RawConn
+func Wrap(child rawsock.RawConn, fn Callback) (*Conn, error) {
+	var c = &Conn{
+		RawConn: child,
+		fn:      fn,
+		own:     map[uint32]time.Time{},
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return nil, errors.WithStack(&net.OpError{Op: "socket", Err: err})
+	}
+	c.sock = os.NewFile(uintptr(fd), "rstwatch")
+	if c.raw, err = c.sock.SyscallConn(); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	}
+
+	// outbound: local -> remote
+	ins := bpf.FilterEndpoint(header.TCPProtocolNumber, child.LocalAddr(), child.RemoteAddr())
+	if err = bpf.SetRawBPF(c.raw, ins); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	}
+
+	go c.watchService()
+	return c, nil
+}
+
+func htons(v uint16) uint16 { return v<<8 | v>>8 }
+
+func (c *Conn) watchService() {
+	var b = make([]byte, 0xffff)
+	for {
+		var (
+			n    int
+			from unix.Sockaddr
+			e    error
+		)
+		err := c.raw.Read(func(fd uintptr) (done bool) {
+			n, from, e = unix.Recvfrom(int(fd), b, 0)
+			return e != unix.EAGAIN
+		})
+		if err != nil || e != nil {
+			return
+		}
+
+		if ll, ok := from.(*unix.SockaddrLinklayer); !ok || ll.Pkttype != unix.PACKET_OUTGOING {
+			continue
+		}
+		ip := b[:n]
+		var tcp header.TCP
+		switch header.IPVersion(ip) {
+		case 4:
+			if len(ip) < header.IPv4MinimumSize || len(ip) < int(header.IPv4(ip).HeaderLength()) {
+				continue
+			}
+			tcp = header.IPv4(ip).Payload()
+		case 6:
+			if len(ip) < header.IPv6MinimumSize {
+				continue
+			}
+			tcp = header.IPv6(ip).Payload()
+		default:
+			continue
+		}
+		if len(tcp) < header.TCPMinimumSize || tcp.Flags()&header.TCPFlagRst == 0 {
+			continue
+		}
+
+		c.mu.Lock()
+		_, self := c.own[tcp.SequenceNumber()]
+		delete(c.own, tcp.SequenceNumber())
+		c.mu.Unlock()
+		if !self {
+			c.fn(append([]byte{}, ip...))
+		}
+	}
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	if tcp := header.TCP(pkt.Bytes()); len(tcp) >= header.TCPMinimumSize &&
+		tcp.Flags()&header.TCPFlagRst != 0 {
+
+		c.mu.Lock()
+		now := time.Now()
+		for seq, t := range c.own {
+			if now.Sub(t) > time.Second {
+				delete(c.own, seq)
+			}
+		}
+		c.own[tcp.SequenceNumber()] = now
+		c.mu.Unlock()
+	}
+	return c.RawConn.Write(pkt)
+}
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		if c.sock != nil {
+			errs = append(errs, errors.WithStack(c.sock.Close()))
+		}
+		return errs
+	})
+}
+
+func (c *Conn) Close() error {
+	return c.close(errors.WithStack(c.RawConn.Close()))
+}
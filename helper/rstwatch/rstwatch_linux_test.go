@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+package rstwatch_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/rstwatch"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type mockConn struct {
+	rawsock.RawConn
+	local, remote netip.AddrPort
+}
+
+func (m *mockConn) Write(pkt *packet.Packet) error { return nil }
+func (m *mockConn) LocalAddr() netip.AddrPort      { return m.local }
+func (m *mockConn) RemoteAddr() netip.AddrPort     { return m.remote }
+func (m *mockConn) Close() error                   { return nil }
+
+func Test_Watch(t *testing.T) {
+	var (
+		loopback = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+		laddr    = netip.AddrPortFrom(loopback, test.RandPort()) // closed port
+		raddr    = netip.AddrPortFrom(loopback, test.RandPort())
+	)
+
+	var rsts = make(chan []byte, 4)
+	conn, err := rstwatch.Wrap(
+		&mockConn{local: laddr, remote: raddr},
+		func(ip []byte) { rsts <- ip },
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// RST written by self is ignored
+	tcp := header.TCP(make([]byte, header.TCPMinimumSize))
+	tcp.Encode(&header.TCPFields{
+		SrcPort: laddr.Port(), DstPort: raddr.Port(),
+		SeqNum: 1, DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagRst,
+	})
+	require.NoError(t, conn.Write(packet.Make(0).Append(tcp...)))
+
+	// system tcp stack reply RST for SYN to closed port
+	d := net.Dialer{LocalAddr: test.TCPAddr(raddr)}
+	_, err = d.Dial("tcp", laddr.String())
+	require.Error(t, err)
+
+	select {
+	case ip := <-rsts:
+		tcp := header.TCP(header.IPv4(ip).Payload())
+		require.Equal(t, laddr.Port(), tcp.SourcePort())
+		require.Equal(t, raddr.Port(), tcp.DestinationPort())
+		require.NotZero(t, tcp.Flags()&header.TCPFlagRst)
+	case <-time.After(time.Second * 2):
+		t.Fatal("not detect RST")
+	}
+}
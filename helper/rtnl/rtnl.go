@@ -0,0 +1,237 @@
+// Package rtnl cached route table, refreshed and notified when system route
+// or address changed, instead of dump route table every query.
+package rtnl
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/route"
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/lysShub/rawsock/helper/netns"
+)
+
+var std struct {
+	once  sync.Once
+	cache *Cache
+	err   error
+}
+
+// Default global cache, started when first called
+func Default() (*Cache, error) {
+	std.once.Do(func() {
+		std.cache, std.err = New()
+	})
+	return std.cache, std.err
+}
+
+// Table get route table from global cache, dump route table directly if not
+// support subscribe route change or called inside other netns
+func Table() (route.Table, error) {
+	if netns.Switched() {
+		// global cache watch the process's netns
+		return route.GetTable()
+	}
+	c, err := Default()
+	if err != nil {
+		return route.GetTable()
+	}
+	return c.Table()
+}
+
+// Match match best route entry of dst, like route.Table.Match, but zoned
+// dst (such as ipv6 link-local) only match entry of the zone's interface,
+// that route.Table.Match never matched
+func Match(table route.Table, dst netip.Addr) route.Entry {
+	if dst.Zone() == "" {
+		return table.Match(dst)
+	}
+	idx, err := ip6.ZoneIndex(dst.Zone())
+	if err != nil {
+		return route.Entry{}
+	}
+	dst = dst.WithZone("")
+	for i := len(table) - 1; i >= 0; i-- {
+		if table[i].Dest.Contains(dst) && (idx == 0 || table[i].Interface == uint32(idx)) {
+			return table[i]
+		}
+	}
+	return route.Entry{}
+}
+
+type Cache struct {
+	mu    sync.RWMutex
+	table route.Table
+	gen   uint64 // increment when changed
+	valid uint64 // gen of table
+
+	subsMu sync.RWMutex
+	subs   map[int]func(route.Table)
+	subId  int
+
+	// link subscribers, shared by interface index
+	linksMu sync.Mutex
+	links   map[int]*link
+	linkId  int
+
+	watcher  io.Closer
+	closeErr errorx.CloseErr
+}
+
+// New subscribe route change
+func New() (*Cache, error) {
+	var c = &Cache{gen: 1, subs: map[int]func(route.Table){}, links: map[int]*link{}}
+
+	var err error
+	if c.watcher, err = watch(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cache) changed() {
+	c.mu.Lock()
+	c.gen++
+	c.mu.Unlock()
+
+	c.subsMu.RLock()
+	var subs = make([]func(route.Table), 0, len(c.subs))
+	for _, fn := range c.subs {
+		subs = append(subs, fn)
+	}
+	c.subsMu.RUnlock()
+
+	if len(subs) > 0 {
+		if t, err := c.Table(); err == nil {
+			for _, fn := range subs {
+				fn(t)
+			}
+		}
+	}
+}
+
+// Table get cached route table, the returned table can't be modified
+func (c *Cache) Table() (route.Table, error) {
+	c.mu.RLock()
+	if c.valid == c.gen {
+		defer c.mu.RUnlock()
+		return c.table, nil
+	}
+	gen := c.gen
+	c.mu.RUnlock()
+
+	t, err := route.GetTable()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if gen > c.valid {
+		c.table, c.valid = t, gen
+	}
+	c.mu.Unlock()
+	return t, nil
+}
+
+// Subscribe fn be called with new route table when route changed, call
+// cancel to unsubscribe
+func (c *Cache) Subscribe(fn func(route.Table)) (cancel func()) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	c.subId++
+	id := c.subId
+	c.subs[id] = fn
+
+	return func() {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		delete(c.subs, id)
+	}
+}
+
+type link struct {
+	mtu  int
+	subs map[int]*linkSub
+}
+
+type linkSub struct {
+	fn      func(mtu int)
+	stopped bool // subscriber maybe called after unsubscribe, guard by linksMu
+}
+
+// SubscribeLink fn be called with new mtu when mtu of interface index changed,
+// mtu is current mtu of the interface. subscribers of the same interface share
+// one entry, call cancel to unsubscribe
+func (c *Cache) SubscribeLink(index, mtu int, fn func(mtu int)) (cancel func()) {
+	c.linksMu.Lock()
+	defer c.linksMu.Unlock()
+	l, has := c.links[index]
+	if !has {
+		l = &link{mtu: mtu, subs: map[int]*linkSub{}}
+		c.links[index] = l
+	}
+	c.linkId++
+	id, sub := c.linkId, &linkSub{fn: fn}
+	l.subs[id] = sub
+
+	return func() {
+		c.linksMu.Lock()
+		defer c.linksMu.Unlock()
+		sub.stopped = true
+		delete(l.subs, id)
+		if len(l.subs) == 0 && c.links[index] == l {
+			delete(c.links, index)
+		}
+	}
+}
+
+// link notify subscribers of interface index if mtu changed
+func (c *Cache) link(index, mtu int) {
+	c.linksMu.Lock()
+	l, has := c.links[index]
+	if !has || l.mtu == mtu {
+		c.linksMu.Unlock()
+		return
+	}
+	l.mtu = mtu
+	var subs = make([]*linkSub, 0, len(l.subs))
+	for _, sub := range l.subs {
+		subs = append(subs, sub)
+	}
+	c.linksMu.Unlock()
+
+	for _, sub := range subs {
+		c.linksMu.Lock()
+		stopped := sub.stopped
+		c.linksMu.Unlock()
+		if !stopped {
+			sub.fn(mtu)
+		}
+	}
+}
+
+// refreshLinks query mtu of subscribed interfaces, used when link change
+// message not available or lost
+func (c *Cache) refreshLinks() {
+	c.linksMu.Lock()
+	var idxs = make([]int, 0, len(c.links))
+	for idx := range c.links {
+		idxs = append(idxs, idx)
+	}
+	c.linksMu.Unlock()
+
+	for _, idx := range idxs {
+		if ifi, err := net.InterfaceByIndex(idx); err == nil {
+			c.link(idx, ifi.MTU)
+		} // interface removed
+	}
+}
+
+func (c *Cache) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		return []error{c.watcher.Close()}
+	})
+}
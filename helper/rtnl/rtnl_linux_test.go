@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package rtnl
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/lysShub/netkit/route"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_Cache(t *testing.T) {
+	c, err := New()
+	require.NoError(t, err)
+	defer c.Close()
+
+	t1, err := c.Table()
+	require.NoError(t, err)
+	require.NotEmpty(t, t1)
+
+	t2, err := c.Table()
+	require.NoError(t, err)
+	require.Same(t, &t1[0], &t2[0], "should cached")
+
+	var tables = make(chan route.Table, 1)
+	cancel := c.Subscribe(func(t route.Table) { tables <- t })
+
+	c.changed()
+	select {
+	case t3 := <-tables:
+		require.Equal(t, t1, t3)
+		require.NotSame(t, &t1[0], &t3[0], "should refreshed")
+	case <-time.After(time.Second):
+		t.Fatal("not notified")
+	}
+
+	cancel()
+	c.changed()
+	require.Len(t, tables, 0)
+}
+
+func Test_SubscribeLink(t *testing.T) {
+	c, err := New()
+	require.NoError(t, err)
+	defer c.Close()
+
+	var mtus1, mtus2 = make(chan int, 4), make(chan int, 4)
+	cancel1 := c.SubscribeLink(1000, 1500, func(mtu int) { mtus1 <- mtu })
+	cancel2 := c.SubscribeLink(1000, 1500, func(mtu int) { mtus2 <- mtu })
+	require.Len(t, c.links, 1, "shared by interface")
+
+	c.link(1000, 1500)
+	c.link(1001, 1280)
+	require.Len(t, mtus1, 0)
+
+	c.link(1000, 1280)
+	require.Equal(t, 1280, <-mtus1)
+	require.Equal(t, 1280, <-mtus2)
+
+	cancel1()
+	c.link(1000, 1400)
+	require.Len(t, mtus1, 0)
+	require.Equal(t, 1400, <-mtus2)
+
+	cancel2()
+	require.Len(t, c.links, 0)
+}
+
+func Test_Links(t *testing.T) {
+	var b = make([]byte, unix.SizeofNlMsghdr+unix.SizeofIfInfomsg+unix.SizeofRtAttr+4)
+	*(*unix.NlMsghdr)(unsafe.Pointer(&b[0])) = unix.NlMsghdr{Len: uint32(len(b)), Type: unix.RTM_NEWLINK}
+	*(*unix.IfInfomsg)(unsafe.Pointer(&b[unix.SizeofNlMsghdr])) = unix.IfInfomsg{Index: 7}
+	attr := b[unix.SizeofNlMsghdr+unix.SizeofIfInfomsg:]
+	*(*unix.RtAttr)(unsafe.Pointer(&attr[0])) = unix.RtAttr{Len: unix.SizeofRtAttr + 4, Type: unix.IFLA_MTU}
+	binary.NativeEndian.PutUint32(attr[unix.SizeofRtAttr:], 1280)
+
+	var got [][2]int
+	links(b, func(index, mtu int) { got = append(got, [2]int{index, mtu}) })
+	require.Equal(t, [][2]int{{7, 1280}}, got)
+}
@@ -0,0 +1,24 @@
+package rtnl_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/route"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Match(t *testing.T) {
+	var table = route.Table{
+		{Dest: netip.MustParsePrefix("::/0"), Next: netip.MustParseAddr("fe80::1"), Interface: 2, Addr: netip.MustParseAddr("2001:db8::2")},
+		{Dest: netip.MustParsePrefix("fe80::/64"), Interface: 2, Addr: netip.MustParseAddr("fe80::2")},
+		{Dest: netip.MustParsePrefix("fe80::/64"), Interface: 3, Addr: netip.MustParseAddr("fe80::3")},
+	}
+
+	require.Equal(t, uint32(3), rtnl.Match(table, netip.MustParseAddr("fe80::9")).Interface)
+	require.Equal(t, uint32(2), rtnl.Match(table, netip.MustParseAddr("fe80::9%2")).Interface)
+	require.Equal(t, uint32(3), rtnl.Match(table, netip.MustParseAddr("fe80::9%3")).Interface)
+	require.False(t, rtnl.Match(table, netip.MustParseAddr("fe80::9%4")).Valid())
+	require.Equal(t, table[0], rtnl.Match(table, netip.MustParseAddr("2001:db8::9")))
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package rtnl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cache(t *testing.T) {
+	c, err := New()
+	require.NoError(t, err)
+
+	t1, err := c.Table()
+	require.NoError(t, err)
+	require.NotEmpty(t, t1)
+
+	t2, err := c.Table()
+	require.NoError(t, err)
+	require.Same(t, &t1[0], &t2[0], "should cached")
+
+	c.changed()
+	t3, err := c.Table()
+	require.NoError(t, err)
+	require.NotSame(t, &t1[0], &t3[0], "should refreshed")
+
+	require.NoError(t, c.Close())
+	require.Empty(t, watchers.fns)
+}
@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package rtnl
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// watch notify c when route/address/link changed, by rtnetlink multicast
+// group, mtu is read from link message
+func watch(c *Cache) (io.Closer, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errors.WithStack(&net.OpError{Op: "socket", Err: err})
+	}
+	err = unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK |
+			unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV4_ROUTE |
+			unix.RTMGRP_IPV6_IFADDR | unix.RTMGRP_IPV6_ROUTE,
+	})
+	if err != nil {
+		unix.Close(fd)
+		return nil, errors.WithStack(&net.OpError{Op: "bind", Err: err})
+	}
+
+	f := os.NewFile(uintptr(fd), "rtnetlink")
+	raw, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	go func() {
+		var b = make([]byte, os.Getpagesize())
+		for {
+			var (
+				n int
+				e error
+			)
+			err := raw.Read(func(fd uintptr) (done bool) {
+				n, _, e = unix.Recvfrom(int(fd), b, 0)
+				return e != unix.EAGAIN
+			})
+			if err != nil {
+				return // closed
+			} else if e == unix.ENOBUFS {
+				// overrun, lost some message
+				c.changed()
+				c.refreshLinks()
+				continue
+			} else if e != nil {
+				return
+			}
+			c.changed()
+			links(b[:n], c.link)
+		}
+	}()
+	return f, nil
+}
+
+// links call fn with interface index and mtu of every link message in b
+func links(b []byte, fn func(index, mtu int)) {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return
+	}
+	for i := range msgs {
+		if msgs[i].Header.Type != unix.RTM_NEWLINK || len(msgs[i].Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		ifi := (*unix.IfInfomsg)(unsafe.Pointer(&msgs[i].Data[0]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msgs[i])
+		if err != nil {
+			continue
+		}
+		for _, a := range attrs {
+			if a.Attr.Type == unix.IFLA_MTU && len(a.Value) >= 4 {
+				fn(int(ifi.Index), int(binary.NativeEndian.Uint32(a.Value)))
+			}
+		}
+	}
+}
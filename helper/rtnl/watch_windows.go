@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package rtnl
+
+import (
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	iphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+
+	procNotifyRouteChange2           = iphlpapi.NewProc("NotifyRouteChange2")
+	procNotifyUnicastIpAddressChange = iphlpapi.NewProc("NotifyUnicastIpAddressChange")
+	procNotifyIpInterfaceChange      = iphlpapi.NewProc("NotifyIpInterfaceChange")
+	procCancelMibChangeNotify2       = iphlpapi.NewProc("CancelMibChangeNotify2")
+)
+
+// registered watchers, indexed by CallerContext of notification, callback
+// created by windows.NewCallback can't be released, so share one
+var watchers = struct {
+	sync.RWMutex
+	fns map[uintptr]func()
+	id  uintptr
+}{fns: map[uintptr]func(){}}
+
+var callback = sync.OnceValue(func() uintptr {
+	return windows.NewCallback(func(ctx, row uintptr, typ uint32) uintptr {
+		watchers.RLock()
+		fn := watchers.fns[ctx]
+		watchers.RUnlock()
+		if fn != nil {
+			fn()
+		}
+		return 0
+	})
+})
+
+type watcher struct {
+	id       uintptr
+	handles  []windows.Handle
+	closeErr errorx.CloseErr
+}
+
+// watch notify c when route/address/interface changed, by iphlpapi change
+// notifications, mtu of subscribed interfaces is queried
+func watch(c *Cache) (io.Closer, error) {
+	watchers.Lock()
+	watchers.id++
+	var w = &watcher{id: watchers.id}
+	watchers.fns[w.id] = func() {
+		c.changed()
+		c.refreshLinks()
+	}
+	watchers.Unlock()
+
+	for _, proc := range []*windows.LazyProc{
+		procNotifyRouteChange2,
+		procNotifyUnicastIpAddressChange,
+		procNotifyIpInterfaceChange,
+	} {
+		if err := proc.Find(); err != nil {
+			return nil, w.close(errors.WithStack(err))
+		}
+
+		var h windows.Handle
+		r, _, _ := proc.Call(
+			windows.AF_UNSPEC, callback(), w.id,
+			0, // not InitialNotification
+			uintptr(unsafe.Pointer(&h)),
+		)
+		if r != 0 {
+			return nil, w.close(errors.WithStack(windows.Errno(r)))
+		}
+		w.handles = append(w.handles, h)
+	}
+	return w, nil
+}
+
+func (w *watcher) close(cause error) error {
+	return w.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		for _, h := range w.handles {
+			if r, _, _ := procCancelMibChangeNotify2.Call(uintptr(h)); r != 0 {
+				errs = append(errs, errors.WithStack(windows.Errno(r)))
+			}
+		}
+		watchers.Lock()
+		delete(watchers.fns, w.id)
+		watchers.Unlock()
+		return errs
+	})
+}
+
+func (w *watcher) Close() error { return w.close(nil) }
@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Info packet info used by Match
+type Info struct {
+	Dir      Direction
+	Proto    tcpip.TransportProtocolNumber
+	Src, Dst netip.AddrPort
+	Flags    header.TCPFlags // only tcp
+}
+
+type Match func(info Info) bool
+
+// MatchAddr match packet which src or dst address is addr
+func MatchAddr(addr netip.Addr) Match {
+	return func(info Info) bool { return info.Src.Addr() == addr || info.Dst.Addr() == addr }
+}
+
+// MatchPort match packet which src or dst port is port
+func MatchPort(port uint16) Match {
+	return func(info Info) bool { return info.Src.Port() == port || info.Dst.Port() == port }
+}
+
+// MatchTCPFlags match tcp packet contain any of flags
+func MatchTCPFlags(flags header.TCPFlags) Match {
+	return func(info Info) bool {
+		return info.Proto == header.TCPProtocolNumber && info.Flags.Intersects(flags)
+	}
+}
+
+// All match packet that all ms matched
+func All(ms ...Match) Match {
+	return func(info Info) bool {
+		for _, m := range ms {
+			if !m(info) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Logger print matched packets to writer
+type Logger struct {
+	rawsock.RawConn
+	proto tcpip.TransportProtocolNumber
+	match Match
+	hex   bool
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ rawsock.RawConn = (*Logger)(nil)
+
+// Log wrap a RawConn, the packet matched by match will be printed to w, print
+// hex dump if set hexdump. match is nil means match all packets.
+func Log(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, w io.Writer, match Match, hexdump bool) *Logger {
+	if match == nil {
+		match = func(Info) bool { return true }
+	}
+	return &Logger{
+		RawConn: child,
+		proto:   proto,
+		match:   match,
+		hex:     hexdump,
+		w:       w,
+	}
+}
+
+func (l *Logger) Read(pkt *packet.Packet) (err error) {
+	old := pkt.Head()
+	if err = l.RawConn.Read(pkt); err != nil {
+		return err
+	}
+	new := pkt.Head()
+
+	l.log(Recv, pkt.SetHead(old).Bytes())
+	pkt.SetHead(new)
+	return nil
+}
+
+func (l *Logger) Write(pkt *packet.Packet) (err error) {
+	l.log(Send, pkt.Bytes())
+	return l.RawConn.Write(pkt)
+}
+
+func (l *Logger) Inject(pkt *packet.Packet) (err error) {
+	l.log(Inject, pkt.Bytes())
+	return l.RawConn.Inject(pkt)
+}
+
+func (l *Logger) log(dir Direction, b []byte) {
+	info := l.parse(dir, b)
+	if !l.match(info) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(
+		l.w, "%s %-6s %s %s->%s [%s] len=%d\n",
+		time.Now().Format("15:04:05.000000"), dir, protoName(info.Proto),
+		info.Src, info.Dst, info.Flags, len(b),
+	)
+	if l.hex {
+		fmt.Fprint(l.w, hex.Dump(b))
+	}
+}
+
+func (l *Logger) parse(dir Direction, b []byte) Info {
+	var info = Info{Dir: dir, Proto: l.proto}
+	var src, dst netip.Addr
+	switch dir {
+	case Recv:
+		switch header.IPVersion(b) {
+		case 4:
+			if len(b) < header.IPv4MinimumSize {
+				return info
+			}
+			ip := header.IPv4(b)
+			src, dst = netip.AddrFrom4(ip.SourceAddress().As4()), netip.AddrFrom4(ip.DestinationAddress().As4())
+			info.Proto, b = ip.TransportProtocol(), b[min(int(ip.HeaderLength()), len(b)):]
+		case 6:
+			if len(b) < header.IPv6MinimumSize {
+				return info
+			}
+			ip := header.IPv6(b)
+			src, dst = netip.AddrFrom16(ip.SourceAddress().As16()), netip.AddrFrom16(ip.DestinationAddress().As16())
+			info.Proto, b = ip.TransportProtocol(), b[header.IPv6MinimumSize:]
+		default:
+			return info
+		}
+	case Send:
+		src, dst = l.LocalAddr().Addr(), l.RemoteAddr().Addr()
+	case Inject:
+		src, dst = l.RemoteAddr().Addr(), l.LocalAddr().Addr()
+	}
+
+	var sport, dport uint16
+	switch info.Proto {
+	case header.TCPProtocolNumber:
+		if len(b) >= header.TCPMinimumSize {
+			tcp := header.TCP(b)
+			sport, dport, info.Flags = tcp.SourcePort(), tcp.DestinationPort(), tcp.Flags()
+		}
+	case header.UDPProtocolNumber:
+		if len(b) >= header.UDPMinimumSize {
+			udp := header.UDP(b)
+			sport, dport = udp.SourcePort(), udp.DestinationPort()
+		}
+	default:
+	}
+	info.Src, info.Dst = netip.AddrPortFrom(src, sport), netip.AddrPortFrom(dst, dport)
+	return info
+}
+
+func protoName(proto tcpip.TransportProtocolNumber) string {
+	switch proto {
+	case header.TCPProtocolNumber:
+		return "tcp"
+	case header.UDPProtocolNumber:
+		return "udp"
+	case header.ICMPv4ProtocolNumber:
+		return "icmp"
+	case header.ICMPv6ProtocolNumber:
+		return "icmp6"
+	default:
+		return fmt.Sprintf("proto(%d)", proto)
+	}
+}
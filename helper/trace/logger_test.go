@@ -0,0 +1,41 @@
+package trace_test
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/trace"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Logger(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+	defer c.Close()
+	defer s.Close()
+
+	var b = &bytes.Buffer{}
+	lc := trace.Log(c, header.TCPProtocolNumber, b, trace.All(
+		trace.MatchAddr(saddr.Addr()),
+		trace.MatchTCPFlags(header.TCPFlagSyn),
+	), true)
+
+	syn := test.BuildTCPSync(t, caddr, saddr)
+	require.NoError(t, lc.Write(packet.Make(64, 0).Append(syn...)))
+	require.True(t, strings.Contains(b.String(), caddr.String()+"->"+saddr.String()), b.String())
+	require.True(t, strings.Contains(b.String(), "00000000"), b.String()) // hex dump
+
+	b.Reset()
+	ack := test.BuildTCPSync(t, caddr, saddr)
+	header.TCP(ack).SetFlags(uint8(header.TCPFlagAck))
+	require.NoError(t, lc.Write(packet.Make(64, 0).Append(ack...)))
+	require.Zero(t, b.Len())
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+type Direction uint8
+
+const (
+	_      Direction = iota
+	Recv             // packet from Read, is ip packet
+	Send             // packet to Write, is transport packet
+	Inject           // packet to Inject, is transport packet
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Recv:
+		return "recv"
+	case Send:
+		return "send"
+	case Inject:
+		return "inject"
+	default:
+		return "unknown"
+	}
+}
+
+type Record struct {
+	Time time.Time
+	Dir  Direction
+	Data []byte
+}
+
+// Ring keep last N packets records
+type Ring struct {
+	mu   sync.Mutex
+	recs []Record
+	i, n int
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{recs: make([]Record, max(size, 1))}
+}
+
+func (r *Ring) Put(dir Direction, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// reuse slot memory
+	rec := &r.recs[r.i]
+	rec.Time = time.Now()
+	rec.Dir = dir
+	rec.Data = append(rec.Data[:0], b...)
+
+	r.i = (r.i + 1) % len(r.recs)
+	r.n = min(r.n+1, len(r.recs))
+}
+
+// Records get records copy, oldest first
+func (r *Ring) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var recs = make([]Record, 0, r.n)
+	start := (r.i - r.n + len(r.recs)) % len(r.recs)
+	for j := 0; j < r.n; j++ {
+		rec := r.recs[(start+j)%len(r.recs)]
+		rec.Data = append([]byte(nil), rec.Data...)
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func (r *Ring) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.i, r.n = 0, 0
+}
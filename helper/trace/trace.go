@@ -0,0 +1,135 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Conn record last N packets of each direction, used for investigate
+// transient failure after the fact.
+type Conn struct {
+	rawsock.RawConn
+
+	proto      tcpip.TransportProtocolNumber
+	recv, send *Ring
+
+	onErr func(err error, recs []Record)
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+// Wrap wrap a RawConn, keep last size packets of recv and send(include inject)
+func Wrap(child rawsock.RawConn, proto tcpip.TransportProtocolNumber, size int) *Conn {
+	return &Conn{
+		RawConn: child,
+		proto:   proto,
+		recv:    NewRing(size),
+		send:    NewRing(size),
+	}
+}
+
+// OnError set callback, called with current records when Read/Write/Inject failed
+func (c *Conn) OnError(fn func(err error, recs []Record)) { c.onErr = fn }
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	old := pkt.Head()
+	if err = c.RawConn.Read(pkt); err != nil {
+		return c.failed(err)
+	}
+	new := pkt.Head()
+
+	c.recv.Put(Recv, pkt.SetHead(old).Bytes())
+	pkt.SetHead(new)
+	return nil
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.send.Put(Send, pkt.Bytes())
+	if err = c.RawConn.Write(pkt); err != nil {
+		return c.failed(err)
+	}
+	return nil
+}
+
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	c.send.Put(Inject, pkt.Bytes())
+	if err = c.RawConn.Inject(pkt); err != nil {
+		return c.failed(err)
+	}
+	return nil
+}
+
+func (c *Conn) failed(err error) error {
+	if c.onErr != nil {
+		c.onErr(err, c.Records())
+	}
+	return err
+}
+
+// Records get records of all direction, order by time
+func (c *Conn) Records() []Record {
+	recs := append(c.recv.Records(), c.send.Records()...)
+	slices.SortStableFunc(recs, func(a, b Record) int { return a.Time.Compare(b.Time) })
+	return recs
+}
+
+// Dump write records summary to w
+func (c *Conn) Dump(w io.Writer) error {
+	for _, e := range c.Records() {
+		if _, err := fmt.Fprintln(w, Format(e, c.proto)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Format format record as one line summary
+func Format(rec Record, proto tcpip.TransportProtocolNumber) string {
+	var s = fmt.Sprintf("%s %-6s len=%d", rec.Time.Format("15:04:05.000000"), rec.Dir, len(rec.Data))
+
+	var b = rec.Data
+	if rec.Dir == Recv {
+		switch header.IPVersion(b) {
+		case 4:
+			if len(b) < header.IPv4MinimumSize {
+				return s
+			}
+			ip := header.IPv4(b)
+			s += fmt.Sprintf(" %s->%s", ip.SourceAddress(), ip.DestinationAddress())
+			proto, b = ip.TransportProtocol(), b[min(int(ip.HeaderLength()), len(b)):]
+		case 6:
+			if len(b) < header.IPv6MinimumSize {
+				return s
+			}
+			ip := header.IPv6(b)
+			s += fmt.Sprintf(" %s->%s", ip.SourceAddress(), ip.DestinationAddress())
+			proto, b = ip.TransportProtocol(), b[header.IPv6MinimumSize:]
+		default:
+			return s
+		}
+	}
+
+	switch proto {
+	case header.TCPProtocolNumber:
+		if len(b) >= header.TCPMinimumSize {
+			tcp := header.TCP(b)
+			s += fmt.Sprintf(
+				" tcp %d->%d [%s] seq=%d ack=%d", tcp.SourcePort(), tcp.DestinationPort(),
+				tcp.Flags(), tcp.SequenceNumber(), tcp.AckNumber(),
+			)
+		}
+	case header.UDPProtocolNumber:
+		if len(b) >= header.UDPMinimumSize {
+			udp := header.UDP(b)
+			s += fmt.Sprintf(" udp %d->%d", udp.SourcePort(), udp.DestinationPort())
+		}
+	default:
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package trace_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/trace"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Ring(t *testing.T) {
+	r := trace.NewRing(4)
+	for i := 0; i < 6; i++ {
+		r.Put(trace.Send, []byte{byte(i)})
+	}
+
+	recs := r.Records()
+	require.Equal(t, 4, len(recs))
+	for i, e := range recs {
+		require.Equal(t, []byte{byte(i + 2)}, e.Data)
+		require.Equal(t, trace.Send, e.Dir)
+	}
+
+	r.Reset()
+	require.Zero(t, len(r.Records()))
+}
+
+func Test_Trace_Conn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	c, s := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+	defer c.Close()
+	defer s.Close()
+
+	tc := trace.Wrap(c, header.TCPProtocolNumber, 8)
+	ts := trace.Wrap(s, header.TCPProtocolNumber, 8)
+
+	syn := test.BuildTCPSync(t, caddr, saddr)
+	require.NoError(t, tc.Write(packet.Make(64, 0).Append(syn...)))
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, ts.Read(p))
+	require.Equal(t, []byte(syn), p.Bytes())
+
+	recs := ts.Records()
+	require.Equal(t, 1, len(recs))
+	require.Equal(t, trace.Recv, recs[0].Dir)
+	test.ValidIP(t, recs[0].Data)
+
+	var b = &bytes.Buffer{}
+	require.NoError(t, tc.Dump(b))
+	ports := fmt.Sprintf("tcp %d->%d", caddr.Port(), saddr.Port())
+	require.True(t, strings.Contains(b.String(), ports), b.String())
+
+	var called bool
+	ts.OnError(func(err error, recs []trace.Record) {
+		called = true
+		require.Equal(t, 1, len(recs))
+	})
+	s.Close()
+	require.Error(t, ts.Read(p.Sets(0, 1536)))
+	require.True(t, called)
+}
@@ -0,0 +1,209 @@
+//go:build linux
+// +build linux
+
+// Package vrf linux VRF (virtual routing and forwarding) device helpers, route
+// lookup scoped in the VRF's table, and bind socket to the VRF device.
+package vrf
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sort"
+	"syscall"
+	"unsafe"
+
+	"github.com/lysShub/netkit/route"
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// TableID route table id of VRF device
+func TableID(name string) (uint32, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	b, err := syscall.NetlinkRIB(unix.RTM_GETLINK, unix.AF_UNSPEC)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	for i := range msgs {
+		if msgs[i].Header.Type != unix.RTM_NEWLINK || len(msgs[i].Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		info := (*unix.IfInfomsg)(unsafe.Pointer(unsafe.SliceData(msgs[i].Data)))
+		if int(info.Index) != ifi.Index {
+			continue
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msgs[i])
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type != unix.IFLA_LINKINFO {
+				continue
+			}
+			linkinfo := nested(attr.Value)
+			if kind := string(linkinfo[unix.IFLA_INFO_KIND]); kind != "vrf\x00" && kind != "vrf" {
+				break
+			}
+			if table := nested(linkinfo[unix.IFLA_INFO_DATA])[unix.IFLA_VRF_TABLE]; len(table) >= 4 {
+				return binary.NativeEndian.Uint32(table), nil
+			}
+		}
+		return 0, errors.Errorf("%s is not a vrf device", name)
+	}
+	return 0, errors.Errorf("not found device %s", name)
+}
+
+// nested parse nested rtattrs
+func nested(b []byte) map[uint16][]byte {
+	var attrs = map[uint16][]byte{}
+	for len(b) >= unix.SizeofRtAttr {
+		n := int(binary.NativeEndian.Uint16(b))
+		typ := binary.NativeEndian.Uint16(b[2:]) &^ unix.NLA_F_NESTED
+		if n < unix.SizeofRtAttr || n > len(b) {
+			break
+		}
+		attrs[typ] = b[unix.SizeofRtAttr:n]
+		b = b[min((n+unix.RTA_ALIGNTO-1)&^(unix.RTA_ALIGNTO-1), len(b)):]
+	}
+	return attrs
+}
+
+// Routes unicast routes in table, include ipv4 and ipv6
+func Routes(table uint32) (route.Table, error) {
+	b, err := syscall.NetlinkRIB(unix.RTM_GETROUTE, unix.AF_UNSPEC)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var routes route.Table
+	for i := range msgs {
+		if msgs[i].Header.Type != unix.RTM_NEWROUTE || len(msgs[i].Data) < unix.SizeofRtMsg {
+			continue
+		}
+		rt := (*unix.RtMsg)(unsafe.Pointer(unsafe.SliceData(msgs[i].Data)))
+		if rt.Type != unix.RTN_UNICAST {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msgs[i])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var (
+			e  route.Entry
+			id = uint32(rt.Table)
+		)
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case unix.RTA_TABLE:
+				id = binary.NativeEndian.Uint32(attr.Value)
+			case unix.RTA_DST:
+				if addr, ok := netip.AddrFromSlice(attr.Value); ok {
+					e.Dest = netip.PrefixFrom(addr, int(rt.Dst_len))
+				}
+			case unix.RTA_GATEWAY:
+				e.Next, _ = netip.AddrFromSlice(attr.Value)
+			case unix.RTA_PREFSRC:
+				e.Addr, _ = netip.AddrFromSlice(attr.Value)
+			case unix.RTA_OIF:
+				e.Interface = binary.NativeEndian.Uint32(attr.Value)
+			case unix.RTA_PRIORITY:
+				e.Metric = binary.NativeEndian.Uint32(attr.Value)
+			}
+		}
+		if id != table || e.Interface == 0 {
+			continue
+		}
+		if !e.Dest.IsValid() {
+			e.Dest = netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+			if rt.Family == unix.AF_INET6 {
+				e.Dest = netip.PrefixFrom(netip.IPv6Unspecified(), 0)
+			}
+		}
+		if !e.Addr.IsValid() {
+			e.Addr = ifaceAddr(int(e.Interface), rt.Family == unix.AF_INET)
+		}
+		routes = append(routes, e)
+	}
+
+	// route.Table.Match search from tail
+	sort.SliceStable(routes, func(i, j int) bool {
+		bi, bj := routes[i].Dest.Bits(), routes[j].Dest.Bits()
+		if bi != bj {
+			return bi < bj
+		}
+		return routes[i].Metric > routes[j].Metric
+	})
+	return routes, nil
+}
+
+func ifaceAddr(index int, ipv4 bool) netip.Addr {
+	ifi, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return netip.Addr{}
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			addr, _ := netip.AddrFromSlice(n.IP)
+			if addr = addr.Unmap(); addr.Is4() == ipv4 {
+				return addr
+			}
+		}
+	}
+	return netip.Addr{}
+}
+
+// Table route table of VRF device
+func Table(name string) (route.Table, error) {
+	table, err := TableID(name)
+	if err != nil {
+		return nil, err
+	}
+	return Routes(table)
+}
+
+// DefaultLocal select local address to raddr by VRF's route table
+func DefaultLocal(name string, raddr netip.Addr) (netip.Addr, error) {
+	routes, err := Table(name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	e := rtnl.Match(routes, raddr)
+	if !e.Valid() || !e.Addr.IsValid() {
+		return netip.Addr{}, errors.WithStack(errors.WithMessagef(
+			unix.ENETUNREACH, "%s in vrf %s", raddr.String(), name,
+		))
+	}
+	return ip6.Zone(e.Addr, int(e.Interface)), nil
+}
+
+// Bind bind socket to VRF device, socket only send/recv packets in the VRF
+func Bind(raw syscall.RawConn, name string) error {
+	var e error
+	if err := raw.Control(func(fd uintptr) {
+		e = unix.BindToDevice(int(fd), name)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(e)
+}
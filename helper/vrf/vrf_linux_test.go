@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package vrf_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_TableID(t *testing.T) {
+	t.Run("not vrf", func(t *testing.T) {
+		_, err := vrf.TableID("lo")
+		require.Error(t, err)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		_, err := vrf.TableID("not-exist-vrf")
+		require.Error(t, err)
+	})
+}
+
+func Test_Routes(t *testing.T) {
+	var dst = netip.MustParseAddr("8.8.8.8")
+
+	all, err := rtnl.Table()
+	require.NoError(t, err)
+	expect := all.Match(dst)
+	if !expect.Valid() {
+		t.Skip("no default route")
+	}
+
+	main, err := vrf.Routes(unix.RT_TABLE_MAIN)
+	require.NoError(t, err)
+	e := main.Match(dst)
+	require.True(t, e.Valid())
+	require.Equal(t, expect.Interface, e.Interface)
+	require.Equal(t, expect.Next, e.Next)
+	require.True(t, e.Addr.IsValid())
+
+	for i := 1; i < len(main); i++ {
+		require.LessOrEqual(t, main[i-1].Dest.Bits(), main[i].Dest.Bits())
+	}
+
+	empty, err := vrf.Routes(12345)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
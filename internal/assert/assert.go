@@ -0,0 +1,46 @@
+// Package assert debug assertions of conn paths, only run when build with
+// debug tag or enabled by Validator, production binary not depend on test packages.
+package assert
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lysShub/netkit/debug"
+	"github.com/lysShub/rawsock/helper/check"
+)
+
+// ValidIP panic with reason if ip packet invalid, see check.Packet
+func ValidIP(ip []byte) {
+	if !debug.Debug() {
+		return
+	}
+	if _, err := check.Packet(ip); err != nil {
+		panic(fmt.Sprintf("%s\n%s", err.Error(), hex.Dump(ip)))
+	}
+}
+
+// Validator per-conn runtime validation, called with invalid ip packet and
+// reason, nil Validator fallback to debug build ValidIP
+type Validator func(ip []byte, err error)
+
+// ValidIP call v if ip packet invalid, ip should not be retained by v
+func (v Validator) ValidIP(ip []byte) {
+	if v == nil {
+		ValidIP(ip)
+		return
+	}
+	if _, err := check.Packet(ip); err != nil {
+		v(ip, err)
+	}
+}
+
+// Equal panic if want not equal got
+func Equal[T comparable](want, got T, msg string) {
+	if !debug.Debug() {
+		return
+	}
+	if want != got {
+		panic(fmt.Sprintf("%s: want %v, got %v", msg, want, got))
+	}
+}
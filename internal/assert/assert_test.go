@@ -0,0 +1,40 @@
+package assert_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/debug"
+	"github.com/lysShub/rawsock/internal/assert"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Validator(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+
+	var invalid [][]byte
+	var v = assert.Validator(func(ip []byte, err error) {
+		require.Error(t, err)
+		invalid = append(invalid, ip)
+	})
+
+	ip := test.RandTCP(t, src, dst)
+	v.ValidIP(ip)
+	require.Empty(t, invalid)
+
+	header.IPv4(ip).SetChecksum(^header.IPv4(ip).Checksum())
+	v.ValidIP(ip)
+	require.Equal(t, [][]byte{ip}, invalid)
+
+	// nil Validator only check in debug build
+	if debug.Debug() {
+		require.Panics(t, func() { assert.Validator(nil).ValidIP(ip) })
+	} else {
+		assert.Validator(nil).ValidIP(ip)
+	}
+}
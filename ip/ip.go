@@ -0,0 +1,3 @@
+// Package ip RawConn of arbitrary ip protocol, such as ESP(50) or EtherIP(97),
+// conn is identified by address pair without port, only support linux
+package ip
@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package ip
+
+import (
+	"net/netip"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/ip/raw"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+func Listen(proto tcpip.TransportProtocolNumber, laddr netip.Addr, opts ...rawsock.Option) (rawsock.Listener, error) {
+	return raw.Listen(proto, laddr, opts...)
+}
+
+func Connect(proto tcpip.TransportProtocolNumber, laddr, raddr netip.Addr, opts ...rawsock.Option) (rawsock.RawConn, error) {
+	return raw.Connect(proto, laddr, raddr, opts...)
+}
@@ -0,0 +1,428 @@
+//go:build linux
+// +build linux
+
+package raw
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/net/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ip6"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/lysShub/rawsock/internal/assert"
+	"github.com/pkg/errors"
+	xbpf "golang.org/x/net/bpf"
+)
+
+type Listener struct {
+	proto tcpip.TransportProtocolNumber
+	addr  netip.Addr
+	zone  int // interface index of zoned addr
+	cfg   *rawsock.Config
+
+	raw *net.IPConn
+	pc6 *ipv6.PacketConn // recv destination address of ipv6 packet
+
+	conns   map[netip.Addr]struct{}
+	connsMu sync.RWMutex
+
+	short, overLimit atomic.Uint64
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+
+// Listen accept conn for every new remote address that send protocol proto
+// packet to laddr, port of conn's address is always 0
+func Listen(proto tcpip.TransportProtocolNumber, laddr netip.Addr, opts ...rawsock.Option) (l *Listener, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		l, err = listen(proto, laddr, cfg)
+		return err
+	})
+	return l, err
+}
+
+func listen(proto tcpip.TransportProtocolNumber, laddr netip.Addr, cfg *rawsock.Config) (*Listener, error) {
+	if err := checkProto(proto); err != nil {
+		return nil, err
+	}
+	var l = &Listener{
+		proto: proto,
+		addr:  laddr,
+		cfg:   cfg,
+		conns: make(map[netip.Addr]struct{}, 16),
+	}
+	var err error
+
+	if l.zone, err = ip6.ZoneIndex(laddr.Zone()); err != nil {
+		return nil, l.close(err)
+	}
+
+	network := "ip4:" + strconv.Itoa(int(proto))
+	if !laddr.Is4() {
+		network = "ip6:" + strconv.Itoa(int(proto))
+	}
+	l.raw, err = net.ListenIP(network, &net.IPAddr{IP: laddr.AsSlice(), Zone: laddr.Zone()})
+	if err != nil {
+		return nil, l.close(errors.WithStack(err))
+	}
+	if !laddr.Is4() {
+		l.pc6 = ipv6.NewPacketConn(l.raw)
+		if err = l.pc6.SetControlMessage(ipv6.FlagDst, true); err != nil {
+			return nil, l.close(errors.WithStack(err))
+		}
+	}
+
+	if raw, err := l.raw.SyscallConn(); err != nil {
+		return nil, l.close(errors.WithStack(err))
+	} else {
+		if l.cfg.VRF != "" {
+			if err = vrf.Bind(raw, l.cfg.VRF); err != nil {
+				return nil, l.close(err)
+			}
+		}
+		if err = setBPF(raw, l.cfg.Filter, l.zone); err != nil {
+			return nil, l.close(err)
+		}
+	}
+	return l, nil
+}
+
+func (l *Listener) close(cause error) error {
+	return l.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		if l.raw != nil {
+			errs = append(errs, errors.WithStack(l.raw.Close()))
+		}
+		return errs
+	})
+}
+
+func (l *Listener) Accept() (rawsock.RawConn, error) {
+	var b = make([]byte, header.IPv4MaximumHeaderSize+1)
+	for {
+		// listen on unspecified address accept packet to any local address,
+		// resolve conn's local address from destination address
+		var id, local netip.Addr
+		if l.addr.Is4() {
+			n, err := l.raw.Read(b)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			} else if n < header.IPv4MinimumSize {
+				l.short.Add(1)
+				continue
+			}
+			iphdr := header.IPv4(b[:n])
+			local = netip.AddrFrom4(iphdr.DestinationAddress().As4())
+			id = netip.AddrFrom4(iphdr.SourceAddress().As4())
+		} else {
+			// ipv6 raw socket not recv ip header
+			_, cm, src, err := l.pc6.ReadFrom(b)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			} else if cm == nil {
+				l.short.Add(1)
+				continue
+			}
+			dst, _ := netip.AddrFromSlice(cm.Dst)
+			srcAddr, _ := netip.AddrFromSlice(src.(*net.IPAddr).IP)
+			local, id = ip6.Zone(dst, l.zone), ip6.Zone(srcAddr, l.zone)
+		}
+		if !l.addr.WithZone("").IsUnspecified() {
+			local = l.addr
+		}
+
+		l.connsMu.Lock()
+		if _, has := l.conns[id]; has {
+			l.connsMu.Unlock()
+			continue
+		} else if l.cfg.MaxConns > 0 && len(l.conns) >= l.cfg.MaxConns {
+			l.connsMu.Unlock()
+			l.overLimit.Add(1)
+			continue
+		}
+		l.conns[id] = struct{}{}
+		l.connsMu.Unlock()
+
+		c := newConnect(l.proto, local, id, l.deleteConn)
+		if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+			return nil, errorx.WrapTemp(c.close(err))
+		}
+		return c, nil
+	}
+}
+
+func (l *Listener) deleteConn(raddr netip.Addr) error {
+	if l == nil {
+		return nil
+	}
+	l.connsMu.Lock()
+	delete(l.conns, raddr)
+	l.connsMu.Unlock()
+	return nil
+}
+func (l *Listener) Addr() netip.AddrPort { return netip.AddrPortFrom(l.addr, 0) }
+func (l *Listener) Stats() rawsock.ListenerStats {
+	return rawsock.ListenerStats{Short: l.short.Load(), OverLimit: l.overLimit.Load()}
+}
+func (l *Listener) Close() error { return l.close(nil) }
+
+// Connect create conn of ip protocol proto, laddr can be unspecified
+func Connect(proto tcpip.TransportProtocolNumber, laddr, raddr netip.Addr, opts ...rawsock.Option) (c *Conn, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		c, err = connect(proto, laddr, raddr, cfg)
+		return err
+	})
+	return c, err
+}
+
+func connect(proto tcpip.TransportProtocolNumber, laddr, raddr netip.Addr, cfg *rawsock.Config) (*Conn, error) {
+	if err := checkProto(proto); err != nil {
+		return nil, err
+	}
+	var err error
+	if laddr, raddr, err = helper.ZoneAddrs(laddr, raddr); err != nil {
+		return nil, err
+	}
+	if cfg.VRF != "" && laddr.WithZone("").IsUnspecified() {
+		laddr, err = vrf.DefaultLocal(cfg.VRF, raddr)
+	} else {
+		laddr, err = helper.DefaultLocal(laddr, raddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c = newConnect(proto, laddr, raddr, nil)
+	if err := c.init(cfg); err != nil {
+		return nil, c.close(err)
+	}
+	return c, nil
+}
+
+type Conn struct {
+	proto         tcpip.TransportProtocolNumber
+	laddr, raddr  netip.Addr
+	closeCallback func(raddr netip.Addr) error
+
+	raw     *net.IPConn
+	ipstack *ipstack.IPStack
+	zone    int // interface index of zoned laddr
+
+	mtu      *ipstack.PMTU
+	ptb      net.PacketConn // recv ICMPv6 packet too big
+	fragment bool           // kernel fragment oversize packet
+	hdrincl  bool           // Write take complete ip packet, if HdrIncl
+
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+var _ syscall.Conn = (*Conn)(nil)
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		c.idle.Stop()
+
+		if c.closeCallback != nil {
+			errs = append(errs, c.closeCallback(c.raddr))
+		}
+		if c.raw != nil {
+			errs = append(errs, errors.WithStack(c.raw.Close()))
+		}
+		if c.ptb != nil {
+			errs = append(errs, errors.WithStack(c.ptb.Close()))
+		}
+		return
+	})
+}
+
+func newConnect(proto tcpip.TransportProtocolNumber, laddr, raddr netip.Addr, close func(netip.Addr) error) *Conn {
+	return &Conn{proto: proto, laddr: laddr, raddr: raddr, closeCallback: close}
+}
+
+func (c *Conn) init(cfg *rawsock.Config) (err error) {
+	if c.zone, err = ip6.ZoneIndex(c.laddr.Zone()); err != nil {
+		return err
+	}
+	if c.raw, err = net.DialIP(
+		"ip:"+strconv.Itoa(int(c.proto)),
+		&net.IPAddr{IP: c.laddr.AsSlice(), Zone: c.laddr.Zone()},
+		&net.IPAddr{IP: c.raddr.AsSlice(), Zone: c.raddr.Zone()},
+	); err != nil {
+		return errors.WithStack(err)
+	}
+	raw, err := c.raw.SyscallConn()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if cfg.VRF != "" {
+		if err = vrf.Bind(raw, cfg.VRF); err != nil {
+			return err
+		}
+	}
+
+	mtu := cfg.MTU
+	if mtu == 0 {
+		if mtu, err = helper.InterfaceMTU(c.laddr); err != nil {
+			return err
+		}
+	}
+	c.mtu = ipstack.NewPMTU(mtu, cfg.PMTUNotify)
+	if c.laddr.Is6() {
+		if c.ptb, err = ipstack.WatchPTB(c.laddr, c.handlePTB); err != nil {
+			return err
+		}
+	}
+	if cfg.HdrIncl {
+		c.hdrincl = true
+		if err = bind.SetHdrIncl(raw, c.laddr.Is4()); err != nil {
+			return err
+		}
+	}
+	if cfg.Fragment && c.laddr.Is4() {
+		c.fragment = true
+		if err = bind.DisablePMTUDisc(raw); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPoll > 0 {
+		if err = bind.SetBusyPoll(raw, cfg.BusyPoll, cfg.BusyPollBudget); err != nil {
+			return err
+		}
+	}
+	if err = setBPF(raw, cfg.Filter, c.zone); err != nil {
+		return err
+	}
+
+	if c.ipstack, err = ipstack.New(
+		c.laddr, c.raddr,
+		c.proto,
+		cfg.IPStack.Unmarshal(),
+	); err != nil {
+		return err
+	}
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
+	return nil
+}
+
+func (c *Conn) handlePTB(ptb ipstack.PTB) {
+	if ptb.Proto == c.proto &&
+		ptb.Src.Addr() == c.laddr.WithZone("") && ptb.Dst.Addr() == c.raddr.WithZone("") {
+		c.mtu.Update(ptb.MTU)
+	}
+}
+
+// Read read protocol payload, connected raw socket only recv packet from
+// remote address
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	n, err := c.raw.Read(pkt.Bytes())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pkt.SetData(n)
+	c.idle.Touch()
+
+	// ipv6 raw socket not recv ip header
+	if c.laddr.Is4() {
+		hdrLen, err := helper.IPCheck(pkt.Bytes())
+		if err != nil {
+			return err
+		}
+		c.valid.ValidIP(pkt.Bytes())
+		pkt.SetHead(pkt.Head() + int(hdrLen))
+	}
+	return nil
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	if c.hdrincl {
+		return c.writeIP(pkt)
+	}
+	if n := pkt.Data() + c.ipstack.Size(); n > c.mtu.Load() && !c.fragment {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
+	_, err = c.raw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
+// writeIP write complete ip packet, if HdrIncl
+func (c *Conn) writeIP(pkt *packet.Packet) (err error) {
+	if _, err = helper.IPCheck(pkt.Bytes()); err != nil {
+		return err
+	} else if n := pkt.Data(); n > c.mtu.Load() {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
+	c.valid.ValidIP(pkt.Bytes())
+	_, err = c.raw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	defer pkt.DetachN(c.ipstack.Size())
+	c.ipstack.AttachInbound(pkt)
+	c.valid.ValidIP(pkt.Bytes())
+	_, err = c.raw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
+// SyscallConn return underlying socket, used to set socket options
+func (c *Conn) SyscallConn() (syscall.RawConn, error) { return c.raw.SyscallConn() }
+
+// Proto ip protocol number of conn
+func (c *Conn) Proto() tcpip.TransportProtocolNumber { return c.proto }
+func (c *Conn) LocalAddr() netip.AddrPort            { return netip.AddrPortFrom(c.laddr, 0) }
+func (c *Conn) RemoteAddr() netip.AddrPort           { return netip.AddrPortFrom(c.raddr, 0) }
+func (c *Conn) Close() error                         { return c.close(nil) }
+
+// MTU current egress path mtu
+func (c *Conn) MTU() int { return c.mtu.Load() }
+
+func checkProto(proto tcpip.TransportProtocolNumber) error {
+	if proto == 0 || proto > 0xff {
+		return errors.Errorf("not support ip protocol number %d", proto)
+	}
+	return nil
+}
+
+// setBPF set Filter and interface check, connected raw socket has filtered
+// address, and there is not port
+func setBPF(raw syscall.RawConn, filter string, zone int) error {
+	ins, err := bpf.WithFilter(filter, bpf.WithInterface(zone, []xbpf.Instruction{
+		xbpf.RetConstant{Val: 0xffff},
+	}))
+	if err != nil {
+		return err
+	}
+	return bpf.SetRawBPF(raw, ins)
+}
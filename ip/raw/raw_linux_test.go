@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package raw
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// experimental protocol number, RFC 3692
+const proto tcpip.TransportProtocolNumber = 253
+
+func Test_Connect(t *testing.T) {
+	var (
+		a = netip.MustParseAddr("127.0.0.1")
+		b = netip.MustParseAddr("127.0.0.2")
+	)
+	c1, err := Connect(proto, a, b, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := Connect(proto, b, a, rawsock.MTU(1500))
+	require.NoError(t, err)
+	defer c2.Close()
+	require.Equal(t, netip.AddrPortFrom(b, 0), c1.RemoteAddr())
+
+	var msg = []byte("hello world")
+	require.NoError(t, c1.Write(packet.Make(64, 0, len(msg)).Append(msg...)))
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, c2.Read(p))
+	require.Equal(t, msg, p.Bytes())
+
+	err = c1.Write(packet.Make(64, 1500))
+	var e *rawsock.ErrPacketTooLarge
+	require.ErrorAs(t, err, &e)
+
+	t.Run("invalid-proto", func(t *testing.T) {
+		_, err := Connect(0, a, b)
+		require.Error(t, err)
+		_, err = Listen(256, a)
+		require.Error(t, err)
+	})
+}
+
+func Test_Listen(t *testing.T) {
+	for _, e := range []struct{ laddr, caddr netip.Addr }{
+		{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.2")},
+		{netip.IPv4Unspecified(), netip.MustParseAddr("127.0.0.3")},
+		{netip.IPv6Loopback(), netip.IPv6Loopback()},
+	} {
+		t.Run(e.laddr.String(), func(t *testing.T) {
+			l, err := Listen(proto, e.laddr)
+			require.NoError(t, err)
+			defer l.Close()
+
+			server := e.laddr
+			if server.IsUnspecified() {
+				server = netip.MustParseAddr("127.0.0.1")
+			}
+			c, err := Connect(proto, e.caddr, server, rawsock.MTU(1500))
+			require.NoError(t, err)
+			defer c.Close()
+
+			var msg = []byte("hello")
+			require.NoError(t, c.Write(packet.Make(64, 0, len(msg)).Append(msg...)))
+
+			a, err := l.Accept()
+			require.NoError(t, err)
+			defer a.Close()
+			require.Equal(t, netip.AddrPortFrom(e.caddr, 0), a.RemoteAddr())
+			require.Equal(t, netip.AddrPortFrom(server, 0), a.LocalAddr())
+
+			require.NoError(t, a.Write(packet.Make(64, 0, len(msg)).Append(msg...)))
+			var p = packet.Make(0, 1536)
+			require.NoError(t, c.Read(p))
+			require.Equal(t, msg, p.Bytes())
+		})
+	}
+}
+
+func Test_HdrIncl(t *testing.T) {
+	var (
+		a = netip.MustParseAddr("127.0.0.1")
+		b = netip.MustParseAddr("127.0.0.2")
+	)
+	c, err := Connect(proto, a, b, rawsock.MTU(1500), rawsock.HdrIncl())
+	require.NoError(t, err)
+	defer c.Close()
+
+	// capture complete ip packet
+	capture, err := net.ListenIP("ip4:"+strconv.Itoa(int(proto)), &net.IPAddr{IP: b.AsSlice()})
+	require.NoError(t, err)
+	defer capture.Close()
+
+	var msg = []byte("hello")
+	pkt := packet.Make(0, header.IPv4MinimumSize+len(msg))
+	copy(pkt.Bytes()[header.IPv4MinimumSize:], msg)
+	ip := header.IPv4(pkt.Bytes())
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(pkt.Data()),
+		ID:          0x1234,
+		TTL:         7,
+		Protocol:    uint8(proto),
+		SrcAddr:     tcpip.AddrFrom4(a.As4()),
+		DstAddr:     tcpip.AddrFrom4(b.As4()),
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	require.NoError(t, c.Write(pkt))
+
+	var p = make([]byte, 1536)
+	n, err := capture.Read(p)
+	require.NoError(t, err)
+	ip = header.IPv4(p[:n])
+	require.Equal(t, uint8(7), ip.TTL())
+	require.Equal(t, uint16(0x1234), ip.ID())
+	require.Equal(t, msg, ip.Payload())
+
+	// not ip packet
+	require.Error(t, c.Write(packet.Make(0, 0, 16).Append(msg...)))
+}
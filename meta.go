@@ -0,0 +1,47 @@
+package rawsock
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+)
+
+// Meta ancillary data of received packet
+type Meta struct {
+	Time time.Time // receive timestamp, zero if not enable Timestamp
+
+	// valid if enable Ancillary
+	TTL   uint8      // ttl or hop limit
+	TOS   uint8      // tos or traffic class
+	Dst   netip.Addr // destination address
+	Ifidx int        // receive interface index
+}
+
+// MetaConn RawConn support read packet with ancillary data, only support linux
+type MetaConn interface {
+	RawConn
+
+	// ReadMeta same as Read, and return ancillary data of the packet
+	ReadMeta(pkt *packet.Packet) (Meta, error)
+}
+
+// Frame link layer header of received packet
+type Frame struct {
+	Src, Dst  net.HardwareAddr // Dst is nil if frame not sent to host/broadcast/multicast
+	EtherType uint16
+	VLAN      uint16 // 802.1Q tag control information, 0 is untagged
+}
+
+// VID vlan id of tag
+func (f Frame) VID() uint16 { return f.VLAN & 0xfff }
+
+// FrameConn RawConn support read packet with link layer header, only
+// support linux eth backend
+type FrameConn interface {
+	RawConn
+
+	// ReadFrame same as Read, and return link layer header of the packet
+	ReadFrame(pkt *packet.Packet) (Frame, error)
+}
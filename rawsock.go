@@ -3,6 +3,7 @@ package rawsock
 import (
 	"net"
 	"net/netip"
+	"time"
 
 	"github.com/lysShub/netkit/packet"
 )
@@ -33,9 +34,60 @@ type Listener interface {
 	Close() error
 }
 
+// ListenerStats counts of handshake packets dropped by Listener
+type ListenerStats struct {
+	Short     uint64 // too short to be a valid packet
+	NonSyn    uint64 // tcp packet without SYN flag, or with ACK flag
+	OverLimit uint64 // exceed MaxConns
+	Duplicate uint64 // retransmitted SYN of accepted conn (same ISN)
+}
+
+// StatsListener Listener expose dropped packets counters, help to distinguish
+// attack traffic from misconfiguration when Accept seems quiet
+type StatsListener interface {
+	Listener
+
+	Stats() ListenerStats
+}
+
+// ConnState conn accepted by Listener
+type ConnState struct {
+	Local  netip.AddrPort
+	Remote netip.AddrPort
+	ISN    uint32    // handshake SYN sequence number
+	Closed time.Time // zero if not closed, closed conn is kept a while to drop retransmitted SYN
+}
+
+// ListenerState conn table of Listener, can be encoded by encoding/json
+type ListenerState struct {
+	Addr  netip.AddrPort
+	Conns []ConnState
+}
+
+// StateListener Listener support export/import conn table, for hot restart:
+// the new process listen the same address (UsedPort or passed fd), and Import
+// the state exported by old process, then old process exit without close
+// conns.
+type StateListener interface {
+	Listener
+
+	// Export conn table
+	Export() ListenerState
+
+	// Import conn table, return not closed conns
+	Import(s ListenerState) ([]RawConn, error)
+}
+
 // todo: 支持raw读写
 // todo: 删除Read会将tail作为容量进行读取
 // todo: 支持deadline
+
+// RawConn Read and Write may be called concurrently with each other, not
+// with themselves, wrappers such as fec, reorder and coalesce keep read
+// state. backend conns are stronger, like a socket: concurrent Read callers
+// share one queue, concurrent Write packets are sent whole, not interleaved,
+// use fanout.New if every reader need every packet. Close unblock pending
+// Read/Write with net.ErrClosed. a pkt must not be used by concurrent calls.
 type RawConn interface {
 
 	// Read read tcp/udp/icmp packet from remote address
@@ -54,6 +106,75 @@ type RawConn interface {
 	Close() error
 }
 
+// RoamConn RawConn support update remote address, such as peer changed
+// address behind NAT, only support linux
+type RoamConn interface {
+	RawConn
+
+	// SetRemote update remote address atomically, the conn will only
+	// recv/send packet from/to the new remote address after return
+	SetRemote(raddr netip.AddrPort) error
+}
+
+// PeekConn RawConn accepted with PeekPayload option
+type PeekConn interface {
+	RawConn
+
+	// Peek first payload sent by peer, it's also returned by Read after
+	// handshake. nil if peer not send payload within peek timeout
+	Peek() []byte
+}
+
+// BufferConn RawConn provide read buffers sized to egress mtu, see
+// ReadBuffers option, only support linux
+type BufferConn interface {
+	RawConn
+
+	// MTU current egress path mtu
+	MTU() int
+
+	// Packet get a read buffer that Read can fill without grow or copy,
+	// preallocated if ReadBuffers set, should Release after used
+	Packet() *packet.Packet
+	Release(pkt *packet.Packet)
+}
+
+// Capability optional features of RawConn backend
+type Capability uint32
+
+const (
+	// CapWrite Write send packet to remote address
+	CapWrite Capability = 1 << iota
+	// CapInject Inject packet to local address
+	CapInject
+	// CapIPv6 support ipv6 address
+	CapIPv6
+	// CapExclusive packets not seen by local network stack, otherwise it
+	// maybe reply RST/ICMP for the packets
+	CapExclusive
+
+	CapAll = CapWrite | CapInject | CapIPv6 | CapExclusive
+)
+
+func (c Capability) Has(f Capability) bool { return c&f == f }
+
+// CapableConn RawConn of degraded backend, not support all features,
+// method of unsupported feature return ErrNotSupported
+type CapableConn interface {
+	RawConn
+
+	Capabilities() Capability
+}
+
+// Capabilities get conn supported features, RawConn not implement
+// CapableConn support all
+func Capabilities(conn RawConn) Capability {
+	if c, ok := conn.(CapableConn); ok {
+		return c.Capabilities()
+	}
+	return CapAll
+}
+
 func LocalAddr() netip.Addr {
 	c, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: []byte{8, 8, 8, 8}, Port: 53})
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/lysShub/rawsock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -14,3 +15,18 @@ func Test_Gofmt(t *testing.T) {
 	require.NoError(t, err)
 	require.Empty(t, string(out))
 }
+
+type degradedConn struct{ rawsock.RawConn }
+
+func (degradedConn) Capabilities() rawsock.Capability { return rawsock.CapIPv6 }
+
+func Test_Capabilities(t *testing.T) {
+	var c rawsock.RawConn
+	require.Equal(t, rawsock.CapAll, rawsock.Capabilities(c))
+
+	c = degradedConn{}
+	caps := rawsock.Capabilities(c)
+	require.True(t, caps.Has(rawsock.CapIPv6))
+	require.False(t, caps.Has(rawsock.CapWrite))
+	require.False(t, caps.Has(rawsock.CapWrite|rawsock.CapIPv6))
+}
@@ -0,0 +1,131 @@
+package reassembly
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Flow one direction of tcp connection
+type Flow struct {
+	Src, Dst netip.AddrPort
+}
+
+func (f Flow) Reverse() Flow { return Flow{Src: f.Dst, Dst: f.Src} }
+
+type Handler interface {
+	// Data in-order data of flow, only valid during the call
+	Data(flow Flow, data []byte)
+
+	// Closed flow finished by FIN/RST, or flushed for idle
+	Closed(flow Flow)
+}
+
+// Assembler track streams of many flows, not concurrent safe
+type Assembler struct {
+	h    Handler
+	opts []Option
+
+	streams map[Flow]*entry
+}
+
+type entry struct {
+	*Stream
+	last time.Time
+}
+
+func NewAssembler(h Handler, opts ...Option) *Assembler {
+	return &Assembler{h: h, opts: opts, streams: map[Flow]*entry{}}
+}
+
+// Assemble push a ip packet, non-tcp packet is ignored
+func (a *Assembler) Assemble(ip []byte) error {
+	var (
+		flow Flow
+		tcp  header.TCP
+	)
+	switch header.IPVersion(ip) {
+	case 4:
+		iphdr := header.IPv4(ip)
+		if !iphdr.IsValid(len(ip)) {
+			return errors.New("invalid ipv4 packet")
+		} else if iphdr.TransportProtocol() != header.TCPProtocolNumber || iphdr.More() || iphdr.FragmentOffset() != 0 {
+			return nil
+		}
+		tcp = iphdr.Payload()
+		flow.Src = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), 0)
+		flow.Dst = netip.AddrPortFrom(netip.AddrFrom4(iphdr.DestinationAddress().As4()), 0)
+	case 6:
+		iphdr := header.IPv6(ip)
+		if !iphdr.IsValid(len(ip)) {
+			return errors.New("invalid ipv6 packet")
+		} else if iphdr.TransportProtocol() != header.TCPProtocolNumber {
+			return nil
+		}
+		tcp = iphdr.Payload()
+		flow.Src = netip.AddrPortFrom(netip.AddrFrom16(iphdr.SourceAddress().As16()), 0)
+		flow.Dst = netip.AddrPortFrom(netip.AddrFrom16(iphdr.DestinationAddress().As16()), 0)
+	default:
+		return errors.Errorf("invalid ip version %d", header.IPVersion(ip))
+	}
+	if len(tcp) < header.TCPMinimumSize {
+		return errors.New("short tcp segment")
+	}
+	flow.Src = netip.AddrPortFrom(flow.Src.Addr(), tcp.SourcePort())
+	flow.Dst = netip.AddrPortFrom(flow.Dst.Addr(), tcp.DestinationPort())
+
+	a.AssembleTCP(flow, tcp)
+	return nil
+}
+
+// AssembleTCP push a tcp segment of flow
+func (a *Assembler) AssembleTCP(flow Flow, tcp header.TCP) {
+	e, has := a.streams[flow]
+	if !has {
+		e = &entry{Stream: NewStream(a.opts...)}
+		a.streams[flow] = e
+	}
+	e.last = time.Now()
+
+	e.Push(tcp, func(data []byte) { a.h.Data(flow, data) })
+	if e.Closed() {
+		delete(a.streams, flow)
+		a.h.Closed(flow)
+	}
+}
+
+// FlushOlderThan close streams not active since t, return closed count
+func (a *Assembler) FlushOlderThan(t time.Time) int {
+	var n int
+	for flow, e := range a.streams {
+		if e.last.Before(t) {
+			delete(a.streams, flow)
+			a.h.Closed(flow)
+			n++
+		}
+	}
+	return n
+}
+
+// Streams count of tracked streams
+func (a *Assembler) Streams() int { return len(a.streams) }
+
+// ReadConn reassemble inbound segments of RawConn until Read error, such as
+// closed. fn be called with in-order data sent by peer.
+func ReadConn(conn rawsock.RawConn, fn func(data []byte), opts ...Option) error {
+	var (
+		s   = NewStream(opts...)
+		pkt = packet.Make(0, 0xffff)
+	)
+	for !s.Closed() {
+		if err := conn.Read(pkt.Sets(0, 0xffff)); err != nil {
+			return err
+		}
+		s.Push(pkt.Bytes(), fn)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package reassembly_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/reassembly"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type handler struct {
+	data   map[reassembly.Flow]string
+	closed []reassembly.Flow
+}
+
+func (h *handler) Data(flow reassembly.Flow, data []byte) { h.data[flow] += string(data) }
+func (h *handler) Closed(flow reassembly.Flow)            { h.closed = append(h.closed, flow) }
+
+func Test_Assembler(t *testing.T) {
+	var (
+		c    = netip.AddrPortFrom(test.RandIP(), 1234)
+		s    = netip.AddrPortFrom(test.RandIP(), 80)
+		flow = reassembly.Flow{Src: c, Dst: s}
+		h    = &handler{data: map[reassembly.Flow]string{}}
+		a    = reassembly.NewAssembler(h)
+	)
+	ip := func(src, dst netip.AddrPort, tcp header.TCP) []byte {
+		tcp.SetSourcePort(src.Port())
+		tcp.SetDestinationPort(dst.Port())
+		return test.BuildIP(t, src.Addr(), dst.Addr(), header.TCPProtocolNumber, tcp)
+	}
+
+	require.NoError(t, a.Assemble(ip(c, s, seg(10, header.TCPFlagSyn, ""))))
+	require.NoError(t, a.Assemble(ip(s, c, seg(50, header.TCPFlagSyn|header.TCPFlagAck, ""))))
+	require.NoError(t, a.Assemble(ip(c, s, seg(14, header.TCPFlagAck, " / HTTP/1.1"))))
+	require.NoError(t, a.Assemble(ip(c, s, seg(11, header.TCPFlagAck, "GET"))))
+	require.NoError(t, a.Assemble(ip(s, c, seg(51, header.TCPFlagAck|header.TCPFlagFin, "200 OK"))))
+
+	require.Equal(t, "GET / HTTP/1.1", h.data[flow])
+	require.Equal(t, "200 OK", h.data[flow.Reverse()])
+	require.Equal(t, []reassembly.Flow{flow.Reverse()}, h.closed)
+	require.Equal(t, 1, a.Streams())
+
+	require.Equal(t, 1, a.FlushOlderThan(time.Now().Add(time.Second)))
+	require.Equal(t, []reassembly.Flow{flow.Reverse(), flow}, h.closed)
+	require.Zero(t, a.Streams())
+}
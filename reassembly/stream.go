@@ -0,0 +1,169 @@
+// Package reassembly reassemble captured tcp segments to ordered byte stream
+// per direction, handle retransmission, overlap and gap.
+package reassembly
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	MaxBuffer int // max out-of-order bytes buffered per stream
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		MaxBuffer: 1 << 20,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MaxBuffer max out-of-order bytes buffered per stream, default 1MB, when
+// exceed, the gap is skipped as lost
+func MaxBuffer(n int) Option {
+	return func(c *Config) {
+		c.MaxBuffer = max(n, 0)
+	}
+}
+
+type Stats struct {
+	Retransmitted uint64 // segments totally received before
+	Overlapped    uint64 // bytes trimmed for partially received before
+	Skipped       uint64 // bytes of gap skipped
+}
+
+// Stream reassemble one direction of tcp connection, not concurrent safe
+type Stream struct {
+	cfg *Config
+
+	init     bool
+	next     uint32 // next expected sequence
+	closed   bool   // recv FIN or RST
+	pending  []segment
+	buffered int
+
+	stats Stats
+}
+
+type segment struct {
+	seq  uint32
+	data []byte
+	fin  bool
+}
+
+func NewStream(opts ...Option) *Stream {
+	return &Stream{cfg: Options(opts...)}
+}
+
+// Push push a tcp segment, fn be called with in-order data, data is only
+// valid during the call.
+func (s *Stream) Push(tcp header.TCP, fn func(data []byte)) {
+	if s.closed || len(tcp) < header.TCPMinimumSize || len(tcp) < int(tcp.DataOffset()) {
+		return
+	}
+	var (
+		flags   = tcp.Flags()
+		seq     = tcp.SequenceNumber()
+		payload = tcp.Payload()
+		fin     = flags.Contains(header.TCPFlagFin)
+	)
+	if flags.Contains(header.TCPFlagSyn) {
+		seq++ // SYN occupy one sequence
+		if !s.init {
+			s.init, s.next = true, seq
+		}
+	}
+	if flags.Contains(header.TCPFlagRst) {
+		s.closed = true
+		return
+	}
+	if !s.init {
+		if len(payload) == 0 && !fin {
+			return
+		}
+		// capture start in the middle of connection
+		s.init, s.next = true, seq
+	}
+
+	s.insert(seq, payload, fin)
+	s.flush(fn)
+
+	for s.buffered > s.cfg.MaxBuffer && len(s.pending) > 0 {
+		s.stats.Skipped += uint64(s.pending[0].seq - s.next)
+		s.next = s.pending[0].seq
+		s.flush(fn)
+	}
+}
+
+func (s *Stream) insert(seq uint32, data []byte, fin bool) {
+	if len(data) == 0 && !fin {
+		return // pure ack
+	}
+	end := seq + uint32(len(data))
+	if before(end, s.next) || (end == s.next && !fin) {
+		s.stats.Retransmitted++
+		return
+	}
+	if before(seq, s.next) {
+		s.stats.Overlapped += uint64(s.next - seq)
+		data = data[s.next-seq:]
+		seq = s.next
+	}
+
+	seg := segment{seq: seq, data: append([]byte(nil), data...), fin: fin}
+	i := sort.Search(len(s.pending), func(i int) bool {
+		return before(seg.seq, s.pending[i].seq)
+	})
+	s.pending = append(s.pending, segment{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = seg
+	s.buffered += len(seg.data)
+}
+
+func (s *Stream) flush(fn func(data []byte)) {
+	for len(s.pending) > 0 && !before(s.next, s.pending[0].seq) {
+		seg := s.pending[0]
+		s.pending = s.pending[1:]
+		s.buffered -= len(seg.data)
+
+		data := seg.data
+		if off := s.next - seg.seq; off > 0 {
+			if int(off) >= len(data) {
+				if len(data) > 0 {
+					s.stats.Retransmitted++
+				}
+				data = nil
+			} else {
+				s.stats.Overlapped += uint64(off)
+				data = data[off:]
+			}
+		}
+		if len(data) > 0 {
+			fn(data)
+			s.next += uint32(len(data))
+		}
+		if seg.fin && seg.seq+uint32(len(seg.data)) == s.next {
+			s.next++
+			s.closed = true
+			s.pending, s.buffered = nil, 0
+			return
+		}
+	}
+}
+
+// Closed recv FIN or RST, and all data before FIN delivered
+func (s *Stream) Closed() bool { return s.closed }
+
+// Buffered out-of-order bytes waiting for gap
+func (s *Stream) Buffered() int { return s.buffered }
+
+func (s *Stream) Stats() Stats { return s.stats }
+
+// before a is before b in sequence space
+func before(a, b uint32) bool { return int32(a-b) < 0 }
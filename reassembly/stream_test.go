@@ -0,0 +1,110 @@
+package reassembly_test
+
+import (
+	"testing"
+
+	"github.com/lysShub/rawsock/reassembly"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func seg(seq uint32, flags header.TCPFlags, payload string) header.TCP {
+	var b = make([]byte, header.TCPMinimumSize+len(payload))
+	header.TCP(b).Encode(&header.TCPFields{
+		SrcPort:    1,
+		DstPort:    2,
+		SeqNum:     seq,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      flags,
+	})
+	copy(b[header.TCPMinimumSize:], payload)
+	return b
+}
+
+type collector struct{ data []byte }
+
+func (c *collector) fn(b []byte) { c.data = append(c.data, b...) }
+
+func Test_Stream(t *testing.T) {
+	const ack = header.TCPFlagAck
+
+	t.Run("in order", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(99, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(100, ack, "hello"), c.fn)
+		s.Push(seg(105, ack, " world"), c.fn)
+		require.Equal(t, "hello world", string(c.data))
+		require.False(t, s.Closed())
+
+		s.Push(seg(111, ack|header.TCPFlagFin, ""), c.fn)
+		require.True(t, s.Closed())
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(99, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(105, ack|header.TCPFlagFin, " world"), c.fn)
+		s.Push(seg(103, ack, "lo"), c.fn)
+		require.Empty(t, c.data)
+		require.Equal(t, 8, s.Buffered())
+
+		s.Push(seg(100, ack, "hel"), c.fn)
+		require.Equal(t, "hello world", string(c.data))
+		require.True(t, s.Closed())
+		require.Zero(t, s.Buffered())
+	})
+
+	t.Run("retransmit and overlap", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(99, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(100, ack, "hello"), c.fn)
+		s.Push(seg(100, ack, "hello"), c.fn)
+		s.Push(seg(103, ack, "lo world"), c.fn)
+		require.Equal(t, "hello world", string(c.data))
+		require.Equal(t, reassembly.Stats{Retransmitted: 1, Overlapped: 2}, s.Stats())
+	})
+
+	t.Run("gap skip", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream(reassembly.MaxBuffer(4))
+		s.Push(seg(99, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(100, ack, "ab"), c.fn)
+		s.Push(seg(110, ack, "xyz"), c.fn)
+		require.Equal(t, "ab", string(c.data))
+
+		s.Push(seg(113, ack, "uv"), c.fn)
+		require.Equal(t, "abxyzuv", string(c.data))
+		require.Equal(t, uint64(8), s.Stats().Skipped)
+	})
+
+	t.Run("mid stream", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(5000, ack, ""), c.fn)
+		s.Push(seg(5000, ack, "abc"), c.fn)
+		s.Push(seg(5003, ack, "def"), c.fn)
+		require.Equal(t, "abcdef", string(c.data))
+	})
+
+	t.Run("sequence wrap", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(0xfffffffd, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(0x00000001, ack, "world"), c.fn)
+		s.Push(seg(0xfffffffe, ack, "hel"), c.fn)
+		require.Equal(t, "helworld", string(c.data))
+	})
+
+	t.Run("rst", func(t *testing.T) {
+		var c collector
+		s := reassembly.NewStream()
+		s.Push(seg(99, header.TCPFlagSyn, ""), c.fn)
+		s.Push(seg(100, header.TCPFlagRst, ""), c.fn)
+		require.True(t, s.Closed())
+		s.Push(seg(100, ack, "abc"), c.fn)
+		require.Empty(t, c.data)
+	})
+}
@@ -0,0 +1,351 @@
+//go:build linux
+// +build linux
+
+// Package scanner scan tcp ports by SYN probes on a single raw socket, the
+// probes are sent at limited rate, and SYN-ACK/RST replies are correlated
+// by the ISN encoded in probes, so there is no per-probe socket.
+package scanner
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type State uint8
+
+const (
+	_        State = iota
+	Open           // reply SYN-ACK
+	Closed         // reply RST
+	Filtered       // no reply after retries
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case Closed:
+		return "closed"
+	case Filtered:
+		return "filtered"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	Rate    int           // probes per second
+	Timeout time.Duration // wait reply after last probe of target
+	Retries int           // resend times for no reply target
+	Port    uint16        // probe source port
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Rate:    1000,
+		Timeout: time.Second,
+		Retries: 1,
+		Port:    uint16(rand.Intn(16384) + 49152),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Rate probes per second, default 1000
+func Rate(pps int) Option {
+	return func(c *Config) {
+		c.Rate = max(pps, 1)
+	}
+}
+
+// Timeout wait reply of probe, default 1s
+func Timeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+// Retries resend times for target without reply, default 1
+func Retries(n int) Option {
+	return func(c *Config) {
+		c.Retries = max(n, 0)
+	}
+}
+
+// SrcPort probe source port, default random high port
+func SrcPort(port uint16) Option {
+	return func(c *Config) {
+		c.Port = port
+	}
+}
+
+type Result struct {
+	Addr  netip.AddrPort
+	State State
+	RTT   time.Duration // zero if Filtered
+}
+
+type Scanner struct {
+	cfg    *Config
+	conn   *net.IPConn
+	secret [8]byte
+
+	mu      sync.Mutex
+	pending map[netip.AddrPort]time.Time // probe send time
+
+	results chan Result
+	err     error // valid after results closed
+}
+
+// Scan probe every port of every address in targets, targets must be same
+// ip version. require privilege of raw socket.
+func Scan(ctx context.Context, targets []netip.Prefix, ports []uint16, opts ...Option) (*Scanner, error) {
+	if len(targets) == 0 || len(ports) == 0 {
+		return nil, errors.New("require targets and ports")
+	}
+	var (
+		is4     = targets[0].Addr().Is4()
+		network = "ip4:tcp"
+		laddr   = &net.IPAddr{IP: net.IPv4zero}
+	)
+	for _, e := range targets {
+		if !e.IsValid() || e.Addr().Is4() != is4 {
+			return nil, errors.Errorf("invalid target %s", e.String())
+		}
+	}
+	if !is4 {
+		network, laddr = "ip6:tcp", &net.IPAddr{IP: net.IPv6zero}
+	}
+
+	var s = &Scanner{
+		cfg:     Options(opts...),
+		pending: map[netip.AddrPort]time.Time{},
+		results: make(chan Result, 64),
+	}
+	binary.BigEndian.PutUint64(s.secret[:], rand.Uint64())
+
+	var err error
+	if s.conn, err = net.ListenIP(network, laddr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if is4 {
+		// ipv4 raw socket bpf see ip header
+		raw, err := s.conn.SyscallConn()
+		if err != nil {
+			s.conn.Close()
+			return nil, errors.WithStack(err)
+		}
+		if err := bpf.SetRawBPF(raw, bpf.FilterDstPort(s.cfg.Port)); err != nil {
+			s.conn.Close()
+			return nil, err
+		}
+	}
+
+	var recved = make(chan struct{})
+	go func() {
+		defer close(recved)
+		s.recvService(ctx)
+	}()
+	go func() {
+		s.err = s.sendService(ctx, targets, ports)
+		s.conn.Close()
+		<-recved
+		close(s.results)
+	}()
+	return s, nil
+}
+
+// Results scan results, closed when scan finished
+func (s *Scanner) Results() <-chan Result { return s.results }
+
+// Err scan error, valid after Results closed
+func (s *Scanner) Err() error { return s.err }
+
+func (s *Scanner) sendService(ctx context.Context, targets []netip.Prefix, ports []uint16) error {
+	var (
+		interval = time.Second / time.Duration(s.cfg.Rate)
+		next     = time.Now()
+		srcs     = map[netip.Prefix]netip.Addr{}
+	)
+	var send = func(src netip.Addr, dst netip.AddrPort) error {
+		if next = next.Add(interval); time.Until(next) > 0 {
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else {
+			next = time.Now() // not accumulate burst
+		}
+
+		s.mu.Lock()
+		s.pending[dst] = time.Now()
+		s.mu.Unlock()
+		for {
+			_, err := s.conn.WriteTo(s.build(src, dst), &net.IPAddr{IP: dst.Addr().AsSlice()})
+			if err == nil {
+				return nil
+			} else if errorx.Temporary(err) {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, e := range targets {
+		e = e.Masked()
+		src, err := helper.DefaultLocal(netip.IPv4Unspecified(), e.Addr())
+		if e.Addr().Is6() {
+			src, err = helper.DefaultLocal(netip.IPv6Unspecified(), e.Addr())
+		}
+		if err != nil {
+			return err
+		}
+		srcs[e] = src
+
+		for addr := e.Addr(); addr.IsValid() && e.Contains(addr); addr = addr.Next() {
+			for _, port := range ports {
+				if err := send(src, netip.AddrPortFrom(addr, port)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for i := 0; i <= s.cfg.Retries; i++ {
+		select {
+		case <-time.After(s.cfg.Timeout):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		s.mu.Lock()
+		var dsts = make([]netip.AddrPort, 0, len(s.pending))
+		for dst := range s.pending {
+			dsts = append(dsts, dst)
+		}
+		s.mu.Unlock()
+		if len(dsts) == 0 {
+			return nil
+		}
+
+		for _, dst := range dsts {
+			if i == s.cfg.Retries {
+				if !s.report(ctx, dst, Filtered) {
+					return ctx.Err()
+				}
+				continue
+			}
+			for e, src := range srcs {
+				if e.Contains(dst.Addr()) {
+					if err := send(src, dst); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scanner) recvService(ctx context.Context) {
+	var b = make([]byte, 1536)
+	for {
+		n, from, err := s.conn.ReadFrom(b)
+		if err != nil {
+			return // closed
+		} else if n < header.TCPMinimumSize {
+			continue
+		}
+		addr, _ := netip.AddrFromSlice(from.(*net.IPAddr).IP)
+
+		tcp := header.TCP(b[:n])
+		dst := netip.AddrPortFrom(addr.Unmap(), tcp.SourcePort())
+		if tcp.DestinationPort() != s.cfg.Port || tcp.AckNumber() != s.isn(dst)+1 {
+			continue
+		}
+
+		var state State
+		switch flags := tcp.Flags(); {
+		case flags.Contains(header.TCPFlagSyn | header.TCPFlagAck):
+			state = Open
+		case flags.Contains(header.TCPFlagRst):
+			state = Closed
+		default:
+			continue
+		}
+		if !s.report(ctx, dst, state) {
+			return
+		}
+	}
+}
+
+// report result of dst, return false if ctx done
+func (s *Scanner) report(ctx context.Context, dst netip.AddrPort, state State) bool {
+	s.mu.Lock()
+	sent, has := s.pending[dst]
+	delete(s.pending, dst)
+	s.mu.Unlock()
+	if !has {
+		return true // duplicate reply
+	}
+
+	var r = Result{Addr: dst, State: state}
+	if state != Filtered {
+		r.RTT = time.Since(sent)
+	}
+	select {
+	case s.results <- r:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isn sequence number of probe to dst, reply's ack must be isn+1
+func (s *Scanner) isn(dst netip.AddrPort) uint32 {
+	h := fnv.New32a()
+	h.Write(s.secret[:])
+	h.Write(dst.Addr().AsSlice())
+	h.Write(binary.BigEndian.AppendUint16(nil, dst.Port()))
+	return h.Sum32()
+}
+
+func (s *Scanner) build(src netip.Addr, dst netip.AddrPort) []byte {
+	var b = make([]byte, header.TCPMinimumSize)
+	header.TCP(b).Encode(&header.TCPFields{
+		SrcPort:    s.cfg.Port,
+		DstPort:    dst.Port(),
+		SeqNum:     s.isn(dst),
+		DataOffset: header.TCPMinimumSize,
+		Flags:      header.TCPFlagSyn,
+		WindowSize: 0xffff,
+	})
+	sum := header.PseudoHeaderChecksum(
+		header.TCPProtocolNumber,
+		tcpip.AddrFromSlice(src.AsSlice()), tcpip.AddrFromSlice(dst.Addr().AsSlice()),
+		0,
+	)
+	ipstack.Checksum(header.TCPProtocolNumber, b, sum)
+	return b
+}
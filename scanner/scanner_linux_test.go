@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package scanner_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock/scanner"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Scan_Loopback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var (
+		open   = uint16(l.Addr().(*net.TCPAddr).Port)
+		closed = test.RandPort()
+	)
+	for closed == open {
+		closed = test.RandPort()
+	}
+
+	s, err := scanner.Scan(
+		context.Background(),
+		[]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+		[]uint16{open, closed},
+		scanner.Timeout(time.Millisecond*200),
+	)
+	require.NoError(t, err)
+
+	var states = map[uint16]scanner.State{}
+	for r := range s.Results() {
+		require.Equal(t, netip.MustParseAddr("127.0.0.1"), r.Addr.Addr())
+		states[r.Addr.Port()] = r.State
+	}
+	require.NoError(t, s.Err())
+	require.Equal(t, map[uint16]scanner.State{open: scanner.Open, closed: scanner.Closed}, states)
+}
+
+func Test_Scan_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := scanner.Scan(
+		ctx,
+		[]netip.Prefix{netip.MustParsePrefix("127.0.0.0/16")},
+		[]uint16{1},
+		scanner.Rate(10),
+	)
+	require.NoError(t, err)
+	cancel()
+
+	for range s.Results() {
+	}
+	require.ErrorIs(t, s.Err(), context.Canceled)
+}
@@ -0,0 +1,63 @@
+package sniff
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+// Meta captured packet metadata
+type Meta struct {
+	Time     time.Time
+	Outbound bool
+	Ifidx    int
+}
+
+// Config of Sniffer, option not apply to the platform is ignored
+type Config struct {
+	Interface *net.Interface    // capture interface, nil means all interfaces
+	Program   []bpf.Instruction // cBPF program for ip packet, only linux
+	Filter    string            // divert filter expression, only windows
+	Priority  int16             // divert priority, only windows
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Interface capture packets on interface ifi, default all interfaces
+func Interface(ifi *net.Interface) Option {
+	return func(c *Config) {
+		c.Interface = ifi
+	}
+}
+
+// Program filter packets by cBPF program for ip packet, only linux, default
+// capture all
+func Program(ins []bpf.Instruction) Option {
+	return func(c *Config) {
+		c.Program = ins
+	}
+}
+
+// DivertFilter filter packets by divert filter expression, such as
+// "tcp and localPort=80", only windows, default capture all
+func DivertFilter(expr string) Option {
+	return func(c *Config) {
+		c.Filter = expr
+	}
+}
+
+// Priority divert handle priority, only windows
+func Priority(priority int16) Option {
+	return func(c *Config) {
+		c.Priority = priority
+	}
+}
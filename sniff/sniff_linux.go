@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package sniff
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/eth"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Sniffer capture ip packets, not bind port and not affect the traffic
+type Sniffer struct {
+	fd  *os.File
+	raw syscall.RawConn
+
+	closeErr errorx.CloseErr
+}
+
+// Open capture ip packets, see Config
+func Open(opts ...Option) (*Sniffer, error) {
+	cfg := Options(opts...)
+
+	// protocol 0 not receive any packet until bind, avoid capture
+	// packets before filter attached
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var s = &Sniffer{fd: os.NewFile(uintptr(fd), "sniff")}
+
+	if len(cfg.Program) > 0 {
+		if err := bpf.SetBPF(uintptr(fd), cfg.Program); err != nil {
+			return nil, s.close(err)
+		}
+	}
+
+	var ifidx int
+	if cfg.Interface != nil {
+		ifidx = cfg.Interface.Index
+	}
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: uint16(eth.Htons(unix.ETH_P_ALL)),
+		Ifindex:  ifidx,
+	}); err != nil {
+		return nil, s.close(errors.WithStack(err))
+	}
+
+	if s.raw, err = s.fd.SyscallConn(); err != nil {
+		return nil, s.close(errors.WithStack(err))
+	}
+	return s, nil
+}
+
+func (s *Sniffer) close(cause error) error {
+	return s.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		if s.fd != nil {
+			errs = append(errs, errors.WithStack(s.fd.Close()))
+		}
+		return errs
+	})
+}
+
+// Read read a ip packet, ignore non-ip frames
+func (s *Sniffer) Read(pkt *packet.Packet) (Meta, error) {
+	var b = pkt.Bytes()
+	for {
+		var (
+			n     int
+			from  unix.Sockaddr
+			operr error
+		)
+		if err := s.raw.Read(func(fd uintptr) (done bool) {
+			n, from, operr = unix.Recvfrom(int(fd), b, unix.MSG_TRUNC)
+			return operr != unix.EAGAIN && operr != unix.EWOULDBLOCK
+		}); err != nil {
+			return Meta{}, errors.WithStack(err)
+		} else if operr != nil {
+			return Meta{}, errors.WithStack(operr)
+		}
+
+		ll, ok := from.(*unix.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		switch eth.Htons(ll.Protocol) {
+		case unix.ETH_P_IP, unix.ETH_P_IPV6:
+		default:
+			continue
+		}
+		if n > len(b) {
+			return Meta{}, errorx.ShortBuff(n, len(b))
+		}
+
+		pkt.SetData(n)
+		return Meta{
+			Time:     time.Now(),
+			Outbound: ll.Pkttype == unix.PACKET_OUTGOING,
+			Ifidx:    ll.Ifindex,
+		}, nil
+	}
+}
+
+func (s *Sniffer) SetReadDeadline(t time.Time) error { return s.fd.SetReadDeadline(t) }
+func (s *Sniffer) Close() error                      { return s.close(nil) }
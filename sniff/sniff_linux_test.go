@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package sniff_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/sniff"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Sniff_Loopback(t *testing.T) {
+	var (
+		saddr = netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), test.RandPort())
+	)
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+
+	s, err := sniff.Open(sniff.Interface(lo), sniff.Program(bpf.FilterDstPort(saddr.Port())))
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.DialUDP("udp", nil, test.UDPAddr(saddr))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// loopback packet captured twice, outbound and inbound
+	var outbound, inbound bool
+	for !outbound || !inbound {
+		require.NoError(t, s.SetReadDeadline(time.Now().Add(time.Second*3)))
+
+		var p = packet.Make(0, 1536)
+		meta, err := s.Read(p)
+		require.NoError(t, err)
+		require.Equal(t, lo.Index, meta.Ifidx)
+		// loopback transport checksum is offloaded, only valid ip header
+		require.True(t, header.IPv4(p.Bytes()).IsChecksumValid())
+
+		udp := header.UDP(header.IPv4(p.Bytes()).Payload())
+		require.Equal(t, saddr.Port(), udp.DestinationPort())
+		require.Equal(t, "hello", string(udp.Payload()))
+
+		if meta.Outbound {
+			outbound = true
+		} else {
+			inbound = true
+		}
+	}
+}
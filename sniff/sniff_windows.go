@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+package sniff
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lysShub/divert-go"
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// Sniffer capture ip packets, not bind port and not affect the traffic
+type Sniffer struct {
+	raw *divert.Handle
+}
+
+// Open capture ip packets, see Config
+func Open(opts ...Option) (*Sniffer, error) {
+	cfg := Options(opts...)
+	filter := cfg.Filter
+	if filter == "" {
+		filter = "true"
+	}
+	if cfg.Interface != nil {
+		filter = fmt.Sprintf("(%s) and ifIdx == %d", filter, cfg.Interface.Index)
+	}
+	raw, err := divert.Open(filter, divert.Network, cfg.Priority, divert.Sniff|divert.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &Sniffer{raw: raw}, nil
+}
+
+func (s *Sniffer) Read(pkt *packet.Packet) (Meta, error) {
+	var addr divert.Address
+	n, err := s.raw.Recv(pkt.Bytes(), &addr)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
+			return Meta{}, errorx.ShortBuff(-1, pkt.Data())
+		}
+		return Meta{}, err
+	}
+	pkt.SetData(n)
+
+	return Meta{
+		Time:     time.Now(),
+		Outbound: addr.Flags.Outbound(),
+		Ifidx:    int(addr.Network().IfIdx),
+	}, nil
+}
+
+func (s *Sniffer) Close() error { return s.raw.Close() }
@@ -0,0 +1,212 @@
+// Package corpus replay recorded ip packets deterministically as tcp
+// Listener and RawConn, include malformed packets, for go-fuzz/oss-fuzz
+// style test of packet parsers and listener state machine. replay not start any
+// goroutine or timer, packets are dispatched in corpus order when Accept or
+// Read need more packet, so same corpus always get same result.
+package corpus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/pkg/errors"
+)
+
+// Corpus ip packets in order
+type Corpus [][]byte
+
+// Unmarshal decode corpus of records: 2 bytes big endian length and
+// packet, never fail, truncated last record is kept as malformed packet,
+// so any fuzz input is a valid corpus.
+func Unmarshal(b []byte) Corpus {
+	var c Corpus
+	for len(b) > 0 {
+		if len(b) < 2 {
+			c = append(c, slices.Clone(b))
+			break
+		}
+		n := min(int(binary.BigEndian.Uint16(b)), len(b)-2)
+		c = append(c, slices.Clone(b[2:2+n]))
+		b = b[2+n:]
+	}
+	return c
+}
+
+func (c Corpus) Marshal() []byte {
+	var b []byte
+	for _, e := range c {
+		n := min(len(e), 0xffff)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+		b = append(b, e[:n]...)
+	}
+	return b
+}
+
+// Recorder record ip packets read by RawConn as corpus
+type Recorder struct {
+	rawsock.RawConn
+
+	mu     sync.Mutex
+	corpus Corpus
+}
+
+var _ rawsock.RawConn = (*Recorder)(nil)
+
+func Record(conn rawsock.RawConn) *Recorder {
+	return &Recorder{RawConn: conn}
+}
+
+func (r *Recorder) Read(pkt *packet.Packet) error {
+	head := pkt.Head()
+	if err := r.RawConn.Read(pkt); err != nil {
+		return err
+	}
+
+	// recover ip header
+	hdr := pkt.Head() - head
+	pkt.SetHead(head)
+	ip := slices.Clone(pkt.Bytes())
+	pkt.SetHead(head + hdr)
+	r.mu.Lock()
+	r.corpus = append(r.corpus, ip)
+	r.mu.Unlock()
+	return nil
+}
+
+// Corpus recorded packets
+func (r *Recorder) Corpus() Corpus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.corpus)
+}
+
+// Conn replay every corpus packet by Read in order, without filter,
+// malformed ip packet return error, io.EOF after corpus exhausted. Write
+// and Inject packets are recorded.
+type Conn struct {
+	l             *Listener // nil if not accepted by Listener
+	id            itcp.ID
+	local, remote netip.AddrPort
+
+	mu      sync.Mutex // protect fields if not accepted by Listener
+	corpus  Corpus
+	next    int
+	queue   Corpus // dispatched packets of accepted conn
+	written Corpus
+	closed  bool
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func NewConn(c Corpus, laddr, raddr netip.AddrPort) *Conn {
+	return &Conn{local: laddr, remote: raddr, corpus: c}
+}
+
+func (c *Conn) lock() {
+	if c.l != nil {
+		c.l.mu.Lock()
+	} else {
+		c.mu.Lock()
+	}
+}
+
+func (c *Conn) unlock() {
+	if c.l != nil {
+		c.l.mu.Unlock()
+	} else {
+		c.mu.Unlock()
+	}
+}
+
+func (c *Conn) Read(pkt *packet.Packet) error {
+	c.lock()
+	ip, err := c.pop()
+	c.unlock()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := ipCheck(ip)
+	if err != nil {
+		return err
+	}
+	if pkt.Data() < len(ip) {
+		return errorx.ShortBuff(len(ip), pkt.Data())
+	}
+	pkt.SetData(0).Append(ip...)
+	pkt.SetHead(pkt.Head() + hdr)
+	return nil
+}
+
+func (c *Conn) pop() ([]byte, error) {
+	for {
+		if c.closed {
+			return nil, errors.WithStack(net.ErrClosed)
+		} else if len(c.queue) > 0 {
+			ip := c.queue[0]
+			c.queue = c.queue[1:]
+			return ip, nil
+		}
+
+		if c.l != nil {
+			if err := c.l.dispatch(); err != nil {
+				return nil, err
+			}
+		} else if c.next < len(c.corpus) {
+			c.queue = append(c.queue, c.corpus[c.next])
+			c.next++
+		} else {
+			return nil, io.EOF
+		}
+	}
+}
+
+func (c *Conn) Write(pkt *packet.Packet) error { return c.record(pkt) }
+
+func (c *Conn) Inject(pkt *packet.Packet) error { return c.record(pkt) }
+
+func (c *Conn) record(pkt *packet.Packet) error {
+	c.lock()
+	defer c.unlock()
+	if c.closed {
+		return errors.WithStack(net.ErrClosed)
+	}
+	c.written = append(c.written, slices.Clone(pkt.Bytes()))
+	return nil
+}
+
+// Written transport packets written by Write and Inject
+func (c *Conn) Written() Corpus {
+	c.lock()
+	defer c.unlock()
+	return slices.Clone(c.written)
+}
+
+func (c *Conn) LocalAddr() netip.AddrPort  { return c.local }
+func (c *Conn) RemoteAddr() netip.AddrPort { return c.remote }
+
+func (c *Conn) Close() error {
+	c.lock()
+	defer c.unlock()
+	if !c.closed {
+		c.closed = true
+		if c.l != nil {
+			c.l.deleteConn(c)
+		}
+	}
+	return nil
+}
+
+func ipCheck(ip []byte) (int, error) {
+	hdr, err := helper.IPCheck(ip)
+	return int(hdr), err
+}
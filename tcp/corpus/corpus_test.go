@@ -0,0 +1,178 @@
+package corpus_test
+
+import (
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/tcp/corpus"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+var (
+	saddr = netip.MustParseAddrPort("10.0.0.1:80")
+	caddr = netip.MustParseAddrPort("10.0.0.2:19986")
+)
+
+func build(t testing.TB, src, dst netip.AddrPort, flags header.TCPFlags, seq uint32, payload string) []byte {
+	var pkt = packet.Make(64, header.TCPMinimumSize)
+	header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+		SrcPort: src.Port(), DstPort: dst.Port(), SeqNum: seq,
+		DataOffset: header.TCPMinimumSize, Flags: flags, WindowSize: 1024,
+	})
+	pkt.Append([]byte(payload)...)
+
+	s, err := ipstack.New(src.Addr(), dst.Addr(), header.TCPProtocolNumber)
+	require.NoError(t, err)
+	s.AttachOutbound(pkt)
+	return pkt.Bytes()
+}
+
+func Test_Marshal(t *testing.T) {
+	var c = corpus.Corpus{{1, 2, 3}, {}, {4}}
+	require.Equal(t, c, corpus.Unmarshal(c.Marshal()))
+
+	// truncated record is kept
+	require.Equal(t, corpus.Corpus{{1}, {2, 3}}, corpus.Unmarshal([]byte{0, 1, 1, 0, 5, 2, 3}))
+	require.Equal(t, corpus.Corpus{{9}}, corpus.Unmarshal([]byte{9}))
+	require.Empty(t, corpus.Unmarshal(nil))
+}
+
+func Test_Conn(t *testing.T) {
+	var c = corpus.Corpus{
+		build(t, caddr, saddr, header.TCPFlagAck, 1, "hello"),
+		{0x45, 0},
+		build(t, caddr, saddr, header.TCPFlagAck, 6, "world"),
+	}
+	conn := corpus.NewConn(c, saddr, caddr)
+
+	var pkt = packet.Make(64, 1500)
+	require.NoError(t, conn.Read(pkt))
+	require.Equal(t, "hello", string(header.TCP(pkt.Bytes()).Payload()))
+	require.Error(t, conn.Read(pkt.Sets(64, 1500))) // malformed
+	require.NoError(t, conn.Read(pkt.Sets(64, 1500)))
+	require.Equal(t, "world", string(header.TCP(pkt.Bytes()).Payload()))
+	require.ErrorIs(t, conn.Read(pkt.Sets(64, 1500)), io.EOF)
+
+	require.NoError(t, conn.Write(packet.Make(0, 0, 4).Append(1, 2, 3, 4)))
+	require.Equal(t, corpus.Corpus{{1, 2, 3, 4}}, conn.Written())
+}
+
+func Test_Listener(t *testing.T) {
+	var (
+		caddr2 = netip.MustParseAddrPort("10.0.0.3:19986")
+		caddr3 = netip.MustParseAddrPort("10.0.0.4:19986")
+		other  = netip.MustParseAddrPort("10.0.0.1:81")
+	)
+	var c = corpus.Corpus{
+		build(t, caddr, saddr, header.TCPFlagSyn, 100, ""),
+		build(t, caddr2, saddr, header.TCPFlagAck, 1, ""), // non syn
+		{0x45, 0, 0}, // malformed
+		build(t, caddr, other, header.TCPFlagSyn, 1, ""),    // not to listener
+		build(t, caddr, saddr, header.TCPFlagAck, 101, "a"), // to conn
+		build(t, caddr3, saddr, header.TCPFlagSyn, 200, ""),
+		build(t, caddr, saddr, header.TCPFlagAck, 102, "b"),
+	}
+
+	var dups int
+	l := corpus.NewListener(c, saddr, rawsock.ReplaySYN(), rawsock.OnDuplicateSYN(func(_, _ netip.AddrPort) { dups++ }))
+	defer l.Close()
+
+	conn1, err := l.Accept()
+	require.NoError(t, err)
+	require.Equal(t, caddr, conn1.RemoteAddr())
+
+	// SYN replayed, then data in order, dispatch accept conn3 on the way
+	var pkt = packet.Make(64, 1500)
+	require.NoError(t, conn1.Read(pkt))
+	require.Equal(t, header.TCPFlagSyn, header.TCP(pkt.Bytes()).Flags())
+	require.NoError(t, conn1.Read(pkt.Sets(64, 1500)))
+	require.Equal(t, "a", string(header.TCP(pkt.Bytes()).Payload()))
+	require.NoError(t, conn1.Read(pkt.Sets(64, 1500)))
+	require.Equal(t, "b", string(header.TCP(pkt.Bytes()).Payload()))
+	require.ErrorIs(t, conn1.Read(pkt.Sets(64, 1500)), io.EOF)
+
+	conn3, err := l.Accept()
+	require.NoError(t, err)
+	require.Equal(t, caddr3, conn3.RemoteAddr())
+	_, err = l.Accept()
+	require.ErrorIs(t, err, io.EOF)
+
+	require.Equal(t, rawsock.ListenerStats{Short: 1, NonSyn: 1}, l.Stats())
+	require.Zero(t, dups)
+}
+
+func Test_Listener_Duplicate(t *testing.T) {
+	syn := build(t, caddr, saddr, header.TCPFlagSyn, 100, "")
+	var dups int
+	l := corpus.NewListener(corpus.Corpus{syn, syn}, saddr,
+		rawsock.OnDuplicateSYN(func(_, _ netip.AddrPort) { dups++ }),
+	)
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.NoError(t, conn.Close()) // closed conn's id kept, retransmit SYN is duplicate
+	_, err = l.Accept()
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 1, dups)
+	require.Equal(t, uint64(1), l.Stats().Duplicate)
+}
+
+func Test_Recorder(t *testing.T) {
+	client, server := test.NewMockRaw(t, header.TCPProtocolNumber, caddr, saddr)
+	r := corpus.Record(server)
+
+	var pkt = packet.Make(64, header.TCPMinimumSize)
+	header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+		SrcPort: caddr.Port(), DstPort: saddr.Port(),
+		DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagSyn,
+	})
+	require.NoError(t, client.Write(pkt))
+
+	var rpkt = packet.Make(64, 1500)
+	require.NoError(t, r.Read(rpkt))
+	require.Equal(t, header.TCPMinimumSize, rpkt.Data())
+
+	c := r.Corpus()
+	require.Len(t, c, 1)
+	test.ValidIP(t, c[0])
+
+	// replay recorded
+	l := corpus.NewListener(corpus.Unmarshal(c.Marshal()), saddr)
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.Equal(t, caddr, conn.RemoteAddr())
+}
+
+func FuzzListener(f *testing.F) {
+	f.Add(corpus.Corpus{
+		build(f, caddr, saddr, header.TCPFlagSyn, 100, ""),
+		build(f, caddr, saddr, header.TCPFlagAck, 101, "hello"),
+		{0x60, 0, 0, 0},
+	}.Marshal())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l := corpus.NewListener(corpus.Unmarshal(data), netip.AddrPortFrom(netip.IPv4Unspecified(), saddr.Port()),
+			rawsock.ReplaySYN(), rawsock.MaxConns(4),
+		)
+		defer l.Close()
+
+		var pkt = packet.Make(64, 0xffff)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				require.ErrorIs(t, err, io.EOF)
+				return
+			}
+			for conn.Read(pkt.Sets(64, 0xffff)) == nil {
+				require.GreaterOrEqual(t, pkt.Data(), header.TCPMinimumSize)
+			}
+			conn.Close()
+		}
+	})
+}
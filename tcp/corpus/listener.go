@@ -0,0 +1,151 @@
+package corpus
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/lysShub/rawsock"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Listener replay corpus as tcp listener, packets to listen port are
+// dispatched like real backend: packet of accepted remote address is
+// queued for the conn, SYN of new remote address is accepted, others are
+// counted in Stats. Accept return io.EOF after corpus exhausted.
+type Listener struct {
+	addr netip.AddrPort
+	cfg  *rawsock.Config
+
+	// protect all fields, and accepted conns
+	mu      sync.Mutex
+	corpus  Corpus
+	next    int
+	accepts []*Conn
+	conns   map[netip.AddrPort]*Conn // by remote address
+	table   *itcp.Table
+	stats   itcp.Stats
+	closed  bool
+}
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+
+// NewListener replay c as listener on laddr, unspecified address means
+// accept any destination address
+func NewListener(c Corpus, laddr netip.AddrPort, opts ...rawsock.Option) *Listener {
+	return &Listener{
+		addr:   laddr,
+		cfg:    rawsock.Options(opts...),
+		corpus: c,
+		conns:  map[netip.AddrPort]*Conn{},
+		table:  itcp.NewTable(),
+	}
+}
+
+func (l *Listener) Accept() (rawsock.RawConn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		if l.closed {
+			return nil, errors.WithStack(net.ErrClosed)
+		} else if len(l.accepts) > 0 {
+			c := l.accepts[0]
+			l.accepts = l.accepts[1:]
+			return c, nil
+		}
+		if err := l.dispatch(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// dispatch next corpus packet, return io.EOF if exhausted
+func (l *Listener) dispatch() error {
+	if l.next >= len(l.corpus) {
+		return io.EOF
+	}
+	ip := l.corpus[l.next]
+	l.next++
+
+	hdr, err := ipCheck(ip)
+	if err != nil || len(ip)-hdr < header.TCPMinimumSize {
+		l.stats.Short.Add(1)
+		return nil
+	}
+	var src, dst netip.Addr
+	if header.IPVersion(ip) == 4 {
+		iphdr := header.IPv4(ip)
+		src, dst = netip.AddrFrom4(iphdr.SourceAddress().As4()), netip.AddrFrom4(iphdr.DestinationAddress().As4())
+		if iphdr.TransportProtocol() != header.TCPProtocolNumber {
+			return nil
+		}
+	} else {
+		iphdr := header.IPv6(ip)
+		src, dst = netip.AddrFrom16(iphdr.SourceAddress().As16()), netip.AddrFrom16(iphdr.DestinationAddress().As16())
+		if iphdr.TransportProtocol() != header.TCPProtocolNumber {
+			return nil
+		}
+	}
+	tcp := header.TCP(ip[hdr:])
+	var (
+		laddr = netip.AddrPortFrom(dst, tcp.DestinationPort())
+		raddr = netip.AddrPortFrom(src, tcp.SourcePort())
+	)
+	if laddr.Port() != l.addr.Port() ||
+		(!l.addr.Addr().IsUnspecified() && laddr.Addr() != l.addr.Addr()) {
+		return nil // not to listener
+	}
+
+	if c, has := l.conns[raddr]; has {
+		c.queue = append(c.queue, ip)
+		return nil
+	} else if l.closed {
+		return nil
+	} else if !itcp.IsSyn(tcp) {
+		l.stats.NonSyn.Add(1)
+		return nil
+	}
+
+	var id = itcp.ID{Local: laddr, Remote: raddr, ISN: tcp.SequenceNumber()}
+	_, res := l.table.Add(id, l.cfg.MaxConns, false)
+	switch res {
+	case itcp.Duplicate:
+		l.stats.Duplicate.Add(1)
+		if l.cfg.OnDuplicateSYN != nil {
+			l.cfg.OnDuplicateSYN(id.Local, id.Remote)
+		}
+		return nil
+	case itcp.OverLimit:
+		l.stats.OverLimit.Add(1)
+		return nil
+	}
+
+	c := &Conn{l: l, id: id, local: laddr, remote: raddr}
+	if l.cfg.ReplaySYN {
+		c.queue = append(c.queue, ip)
+	}
+	l.conns[raddr] = c
+	l.accepts = append(l.accepts, c)
+	return nil
+}
+
+func (l *Listener) deleteConn(c *Conn) {
+	delete(l.conns, c.remote)
+	l.table.Close(c.id)
+}
+
+func (l *Listener) Addr() netip.AddrPort { return l.addr }
+
+func (l *Listener) Stats() rawsock.ListenerStats { return l.stats.Load() }
+
+// Close stop accept, accepted conns can read remain packets
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.accepts = nil
+	return nil
+}
@@ -5,21 +5,20 @@ import (
 	"fmt"
 	"net/netip"
 	"sync"
-	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/lysShub/divert-go"
-	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/errorx"
 	"github.com/lysShub/netkit/packet"
-	"github.com/lysShub/netkit/route"
 	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/helper"
 	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/idle"
 	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/lysShub/rawsock/internal/assert"
 	itcp "github.com/lysShub/rawsock/tcp/internal"
-	"github.com/lysShub/rawsock/test"
 	"golang.org/x/sys/windows"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -48,18 +47,18 @@ type Listener struct {
 
 	// priority int16
 
-	conns   map[itcp.ID]struct{}
-	connsMu sync.RWMutex
+	conns *itcp.Table
+	stats itcp.Stats
 
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.Listener = (*Listener)(nil)
+var _ rawsock.StatsListener = (*Listener)(nil)
 
 func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
 	var l = &Listener{
 		cfg:   rawsock.Options(opts...),
-		conns: make(map[itcp.ID]struct{}, 16),
+		conns: itcp.NewTable(),
 	}
 
 	// usaully should listen on all nic, but we juse listen on default nic
@@ -95,6 +94,23 @@ func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
 	return l, err
 }
 
+// Available WinDivert driver can be loaded and opened, cached after first
+// call, should call after divert.Load if use embed dll
+var Available = sync.OnceValue(func() (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false // dll not found
+		}
+	}()
+
+	h, err := divert.Open("false", divert.Network, 0, divert.Sniff|divert.ReadOnly)
+	if err != nil {
+		return false
+	}
+	h.Close()
+	return true
+})
+
 // set divert priority, for Listen will use p and p+1
 func Priority(p int16) rawsock.Option {
 	return func(c *rawsock.Config) {
@@ -128,45 +144,62 @@ func (l *Listener) Accept() (rawsock.RawConn, error) {
 		if err != nil {
 			return nil, l.close(err)
 		} else if n < min {
-			return nil, errors.Errorf("recved invalid ip packet, bytes %d", n)
+			l.stats.Short.Add(1)
+			continue
 		}
 
 		var id = itcp.ID{Local: l.addr}
+		var syn header.TCP
 		switch header.IPVersion(b) {
 		case 4:
 			iphdr := header.IPv4(b[:n])
 			tcphdr := header.TCP(iphdr.Payload())
 			id.Remote = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
+			id.ISN, syn = tcphdr.SequenceNumber(), tcphdr
+			if !itcp.IsSyn(tcphdr) {
+				l.stats.NonSyn.Add(1)
+				continue
+			}
 		case 6:
 			iphdr := header.IPv6(b[:n])
 			tcphdr := header.TCP(iphdr.Payload())
 			id.Remote = netip.AddrPortFrom(netip.AddrFrom16(iphdr.SourceAddress().As16()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
+			id.ISN, syn = tcphdr.SequenceNumber(), tcphdr
+			if !itcp.IsSyn(tcphdr) {
+				l.stats.NonSyn.Add(1)
+				continue
+			}
 		default:
 			return nil, fmt.Errorf("recv invalid ip packet: %s", hex.Dump(b[:n]))
 		}
 
-		l.connsMu.RLock()
-		_, has := l.conns[id]
-		l.connsMu.RUnlock()
-		if !has {
-			l.connsMu.Lock()
-			l.conns[id] = struct{}{}
-			l.connsMu.Unlock()
-
-			conn := newConnect(
-				id,
-				addr.Loopback(), int(addr.Network().IfIdx),
-				l.deleteConn,
-			)
-
-			if err := conn.init(l.cfg); err != nil {
-				return nil, conn.close(err)
+		replay, res := l.conns.Add(id, l.cfg.MaxConns, l.cfg.ReplaySYN)
+		switch res {
+		case itcp.Duplicate:
+			l.stats.Duplicate.Add(1)
+			replay.Push(syn)
+			if l.cfg.OnDuplicateSYN != nil {
+				l.cfg.OnDuplicateSYN(id.Local, id.Remote)
 			}
-			return conn, nil
-			// todo: inject P1
+			continue
+		case itcp.OverLimit:
+			l.stats.OverLimit.Add(1)
+			continue
 		}
+		replay.Push(syn)
+
+		conn := newConnect(
+			id,
+			addr.Loopback(), int(addr.Network().IfIdx),
+			l.deleteConn,
+		)
+		conn.replay = replay
+
+		if err := conn.init(l.cfg); err != nil {
+			return nil, conn.close(err)
+		}
+		return conn, nil
+		// todo: inject P1
 	}
 }
 
@@ -174,19 +207,17 @@ func (l *Listener) deleteConn(id itcp.ID) error {
 	if l == nil {
 		return nil
 	}
-	time.AfterFunc(time.Minute, func() {
-		l.connsMu.Lock()
-		defer l.connsMu.Unlock()
-
-		delete(l.conns, id)
-	})
+	l.conns.Close(id)
 	return nil
 }
 
+func (l *Listener) Stats() rawsock.ListenerStats { return l.stats.Load() }
+
 func (l *Listener) Close() error { return l.close(nil) }
 
 type Conn struct {
 	itcp.ID
+	replay   *itcp.Replay // replay handshake SYN, if ReplaySYN
 	loopback bool
 
 	tcp windows.Handle
@@ -197,7 +228,13 @@ type Conn struct {
 
 	ipstack *ipstack.IPStack
 
+	mtu      int
+	fragment bool
+	tso      bool
+
 	closeFn  itcp.CloseCallback
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
 	closeErr errorx.CloseErr
 }
 
@@ -213,6 +250,7 @@ var _ rawsock.RawConn = (*Conn)(nil)
 func (c *Conn) close(cause error) error {
 	return c.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
+		c.idle.Stop()
 
 		if c.raw != nil {
 			errs = append(errs, c.raw.Close())
@@ -230,11 +268,11 @@ func (c *Conn) close(cause error) error {
 func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
 	cfg := rawsock.Options(opts...)
 
-	table, err := route.GetTable()
+	table, err := rtnl.Table()
 	if err != nil {
 		return nil, err
 	}
-	entry := table.Match(raddr.Addr())
+	entry := rtnl.Match(table, raddr.Addr())
 	if !entry.Valid() {
 		err = errors.WithMessagef(
 			windows.ERROR_NETWORK_UNREACHABLE,
@@ -313,10 +351,27 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 		return err
 	}
 
+	if c.mtu = cfg.MTU; c.mtu == 0 {
+		if c.mtu, err = helper.InterfaceMTU(c.Local.Addr()); err != nil {
+			return err
+		}
+	}
+	c.fragment = cfg.Fragment && c.Local.Addr().Is4()
+	c.tso = cfg.TSO
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
 	return nil
 }
 
 func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	if ok, err := c.replay.Pop(pkt); ok {
+		return err
+	}
 	n, err := c.raw.Recv(pkt.Bytes(), nil)
 	if err != nil {
 		if errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
@@ -328,22 +383,39 @@ func (c *Conn) Read(pkt *packet.Packet) (err error) {
 	}
 
 	pkt.SetData(n)
+	c.idle.Touch()
 	hdr, err := helper.IPCheck(pkt.Bytes())
 	if err != nil {
 		return err
 	}
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 	pkt.SetHead(pkt.Head() + int(hdr))
 	return nil
 }
 
 func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	c.replay.Answer()
+	if c.tso {
+		mss := c.mtu - c.ipstack.Size() - int(header.TCP(pkt.Bytes()).DataOffset())
+		return itcp.Segment(pkt, mss, c.ipstack.Pseudo(), c.ipstack.PseudoChecksum(), c.write)
+	}
+	return c.write(pkt)
+}
+
+func (c *Conn) write(pkt *packet.Packet) (err error) {
 	defer pkt.DetachN(c.ipstack.Size())
 	c.ipstack.AttachOutbound(pkt)
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
+	c.valid.ValidIP(pkt.Bytes())
+
+	if n := pkt.Data(); n > c.mtu {
+		if !c.fragment {
+			return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu})
+		}
+		return ipstack.Fragment(pkt.Bytes(), c.mtu, func(frag header.IPv4) error {
+			_, err := c.raw.Send(frag, outboundAddr)
+			return err
+		})
 	}
 
 	_, err = c.raw.Send(pkt.Bytes(), outboundAddr)
@@ -353,9 +425,7 @@ func (c *Conn) Write(pkt *packet.Packet) (err error) {
 func (c *Conn) Inject(pkt *packet.Packet) (err error) {
 	defer pkt.DetachN(c.ipstack.Size())
 	c.ipstack.AttachInbound(pkt)
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 
 	_, err = c.raw.Send(pkt.Bytes(), c.injectAddr)
 	return err
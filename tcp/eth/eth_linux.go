@@ -4,27 +4,36 @@
 package eth
 
 import (
-	"fmt"
+	"math/rand"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/errorx"
 	"github.com/lysShub/netkit/eth"
 	"github.com/lysShub/netkit/packet"
 	"github.com/lysShub/netkit/route"
 	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/arpd"
 	"github.com/lysShub/rawsock/helper/bind"
 	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/cmsg"
+	"github.com/lysShub/rawsock/helper/idle"
 	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/lysShub/rawsock/internal/assert"
 	itcp "github.com/lysShub/rawsock/tcp/internal"
-	"github.com/lysShub/rawsock/test"
 	"github.com/mdlayher/arp"
 	"github.com/pkg/errors"
-	"github.com/stretchr/testify/require"
+	xbpf "golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -34,31 +43,58 @@ type Listener struct {
 	cfg  *rawsock.Config
 
 	tcp *net.TCPListener
+	rst *bind.RSTRule // replace tcp if SuppressRST
 
 	raw *net.IPConn
 
-	conns   map[itcp.ID]struct{}
-	connsMu sync.RWMutex
+	// capture by eth and answer ARP, if VirtualIP
+	eth *eth.ETHConn
+	arp *arpd.Responder
+
+	conns *itcp.Table
+	stats itcp.Stats
 
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.Listener = (*Listener)(nil)
+var _ rawsock.StatsListener = (*Listener)(nil)
+var _ rawsock.StateListener = (*Listener)(nil)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (l *Listener, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		l, err = listen(laddr, cfg)
+		return err
+	})
+	return l, err
+}
 
-func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+func listen(laddr netip.AddrPort, cfg *rawsock.Config) (*Listener, error) {
 	var l = &Listener{
-		cfg:   rawsock.Options(opts...),
-		conns: make(map[itcp.ID]struct{}, 16),
+		cfg:   cfg,
+		conns: itcp.NewTable(),
+	}
+
+	if l.cfg.VirtualIP {
+		return l, l.listenVirtual(laddr)
 	}
 
 	var err error
-	l.tcp, l.addr, err = bind.ListenTCPLocal(laddr, l.cfg.UsedPort)
+	if l.cfg.SuppressRST {
+		l.rst, l.addr, err = bind.DropRST(l.cfg.NetNS, laddr, netip.AddrPort{})
+	} else {
+		l.tcp, l.addr, err = bind.ListenTCPLocal(laddr, l.cfg.UsedPort)
+	}
 	if err != nil {
 		return nil, l.close(err)
 	}
 
+	network := "ip4:tcp"
+	if !l.addr.Addr().Is4() {
+		network = "ip6:tcp"
+	}
 	l.raw, err = net.ListenIP(
-		"ip:tcp",
+		network,
 		&net.IPAddr{IP: l.addr.Addr().AsSlice(), Zone: laddr.Addr().Zone()},
 	)
 	if err != nil {
@@ -70,25 +106,92 @@ func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
 		return nil, l.close(err)
 	}
 
-	if err = bpf.SetRawBPF(
-		raw,
-		bpf.FilterDstPortAndTCPSyn(l.addr.Port()),
-	); err != nil {
+	ins, err := bpf.WithFilter(l.cfg.Filter, bpf.WithShard(l.cfg.Shard, l.cfg.Shards, bpf.FilterDstPortAndTCPSyn(l.addr.Port())))
+	if err != nil {
+		return nil, l.close(err)
+	}
+	if err = bpf.SetRawBPF(raw, ins); err != nil {
 		return nil, l.close(err)
 	}
 
 	return l, nil
 }
 
+// listenVirtual capture handshake packet to virtual ip by eth, system tcp
+// stack not own the address, so needn't bind port
+func (l *Listener) listenVirtual(laddr netip.AddrPort) error {
+	// proxy ARP mode listen on all address of prefix
+	prefix, dst := l.cfg.ProxyARP, "dst net "+l.cfg.ProxyARP.String()
+	if !prefix.IsValid() {
+		prefix, dst = netip.PrefixFrom(laddr.Addr(), 32), "dst host "+laddr.Addr().String()
+	}
+	if !prefix.Addr().Is4() || laddr.Port() == 0 {
+		return l.close(errors.Errorf("invalid virtual address %s", laddr.String()))
+	}
+	l.addr = laddr
+
+	table, err := routeTable(l.cfg.VRF)
+	if err != nil {
+		return l.close(err)
+	}
+	entry := table.Match(prefix.Addr())
+	if !entry.Valid() {
+		return l.close(errors.WithStack(errors.WithMessage(unix.ENETUNREACH, prefix.Addr().String())))
+	}
+	ifi, err := net.InterfaceByIndex(int(entry.Interface))
+	if err != nil {
+		return l.close(errors.WithStack(err))
+	}
+
+	if l.eth, err = eth.Listen("eth:ip4", ifi); err != nil {
+		return l.close(err)
+	}
+	if err = bind.IgnoreOutgoing(l.eth.SyscallConn()); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return l.close(err)
+	}
+	ins, err := bpf.WithFilter(l.cfg.Filter, bpf.WithShard(l.cfg.Shard, l.cfg.Shards, bpf.FilterDstPortAndTCPSyn(l.addr.Port())))
+	if err != nil {
+		return l.close(err)
+	}
+	if ins, err = bpf.WithFilter(dst, ins); err != nil {
+		return l.close(err)
+	}
+	if err = bpf.SetLinkBPF(l.eth.SyscallConn(), bpf.WithInbound(bpf.WithFragment(false, netip.Addr{}, netip.Addr{}, ins))); err != nil {
+		return l.close(err)
+	}
+
+	if l.arp, err = arpd.New(ifi, prefix); err != nil {
+		return l.close(err)
+	}
+	return nil
+}
+
+func (l *Listener) read(ip []byte) (int, error) {
+	if l.eth != nil {
+		n, _, err := l.eth.ReadFromETH(ip)
+		return n, err
+	}
+	return l.raw.Read(ip)
+}
+
 func (l *Listener) close(cause error) error {
 	return l.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
 		if l.raw != nil {
 			errs = append(errs, l.raw.Close())
 		}
+		if l.eth != nil {
+			errs = append(errs, l.eth.Close())
+		}
+		if l.arp != nil {
+			errs = append(errs, l.arp.Close())
+		}
 		if l.tcp != nil {
 			errs = append(errs, errors.WithStack(l.tcp.Close()))
 		}
+		if l.rst != nil {
+			errs = append(errs, l.rst.Remove())
+		}
 		return
 	})
 }
@@ -103,88 +206,182 @@ func (l *Listener) Accept() (rawsock.RawConn, error) {
 
 	var ip = make([]byte, max)
 	for {
-		n, err := l.raw.Read(ip[:max])
+		n, err := l.read(ip[:max])
 		if err != nil {
 			return nil, l.close(err)
 		} else if n < min {
-			return nil, fmt.Errorf("recved invalid ip packet, bytes %d", n)
+			l.stats.Short.Add(1)
+			continue
 		}
 
-		var id = itcp.ID{Local: l.addr}
+		// listen on unspecified address accept packet to any local address,
+		// resolve conn's local address from destination address
+		var id itcp.ID
+		var syn header.TCP
 		switch header.IPVersion(ip) {
 		case 4:
 			iphdr := header.IPv4(ip[:n])
 			tcphdr := header.TCP(iphdr.Payload())
+			id.Local = netip.AddrPortFrom(netip.AddrFrom4(iphdr.DestinationAddress().As4()), l.addr.Port())
 			id.Remote = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
+			id.ISN, syn = tcphdr.SequenceNumber(), tcphdr
+			if !itcp.IsSyn(tcphdr) {
+				l.stats.NonSyn.Add(1)
+				continue
+			}
 		case 6:
 			iphdr := header.IPv6(ip[:n])
 			tcphdr := header.TCP(iphdr.Payload())
-			id.Remote = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
+			id.Local = netip.AddrPortFrom(netip.AddrFrom16(iphdr.DestinationAddress().As16()), l.addr.Port())
+			id.Remote = netip.AddrPortFrom(netip.AddrFrom16(iphdr.SourceAddress().As16()), tcphdr.SourcePort())
+			id.ISN, syn = tcphdr.SequenceNumber(), tcphdr
+			if !itcp.IsSyn(tcphdr) {
+				l.stats.NonSyn.Add(1)
+				continue
+			}
 		default:
 			continue
 		}
 
-		l.connsMu.RLock()
-		_, has := l.conns[id]
-		l.connsMu.RUnlock()
+		replay, res := l.conns.Add(id, l.cfg.MaxConns, l.cfg.ReplaySYN)
+		switch res {
+		case itcp.Duplicate:
+			l.stats.Duplicate.Add(1)
+			replay.Push(syn)
+			if l.cfg.OnDuplicateSYN != nil {
+				l.cfg.OnDuplicateSYN(id.Local, id.Remote)
+			}
+			continue
+		case itcp.OverLimit:
+			l.stats.OverLimit.Add(1)
+			continue
+		}
+		replay.Push(syn)
+
+		c := newConnect(id, l.deleteConn)
+		c.replay = replay
+		if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+			return nil, errorx.WrapTemp(c.close(err))
+		}
+		return c, nil
+	}
+}
 
-		if !has {
-			l.connsMu.Lock()
-			l.conns[id] = struct{}{}
-			l.connsMu.Unlock()
+func (l *Listener) Export() rawsock.ListenerState {
+	return rawsock.ListenerState{Addr: l.addr, Conns: l.conns.Export()}
+}
 
-			c := newConnect(id, l.deleteConn)
-			if err := c.init(l.cfg); err != nil {
-				return nil, errorx.WrapTemp(c.close(err))
+// Import import conn table exported by old process's Listener with same
+// address, the not closed conns is re-created
+func (l *Listener) Import(s rawsock.ListenerState) ([]rawsock.RawConn, error) {
+	if s.Addr.Port() != l.addr.Port() {
+		return nil, errors.Errorf("import %s state to listener %s", s.Addr.String(), l.addr.String())
+	}
+
+	var (
+		ids   = l.conns.Import(s.Conns)
+		conns = make([]rawsock.RawConn, 0, len(ids))
+	)
+	for i, id := range ids {
+		c := newConnect(id, l.deleteConn)
+		if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+			err = c.close(err)
+			for _, c := range conns {
+				c.Close()
 			}
-			return c, nil
+			for _, id := range ids[i+1:] {
+				l.conns.Close(id)
+			}
+			return nil, err
 		}
+		conns = append(conns, c)
 	}
+	return conns, nil
 }
 
 func (l *Listener) deleteConn(id itcp.ID) error {
 	if l == nil {
 		return nil
 	}
-	time.AfterFunc(time.Minute, func() {
-		l.connsMu.Lock()
-		defer l.connsMu.Unlock()
-
-		delete(l.conns, id)
-	})
+	l.conns.Close(id)
 	return nil
 }
 
+func (l *Listener) Stats() rawsock.ListenerStats { return l.stats.Load() }
+
 func (l *Listener) Close() error {
 	return l.close(nil)
 }
 
 type Conn struct {
 	itcp.ID
+	replay *itcp.Replay // replay handshake SYN, if ReplaySYN
 
 	// todo: set buff 0
 	tcp *net.TCPListener
-
-	raw     *eth.ETHConn
-	ipstack *ipstack.IPStack
-	gateway net.HardwareAddr
+	rst *bind.RSTRule // replace tcp if SuppressRST
+
+	raw        *eth.ETHConn
+	arp        *arpd.Responder // answer ARP for local address, if VirtualIP
+	ipstack    *ipstack.IPStack
+	gateway    atomic.Pointer[net.HardwareAddr]
+	unwatch    func() // stop refresh gateway when route changed
+	unwatchMTU func() // stop watch interface mtu, nil if MTU specified
+	filter     string
+	remote     atomic.Pointer[netip.AddrPort] // current remote address, maybe roamed
+
+	mtu      *ipstack.PMTU
+	bufs     *bufpool.Pool  // read buffers
+	ptb      net.PacketConn // recv ICMPv6 packet too big
+	fragment bool
+	tso      bool
+	split    *itcp.Split                   // split GRO super-packet, if SplitGRO
+	frame    atomic.Pointer[rawsock.Frame] // link layer header of split super-packet
+	defrag   *ipstack.Defrag               // reassemble inbound fragments, nil is disable
 
 	ctxPeriod time.Duration
 	closeFn   itcp.CloseCallback
 
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.RawConn = (*Conn)(nil)
+var _ rawsock.MetaConn = (*Conn)(nil)
+var _ rawsock.FrameConn = (*Conn)(nil)
+var _ rawsock.RoamConn = (*Conn)(nil)
+var _ rawsock.BufferConn = (*Conn)(nil)
+var _ syscall.Conn = (*Conn)(nil)
 
-func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (c *Conn, err error) {
 	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		c, err = connect(laddr, raddr, cfg)
+		return err
+	})
+	return c, err
+}
+
+func connect(laddr, raddr netip.AddrPort, cfg *rawsock.Config) (*Conn, error) {
+	if l, r, err := helper.ZoneAddrs(laddr.Addr(), raddr.Addr()); err != nil {
+		return nil, err
+	} else {
+		laddr, raddr = netip.AddrPortFrom(l, laddr.Port()), netip.AddrPortFrom(r, raddr.Port())
+	}
 	var c = newConnect(itcp.ID{Local: laddr, Remote: raddr, ISN: 0}, nil)
 
 	var err error
-	c.tcp, c.Local, err = bind.ListenTCPLocal(laddr, cfg.UsedPort)
+	if cfg.VirtualIP {
+		// system tcp stack not own the address, needn't reserve port
+		if laddr.Port() == 0 {
+			laddr = netip.AddrPortFrom(laddr.Addr(), uint16(49152+rand.Intn(16384)))
+		}
+		c.Local = laddr
+	} else if cfg.SuppressRST {
+		c.rst, c.Local, err = bind.DropRST(cfg.NetNS, laddr, raddr)
+	} else {
+		c.tcp, c.Local, err = bind.ListenTCPLocal(laddr, cfg.UsedPort)
+	}
 	if err != nil {
 		return nil, c.close(err)
 	}
@@ -203,12 +400,14 @@ func newConnect(id itcp.ID, closeCall itcp.CloseCallback) *Conn {
 }
 
 func (c *Conn) init(cfg *rawsock.Config) (err error) {
-	table, err := route.GetTable()
+	c.remote.Store(&c.ID.Remote)
+	c.filter = cfg.Filter
+	table, err := routeTable(cfg.VRF)
 	if err != nil {
 		return err
 	}
 
-	entry := table.Match(c.Remote.Addr())
+	entry := rtnl.Match(table, c.Remote.Addr())
 	if !entry.Valid() {
 		err = errors.WithMessagef(
 			unix.EADDRNOTAVAIL, c.Remote.Addr().String(),
@@ -232,47 +431,94 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 		// }
 		// c.gateway = net.HardwareAddr(make([]byte, 6))
 	} else {
-		if debug.Debug() {
-			require.Equal(test.T(), c.Local.Addr(), entry.Addr)
+		if !cfg.VirtualIP {
+			assert.Equal(c.Local.Addr().WithZone(""), entry.Addr, "route source address")
 		}
-		ifi, err = net.InterfaceByIndex(int(entry.Interface))
-		if err != nil {
-			return errors.WithStack(err)
+		var gateway net.HardwareAddr
+		if ifi, gateway, err = resolveGateway(entry); err != nil {
+			return err
 		}
-
-		// get gatway hardware address
-		if client, err := arp.Dial(c.raw.Interface()); err != nil {
-			return errors.WithStack(err)
-		} else {
-			defer client.Close()
-			if err = client.SetDeadline(time.Now().Add(time.Second * 3)); err != nil {
-				return errors.WithStack(err)
-			}
-
-			c.gateway, err = client.Resolve(entry.Next)
-			if err != nil {
-				return errors.WithStack(err)
-			}
+		c.gateway.Store(&gateway)
+		if !netns.Switched() {
+			// global route cache watch the process's netns
+			c.watchGateway(cfg.VRF, entry)
 		}
 	}
 
-	if cfg.SetGRO {
+	if cfg.SetGRO && !cfg.VirtualIP {
 		if err := bind.SetGRO(c.Local.Addr(), c.Remote.Addr(), false); err != nil {
 			return err
 		}
 	}
 
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = ifi.MTU
+	}
+	c.mtu = ipstack.NewPMTU(mtu, cfg.PMTUNotify)
+	if cfg.MTU == 0 {
+		// best effort, buffers sized at init, so only interface mtu shrink take effect
+		c.unwatchMTU, _ = helper.WatchMTU(ifi.Name, func(mtu int) { c.mtu.Update(mtu) })
+	}
+	c.bufs = bufpool.New(64, mtu, cfg.ReadBuffers)
+	if c.Local.Addr().Is6() {
+		if c.ptb, err = ipstack.WatchPTB(c.Local.Addr(), c.handlePTB); err != nil {
+			return err
+		}
+	}
+	c.fragment = cfg.Fragment && c.Local.Addr().Is4()
+	c.tso = cfg.TSO
+	if cfg.SplitGRO {
+		c.split = itcp.NewSplit()
+	}
+	if cfg.Defrag && c.Local.Addr().Is4() {
+		c.defrag = ipstack.NewDefrag(time.Second*30, 64)
+	}
+
 	// create eth conn and set bpf filter
 	c.raw, err = eth.Listen("eth:ip4", ifi)
 	if err != nil {
 		return err
 	}
-	if err := bpf.SetRawBPF(
-		c.raw.SyscallConn(),
-		bpf.FilterEndpoint(header.TCPProtocolNumber, c.Remote, c.Local),
-	); err != nil {
+	if err = bind.IgnoreOutgoing(c.raw.SyscallConn()); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return err
+	}
+	ins, err := c.linkFilter(c.Remote)
+	if err != nil {
+		return err
+	}
+	if err := bpf.SetLinkBPF(c.raw.SyscallConn(), ins); err != nil {
+		return err
+	}
+	// accepted conn's address is answered by listener
+	if cfg.VirtualIP && c.closeFn == nil {
+		if c.arp, err = arpd.New(ifi, netip.PrefixFrom(c.Local.Addr(), 32)); err != nil {
+			return err
+		}
+	}
+	if err = cmsg.SetAuxData(c.raw.SyscallConn()); err != nil {
 		return err
 	}
+	if cfg.Priority > 0 {
+		if err = bind.SetPriority(c.raw.SyscallConn(), cfg.Priority); err != nil {
+			return err
+		}
+		if cfg.PCP {
+			if err = bind.SetEgressQoS(ifi.Name, cfg.Priority, cfg.Priority); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Timestamp {
+		if err = cmsg.SetTimestamp(c.raw.SyscallConn(), cfg.HardwareTimestamp); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPoll > 0 {
+		if err = bind.SetBusyPoll(c.raw.SyscallConn(), cfg.BusyPoll, cfg.BusyPollBudget); err != nil {
+			return err
+		}
+	}
 
 	if c.ipstack, err = ipstack.New(
 		c.Local.Addr(), c.Remote.Addr(),
@@ -280,18 +526,95 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	); err != nil {
 		return err
 	}
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
 	return nil
 }
 
+// resolveGateway get gateway hardware address of route entry
+func resolveGateway(entry route.Entry) (*net.Interface, net.HardwareAddr, error) {
+	ifi, err := net.InterfaceByIndex(int(entry.Interface))
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	client, err := arp.Dial(ifi)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer client.Close()
+	if err = client.SetDeadline(time.Now().Add(time.Second * 3)); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	gateway, err := client.Resolve(entry.Next)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return ifi, gateway, nil
+}
+
+// watchGateway re-resolve gateway when route/address/link changed, the
+// gateway resolved at init maybe stale after network changes
+func (c *Conn) watchGateway(vrfName string, entry route.Entry) {
+	cache, err := rtnl.Default()
+	if err != nil {
+		return // not support subscribe, keep gateway resolved at init
+	}
+
+	var mu sync.Mutex
+	c.unwatch = cache.Subscribe(func(route.Table) {
+		// arp resolve maybe slow, not block other subscribers
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			table, err := routeTable(vrfName)
+			if err != nil {
+				return
+			}
+			e := rtnl.Match(table, c.RemoteAddr().Addr())
+			if !e.Valid() || !e.Next.IsValid() ||
+				(e.Next == entry.Next && e.Interface == entry.Interface) {
+				return
+			}
+			if _, gateway, err := resolveGateway(e); err == nil {
+				entry = e
+				c.gateway.Store(&gateway)
+			}
+		}()
+	})
+}
+
 func (c *Conn) close(cause error) error {
 	return c.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
+		c.idle.Stop()
+		if c.unwatch != nil {
+			c.unwatch()
+		}
+		if c.unwatchMTU != nil {
+			c.unwatchMTU()
+		}
 		if c.raw != nil {
 			errs = append(errs, c.raw.Close())
 		}
+		if c.arp != nil {
+			errs = append(errs, c.arp.Close())
+		}
+		if c.ptb != nil {
+			errs = append(errs, errors.WithStack(c.ptb.Close()))
+		}
 		if c.tcp != nil {
 			errs = append(errs, errors.WithStack(c.tcp.Close()))
 		}
+		if c.rst != nil {
+			errs = append(errs, c.rst.Remove())
+		}
 		if c.closeFn != nil {
 			errs = append(errs, c.closeFn(c.ID))
 		}
@@ -299,32 +622,211 @@ func (c *Conn) close(cause error) error {
 	})
 }
 
+func (c *Conn) handlePTB(ptb ipstack.PTB) {
+	if ptb.Proto == header.TCPProtocolNumber && ptb.Src == c.Local && ptb.Dst == *c.remote.Load() {
+		c.mtu.Update(ptb.MTU)
+	}
+}
+
 func (c *Conn) Read(pkt *packet.Packet) (err error) {
-	n, _, err := c.raw.ReadFromETH(pkt.Bytes())
-	if err != nil {
-		return err
+	_, err = c.ReadFrame(pkt)
+	return err
+}
+
+func (c *Conn) ReadFrame(pkt *packet.Packet) (frame rawsock.Frame, err error) {
+	if ok, err := c.replay.Pop(pkt); ok {
+		return frame, err
+	} else if ok, err := c.split.Pop(pkt); ok {
+		if f := c.frame.Load(); f != nil {
+			frame = *f
+		}
+		return frame, err
+	}
+	if err = c.readIP(pkt, &frame, nil); err != nil {
+		return frame, err
+	}
+	if c.split != nil {
+		c.frame.Store(&frame)
+	}
+	return frame, c.splitGRO(pkt)
+}
+
+// readIP read tcp packet, reassemble fragments if Defrag, frame and meta
+// are filled if not nil
+func (c *Conn) readIP(pkt *packet.Packet, frame *rawsock.Frame, meta *rawsock.Meta) error {
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		n, err := c.recvFrame(pkt.Sets(head, data).Bytes(), frame, meta)
+		if err != nil {
+			return err
+		}
+		pkt.SetData(n)
+		c.idle.Touch()
+		if c.defrag == nil || !ipstack.IsFragment(pkt.Bytes()) {
+			break
+		}
+
+		ip, ok := c.defrag.Push(pkt.Bytes())
+		if !ok {
+			continue
+		} else if len(ip) > data {
+			return errorx.ShortBuff(len(ip), data)
+		}
+		pkt.SetData(0).Append(ip...)
+		if c.matchEndpoint(ip) {
+			break
+		}
 	}
-	pkt.SetData(n)
 
 	hdr, err := helper.IPCheck(pkt.Bytes())
 	if err != nil {
 		return err
 	}
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 	pkt.SetHead(pkt.Head() + int(hdr))
 	return nil
 }
 
+// recvFrame recv ip packet, and link layer header from sockaddr_ll and
+// PACKET_AUXDATA, cooked socket not keep the ethernet header. frame and
+// meta are filled if not nil
+func (c *Conn) recvFrame(ip []byte, frame *rawsock.Frame, meta *rawsock.Meta) (n int, err error) {
+	var (
+		oob   [cmsg.Size]byte
+		oobn  int
+		from  unix.Sockaddr
+		operr error
+	)
+	if err = c.raw.SyscallConn().Read(func(fd uintptr) (done bool) {
+		n, oobn, _, from, operr = unix.Recvmsg(int(fd), ip, oob[:], 0)
+		return operr != unix.EAGAIN
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	} else if operr != nil {
+		return 0, errors.WithStack(operr)
+	}
+
+	if n, err = trimFrame(ip, n); err != nil {
+		return 0, err
+	}
+
+	if meta != nil {
+		*meta = rawsock.Meta{}
+		if err = cmsg.Parse(oob[:oobn], meta); err != nil {
+			return 0, err
+		}
+	}
+	if frame == nil {
+		return n, nil
+	}
+	*frame = rawsock.Frame{}
+	if ll, ok := from.(*unix.SockaddrLinklayer); ok {
+		frame.Src = slices.Clone(ll.Addr[:ll.Halen])
+		frame.EtherType = eth.Htons(ll.Protocol)
+		frame.Dst = frameDst(ll.Pkttype, c.raw.Interface().HardwareAddr, ip)
+	}
+	return n, cmsg.ParseFrame(oob[:oobn], frame)
+}
+
+// trimFrame get ip packet length of recved n bytes, ethernet frame maybe
+// padded, trim by ip header
+func trimFrame(b []byte, n int) (int, error) {
+	var size int
+	switch header.IPVersion(b[:n]) {
+	case 4:
+		if n >= header.IPv4MinimumSize {
+			size = int(header.IPv4(b).TotalLength())
+		}
+	case 6:
+		if n >= header.IPv6MinimumSize {
+			size = int(header.IPv6(b).PayloadLength()) + header.IPv6MinimumSize
+		}
+	}
+	if size == 0 {
+		return 0, errors.Errorf("recved invalid ip packet: %#v", b[:min(20, n)])
+	} else if size > n {
+		if n == len(b) {
+			return 0, errorx.ShortBuff(size, len(b))
+		}
+		return 0, errors.Errorf("recved truncated ip packet, length %d, recved %d", size, n)
+	}
+	return min(n, size), nil
+}
+
+// frameDst destination hardware address of frame, multicast address is
+// mapped from destination ip
+func frameDst(pkttype uint8, local net.HardwareAddr, ip []byte) net.HardwareAddr {
+	switch pkttype {
+	case unix.PACKET_HOST:
+		return local
+	case unix.PACKET_BROADCAST:
+		return net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	case unix.PACKET_MULTICAST:
+		if header.IPVersion(ip) == 4 {
+			dst := header.IPv4(ip).DestinationAddress().As4()
+			return net.HardwareAddr{0x01, 0x00, 0x5e, dst[1] & 0x7f, dst[2], dst[3]}
+		}
+		dst := header.IPv6(ip).DestinationAddress().As16()
+		return net.HardwareAddr{0x33, 0x33, dst[12], dst[13], dst[14], dst[15]}
+	default:
+		return nil
+	}
+}
+
+// matchEndpoint check reassembled packet, fragments bypass bpf port filter
+func (c *Conn) matchEndpoint(ip header.IPv4) bool {
+	if ip.Protocol() != uint8(header.TCPProtocolNumber) ||
+		len(ip.Payload()) < header.TCPMinimumSize {
+		return false
+	}
+	var (
+		tcp    = header.TCP(ip.Payload())
+		remote = c.RemoteAddr()
+	)
+	return tcp.SourcePort() == remote.Port() && tcp.DestinationPort() == c.Local.Port() &&
+		ip.SourceAddress().As4() == remote.Addr().As4() &&
+		ip.DestinationAddress().As4() == c.Local.Addr().As4()
+}
+
+func (c *Conn) ReadMeta(pkt *packet.Packet) (meta rawsock.Meta, err error) {
+	if ok, err := c.replay.Pop(pkt); ok {
+		return meta, err
+	} else if ok, err := c.split.Pop(pkt); ok {
+		return meta, err
+	}
+	// same as Read, fragments let through by bpf need reassemble and re-check
+	if err = c.readIP(pkt, nil, &meta); err != nil {
+		return meta, err
+	}
+	return meta, c.splitGRO(pkt)
+}
+
 func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	c.replay.Answer()
+	if c.tso {
+		mss := c.mtu.Load() - c.ipstack.Size() - int(header.TCP(pkt.Bytes()).DataOffset())
+		return itcp.Segment(pkt, mss, c.ipstack.Pseudo(), c.ipstack.PseudoChecksum(), c.write)
+	}
+	return c.write(pkt)
+}
+
+func (c *Conn) write(pkt *packet.Packet) (err error) {
 	defer pkt.DetachN(c.ipstack.Size())
 	c.ipstack.AttachOutbound(pkt)
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
+	c.valid.ValidIP(pkt.Bytes())
+
+	if n := pkt.Data(); n > c.mtu.Load() {
+		if !c.fragment {
+			return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+		}
+		return ipstack.Fragment(pkt.Bytes(), c.mtu.Load(), func(frag header.IPv4) error {
+			_, err := c.raw.WriteToETH(frag, *c.gateway.Load())
+			return err
+		})
 	}
 
-	_, err = c.raw.WriteToETH(pkt.Bytes(), c.gateway)
+	_, err = c.raw.WriteToETH(pkt.Bytes(), *c.gateway.Load())
 	return err
 }
 
@@ -333,7 +835,7 @@ func (c *Conn) Inject(p *packet.Packet) (err error) {
 
 	// c.ipstack.AttachInbound(p)
 	// if debug.Debug() {
-	// 	test.ValidIP(test.P(), p.Data())
+	// 	c.valid.ValidIP(p.Data())
 	// }
 	// // p.Attach(c.outEthdr[:])
 	// _, err = c.raw.Write(p.Data())
@@ -341,6 +843,73 @@ func (c *Conn) Inject(p *packet.Packet) (err error) {
 }
 func (c *Conn) Raw() *eth.ETHConn { return c.raw }
 
+// SetRemote update remote address, the new remote address should be routed
+// by same gateway
+func (c *Conn) SetRemote(raddr netip.AddrPort) error {
+	if raddr.Addr().Is4() != c.Local.Addr().Is4() {
+		return errors.Errorf("address family not match %s and %s", c.Local.Addr(), raddr.Addr())
+	}
+
+	// prepare filter firstly, commit new remote only if every step succeed
+	old := *c.remote.Load()
+	ins, err := c.linkFilter(raddr)
+	if err != nil {
+		return err
+	}
+	oldIns, err := c.linkFilter(old)
+	if err != nil {
+		return err
+	}
+
+	if err = bpf.SetLinkBPF(c.raw.SyscallConn(), ins); err != nil {
+		bpf.SetLinkBPF(c.raw.SyscallConn(), oldIns)
+		return err
+	}
+	if err := c.ipstack.SetRemote(raddr.Addr()); err != nil {
+		bpf.SetLinkBPF(c.raw.SyscallConn(), oldIns)
+		return errors.WithStack(err)
+	}
+	c.remote.Store(&raddr)
+	return nil
+}
+
+// linkFilter bpf filter of tcp packets from raddr to local
+func (c *Conn) linkFilter(raddr netip.AddrPort) ([]xbpf.Instruction, error) {
+	ins, err := bpf.WithFilter(c.filter, bpf.FilterEndpoint(header.TCPProtocolNumber, raddr, c.Local))
+	if err != nil {
+		return nil, err
+	}
+	return bpf.WithInbound(bpf.WithFragment(c.defrag != nil, raddr.Addr(), c.Local.Addr(), ins)), nil
+}
+
+// SyscallConn return underlying socket, used to set socket options
+func (c *Conn) SyscallConn() (syscall.RawConn, error) { return c.raw.SyscallConn(), nil }
+
 func (c *Conn) LocalAddr() netip.AddrPort  { return c.Local }
-func (c *Conn) RemoteAddr() netip.AddrPort { return c.Remote }
+func (c *Conn) RemoteAddr() netip.AddrPort { return *c.remote.Load() }
 func (c *Conn) Close() (err error)         { return c.close(nil) }
+
+// MTU current egress path mtu
+func (c *Conn) MTU() int { return c.mtu.Load() }
+
+// Packet get a read buffer sized to mtu detected at init
+func (c *Conn) Packet() *packet.Packet { return c.bufs.Get() }
+
+func (c *Conn) Release(pkt *packet.Packet) { c.bufs.Put(pkt) }
+
+// routeTable route table of vrf device, or all tables if not specified
+func routeTable(vrfName string) (route.Table, error) {
+	if vrfName != "" {
+		return vrf.Table(vrfName)
+	}
+	return rtnl.Table()
+}
+
+// splitGRO split super-packet to segments sized to path mtu, if SplitGRO
+func (c *Conn) splitGRO(pkt *packet.Packet) error {
+	if c.split == nil || pkt.Data() < header.TCPMinimumSize {
+		return nil
+	}
+	mss := c.mtu.Load() - c.ipstack.Size() - int(header.TCP(pkt.Bytes()).DataOffset())
+	return c.split.Split(pkt, mss, c.ipstack.PseudoChecksum())
+}
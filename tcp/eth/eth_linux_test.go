@@ -171,3 +171,35 @@ func Test_Conn(t *testing.T) {
 
 	fmt.Println(gs.Wait())
 }
+
+func Test_TrimFrame(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	ip := test.RandTCP(t, src, dst)
+
+	t.Run("padded", func(t *testing.T) {
+		b := append(append([]byte{}, ip...), make([]byte, 16)...)
+		n, err := trimFrame(b, len(b))
+		require.NoError(t, err)
+		require.Equal(t, len(ip), n)
+	})
+
+	t.Run("short", func(t *testing.T) {
+		b := make([]byte, 64)
+		copy(b, ip)
+		_, err := trimFrame(b, 3)
+		require.Error(t, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		b := make([]byte, 1500)
+		copy(b, ip)
+		_, err := trimFrame(b, len(ip)-1)
+		require.Error(t, err)
+
+		_, err = trimFrame(b[:len(ip)-1], len(ip)-1)
+		require.ErrorIs(t, err, io.ErrShortBuffer)
+	})
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package eth
+
+import (
+	"net/netip"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/tcp/divert"
+)
+
+// windows not support AF_PACKET, eth Listener/Conn is implemented by divert
+// backend, that capture at network layer. Linux only methods (Raw, ReadMeta,
+// SetRemote, SyscallConn) are not available.
+
+type Listener = divert.Listener
+
+type Conn = divert.Conn
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+	return divert.Listen(laddr, opts...)
+}
+
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+	return divert.Connect(laddr, raddr, opts...)
+}
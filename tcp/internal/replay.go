@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"slices"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+)
+
+// Replay replay handshake SYN received by Listener to accepted conn's Read,
+// until the conn answered (first Write), methods are no-op if nil
+type Replay struct {
+	syn      chan []byte
+	answered atomic.Bool
+}
+
+func NewReplay() *Replay {
+	return &Replay{syn: make(chan []byte, 1)}
+}
+
+// Push push SYN tcp packet, only keep one pending SYN, return false
+// if the conn answered
+func (r *Replay) Push(tcp []byte) bool {
+	if r == nil || r.answered.Load() {
+		return false
+	}
+	select {
+	case r.syn <- slices.Clone(tcp):
+	default:
+	}
+	return true
+}
+
+// Pop read pending SYN into pkt, return false if not exist
+func (r *Replay) Pop(pkt *packet.Packet) (bool, error) {
+	if r == nil {
+		return false, nil
+	}
+	select {
+	case tcp := <-r.syn:
+		if len(tcp) > pkt.Data() {
+			select {
+			case r.syn <- tcp: // keep for next read
+			default:
+			}
+			return true, errorx.ShortBuff(len(tcp), pkt.Data())
+		}
+		pkt.SetData(0).Append(tcp...)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Answer mark the conn answered, stop replay
+func (r *Replay) Answer() {
+	if r != nil && !r.answered.Load() {
+		r.answered.Store(true)
+	}
+}
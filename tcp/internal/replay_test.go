@@ -0,0 +1,57 @@
+package tcp_test
+
+import (
+	"testing"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Replay(t *testing.T) {
+	var syn = make(header.TCP, header.TCPMinimumSize)
+	syn.Encode(&header.TCPFields{
+		SrcPort: 19986, DstPort: 80, SeqNum: 1234,
+		DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagSyn,
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var r *itcp.Replay
+		require.False(t, r.Push(syn))
+		ok, err := r.Pop(packet.Make(0, 1500))
+		require.False(t, ok)
+		require.NoError(t, err)
+		r.Answer()
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		r := itcp.NewReplay()
+		require.True(t, r.Push(syn))
+		require.True(t, r.Push(syn)) // only keep one
+
+		// short buffer keep the SYN
+		ok, err := r.Pop(packet.Make(0, 4))
+		require.True(t, ok)
+		require.True(t, errorx.Temporary(err))
+
+		var pkt = packet.Make(64, 1500)
+		ok, err = r.Pop(pkt)
+		require.True(t, ok)
+		require.NoError(t, err)
+		require.Equal(t, []byte(syn), pkt.Bytes())
+
+		ok, err = r.Pop(pkt)
+		require.False(t, ok)
+		require.NoError(t, err)
+	})
+
+	t.Run("answered", func(t *testing.T) {
+		r := itcp.NewReplay()
+		r.Answer()
+		require.False(t, r.Push(syn))
+		ok, _ := r.Pop(packet.Make(0, 1500))
+		require.False(t, ok)
+	})
+}
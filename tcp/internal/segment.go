@@ -0,0 +1,80 @@
+package tcp
+
+import (
+	"sync"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// segs reused segment buffers, avoid alloc for every super packet
+var segs = sync.Pool{New: func() any { return packet.Make(0, 0, 0) }}
+
+// Segment split tcp packet to segments that payload not exceed mss, fn be called
+// with every segment, the seg only valid during the call. if pseudo, segment
+// checksum include pseudo header checksum psum (without length), otherwise is
+// without-pseudo-checksum and psum is ignored.
+func Segment(pkt *packet.Packet, mss int, pseudo bool, psum uint16, fn func(seg *packet.Packet) error) error {
+	var (
+		tcp     = header.TCP(pkt.Bytes())
+		hdrLen  = int(tcp.DataOffset())
+		payload = tcp.Payload()
+	)
+	if len(payload) <= mss {
+		return fn(pkt)
+	} else if mss <= 0 {
+		return errors.Errorf("invalid mss %d", mss)
+	}
+
+	var (
+		seg   = segs.Get().(*packet.Packet)
+		flags = tcp.Flags()
+		seq   = tcp.SequenceNumber()
+	)
+	if size := pkt.Head() + hdrLen + mss; seg.Head()+seg.Data()+seg.Tail() < size {
+		seg = packet.Make(pkt.Head(), hdrLen+mss, 0)
+	}
+	defer segs.Put(seg)
+	// SetHead is limited by len, grow data firstly for pooled seg
+	seg.Sets(0, pkt.Head()+hdrLen).SetHead(pkt.Head())
+	copy(seg.Bytes(), tcp[:hdrLen])
+	for off := 0; off < len(payload); off += mss {
+		n := min(mss, len(payload)-off)
+		seg.Sets(pkt.Head(), hdrLen+n)
+		s := header.TCP(seg.Bytes())
+		copy(s[hdrLen:], payload[off:off+n])
+
+		f := flags
+		if off > 0 {
+			// SYN only in first segment, and it occupy a sequence number
+			f &^= header.TCPFlagSyn | header.TCPFlagUrg | header.TCPFlagCwr
+		}
+		if off+n < len(payload) {
+			f &^= header.TCPFlagFin | header.TCPFlagPsh
+		}
+		s.SetFlags(uint8(f))
+		if off > 0 && flags.Contains(header.TCPFlagSyn) {
+			s.SetSequenceNumber(seq + 1 + uint32(off))
+		} else {
+			s.SetSequenceNumber(seq + uint32(off))
+		}
+
+		s.SetChecksum(0)
+		sum := checksum.Checksum(s, 0)
+		if pseudo {
+			sum = checksum.Combine(sum, checksum.Combine(psum, uint16(len(s))))
+		}
+		s.SetChecksum(^sum)
+
+		if err := fn(seg); err != nil {
+			if off > 0 {
+				return &rawsock.ErrPartialWrite{Sent: off / mss, Err: err}
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package tcp_test
+
+import (
+	"errors"
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Segment(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	s, err := ipstack.New(src.Addr(), dst.Addr(), header.TCPProtocolNumber)
+	require.NoError(t, err)
+
+	randTCP := func(flags header.TCPFlags) header.TCP {
+		for {
+			tcp := header.TCP(test.StripIP(test.RandTCP(t, src, dst)))
+			if len(tcp.Payload()) >= 256 {
+				tcp.SetFlags(uint8(flags))
+				return tcp
+			}
+		}
+	}
+
+	t.Run("not-segment", func(t *testing.T) {
+		tcp := randTCP(header.TCPFlagAck)
+
+		var n int
+		err := itcp.Segment(packet.Make().Append(tcp...), len(tcp.Payload()), true, s.PseudoChecksum(), func(seg *packet.Packet) error {
+			n++
+			require.Equal(t, []byte(tcp), seg.Bytes())
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("segment", func(t *testing.T) {
+		tcp := randTCP(header.TCPFlagAck | header.TCPFlagPsh | header.TCPFlagFin)
+
+		const mss = 100
+		var payload []byte
+		err := itcp.Segment(packet.Make().Append(tcp...), mss, true, s.PseudoChecksum(), func(seg *packet.Packet) error {
+			hdr := header.TCP(seg.Bytes())
+			require.LessOrEqual(t, len(hdr.Payload()), mss)
+			require.Equal(t, tcp.SequenceNumber()+uint32(len(payload)), hdr.SequenceNumber())
+			require.Equal(t, tcp.AckNumber(), hdr.AckNumber())
+
+			last := len(payload)+len(hdr.Payload()) == len(tcp.Payload())
+			require.Equal(t, last, hdr.Flags().Contains(header.TCPFlagFin))
+			require.Equal(t, last, hdr.Flags().Contains(header.TCPFlagPsh))
+
+			test.ValidIP(t, test.BuildIP(t, src.Addr(), dst.Addr(), header.TCPProtocolNumber, hdr))
+			payload = append(payload, hdr.Payload()...)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []byte(tcp.Payload()), payload)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		tcp := randTCP(header.TCPFlagAck)
+
+		var n int
+		err := itcp.Segment(packet.Make().Append(tcp...), 100, true, s.PseudoChecksum(), func(seg *packet.Packet) error {
+			if n++; n == 2 {
+				return io.ErrShortWrite
+			}
+			return nil
+		})
+		var partial *rawsock.ErrPartialWrite
+		require.True(t, errors.As(err, &partial))
+		require.Equal(t, 1, partial.Sent)
+		require.ErrorIs(t, err, io.ErrShortWrite)
+	})
+
+	t.Run("syn", func(t *testing.T) {
+		tcp := randTCP(header.TCPFlagSyn)
+
+		var i int
+		err := itcp.Segment(packet.Make().Append(tcp...), 100, true, s.PseudoChecksum(), func(seg *packet.Packet) error {
+			hdr := header.TCP(seg.Bytes())
+			if i == 0 {
+				require.True(t, hdr.Flags().Contains(header.TCPFlagSyn))
+				require.Equal(t, tcp.SequenceNumber(), hdr.SequenceNumber())
+			} else {
+				require.False(t, hdr.Flags().Contains(header.TCPFlagSyn))
+				require.Equal(t, tcp.SequenceNumber()+1+uint32(i*100), hdr.SequenceNumber())
+			}
+			i++
+			return nil
+		})
+		require.NoError(t, err)
+	})
+}
+
+func Test_Segment_IPStack(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	for _, opt := range []ipstack.Option{ipstack.UpdateChecksum, ipstack.NotCalcChecksum, ipstack.ReCalcChecksum} {
+		s, err := ipstack.New(src.Addr(), dst.Addr(), header.TCPProtocolNumber, opt)
+		require.NoError(t, err)
+
+		tcp := header.TCP(test.StripIP(test.RandTCP(t, src, dst)))
+		tcp.SetFlags(uint8(header.TCPFlagAck))
+		tcp.SetChecksum(0)
+		if s.Pseudo() {
+			tcp.SetChecksum(^checksum.Checksum(tcp, checksum.Combine(s.PseudoChecksum(), uint16(len(tcp)))))
+		} else {
+			tcp.SetChecksum(^checksum.Checksum(tcp, 0))
+		}
+
+		err = itcp.Segment(packet.Make(64, 0).Append(tcp...), 100, s.Pseudo(), s.PseudoChecksum(), func(seg *packet.Packet) error {
+			s.AttachOutbound(seg)
+			test.ValidIP(t, seg.Bytes())
+			seg.DetachN(s.Size())
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+func Test_Segment_Allocs(t *testing.T) {
+	s, err := ipstack.New(test.RandIP(), test.RandIP(), header.TCPProtocolNumber)
+	require.NoError(t, err)
+
+	var pkt = packet.Make(64, header.TCPMinimumSize+4000)
+	header.TCP(pkt.Bytes()).Encode(&header.TCPFields{DataOffset: header.TCPMinimumSize})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		err := itcp.Segment(pkt, 1400, true, s.PseudoChecksum(), func(seg *packet.Packet) error {
+			s.AttachOutbound(seg)
+			seg.DetachN(s.Size())
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,71 @@
+package tcp
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Split split received tcp super-packet, that merged by nic LRO or GRO and
+// payload exceed mss, back into wire-sized segments, the first segment is
+// returned directly, the others are queued for next Read. methods are no-op
+// if nil
+type Split struct {
+	mu      sync.Mutex
+	pending [][]byte
+}
+
+func NewSplit() *Split {
+	return &Split{}
+}
+
+// Split replace tcp packet pkt with it's first segment if payload exceed mss,
+// see Segment
+func (s *Split) Split(pkt *packet.Packet, mss int, psum uint16) error {
+	if s == nil || pkt.Data() < header.TCPMinimumSize {
+		return nil
+	}
+	tcp := header.TCP(pkt.Bytes())
+	if int(tcp.DataOffset()) < header.TCPMinimumSize || int(tcp.DataOffset()) > len(tcp) ||
+		len(tcp.Payload()) <= mss {
+		return nil
+	}
+
+	var segs [][]byte
+	if err := Segment(pkt, mss, true, psum, func(seg *packet.Packet) error {
+		segs = append(segs, slices.Clone(seg.Bytes()))
+		return nil
+	}); err != nil {
+		return err
+	}
+	pkt.SetData(0).Append(segs[0]...)
+
+	s.mu.Lock()
+	s.pending = append(s.pending, segs[1:]...)
+	s.mu.Unlock()
+	return nil
+}
+
+// Pop read pending segment into pkt, return false if not exist
+func (s *Split) Pop(pkt *packet.Packet) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return false, nil
+	}
+
+	seg := s.pending[0]
+	if len(seg) > pkt.Data() {
+		return true, errorx.ShortBuff(len(seg), pkt.Data()) // keep for next read
+	}
+	s.pending[0] = nil
+	s.pending = s.pending[1:]
+	pkt.SetData(0).Append(seg...)
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package tcp_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Split(t *testing.T) {
+	var (
+		src = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		dst = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	s, err := ipstack.New(src.Addr(), dst.Addr(), header.TCPProtocolNumber)
+	require.NoError(t, err)
+
+	randTCP := func() header.TCP {
+		for {
+			tcp := header.TCP(test.StripIP(test.RandTCP(t, src, dst)))
+			if len(tcp.Payload()) >= 256 {
+				tcp.SetFlags(uint8(header.TCPFlagAck | header.TCPFlagPsh))
+				return tcp
+			}
+		}
+	}
+
+	t.Run("not-split", func(t *testing.T) {
+		tcp := randTCP()
+		sp := itcp.NewSplit()
+
+		pkt := packet.Make().Append(tcp...)
+		require.NoError(t, sp.Split(pkt, len(tcp.Payload()), s.PseudoChecksum()))
+		require.Equal(t, []byte(tcp), pkt.Bytes())
+
+		ok, err := sp.Pop(packet.Make(0, 1536))
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("split", func(t *testing.T) {
+		tcp := randTCP()
+		sp := itcp.NewSplit()
+
+		const mss = 100
+		pkt := packet.Make(64, 1536).SetData(0).Append(tcp...)
+		require.NoError(t, sp.Split(pkt, mss, s.PseudoChecksum()))
+
+		var payload []byte
+		for {
+			hdr := header.TCP(pkt.Bytes())
+			require.LessOrEqual(t, len(hdr.Payload()), mss)
+			require.Equal(t, tcp.SequenceNumber()+uint32(len(payload)), hdr.SequenceNumber())
+			test.ValidIP(t, test.BuildIP(t, src.Addr(), dst.Addr(), header.TCPProtocolNumber, hdr))
+			payload = append(payload, hdr.Payload()...)
+
+			ok, err := sp.Pop(pkt.Sets(64, 1536))
+			require.NoError(t, err)
+			if !ok {
+				break
+			}
+		}
+		require.Equal(t, []byte(tcp.Payload()), payload)
+	})
+
+	t.Run("short-buff", func(t *testing.T) {
+		tcp := randTCP()
+		sp := itcp.NewSplit()
+
+		pkt := packet.Make(0, 1536).SetData(0).Append(tcp...)
+		require.NoError(t, sp.Split(pkt, 100, s.PseudoChecksum()))
+
+		ok, err := sp.Pop(packet.Make(0, header.TCPMinimumSize))
+		require.True(t, ok)
+		require.True(t, errorx.Temporary(err))
+
+		ok, err = sp.Pop(pkt.Sets(0, 1536))
+		require.True(t, ok)
+		require.NoError(t, err)
+		require.Equal(t, tcp.SequenceNumber()+100, header.TCP(pkt.Bytes()).SequenceNumber())
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var sp *itcp.Split
+		pkt := packet.Make().Append(randTCP()...)
+		require.NoError(t, sp.Split(pkt, 100, s.PseudoChecksum()))
+		ok, err := sp.Pop(pkt)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,189 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/rawsock/helper/checksum"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// SynProxy answer SYN with SYN-ACK that ISN is cookie, validate the
+// handshake final ACK statelessly, so SYN flood not consume any state.
+//
+// cookie layout like linux: 5 bits time counter (64s), 3 bits mss index,
+// 24 bits hash of address, ports, client ISN and time counter. the SYN-ACK
+// only carry MSS option, so peer not use window scale, SACK or timestamp.
+type SynProxy struct {
+	seed maphash.Seed
+	now  func() time.Time
+}
+
+// cookie is valid within 2 time counters
+const cookiePeriod = 64
+
+var msss = [8]uint16{536, 1220, 1300, 1360, 1400, 1440, 1460, 8960}
+
+// SynOptionsSize tcp header size of SYN and SYN-ACK built by SynProxy
+const SynOptionsSize = header.TCPMinimumSize + header.TCPOptionMSSLength
+
+func NewSynProxy() *SynProxy {
+	return &SynProxy{seed: maphash.MakeSeed(), now: time.Now}
+}
+
+func (p *SynProxy) counter() uint32 {
+	return uint32(p.now().Unix() / cookiePeriod)
+}
+
+func (p *SynProxy) hash(local, remote netip.AddrPort, isn, t uint32) uint32 {
+	var b [2*(16+2) + 4 + 4]byte
+	l, r := local.Addr().As16(), remote.Addr().As16()
+	copy(b[0:], l[:])
+	binary.BigEndian.PutUint16(b[16:], local.Port())
+	copy(b[18:], r[:])
+	binary.BigEndian.PutUint16(b[34:], remote.Port())
+	binary.BigEndian.PutUint32(b[36:], isn)
+	binary.BigEndian.PutUint32(b[40:], t)
+	return uint32(maphash.Bytes(p.seed, b[:]))
+}
+
+func (p *SynProxy) cookie(id ID, idx uint8, t uint32) uint32 {
+	return t<<27 | uint32(idx)<<24 | p.hash(id.Local, id.Remote, id.ISN, t)&0xffffff
+}
+
+// Answer build cookie SYN-ACK answer syn into b, id.ISN is syn's sequence
+// number, b at least SynOptionsSize bytes
+func (p *SynProxy) Answer(id ID, syn header.TCP, b []byte) header.TCP {
+	mss := header.ParseSynOptions(syn.Options(), false).MSS
+	var idx uint8
+	for i, m := range msss {
+		if m <= mss {
+			idx = uint8(i)
+		}
+	}
+
+	return build(id.Local, id.Remote, &header.TCPFields{
+		SeqNum:     p.cookie(id, idx, p.counter()),
+		AckNum:     id.ISN + 1,
+		Flags:      header.TCPFlagSyn | header.TCPFlagAck,
+		WindowSize: 0xffff,
+	}, msss[idx], b)
+}
+
+// Validate validate handshake final ACK from remote to local, return the
+// SYN rebuilt from cookie and id of the conn, id.ISN is peer's ISN
+func (p *SynProxy) Validate(local, remote netip.AddrPort, ack header.TCP) (syn header.TCP, id ID, ok bool) {
+	const mask = header.TCPFlagFin | header.TCPFlagSyn | header.TCPFlagRst | header.TCPFlagAck
+	if ack.Flags()&mask != header.TCPFlagAck {
+		return nil, id, false
+	}
+	id = ID{Local: local, Remote: remote, ISN: ack.SequenceNumber() - 1}
+	cookie := ack.AckNumber() - 1
+
+	now, idx := p.counter(), uint8(cookie>>24&0x7)
+	for _, t := range [2]uint32{now, now - 1} {
+		if t&0x1f != cookie>>27 || p.cookie(id, idx, t) != cookie {
+			continue
+		}
+
+		syn = build(remote, local, &header.TCPFields{
+			SeqNum:     id.ISN,
+			Flags:      header.TCPFlagSyn,
+			WindowSize: ack.WindowSize(),
+		}, msss[idx], make([]byte, SynOptionsSize))
+		return syn, id, true
+	}
+	return nil, id, false
+}
+
+func build(src, dst netip.AddrPort, f *header.TCPFields, mss uint16, b []byte) header.TCP {
+	tcp := header.TCP(b[:SynOptionsSize])
+	f.SrcPort, f.DstPort = src.Port(), dst.Port()
+	f.DataOffset = SynOptionsSize
+	tcp.Encode(f)
+	header.EncodeMSSOption(uint32(mss), tcp[header.TCPMinimumSize:])
+
+	psum := header.PseudoHeaderChecksum(
+		header.TCPProtocolNumber,
+		tcpip.AddrFromSlice(src.Addr().AsSlice()), tcpip.AddrFromSlice(dst.Addr().AsSlice()), 0,
+	)
+	ipstack.Checksum(header.TCPProtocolNumber, tcp, psum)
+	return tcp
+}
+
+// Proxied translate sequence number of conn accepted by SynProxy, the
+// peer has been answered with cookie ISN, so app's SYN-ACK is dropped and
+// app's sequence number is shifted to cookie's.
+type Proxied struct {
+	cookie uint32
+	ack    []byte // handshake final ACK, replayed after app answered
+	replay *Replay
+
+	delta atomic.Uint32
+	ready atomic.Bool
+}
+
+// NewProxied syn and ack is returned by SynProxy.Validate and received ACK
+func NewProxied(syn, ack header.TCP) *Proxied {
+	var p = &Proxied{
+		cookie: ack.AckNumber() - 1,
+		ack:    slices.Clone(ack),
+		replay: NewReplay(),
+	}
+	p.replay.Push(syn)
+	return p
+}
+
+// Replay replay rebuilt SYN, then handshake final ACK after app answered
+func (p *Proxied) Replay() *Replay { return p.replay }
+
+// Outbound translate app's outbound tcp packet, return false if it should
+// be dropped
+func (p *Proxied) Outbound(tcp header.TCP) bool {
+	if p.ready.Load() {
+		if tcp.Flags().Contains(header.TCPFlagSyn) {
+			return false // retransmitted SYN-ACK
+		}
+		setUint32(tcp, header.TCPSeqNumOffset, tcp.SequenceNumber()+p.delta.Load())
+		return true
+	} else if tcp.Flags()&(header.TCPFlagSyn|header.TCPFlagAck) != header.TCPFlagSyn|header.TCPFlagAck {
+		return false // not answer handshake
+	}
+
+	p.delta.Store(p.cookie - tcp.SequenceNumber())
+	p.ready.Store(true)
+	ack := header.TCP(slices.Clone(p.ack))
+	p.Inbound(ack)
+	p.replay.Push(ack)
+	return false
+}
+
+// Inbound translate inbound tcp packet, return false if it should be
+// dropped, packets are dropped before app answered
+func (p *Proxied) Inbound(tcp header.TCP) bool {
+	if !p.ready.Load() {
+		return false
+	}
+	if tcp.Flags().Contains(header.TCPFlagAck) {
+		setUint32(tcp, header.TCPAckNumOffset, tcp.AckNumber()-p.delta.Load())
+	}
+	return true
+}
+
+// setUint32 set 32 bits field, update checksum incrementally (RFC 1624)
+func setUint32(tcp header.TCP, off int, v uint32) {
+	old := binary.BigEndian.Uint32(tcp[off:])
+	sum := ^tcp.Checksum()
+	sum = checksum.Combine(sum, ^uint16(old>>16))
+	sum = checksum.Combine(sum, ^uint16(old))
+	sum = checksum.Combine(sum, uint16(v>>16))
+	sum = checksum.Combine(sum, uint16(v))
+	binary.BigEndian.PutUint32(tcp[off:], v)
+	tcp.SetChecksum(^sum)
+}
@@ -0,0 +1,113 @@
+package tcp_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/checksum"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_SynProxy(t *testing.T) {
+	var (
+		local  = netip.MustParseAddrPort("10.0.0.1:80")
+		remote = netip.MustParseAddrPort("10.0.0.2:19986")
+		p      = itcp.NewSynProxy()
+	)
+	valid := func(src, dst netip.AddrPort, tcp header.TCP) {
+		psum := header.PseudoHeaderChecksum(
+			header.TCPProtocolNumber,
+			tcpip.AddrFromSlice(src.Addr().AsSlice()), tcpip.AddrFromSlice(dst.Addr().AsSlice()),
+			uint16(len(tcp)),
+		)
+		require.Equal(t, uint16(0xffff), checksum.Checksum(tcp, psum))
+	}
+	segment := func(seq, ack uint32, flags header.TCPFlags, payload string) header.TCP {
+		tcp := make(header.TCP, header.TCPMinimumSize, header.TCPMinimumSize+len(payload))
+		tcp.Encode(&header.TCPFields{
+			SrcPort: remote.Port(), DstPort: local.Port(), SeqNum: seq, AckNum: ack,
+			DataOffset: header.TCPMinimumSize, Flags: flags, WindowSize: 1024,
+		})
+		tcp = append(tcp, payload...)
+		psum := header.PseudoHeaderChecksum(
+			header.TCPProtocolNumber,
+			tcpip.AddrFromSlice(remote.Addr().AsSlice()), tcpip.AddrFromSlice(local.Addr().AsSlice()), 0,
+		)
+		tcp.SetChecksum(^checksum.Checksum(tcp, checksum.Combine(psum, uint16(len(tcp)))))
+		return tcp
+	}
+
+	var syn = make(header.TCP, itcp.SynOptionsSize)
+	syn.Encode(&header.TCPFields{
+		SrcPort: remote.Port(), DstPort: local.Port(), SeqNum: 1000,
+		DataOffset: itcp.SynOptionsSize, Flags: header.TCPFlagSyn, WindowSize: 1024,
+	})
+	header.EncodeMSSOption(1450, syn[header.TCPMinimumSize:])
+
+	synack := p.Answer(itcp.ID{Local: local, Remote: remote, ISN: 1000}, syn, make([]byte, 64))
+	require.Equal(t, header.TCPFlagSyn|header.TCPFlagAck, synack.Flags())
+	require.Equal(t, uint32(1001), synack.AckNumber())
+	require.Equal(t, uint16(1440), header.ParseSynOptions(synack.Options(), true).MSS)
+	valid(local, remote, synack)
+	cookie := synack.SequenceNumber()
+
+	// invalid ACK
+	for _, ack := range []header.TCP{
+		segment(1001, cookie+2, header.TCPFlagAck, ""),
+		segment(1002, cookie+1, header.TCPFlagAck, ""),
+		segment(1001, cookie+1, header.TCPFlagAck|header.TCPFlagSyn, ""),
+		segment(1001, cookie+1, header.TCPFlagRst|header.TCPFlagAck, ""),
+	} {
+		_, _, ok := p.Validate(local, remote, ack)
+		require.False(t, ok)
+	}
+	_, _, ok := p.Validate(local, netip.AddrPortFrom(remote.Addr(), 1), segment(1001, cookie+1, header.TCPFlagAck, ""))
+	require.False(t, ok)
+
+	ack := segment(1001, cookie+1, header.TCPFlagAck, "")
+	rebuilt, id, ok := p.Validate(local, remote, ack)
+	require.True(t, ok)
+	require.Equal(t, itcp.ID{Local: local, Remote: remote, ISN: 1000}, id)
+	require.Equal(t, header.TCPFlagSyn, rebuilt.Flags())
+	require.Equal(t, uint32(1000), rebuilt.SequenceNumber())
+	require.Equal(t, uint16(1440), header.ParseSynOptions(rebuilt.Options(), false).MSS)
+	valid(remote, local, rebuilt)
+
+	t.Run("proxied", func(t *testing.T) {
+		var (
+			c   = itcp.NewProxied(rebuilt, ack)
+			pkt = packet.Make(64, 1500)
+		)
+		ok, err := c.Replay().Pop(pkt)
+		require.True(t, ok)
+		require.NoError(t, err)
+		require.Equal(t, []byte(rebuilt), pkt.Bytes())
+
+		// not answered
+		require.False(t, c.Inbound(segment(1001, cookie+1, header.TCPFlagAck, "data")))
+		require.False(t, c.Outbound(segment(5001, 1001, header.TCPFlagAck, "")))
+
+		// app answer SYN-ACK with its ISN
+		require.False(t, c.Outbound(segment(5000, 1001, header.TCPFlagSyn|header.TCPFlagAck, "")))
+		ok, err = c.Replay().Pop(pkt.Sets(64, 1500))
+		require.True(t, ok)
+		require.NoError(t, err)
+		require.Equal(t, uint32(5001), header.TCP(pkt.Bytes()).AckNumber())
+		valid(remote, local, pkt.Bytes())
+		require.False(t, c.Outbound(segment(5000, 1001, header.TCPFlagSyn|header.TCPFlagAck, "")))
+
+		out := segment(5001, 1001, header.TCPFlagAck|header.TCPFlagPsh, "hello")
+		require.True(t, c.Outbound(out))
+		require.Equal(t, cookie+1, out.SequenceNumber())
+		valid(remote, local, out) // segment encode ports as inbound
+
+		in := segment(1001, cookie+6, header.TCPFlagAck, "world")
+		require.True(t, c.Inbound(in))
+		require.Equal(t, uint32(5006), in.AckNumber())
+		valid(remote, local, in)
+	})
+}
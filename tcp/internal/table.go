@@ -0,0 +1,121 @@
+package tcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lysShub/rawsock"
+)
+
+// Keep closed conn is kept in Table, because handshake SYN maybe retransmitted,
+// if Conn.Close not send RST
+const Keep = time.Minute
+
+type AddResult uint8
+
+const (
+	Added AddResult = iota
+	Duplicate
+	OverLimit
+)
+
+// Table conns accepted by Listener
+type Table struct {
+	mu     sync.Mutex
+	conns  map[ID]*entry
+	active int // not closed conns
+}
+
+type entry struct {
+	replay *Replay
+	closed time.Time
+}
+
+func NewTable() *Table {
+	return &Table{conns: make(map[ID]*entry, 16)}
+}
+
+// Add add conn if not exist and not exceed max (0 is unlimited), return
+// the conn's replay, it's nil if not replay
+func (t *Table) Add(id ID, max int, replay bool) (*Replay, AddResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, has := t.conns[id]; has {
+		return e.replay, Duplicate
+	} else if max > 0 && t.active >= max {
+		return nil, OverLimit
+	}
+
+	var e = &entry{}
+	if replay {
+		e.replay = NewReplay()
+	}
+	t.conns[id] = e
+	t.active++
+	return e.replay, Added
+}
+
+// Close mark conn closed, delete it after Keep
+func (t *Table) Close(id ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, has := t.conns[id]; has && e.closed.IsZero() {
+		e.closed = time.Now()
+		t.active--
+		t.expire(id, Keep)
+	}
+}
+
+func (t *Table) expire(id ID, after time.Duration) {
+	time.AfterFunc(after, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if e, has := t.conns[id]; has && !e.closed.IsZero() {
+			delete(t.conns, id)
+		}
+	})
+}
+
+func (t *Table) Export() []rawsock.ConnState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var conns = make([]rawsock.ConnState, 0, len(t.conns))
+	for id, e := range t.conns {
+		conns = append(conns, rawsock.ConnState{
+			Local: id.Local, Remote: id.Remote, ISN: id.ISN, Closed: e.closed,
+		})
+	}
+	return conns
+}
+
+// Import import conns, return ids of not closed conns, exist conns are skipped
+func (t *Table) Import(conns []rawsock.ConnState) (active []ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range conns {
+		id := ID{Local: c.Local, Remote: c.Remote, ISN: c.ISN}
+		if _, has := t.conns[id]; has {
+			continue
+		}
+
+		if c.Closed.IsZero() {
+			t.conns[id] = &entry{}
+			t.active++
+			active = append(active, id)
+		} else if remain := Keep - time.Since(c.Closed); remain > 0 {
+			t.conns[id] = &entry{closed: c.Closed}
+			t.expire(id, remain)
+		}
+	}
+	return active
+}
+
+// Active not closed conns
+func (t *Table) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
@@ -0,0 +1,81 @@
+package tcp_test
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/rawsock"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Table(t *testing.T) {
+	var (
+		local = netip.MustParseAddrPort("10.0.0.1:80")
+		id1   = itcp.ID{Local: local, Remote: netip.MustParseAddrPort("10.0.0.2:19986"), ISN: 1}
+		id2   = itcp.ID{Local: local, Remote: netip.MustParseAddrPort("10.0.0.3:19986"), ISN: 2}
+		id3   = itcp.ID{Local: local, Remote: netip.MustParseAddrPort("10.0.0.4:19986"), ISN: 3}
+	)
+
+	t.Run("add", func(t *testing.T) {
+		tb := itcp.NewTable()
+
+		r, res := tb.Add(id1, 2, false)
+		require.Equal(t, itcp.Added, res)
+		require.Nil(t, r)
+		r, res = tb.Add(id2, 2, true)
+		require.Equal(t, itcp.Added, res)
+		require.NotNil(t, r)
+
+		_, res = tb.Add(id3, 2, false)
+		require.Equal(t, itcp.OverLimit, res)
+		r2, res := tb.Add(id2, 2, false)
+		require.Equal(t, itcp.Duplicate, res)
+		require.Equal(t, r, r2)
+
+		// closed conn still duplicate, but not count as active
+		tb.Close(id1)
+		tb.Close(id1)
+		require.Equal(t, 1, tb.Active())
+		_, res = tb.Add(id1, 2, false)
+		require.Equal(t, itcp.Duplicate, res)
+		_, res = tb.Add(id3, 2, false)
+		require.Equal(t, itcp.Added, res)
+	})
+
+	t.Run("export-import", func(t *testing.T) {
+		old := itcp.NewTable()
+		old.Add(id1, 0, false)
+		old.Add(id2, 0, false)
+		old.Close(id2)
+
+		b, err := json.Marshal(rawsock.ListenerState{Addr: local, Conns: old.Export()})
+		require.NoError(t, err)
+		var s rawsock.ListenerState
+		require.NoError(t, json.Unmarshal(b, &s))
+		require.Equal(t, local, s.Addr)
+		require.Len(t, s.Conns, 2)
+
+		// expired closed conn is skipped
+		s.Conns = append(s.Conns, rawsock.ConnState{
+			Local: id3.Local, Remote: id3.Remote, ISN: id3.ISN,
+			Closed: time.Now().Add(-itcp.Keep * 2),
+		})
+
+		tb := itcp.NewTable()
+		active := tb.Import(s.Conns)
+		require.Equal(t, []itcp.ID{id1}, active)
+		require.Equal(t, 1, tb.Active())
+		require.Len(t, tb.Export(), 2)
+
+		_, res := tb.Add(id2, 0, false)
+		require.Equal(t, itcp.Duplicate, res)
+		_, res = tb.Add(id3, 0, false)
+		require.Equal(t, itcp.Added, res)
+
+		// import again is no-op
+		require.Empty(t, tb.Import(s.Conns))
+	})
+}
@@ -2,7 +2,9 @@ package tcp
 
 import (
 	"net/netip"
+	"sync/atomic"
 
+	"github.com/lysShub/rawsock"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
@@ -25,3 +27,22 @@ func SizeRange(ipv4 bool) (min, max int) {
 	}
 	return
 }
+
+// Stats dropped handshake packets counters of Listener
+type Stats struct {
+	Short, NonSyn, OverLimit, Duplicate atomic.Uint64
+}
+
+func (s *Stats) Load() rawsock.ListenerStats {
+	return rawsock.ListenerStats{
+		Short:     s.Short.Load(),
+		NonSyn:    s.NonSyn.Load(),
+		OverLimit: s.OverLimit.Load(),
+		Duplicate: s.Duplicate.Load(),
+	}
+}
+
+// IsSyn tcp handshake request packet
+func IsSyn(tcp header.TCP) bool {
+	return tcp.Flags()&(header.TCPFlagSyn|header.TCPFlagAck) == header.TCPFlagSyn
+}
@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+package raw
+
+import (
+	"net"
+	"net/netip"
+	"os"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/handoff"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type handoffState struct {
+	Local, Remote netip.AddrPort
+	ISN           uint32
+	MTU           int
+	Filter        string
+	Fragment, TSO bool
+	HdrIncl       bool // socket option is kept by the socket
+	TCP, PTB      bool // has port reserve listener and ICMPv6 watcher socket
+}
+
+// Handoff send conn's sockets to other process by unix socket, the conn is
+// closed after sent, the sockets are kept by receiver. not support
+// SuppressRST conn, because the nftables rule is owned by this process, and
+// SynProxy conn, because the sequence number translation is not sent.
+func Handoff(uc *net.UnixConn, c *Conn) error {
+	if c.rst != nil {
+		return errors.New("not support handoff SuppressRST conn")
+	} else if c.proxied != nil {
+		return errors.New("not support handoff SynProxy conn")
+	}
+
+	var (
+		state = handoffState{
+			Local: c.Local, Remote: c.RemoteAddr(), ISN: c.ISN,
+			MTU: c.mtu.Load(), Filter: c.filter,
+			Fragment: c.fragment, TSO: c.tso, HdrIncl: c.hdrincl,
+		}
+		files []*os.File
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	f, err := c.raw.File()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files = append(files, f)
+	if c.tcp != nil {
+		if f, err = c.tcp.File(); err != nil {
+			return errors.WithStack(err)
+		}
+		files, state.TCP = append(files, f), true
+	}
+	if c.ptb != nil {
+		if ptb, ok := c.ptb.(interface{ File() (*os.File, error) }); ok {
+			if f, err = ptb.File(); err != nil {
+				return errors.WithStack(err)
+			}
+			files, state.PTB = append(files, f), true
+		}
+	}
+
+	if err = handoff.Send(uc, state, files...); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// Adopt recv conn sent by Handoff, not need privilege, opts only used for
+// ReadBuffers, PMTUNotify and IdleTimeout
+func Adopt(uc *net.UnixConn, opts ...rawsock.Option) (*Conn, error) {
+	var state handoffState
+	files, err := handoff.Recv(uc, &state)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if n := 1 + btoi(state.TCP) + btoi(state.PTB); len(files) != n {
+		return nil, errors.Errorf("handoff expect %d files, got %d", n, len(files))
+	}
+
+	var (
+		cfg = rawsock.Options(opts...)
+		c   = newConnect(itcp.ID{Local: state.Local, Remote: state.Remote, ISN: state.ISN}, nil)
+	)
+	c.remote.Store(&c.ID.Remote)
+	c.filter, c.fragment, c.tso, c.hdrincl = state.Filter, state.Fragment, state.TSO, state.HdrIncl
+
+	if conn, err := net.FileConn(files[0]); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	} else if c.raw, _ = conn.(*net.IPConn); c.raw == nil {
+		conn.Close()
+		return nil, c.close(errors.Errorf("handoff invalid raw socket %T", conn))
+	}
+	files = files[1:]
+	if state.TCP {
+		if l, err := net.FileListener(files[0]); err != nil {
+			return nil, c.close(errors.WithStack(err))
+		} else if c.tcp, _ = l.(*net.TCPListener); c.tcp == nil {
+			l.Close()
+			return nil, c.close(errors.Errorf("handoff invalid tcp listener %T", l))
+		}
+		files = files[1:]
+	}
+	if state.PTB {
+		if c.ptb, err = net.FilePacketConn(files[0]); err != nil {
+			return nil, c.close(errors.WithStack(err))
+		}
+		ipstack.ServePTB(c.ptb, c.handlePTB)
+	}
+
+	c.mtu = ipstack.NewPMTU(state.MTU, cfg.PMTUNotify)
+	c.bufs = bufpool.New(64, state.MTU, cfg.ReadBuffers)
+	if c.ipstack, err = ipstack.New(
+		c.Local.Addr(), c.Remote.Addr(),
+		header.TCPProtocolNumber, cfg.IPStack.Unmarshal(),
+	); err != nil {
+		return nil, c.close(err)
+	}
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
+	return c, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
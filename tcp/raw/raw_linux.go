@@ -6,7 +6,11 @@ package raw
 import (
 	"net"
 	"net/netip"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/lysShub/netkit/errorx"
@@ -14,65 +18,146 @@ import (
 	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/helper"
 	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/cmsg"
 	itcp "github.com/lysShub/rawsock/tcp/internal"
 	"github.com/pkg/errors"
 
-	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ip6"
 	"github.com/lysShub/rawsock/helper/ipstack"
-	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/lysShub/rawsock/internal/assert"
+	"golang.org/x/net/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
 type Listener struct {
 	addr netip.AddrPort
+	zone int // interface index of zoned addr
 	cfg  *rawsock.Config
 
 	tcp *net.TCPListener
+	rst *bind.RSTRule // replace tcp if SuppressRST
 
 	raw *net.IPConn
+	pc6 *ipv6.PacketConn // recv destination address of ipv6 packet
 
-	// AddrPort:ISN
-	conns   map[itcp.ID]struct{}
-	connsMu sync.RWMutex
+	conns *itcp.Table
+	stats itcp.Stats
+	proxy *itcp.SynProxy // answer SYN with cookie, if SynProxy
+
+	// validated handshake waiting first payload, if PeekPayload
+	mu      sync.Mutex
+	pending map[itcp.ID]*pending
 
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.Listener = (*Listener)(nil)
+type pending struct {
+	syn, ack header.TCP
+	deadline time.Time
+}
+
+// maxPending max handshakes waiting first payload
+const maxPending = 1024
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+var _ rawsock.StateListener = (*Listener)(nil)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (l *Listener, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		l, err = listen(laddr, cfg)
+		return err
+	})
+	return l, err
+}
+
+// ListenShards create n listeners on laddr, every listener only accept flows
+// hashed to it, so can Accept concurrently without duplicate conns. first
+// listener occupy the local port.
+func ListenShards(laddr netip.AddrPort, n int, opts ...rawsock.Option) ([]*Listener, error) {
+	var ls = make([]*Listener, 0, n)
+	for i := 0; i < n; i++ {
+		o := append(opts[:len(opts):len(opts)], rawsock.Shard(i, n))
+		if i > 0 {
+			laddr = ls[0].Addr()
+			o = append(o, rawsock.UsedPort())
+		}
 
-func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+		l, err := Listen(laddr, o...)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+func listen(laddr netip.AddrPort, cfg *rawsock.Config) (*Listener, error) {
 	var l = &Listener{
-		cfg:   rawsock.Options(opts...),
-		conns: make(map[itcp.ID]struct{}, 16),
+		cfg:   cfg,
+		conns: itcp.NewTable(),
+	}
+	if cfg.SynProxy {
+		l.proxy = itcp.NewSynProxy()
+		l.pending = map[itcp.ID]*pending{}
 	}
 	var err error
 
-	// usaully should listen on all nic, but we juse listen on default nic
-	if laddr.Addr().IsUnspecified() {
-		laddr = netip.AddrPortFrom(rawsock.LocalAddr(), laddr.Port())
+	if l.zone, err = ip6.ZoneIndex(laddr.Addr().Zone()); err != nil {
+		return nil, l.close(err)
+	}
+	if l.cfg.SuppressRST {
+		l.rst, l.addr, err = bind.DropRST(l.cfg.NetNS, laddr, netip.AddrPort{})
+	} else {
+		l.tcp, l.addr, err = bind.ListenTCPLocal(laddr, l.cfg.UsedPort)
 	}
-
-	l.tcp, l.addr, err = bind.ListenTCPLocal(laddr, l.cfg.UsedPort)
 	if err != nil {
 		return nil, l.close(err)
 	}
 
+	network := "ip4:tcp"
+	if !l.addr.Addr().Is4() {
+		network = "ip6:tcp"
+	}
 	l.raw, err = net.ListenIP(
-		"ip:tcp",
+		network,
 		&net.IPAddr{IP: l.addr.Addr().AsSlice(), Zone: laddr.Addr().Zone()},
 	)
 	if err != nil {
 		return nil, l.close(err)
 	}
+	if !l.addr.Addr().Is4() {
+		l.pc6 = ipv6.NewPacketConn(l.raw)
+		if err = l.pc6.SetControlMessage(ipv6.FlagDst, true); err != nil {
+			return nil, l.close(errors.WithStack(err))
+		}
+	}
 
 	if raw, err := l.raw.SyscallConn(); err != nil {
 		return nil, l.close(err)
 	} else {
-		if err = bpf.SetRawBPF(
-			raw,
-			bpf.FilterDstPortAndTCPSyn(l.addr.Port()),
-		); err != nil {
+		if l.cfg.VRF != "" {
+			if err = vrf.Bind(raw, l.cfg.VRF); err != nil {
+				return nil, l.close(err)
+			}
+		}
+		ins := bpf.FilterDstPortAndTCPSyn(l.addr.Port())
+		if l.proxy != nil {
+			ins = bpf.FilterDstPortAndTCPHandshake(l.addr.Port())
+		}
+		ins, err := bpf.WithFilter(l.cfg.Filter, bpf.WithInterface(l.zone, bpf.WithShard(l.cfg.Shard, l.cfg.Shards, ins)))
+		if err != nil {
+			return nil, l.close(err)
+		}
+		if err = bpf.SetRawBPF(raw, ins); err != nil {
 			return nil, l.close(err)
 		}
 	}
@@ -90,6 +175,9 @@ func (l *Listener) close(cause error) error {
 		if l.tcp != nil {
 			errs = append(errs, errors.WithStack(l.tcp.Close()))
 		}
+		if l.rst != nil {
+			errs = append(errs, l.rst.Remove())
+		}
 		return
 	})
 }
@@ -97,92 +185,311 @@ func (l *Listener) close(cause error) error {
 // todo: not support private proto that not start with tcp SYN flag
 func (l *Listener) Accept() (rawsock.RawConn, error) {
 	var min, max = itcp.SizeRange(l.addr.Addr().Is4())
+	if l.pc6 != nil {
+		// ipv6 raw socket not recv ip header
+		min, max = min-header.IPv6MinimumSize, max-header.IPv6MinimumSize
+	}
+	if l.cfg.PeekTimeout > 0 {
+		max = 0xffff // include first payload
+	}
 
 	var ip = make([]byte, max)
 	for {
-		n, err := l.raw.Read(ip[:max])
-		if err != nil {
+		n, src, dst, err := l.read(ip[:max])
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// accept without payload
+			if id, p := l.expired(); p != nil {
+				if c, err := l.accept(id, p.ack, itcp.NewProxied(p.syn, p.ack), nil); err != nil {
+					return nil, errorx.WrapTemp(err)
+				} else if c != nil {
+					return c, nil
+				}
+			}
+			continue
+		} else if err != nil {
 			return nil, l.close(err)
 		} else if n < min {
-			return nil, errors.Errorf("recved invalid ip packet, bytes %d", n)
+			l.stats.Short.Add(1)
+			continue
 		}
 
-		var id = itcp.ID{Local: l.addr}
-		switch header.IPVersion(ip) {
-		case 4:
+		// listen on unspecified address accept packet to any local address,
+		// resolve conn's local address from destination address
+		var id itcp.ID
+		var syn header.TCP
+		if l.pc6 == nil {
+			if header.IPVersion(ip) != 4 {
+				continue
+			}
 			iphdr := header.IPv4(ip[:n])
-			tcphdr := header.TCP(iphdr.Payload())
-			id.Remote = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
-		case 6:
-			iphdr := header.IPv6(ip[:n])
-			tcphdr := header.TCP(iphdr.Payload())
-			id.Remote = netip.AddrPortFrom(netip.AddrFrom4(iphdr.SourceAddress().As4()), tcphdr.SourcePort())
-			id.ISN = tcphdr.SequenceNumber()
-		default:
+			syn = header.TCP(iphdr.Payload())
+			src, dst = netip.AddrFrom4(iphdr.SourceAddress().As4()), netip.AddrFrom4(iphdr.DestinationAddress().As4())
+		} else if !dst.IsValid() {
+			l.stats.Short.Add(1)
 			continue
+		} else {
+			syn = header.TCP(ip[:n])
+		}
+		id.Local = netip.AddrPortFrom(dst, l.addr.Port())
+		id.Remote = netip.AddrPortFrom(src, syn.SourcePort())
+		id.ISN = syn.SequenceNumber()
+
+		var (
+			proxied *itcp.Proxied
+			peek    []byte
+		)
+		if l.proxy != nil {
+			if itcp.IsSyn(syn) {
+				l.answer(id, syn)
+				continue
+			}
+			// maybe ACK of accepted conns, ignore silently
+			rebuilt, pid, ok := l.proxy.Validate(id.Local, id.Remote, syn)
+			if !ok {
+				continue
+			}
+			if l.cfg.PeekTimeout > 0 {
+				if len(syn.Payload()) == 0 {
+					l.wait(pid, rebuilt, syn)
+					continue
+				}
+				l.remove(pid)
+				peek = slices.Clone(syn.Payload())
+			}
+			id, proxied = pid, itcp.NewProxied(rebuilt, syn)
+		} else if !itcp.IsSyn(syn) {
+			l.stats.NonSyn.Add(1)
+			continue
+		}
+
+		if c, err := l.accept(id, syn, proxied, peek); err != nil {
+			return nil, errorx.WrapTemp(err)
+		} else if c != nil {
+			return c, nil
+		}
+	}
+}
+
+// read handshake packet, ipv6 packet's addresses are got from sockaddr and
+// IPV6_PKTINFO, dst is invalid if without pktinfo
+func (l *Listener) read(b []byte) (n int, src, dst netip.Addr, err error) {
+	if l.pc6 == nil {
+		n, err = l.raw.Read(b)
+		return n, src, dst, err
+	}
+
+	n, cm, from, err := l.pc6.ReadFrom(b)
+	if err != nil || cm == nil {
+		return n, src, dst, err
+	}
+	src, _ = netip.AddrFromSlice(from.(*net.IPAddr).IP)
+	dst, _ = netip.AddrFromSlice(cm.Dst)
+	return n, ip6.Zone(src, l.zone), ip6.Zone(dst, l.zone), nil
+}
+
+// accept create conn for handshake, return nil if it's dropped
+func (l *Listener) accept(id itcp.ID, syn header.TCP, proxied *itcp.Proxied, peek []byte) (*Conn, error) {
+	replay, res := l.conns.Add(id, l.cfg.MaxConns, l.cfg.ReplaySYN && proxied == nil)
+	switch res {
+	case itcp.Duplicate:
+		if proxied != nil {
+			return nil, nil // ACK before the conn's first Read
+		}
+		l.stats.Duplicate.Add(1)
+		replay.Push(syn)
+		if l.cfg.OnDuplicateSYN != nil {
+			l.cfg.OnDuplicateSYN(id.Local, id.Remote)
 		}
+		return nil, nil
+	case itcp.OverLimit:
+		l.stats.OverLimit.Add(1)
+		return nil, nil
+	}
+	replay.Push(syn)
+
+	// todo: 应该把这个SYN携带进去
+	c := newConnect(id, l.deleteConn)
+	c.replay, c.peek = replay, peek
+	if proxied != nil {
+		c.replay, c.proxied = proxied.Replay(), proxied
+	}
+	if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+		return nil, c.close(err)
+	}
+	return c, nil
+}
+
+// wait handshake waiting first payload, until peek timeout
+func (l *Listener) wait(id itcp.ID, syn, ack header.TCP) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, has := l.pending[id]; has {
+		return
+	} else if len(l.pending) >= maxPending {
+		l.stats.OverLimit.Add(1)
+		return
+	}
+	l.pending[id] = &pending{
+		syn: syn, ack: slices.Clone(ack),
+		deadline: time.Now().Add(l.cfg.PeekTimeout),
+	}
+	l.setDeadline()
+}
+
+func (l *Listener) remove(id itcp.ID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, has := l.pending[id]; has {
+		delete(l.pending, id)
+		l.setDeadline()
+	}
+}
+
+// expired pop a handshake that peek timeout
+func (l *Listener) expired() (itcp.ID, *pending) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.setDeadline()
+
+	now := time.Now()
+	for id, p := range l.pending {
+		if !p.deadline.After(now) {
+			delete(l.pending, id)
+			return id, p
+		}
+	}
+	return itcp.ID{}, nil
+}
+
+// setDeadline set read deadline to earliest pending deadline, must hold mu
+func (l *Listener) setDeadline() {
+	var deadline time.Time
+	for _, p := range l.pending {
+		if deadline.IsZero() || p.deadline.Before(deadline) {
+			deadline = p.deadline
+		}
+	}
+	l.raw.SetReadDeadline(deadline)
+}
+
+// answer answer SYN with cookie SYN-ACK
+func (l *Listener) answer(id itcp.ID, syn header.TCP) {
+	var b [itcp.SynOptionsSize]byte
+	synack := l.proxy.Answer(id, syn, b[:])
+	l.raw.WriteToIP(synack, &net.IPAddr{IP: id.Remote.Addr().AsSlice(), Zone: id.Remote.Addr().Zone()})
+}
 
-		l.connsMu.RLock()
-		_, has := l.conns[id]
-		l.connsMu.RUnlock()
-		if !has {
-			l.connsMu.Lock()
-			l.conns[id] = struct{}{}
-			l.connsMu.Unlock()
+func (l *Listener) Export() rawsock.ListenerState {
+	return rawsock.ListenerState{Addr: l.addr, Conns: l.conns.Export()}
+}
 
-			// todo: 应该把这个SYN携带进去
-			c := newConnect(id, l.deleteConn)
-			if err := c.init(l.cfg); err != nil {
-				return nil, errorx.WrapTemp(c.close(err))
+// Import import conn table exported by old process's Listener with same
+// address, the not closed conns is re-created
+func (l *Listener) Import(s rawsock.ListenerState) ([]rawsock.RawConn, error) {
+	if s.Addr.Port() != l.addr.Port() {
+		return nil, errors.Errorf("import %s state to listener %s", s.Addr.String(), l.addr.String())
+	}
+
+	var (
+		ids   = l.conns.Import(s.Conns)
+		conns = make([]rawsock.RawConn, 0, len(ids))
+	)
+	for i, id := range ids {
+		c := newConnect(id, l.deleteConn)
+		if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+			err = c.close(err)
+			for _, c := range conns {
+				c.Close()
 			}
-			return c, nil
+			for _, id := range ids[i+1:] {
+				l.conns.Close(id)
+			}
+			return nil, err
 		}
+		conns = append(conns, c)
 	}
+	return conns, nil
 }
 
 func (l *Listener) deleteConn(id itcp.ID) error {
 	if l == nil {
 		return nil
 	}
-
-	// delay delete, because tcp handshake request will retry, if
-	// Conn.Close() not send RST
-	time.AfterFunc(time.Minute, func() {
-		l.connsMu.Lock()
-		defer l.connsMu.Unlock()
-		delete(l.conns, id)
-	})
+	l.conns.Close(id)
 	return nil
 }
 
-func (l *Listener) Addr() netip.AddrPort { return l.addr }
-func (l *Listener) Close() error         { return l.close(nil) }
+func (l *Listener) Addr() netip.AddrPort         { return l.addr }
+func (l *Listener) Stats() rawsock.ListenerStats { return l.stats.Load() }
+func (l *Listener) Close() error                 { return l.close(nil) }
 
 type Conn struct {
 	itcp.ID
-	tcp *net.TCPListener
+	replay  *itcp.Replay  // replay handshake SYN, if ReplaySYN
+	proxied *itcp.Proxied // translate sequence number, if SynProxy
+	peek    []byte        // first payload, if PeekPayload
+	tcp     *net.TCPListener
+	rst     *bind.RSTRule // replace tcp if SuppressRST
 
 	raw *net.IPConn
 
 	ipstack *ipstack.IPStack
+	filter  string
+	zone    int                            // interface index of zoned local address
+	remote  atomic.Pointer[netip.AddrPort] // current remote address, maybe roamed
+
+	mtu      *ipstack.PMTU
+	unwatch  func()         // stop watch interface mtu, nil if MTU specified
+	bufs     *bufpool.Pool  // read buffers
+	ptb      net.PacketConn // recv ICMPv6 packet too big
+	fragment bool           // kernel fragment oversize packet
+	tso      bool
+	split    *itcp.Split // split GRO super-packet, if SplitGRO
+	hdrincl  bool        // Write take complete ip packet, if HdrIncl
 
 	closeFn  itcp.CloseCallback
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.RawConn = (*Conn)(nil)
+var _ rawsock.MetaConn = (*Conn)(nil)
+var _ rawsock.RoamConn = (*Conn)(nil)
+var _ rawsock.BufferConn = (*Conn)(nil)
+var _ rawsock.PeekConn = (*Conn)(nil)
+var _ syscall.Conn = (*Conn)(nil)
 
-func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (c *Conn, err error) {
 	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		c, err = connect(laddr, raddr, cfg)
+		return err
+	})
+	return c, err
+}
 
-	if l, err := helper.DefaultLocal(laddr.Addr(), raddr.Addr()); err != nil {
+func connect(laddr, raddr netip.AddrPort, cfg *rawsock.Config) (*Conn, error) {
+	if l, r, err := helper.ZoneAddrs(laddr.Addr(), raddr.Addr()); err != nil {
+		return nil, err
+	} else {
+		laddr, raddr = netip.AddrPortFrom(l, laddr.Port()), netip.AddrPortFrom(r, raddr.Port())
+	}
+	if l, err := defaultLocal(laddr.Addr(), raddr.Addr(), cfg.VRF); err != nil {
 		return nil, errors.WithStack(err)
 	} else {
 		laddr = netip.AddrPortFrom(l, laddr.Port())
 	}
 
-	tcp, laddr, err := bind.ListenTCPLocal(laddr, cfg.UsedPort)
+	var (
+		tcp *net.TCPListener
+		rst *bind.RSTRule
+		err error
+	)
+	if cfg.SuppressRST {
+		rst, laddr, err = bind.DropRST(cfg.NetNS, laddr, raddr)
+	} else {
+		tcp, laddr, err = bind.ListenTCPLocal(laddr, cfg.UsedPort)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +497,7 @@ func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error)
 	var c = newConnect(
 		itcp.ID{Local: laddr, Remote: raddr, ISN: 0}, nil,
 	)
-	c.tcp = tcp
+	c.tcp, c.rst = tcp, rst
 
 	if err = c.init(cfg); err != nil {
 		return nil, c.close(err)
@@ -206,6 +513,11 @@ func newConnect(id itcp.ID, closeCall itcp.CloseCallback) *Conn {
 }
 
 func (c *Conn) init(cfg *rawsock.Config) (err error) {
+	c.remote.Store(&c.ID.Remote)
+	c.filter = cfg.Filter
+	if c.zone, err = ip6.ZoneIndex(c.Local.Addr().Zone()); err != nil {
+		return err
+	}
 	if c.raw, err = net.DialIP(
 		"ip:tcp",
 		&net.IPAddr{IP: c.Local.Addr().AsSlice(), Zone: c.Local.Addr().Zone()},
@@ -213,11 +525,80 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	); err != nil {
 		return err
 	}
+	if cfg.VRF != "" {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return err
+		} else if err = vrf.Bind(raw, cfg.VRF); err != nil {
+			return err
+		}
+	}
+
+	mtu := cfg.MTU
+	var ifi *net.Interface
+	if mtu == 0 {
+		if ifi, err = helper.InterfaceByAddr(c.Local.Addr()); err != nil {
+			return err
+		}
+		mtu = ifi.MTU
+	}
+	c.mtu = ipstack.NewPMTU(mtu, cfg.PMTUNotify)
+	if ifi != nil {
+		// best effort, buffers sized at init, so only interface mtu shrink take effect
+		c.unwatch, _ = helper.WatchMTU(ifi.Name, func(mtu int) { c.mtu.Update(mtu) })
+	}
+	c.bufs = bufpool.New(64, mtu, cfg.ReadBuffers)
+	if c.Local.Addr().Is6() {
+		if c.ptb, err = ipstack.WatchPTB(c.Local.Addr(), c.handlePTB); err != nil {
+			return err
+		}
+	}
+	c.tso = cfg.TSO
+	if cfg.SplitGRO {
+		c.split = itcp.NewSplit()
+	}
+	if cfg.HdrIncl {
+		c.hdrincl = true
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.SetHdrIncl(raw, c.Local.Addr().Is4()); err != nil {
+			return err
+		}
+	}
+	if cfg.Fragment && c.Local.Addr().Is4() {
+		c.fragment = true
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.DisablePMTUDisc(raw); err != nil {
+			return err
+		}
+	}
 
 	// todo: set nic offload should be options, some option can't be update: rx-gro-hw: on [fixed]
 	// todo: if loopback, should set tso/gso:
 	//   ethtool -K lo tcp-segmentation-offload off
 	//   ethtool -K lo generic-segmentation-offload off
+	if cfg.Timestamp {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = cmsg.SetTimestamp(raw, cfg.HardwareTimestamp); err != nil {
+			return err
+		}
+	}
+	if cfg.Ancillary {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = cmsg.SetAncillary(raw, c.Local.Addr().Is4()); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPoll > 0 {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.SetBusyPoll(raw, cfg.BusyPoll, cfg.BusyPollBudget); err != nil {
+			return err
+		}
+	}
+
 	if cfg.SetGRO {
 		if err = bind.SetGRO(c.Local.Addr(), c.Remote.Addr(), false); err != nil {
 			return err
@@ -228,10 +609,11 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	if raw, err := c.raw.SyscallConn(); err != nil {
 		return err
 	} else {
-		if err = bpf.SetRawBPF(
-			raw,
-			bpf.FilterPorts(c.ID.Remote.Port(), c.Local.Port()),
-		); err != nil {
+		ins, err := bpf.WithFilter(cfg.Filter, bpf.WithInterface(c.zone, bpf.FilterPorts(c.ID.Remote.Port(), c.Local.Port())))
+		if err != nil {
+			return err
+		}
+		if err = bpf.SetRawBPF(raw, ins); err != nil {
 			return err
 		}
 	}
@@ -243,19 +625,36 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	); err != nil {
 		return err
 	}
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
 	return nil
 }
 
 func (c *Conn) close(cause error) error {
 	return c.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
+		c.idle.Stop()
+		if c.unwatch != nil {
+			c.unwatch()
+		}
 
 		if c.raw != nil {
 			errs = append(errs, c.raw.Close())
 		}
+		if c.ptb != nil {
+			errs = append(errs, errors.WithStack(c.ptb.Close()))
+		}
 		if c.tcp != nil {
 			errs = append(errs, errors.WithStack(c.tcp.Close()))
 		}
+		if c.rst != nil {
+			errs = append(errs, c.rst.Remove())
+		}
 		if c.closeFn != nil {
 			errs = append(errs, c.closeFn(c.ID))
 		}
@@ -263,25 +662,113 @@ func (c *Conn) close(cause error) error {
 	})
 }
 
+func (c *Conn) handlePTB(ptb ipstack.PTB) {
+	if ptb.Proto == header.TCPProtocolNumber && ptb.Src == c.Local && ptb.Dst == *c.remote.Load() {
+		c.mtu.Update(ptb.MTU)
+	}
+}
+
 func (c *Conn) Read(pkt *packet.Packet) (err error) {
-	n, err := c.raw.Read(pkt.Bytes())
-	if err != nil {
-		return errors.WithStack(err)
+	if ok, err := c.replay.Pop(pkt); ok {
+		return err
+	} else if ok, err := c.split.Pop(pkt); ok {
+		return err
+	}
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		n, err := c.raw.Read(pkt.Sets(head, data).Bytes())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pkt.SetData(n)
+		c.idle.Touch()
+
+		if err := c.trimIP(pkt); err != nil {
+			return err
+		}
+		if c.proxied == nil || c.proxied.Inbound(pkt.Bytes()) {
+			return c.splitGRO(pkt)
+		}
+	}
+}
+
+func (c *Conn) ReadMeta(pkt *packet.Packet) (meta rawsock.Meta, err error) {
+	if ok, err := c.replay.Pop(pkt); ok {
+		return meta, err
+	} else if ok, err := c.split.Pop(pkt); ok {
+		return meta, err
+	}
+	var oob [cmsg.Size]byte
+	head, data := pkt.Head(), pkt.Data()
+	for {
+		n, oobn, _, _, err := c.raw.ReadMsgIP(pkt.Sets(head, data).Bytes(), oob[:])
+		if err != nil {
+			return meta, errors.WithStack(err)
+		}
+		pkt.SetData(n)
+		c.idle.Touch()
+
+		if err := c.trimIP(pkt); err != nil {
+			return meta, err
+		}
+		if c.proxied == nil || c.proxied.Inbound(pkt.Bytes()) {
+			if err := cmsg.Parse(oob[:oobn], &meta); err != nil {
+				return meta, err
+			}
+			return meta, c.splitGRO(pkt)
+		}
 	}
-	pkt.SetData(n)
+}
 
+// trimIP trim ip header of read packet, ipv6 raw socket not recv ip header
+func (c *Conn) trimIP(pkt *packet.Packet) error {
+	if !c.Local.Addr().Is4() {
+		return nil
+	}
 	hdrLen, err := helper.IPCheck(pkt.Bytes())
 	if err != nil {
 		return err
 	}
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 	pkt.SetHead(pkt.Head() + int(hdrLen))
 	return nil
 }
 
+// Peek first payload, if accepted with PeekPayload
+func (c *Conn) Peek() []byte { return c.peek }
+
 func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	if c.hdrincl {
+		return c.writeIP(pkt)
+	}
+	if c.proxied != nil && !c.proxied.Outbound(pkt.Bytes()) {
+		return nil
+	}
+	c.replay.Answer()
+	if c.tso {
+		mss := c.mtu.Load() - c.ipstack.Size() - int(header.TCP(pkt.Bytes()).DataOffset())
+		return itcp.Segment(pkt, mss, true, c.ipstack.PseudoChecksum(), c.write)
+	}
+	return c.write(pkt)
+}
+
+func (c *Conn) write(pkt *packet.Packet) (err error) {
+	if n := pkt.Data() + c.ipstack.Size(); n > c.mtu.Load() && !c.fragment {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
+	_, err = c.raw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
+// writeIP write complete ip packet, if HdrIncl
+func (c *Conn) writeIP(pkt *packet.Packet) (err error) {
+	if _, err = helper.IPCheck(pkt.Bytes()); err != nil {
+		return err
+	} else if n := pkt.Data(); n > c.mtu.Load() {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
+	c.valid.ValidIP(pkt.Bytes())
 	_, err = c.raw.Write(pkt.Bytes())
 	return errors.WithStack(err)
 }
@@ -289,13 +776,77 @@ func (c *Conn) Write(pkt *packet.Packet) (err error) {
 func (c *Conn) Inject(pkt *packet.Packet) (err error) {
 	defer pkt.DetachN(c.ipstack.Size())
 	c.ipstack.AttachInbound(pkt)
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 	_, err = c.raw.Write(pkt.Bytes())
 	return errors.WithStack(err)
 }
 
+func (c *Conn) SetRemote(raddr netip.AddrPort) error {
+	raw, err := c.raw.SyscallConn()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	raddr = netip.AddrPortFrom(ip6.Zone(raddr.Addr(), c.zone), raddr.Port())
+	if raddr.Addr().Is4() != c.Local.Addr().Is4() {
+		return errors.Errorf("address family not match %s and %s", c.Local.Addr(), raddr.Addr())
+	}
+
+	// prepare filters firstly, commit new remote only if every step succeed
+	old := *c.remote.Load()
+	ins, err := bpf.WithFilter(c.filter, bpf.WithInterface(c.zone, bpf.FilterPorts(raddr.Port(), c.Local.Port())))
+	if err != nil {
+		return err
+	}
+	oldIns, err := bpf.WithFilter(c.filter, bpf.WithInterface(c.zone, bpf.FilterPorts(old.Port(), c.Local.Port())))
+	if err != nil {
+		return err
+	}
+	rollback := func(cause error) error {
+		bpf.SetRawBPF(raw, oldIns)
+		bind.Reconnect(raw, old.Addr())
+		return cause
+	}
+
+	if err = bpf.SetRawBPF(raw, ins); err != nil {
+		return rollback(err)
+	}
+	if err = bind.Reconnect(raw, raddr.Addr()); err != nil {
+		return rollback(err)
+	}
+	if err := c.ipstack.SetRemote(raddr.Addr()); err != nil {
+		return rollback(errors.WithStack(err))
+	}
+	c.remote.Store(&raddr)
+	return nil
+}
+
+// SyscallConn return underlying socket, used to set socket options
+func (c *Conn) SyscallConn() (syscall.RawConn, error) { return c.raw.SyscallConn() }
+
 func (c *Conn) LocalAddr() netip.AddrPort  { return c.Local }
-func (c *Conn) RemoteAddr() netip.AddrPort { return c.ID.Remote }
+func (c *Conn) RemoteAddr() netip.AddrPort { return *c.remote.Load() }
 func (c *Conn) Close() error               { return c.close(nil) }
+
+// MTU current egress path mtu
+func (c *Conn) MTU() int { return c.mtu.Load() }
+
+// Packet get a read buffer sized to mtu detected at init
+func (c *Conn) Packet() *packet.Packet { return c.bufs.Get() }
+
+func (c *Conn) Release(pkt *packet.Packet) { c.bufs.Put(pkt) }
+
+func defaultLocal(laddr, raddr netip.Addr, vrfName string) (netip.Addr, error) {
+	if vrfName != "" && laddr.WithZone("").IsUnspecified() {
+		return vrf.DefaultLocal(vrfName, raddr)
+	}
+	return helper.DefaultLocal(laddr, raddr)
+}
+
+// splitGRO split super-packet to segments sized to path mtu, if SplitGRO
+func (c *Conn) splitGRO(pkt *packet.Packet) error {
+	if c.split == nil || pkt.Data() < header.TCPMinimumSize {
+		return nil
+	}
+	mss := c.mtu.Load() - c.ipstack.Size() - int(header.TCP(pkt.Bytes()).DataOffset())
+	return c.split.Split(pkt, mss, c.ipstack.PseudoChecksum())
+}
@@ -18,7 +18,9 @@ import (
 
 	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/test/conntest"
 	"github.com/stretchr/testify/require"
 	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -242,10 +244,29 @@ func Test_Default_Addr(t *testing.T) {
 		defer l.Close()
 
 		laddr := l.Addr()
-		require.Equal(t, test.LocIP(), laddr.Addr())
+		require.True(t, laddr.Addr().IsUnspecified())
 		require.NotZero(t, laddr.Port())
 	})
 
+	t.Run("listen wildcard", func(t *testing.T) {
+		l, err := Listen(addr, rawsock.SetGRO(false))
+		require.NoError(t, err)
+		defer l.Close()
+
+		for _, a := range []netip.Addr{test.LocIP(), netip.AddrFrom4([4]byte{127, 0, 0, 1})} {
+			saddr := netip.AddrPortFrom(a, l.Addr().Port())
+			go func() {
+				d := net.Dialer{Timeout: time.Second}
+				d.Dial("tcp", saddr.String())
+			}()
+
+			conn, err := l.Accept()
+			require.NoError(t, err)
+			require.Equal(t, saddr, conn.LocalAddr())
+			require.NoError(t, conn.Close())
+		}
+	})
+
 	t.Run("dial", func(t *testing.T) {
 		conn, err := Connect(addr, netip.AddrPortFrom(netip.AddrFrom4([4]byte{8, 8, 8, 8}), 80))
 		require.NoError(t, err)
@@ -317,3 +338,298 @@ func Test_Complete_Check(t *testing.T) {
 		require.True(t, errors.Is(err, io.ErrShortBuffer))
 	})
 }
+
+func Test_SyscallConn(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	raw, err := Connect(caddr, saddr, rawsock.SetGRO(false))
+	require.NoError(t, err)
+	defer raw.Close()
+
+	rc, err := raw.SyscallConn()
+	require.NoError(t, err)
+
+	var prio int
+	err = rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PRIORITY, 6)
+		if err == nil {
+			prio, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PRIORITY)
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, 6, prio)
+}
+
+func Test_ListenerStats(t *testing.T) {
+	var (
+		saddr  = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		caddr1 = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		caddr2 = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	l, err := Listen(saddr, rawsock.SetGRO(false), rawsock.MaxConns(1))
+	require.NoError(t, err)
+	defer l.Close()
+
+	for _, caddr := range []netip.AddrPort{caddr1, caddr2} {
+		go func(caddr netip.AddrPort) {
+			d := net.Dialer{LocalAddr: test.TCPAddr(caddr), Timeout: time.Second * 3}
+			d.Dial("tcp", saddr.String())
+		}(caddr)
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, caddr1, conn.RemoteAddr())
+
+	go l.Accept()
+	time.Sleep(time.Second * 2) // wait SYN retransmit
+
+	stats := l.Stats()
+	require.NotZero(t, stats.OverLimit)
+	require.NotZero(t, stats.Duplicate)
+	require.Zero(t, stats.Short)
+	require.Zero(t, stats.NonSyn)
+}
+
+func Test_ListenShards(t *testing.T) {
+	var saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+
+	ls, err := ListenShards(saddr, 2, rawsock.SetGRO(false))
+	require.NoError(t, err)
+	require.Len(t, ls, 2)
+	require.Equal(t, ls[0].Addr(), ls[1].Addr())
+
+	var accepted = make(chan netip.AddrPort, 16)
+	for _, l := range ls {
+		defer l.Close()
+		go func(l *Listener) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn.RemoteAddr()
+			}
+		}(l)
+	}
+
+	const n = 8
+	for i := 0; i < n; i++ {
+		go func() {
+			d := net.Dialer{LocalAddr: test.TCPAddr(netip.AddrPortFrom(test.LocIP(), test.RandPort())), Timeout: time.Second * 3}
+			d.Dial("tcp", saddr.String())
+		}()
+	}
+
+	var remotes = map[netip.AddrPort]int{}
+	for i := 0; i < n; i++ {
+		select {
+		case raddr := <-accepted:
+			remotes[raddr]++
+		case <-time.After(time.Second * 3):
+			t.Fatal("accept timeout")
+		}
+	}
+	require.Len(t, remotes, n)
+
+	select {
+	case raddr := <-accepted:
+		t.Fatalf("duplicate accept %s", raddr)
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func Test_SynProxy(t *testing.T) {
+	var (
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	l, err := Listen(saddr, rawsock.SetGRO(false), rawsock.SynProxy())
+	require.NoError(t, err)
+	defer l.Close()
+
+	var accepted = make(chan rawsock.RawConn, 1)
+	go func() {
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+
+	// handshake completed by listener
+	tcp, err := (&net.Dialer{LocalAddr: test.TCPAddr(caddr), Timeout: time.Second * 3}).Dial("tcp", saddr.String())
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	conn := <-accepted
+	defer conn.Close()
+	require.Equal(t, caddr, conn.RemoteAddr())
+
+	var pkt = packet.Make(64, 1536)
+	require.NoError(t, conn.Read(pkt))
+	syn := header.TCP(pkt.Bytes())
+	require.Equal(t, header.TCPFlagSyn, syn.Flags())
+	isn := syn.SequenceNumber()
+
+	// app's SYN-ACK not sent
+	synack := header.TCP(make([]byte, header.TCPMinimumSize))
+	synack.Encode(&header.TCPFields{
+		SrcPort: saddr.Port(), DstPort: caddr.Port(), SeqNum: 1234, AckNum: isn + 1,
+		DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagSyn | header.TCPFlagAck, WindowSize: 1024,
+	})
+	require.NoError(t, conn.Write(packet.Make(64, 0).Append(synack...)))
+
+	require.NoError(t, conn.Read(pkt.Sets(64, 1536)))
+	ack := header.TCP(pkt.Bytes())
+	require.Equal(t, header.TCPFlagAck, ack.Flags())
+	require.Equal(t, uint32(1235), ack.AckNumber())
+	require.Equal(t, isn+1, ack.SequenceNumber())
+
+	_, err = tcp.Write([]byte("hello"))
+	require.NoError(t, err)
+	for {
+		require.NoError(t, conn.Read(pkt.Sets(64, 1536)))
+		if data := header.TCP(pkt.Bytes()); len(data.Payload()) > 0 {
+			require.Equal(t, "hello", string(data.Payload()))
+			require.Equal(t, uint32(1235), data.AckNumber())
+			break
+		}
+	}
+}
+
+func Test_PeekPayload(t *testing.T) {
+	var saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+
+	l, err := Listen(saddr, rawsock.SetGRO(false), rawsock.PeekPayload(time.Second))
+	require.NoError(t, err)
+	defer l.Close()
+
+	var accepted = make(chan rawsock.RawConn, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	t.Run("peek", func(t *testing.T) {
+		caddr := netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		tcp, err := (&net.Dialer{LocalAddr: test.TCPAddr(caddr), Timeout: time.Second * 3}).Dial("tcp", saddr.String())
+		require.NoError(t, err)
+		defer tcp.Close()
+		_, err = tcp.Write([]byte("hello"))
+		require.NoError(t, err)
+
+		conn := <-accepted
+		defer conn.Close()
+		require.Equal(t, caddr, conn.RemoteAddr())
+		require.Equal(t, "hello", string(conn.(rawsock.PeekConn).Peek()))
+
+		var pkt = packet.Make(64, 1536)
+		require.NoError(t, conn.Read(pkt))
+		syn := header.TCP(pkt.Bytes())
+		require.Equal(t, header.TCPFlagSyn, syn.Flags())
+
+		synack := header.TCP(make([]byte, header.TCPMinimumSize))
+		synack.Encode(&header.TCPFields{
+			SrcPort: saddr.Port(), DstPort: caddr.Port(), SeqNum: 1234, AckNum: syn.SequenceNumber() + 1,
+			DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagSyn | header.TCPFlagAck, WindowSize: 1024,
+		})
+		require.NoError(t, conn.Write(packet.Make(64, 0).Append(synack...)))
+
+		// first payload replayed as handshake final ACK
+		require.NoError(t, conn.Read(pkt.Sets(64, 1536)))
+		data := header.TCP(pkt.Bytes())
+		require.Equal(t, uint32(1235), data.AckNumber())
+		require.Equal(t, "hello", string(data.Payload()))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		caddr := netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		tcp, err := (&net.Dialer{LocalAddr: test.TCPAddr(caddr), Timeout: time.Second * 3}).Dial("tcp", saddr.String())
+		require.NoError(t, err)
+		defer tcp.Close()
+
+		start := time.Now()
+		conn := <-accepted
+		defer conn.Close()
+		require.Greater(t, time.Since(start), time.Millisecond*500)
+		require.Equal(t, caddr, conn.RemoteAddr())
+		require.Nil(t, conn.(rawsock.PeekConn).Peek())
+	})
+}
+
+func Test_Conntest(t *testing.T) {
+	conntest.TestConn(t, header.TCPProtocolNumber, func() (c1, c2 rawsock.RawConn, stop func(), err error) {
+		var (
+			caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+			saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		)
+		c, err := Connect(caddr, saddr, rawsock.SetGRO(false))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		s, err := Connect(saddr, caddr, rawsock.SetGRO(false))
+		if err != nil {
+			c.Close()
+			return nil, nil, nil, err
+		}
+		return c, s, func() { c.Close(); s.Close() }, nil
+	})
+}
+
+func Test_IPv6(t *testing.T) {
+	// ipv6 raw socket not recv ip header
+	var addrs = []netip.Addr{netip.IPv6Loopback()}
+	if ifis, err := net.Interfaces(); err == nil {
+	next:
+		for _, ifi := range ifis {
+			as, _ := ifi.Addrs()
+			for _, a := range as {
+				if a, ok := netip.AddrFromSlice(a.(*net.IPNet).IP); ok && a.Is6() && a.IsLinkLocalUnicast() {
+					addrs = append(addrs, a.WithZone(ifi.Name))
+					break next
+				}
+			}
+		}
+	}
+
+	for _, addr := range addrs {
+		t.Run(addr.String(), func(t *testing.T) {
+			var (
+				saddr = netip.AddrPortFrom(addr, test.RandPort())
+				caddr = netip.AddrPortFrom(addr, test.RandPort())
+			)
+			l, err := Listen(saddr, rawsock.SetGRO(false))
+			require.NoError(t, err)
+			defer l.Close()
+
+			c, err := Connect(caddr, saddr, rawsock.SetGRO(false))
+			require.NoError(t, err)
+			defer c.Close()
+
+			syn := test.BuildTCPSync(t, caddr, saddr)
+			require.NoError(t, c.Write(packet.Make().Append(syn...)))
+
+			conn, err := l.Accept()
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, saddr, conn.LocalAddr())
+			require.Equal(t, caddr, conn.RemoteAddr())
+
+			require.NoError(t, c.Write(packet.Make().Append(syn...)))
+			var pkt = packet.Make(0, 1536)
+			require.NoError(t, conn.Read(pkt))
+			require.Equal(t, []byte(syn), pkt.Bytes())
+		})
+	}
+}
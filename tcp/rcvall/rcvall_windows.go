@@ -0,0 +1,294 @@
+// Package rcvall is degraded tcp backend of windows, used when WinDivert
+// driver can't be installed. capture packets by raw socket with SIO_RCVALL,
+// only support ipv4 and Read, windows not allow send tcp data by raw socket,
+// and the packets are also seen by local tcp stack, see Capabilities.
+package rcvall
+
+import (
+	"net/netip"
+	"unsafe"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	itcp "github.com/lysShub/rawsock/tcp/internal"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Capabilities supported features of rcvall conn
+const Capabilities rawsock.Capability = 0
+
+const (
+	sioRcvall = windows.IOC_IN | windows.IOC_VENDOR | 1
+	rcvallOn  = 1
+)
+
+// open raw socket recv all ipv4 packets of the interface own laddr,
+// include outbound packets
+func open(laddr netip.Addr) (windows.Handle, error) {
+	if !laddr.Is4() {
+		return 0, errors.WithMessage(rawsock.ErrNotSupported, laddr.String())
+	}
+
+	fd, err := windows.Socket(windows.AF_INET, windows.SOCK_RAW, windows.IPPROTO_IP)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if err = windows.Bind(fd, &windows.SockaddrInet4{Addr: laddr.As4()}); err != nil {
+		windows.Closesocket(fd)
+		return 0, errors.WithStack(err)
+	}
+
+	var in, ret uint32 = rcvallOn, 0
+	if err = windows.WSAIoctl(
+		fd, sioRcvall, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)),
+		nil, 0, &ret, nil, 0,
+	); err != nil {
+		windows.Closesocket(fd)
+		return 0, errors.WithStack(err)
+	}
+	return fd, nil
+}
+
+// recv recv tcp packet from src to dst, invalid src means any
+func recv(fd windows.Handle, b []byte, src, dst netip.AddrPort) (n int, hdr int, err error) {
+	for {
+		n, _, err = windows.Recvfrom(fd, b, 0)
+		if err != nil {
+			if errors.Is(err, windows.WSAEMSGSIZE) {
+				return 0, 0, errorx.ShortBuff(-1, len(b))
+			}
+			return 0, 0, errors.WithStack(err)
+		}
+
+		if n < header.IPv4MinimumSize+header.TCPMinimumSize || header.IPVersion(b) != 4 {
+			continue
+		}
+		ip := header.IPv4(b[:n])
+		if ip.TransportProtocol() != header.TCPProtocolNumber ||
+			ip.More() || ip.FragmentOffset() != 0 ||
+			int(ip.HeaderLength()) > n-header.TCPMinimumSize {
+			continue
+		}
+		tcp := header.TCP(ip.Payload())
+		if netip.AddrFrom4(ip.DestinationAddress().As4()) != dst.Addr() ||
+			tcp.DestinationPort() != dst.Port() {
+			continue
+		} else if src.IsValid() && (netip.AddrFrom4(ip.SourceAddress().As4()) != src.Addr() ||
+			tcp.SourcePort() != src.Port()) {
+			continue
+		}
+		return n, int(ip.HeaderLength()), nil
+	}
+}
+
+type Listener struct {
+	addr netip.AddrPort
+	cfg  *rawsock.Config
+
+	tcp windows.Handle
+	raw windows.Handle
+
+	conns *itcp.Table
+	stats itcp.Stats
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+	var l = &Listener{
+		cfg:   rawsock.Options(opts...),
+		conns: itcp.NewTable(),
+	}
+
+	if laddr.Addr().IsUnspecified() {
+		laddr = netip.AddrPortFrom(rawsock.LocalAddr(), laddr.Port())
+	}
+
+	var err error
+	l.tcp, l.addr, err = bind.BindLocal(header.TCPProtocolNumber, laddr, l.cfg.UsedPort)
+	if err != nil {
+		return nil, l.close(err)
+	}
+	if l.raw, err = open(l.addr.Addr()); err != nil {
+		return nil, l.close(err)
+	}
+	return l, nil
+}
+
+func (l *Listener) close(cause error) error {
+	return l.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+
+		if l.raw != 0 {
+			errs = append(errs, errors.WithStack(windows.Closesocket(l.raw)))
+		}
+		if l.tcp != 0 {
+			errs = append(errs, errors.WithStack(windows.Close(l.tcp)))
+		}
+		return
+	})
+}
+
+func (l *Listener) Addr() netip.AddrPort { return l.addr }
+
+func (l *Listener) Accept() (rawsock.RawConn, error) {
+	var b = make([]byte, 0xffff)
+	for {
+		n, hdr, err := recv(l.raw, b, netip.AddrPort{}, l.addr)
+		if err != nil {
+			return nil, l.close(err)
+		}
+
+		ip := header.IPv4(b[:n])
+		tcp := header.TCP(b[hdr:n])
+		var id = itcp.ID{
+			Local:  l.addr,
+			Remote: netip.AddrPortFrom(netip.AddrFrom4(ip.SourceAddress().As4()), tcp.SourcePort()),
+			ISN:    tcp.SequenceNumber(),
+		}
+		if !itcp.IsSyn(tcp) {
+			l.stats.NonSyn.Add(1)
+			continue
+		}
+
+		replay, res := l.conns.Add(id, l.cfg.MaxConns, l.cfg.ReplaySYN)
+		switch res {
+		case itcp.Duplicate:
+			l.stats.Duplicate.Add(1)
+			replay.Push(tcp)
+			if l.cfg.OnDuplicateSYN != nil {
+				l.cfg.OnDuplicateSYN(id.Local, id.Remote)
+			}
+			continue
+		case itcp.OverLimit:
+			l.stats.OverLimit.Add(1)
+			continue
+		}
+		replay.Push(tcp)
+
+		conn := newConnect(id, l.deleteConn)
+		conn.replay = replay
+		if err := conn.init(); err != nil {
+			return nil, conn.close(err)
+		}
+		return conn, nil
+	}
+}
+
+func (l *Listener) deleteConn(id itcp.ID) error {
+	if l == nil {
+		return nil
+	}
+	l.conns.Close(id)
+	return nil
+}
+
+func (l *Listener) Stats() rawsock.ListenerStats { return l.stats.Load() }
+
+func (l *Listener) Close() error { return l.close(nil) }
+
+type Conn struct {
+	itcp.ID
+	replay *itcp.Replay // replay handshake SYN, if ReplaySYN
+
+	tcp windows.Handle
+	raw windows.Handle
+
+	closeFn  itcp.CloseCallback
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.CapableConn = (*Conn)(nil)
+
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+	cfg := rawsock.Options(opts...)
+
+	if laddr.Addr().IsUnspecified() {
+		table, err := rtnl.Table()
+		if err != nil {
+			return nil, err
+		}
+		entry := rtnl.Match(table, raddr.Addr())
+		if !entry.Valid() {
+			err = errors.WithMessagef(
+				windows.ERROR_NETWORK_UNREACHABLE,
+				"%s -> %s", laddr.Addr().String(), raddr.Addr().String(),
+			)
+			return nil, errors.WithStack(err)
+		}
+		laddr = netip.AddrPortFrom(entry.Addr, laddr.Port())
+	}
+
+	tcp, laddr, err := bind.BindLocal(header.TCPProtocolNumber, laddr, cfg.UsedPort)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConnect(itcp.ID{Local: laddr, Remote: raddr, ISN: 0}, nil)
+	c.tcp = tcp
+	if err := c.init(); err != nil {
+		return nil, c.close(err)
+	}
+	return c, nil
+}
+
+func newConnect(id itcp.ID, closeCall itcp.CloseCallback) *Conn {
+	return &Conn{ID: id, closeFn: closeCall}
+}
+
+func (c *Conn) init() (err error) {
+	c.raw, err = open(c.Local.Addr())
+	return err
+}
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+
+		if c.raw != 0 {
+			errs = append(errs, errors.WithStack(windows.Closesocket(c.raw)))
+		}
+		if c.tcp != 0 {
+			errs = append(errs, errors.WithStack(windows.Close(c.tcp)))
+		}
+		if c.closeFn != nil {
+			errs = append(errs, c.closeFn(c.ID))
+		}
+		return
+	})
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	if ok, err := c.replay.Pop(pkt); ok {
+		return err
+	}
+	n, hdr, err := recv(c.raw, pkt.Bytes(), c.Remote, c.Local)
+	if err != nil {
+		return err
+	}
+	pkt.SetData(n)
+	pkt.SetHead(pkt.Head() + hdr)
+	return nil
+}
+
+// Write not supported, windows not allow send tcp data by raw socket
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	return errors.WithStack(rawsock.ErrNotSupported)
+}
+
+// Inject not supported
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	return errors.WithStack(rawsock.ErrNotSupported)
+}
+
+func (c *Conn) Capabilities() rawsock.Capability { return Capabilities }
+func (c *Conn) LocalAddr() netip.AddrPort        { return c.Local }
+func (c *Conn) RemoteAddr() netip.AddrPort       { return c.Remote }
+func (c *Conn) Close() error                     { return c.close(nil) }
@@ -0,0 +1,34 @@
+package rcvall
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Connect(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(netip.AddrFrom4([4]byte{8, 8, 8, 8}), 80)
+	)
+
+	conn, err := Connect(caddr, saddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Equal(t, rawsock.Capability(0), rawsock.Capabilities(conn))
+	require.ErrorIs(t, conn.Write(packet.Make(0, 20)), rawsock.ErrNotSupported)
+	require.ErrorIs(t, conn.Inject(packet.Make(0, 20)), rawsock.ErrNotSupported)
+}
+
+func Test_IPv6(t *testing.T) {
+	_, err := Connect(
+		netip.MustParseAddrPort("[::1]:19986"),
+		netip.MustParseAddrPort("[::1]:8080"),
+	)
+	require.ErrorIs(t, err, rawsock.ErrNotSupported)
+}
@@ -8,12 +8,23 @@ import (
 
 	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/tcp/divert"
+	"github.com/lysShub/rawsock/tcp/rcvall"
 )
 
+// Listen use WinDivert backend, fallback to degraded rcvall backend if
+// WinDivert unavailable, check accepted conn by rawsock.Capabilities
 func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (rawsock.Listener, error) {
+	if !divert.Available() {
+		return rcvall.Listen(laddr, opts...)
+	}
 	return divert.Listen(laddr, opts...)
 }
 
+// Connect use WinDivert backend, fallback to degraded rcvall backend if
+// WinDivert unavailable, check conn by rawsock.Capabilities
 func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (rawsock.RawConn, error) {
+	if !divert.Available() {
+		return rcvall.Connect(laddr, raddr, opts...)
+	}
 	return divert.Connect(laddr, raddr, opts...)
 }
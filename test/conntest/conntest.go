@@ -0,0 +1,326 @@
+// Package conntest conformance tests of rawsock.RawConn and rawsock.Listener
+// implementations, like golang.org/x/net/nettest.TestConn, keep third-party
+// backends consistent with the contract documented by rawsock.RawConn.
+//
+// RawConn not support context or deadline, blocked call is canceled by Close,
+// so the suite check Close semantics instead.
+package conntest
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// MakePipe create a connected conns pair, packet written by c1 is read by c2
+// and vice versa, stop release resources, called after every sub test
+type MakePipe func() (c1, c2 rawsock.RawConn, stop func(), err error)
+
+// MakeListener create a listener, dial create a client conn that can be
+// accepted by l (such as has sent handshake SYN), stop release resources
+type MakeListener func() (l rawsock.Listener, dial func() (rawsock.RawConn, error), stop func(), err error)
+
+const (
+	head    = 64   // enough for ip header
+	mtu     = 1536 // read buffer size
+	timeout = time.Second * 5
+)
+
+// TestConn test RawConn implementation, conns transmit proto (tcp or udp) packet
+func TestConn(t *testing.T, proto tcpip.TransportProtocolNumber, mp MakePipe) {
+	for _, e := range []struct {
+		name string
+		fn   func(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn)
+	}{
+		{"BasicIO", testBasicIO},
+		{"PacketFraming", testPacketFraming},
+		{"PreserveHead", testPreserveHead},
+		{"CloseRead", testCloseRead},
+		{"CloseWrite", testCloseWrite},
+		{"Concurrency", testConcurrency},
+	} {
+		t.Run(e.name, func(t *testing.T) {
+			c1, c2, stop, err := mp()
+			require.NoError(t, err)
+			defer stop()
+			e.fn(t, proto, c1, c2)
+		})
+	}
+}
+
+// TestListener test Listener implementation
+func TestListener(t *testing.T, ml MakeListener) {
+	for _, e := range []struct {
+		name string
+		fn   func(t *testing.T, l rawsock.Listener, dial func() (rawsock.RawConn, error))
+	}{
+		{"Accept", testAccept},
+		{"CloseAccept", testCloseAccept},
+	} {
+		t.Run(e.name, func(t *testing.T) {
+			l, dial, stop, err := ml()
+			require.NoError(t, err)
+			defer stop()
+			e.fn(t, l, dial)
+		})
+	}
+}
+
+// build transport packet from conn to its remote address, payload is id
+// encoded and padded to size
+func build(proto tcpip.TransportProtocolNumber, conn rawsock.RawConn, id uint32, size int) *packet.Packet {
+	var hdr int
+	switch proto {
+	case header.TCPProtocolNumber:
+		hdr = header.TCPMinimumSize
+	case header.UDPProtocolNumber:
+		hdr = header.UDPMinimumSize
+	default:
+		panic("not support protocol")
+	}
+	size = max(size, 4)
+
+	pkt := packet.Make(head, hdr+size)
+	binary.BigEndian.PutUint32(pkt.Bytes()[hdr:], id)
+	for i := hdr + 4; i < pkt.Data(); i++ {
+		pkt.Bytes()[i] = byte(i)
+	}
+	src, dst := conn.LocalAddr().Port(), conn.RemoteAddr().Port()
+	if proto == header.TCPProtocolNumber {
+		header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+			SrcPort: src, DstPort: dst, SeqNum: id,
+			DataOffset: header.TCPMinimumSize, Flags: header.TCPFlagAck | header.TCPFlagPsh,
+			WindowSize: 1024,
+		})
+	} else {
+		header.UDP(pkt.Bytes()).Encode(&header.UDPFields{
+			SrcPort: src, DstPort: dst, Length: uint16(pkt.Data()),
+		})
+	}
+	return pkt
+}
+
+// parse check transport packet read by conn, return payload id and size
+func parse(t require.TestingT, proto tcpip.TransportProtocolNumber, conn rawsock.RawConn, pkt *packet.Packet) (id uint32, size int) {
+	var src, dst uint16
+	var payload []byte
+	switch proto {
+	case header.TCPProtocolNumber:
+		require.GreaterOrEqual(t, pkt.Data(), header.TCPMinimumSize)
+		tcp := header.TCP(pkt.Bytes())
+		src, dst, payload = tcp.SourcePort(), tcp.DestinationPort(), tcp.Payload()
+	default:
+		require.GreaterOrEqual(t, pkt.Data(), header.UDPMinimumSize)
+		udp := header.UDP(pkt.Bytes())
+		src, dst, payload = udp.SourcePort(), udp.DestinationPort(), udp.Payload()
+	}
+	require.Equal(t, conn.RemoteAddr().Port(), src, "source port")
+	require.Equal(t, conn.LocalAddr().Port(), dst, "destination port")
+	require.GreaterOrEqual(t, len(payload), 4)
+	for i := 4; i < len(payload); i++ {
+		require.Equal(t, byte(pkt.Data()-len(payload)+i), payload[i], "payload")
+	}
+	return binary.BigEndian.Uint32(payload), len(payload)
+}
+
+// read Read with timeout, the conn is closed if timeout
+func read(t require.TestingT, conn rawsock.RawConn, pkt *packet.Packet) {
+	var done = make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			conn.Close()
+		}
+	}()
+	require.NoError(t, conn.Read(pkt.Sets(head, mtu)))
+}
+
+func testBasicIO(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	require.Equal(t, c1.LocalAddr(), c2.RemoteAddr())
+	require.Equal(t, c1.RemoteAddr(), c2.LocalAddr())
+
+	var pkt = packet.Make(head, mtu)
+	for i, e := range [][2]rawsock.RawConn{{c1, c2}, {c2, c1}} {
+		require.NoError(t, e[0].Write(build(proto, e[0], uint32(i), 64)))
+
+		read(t, e[1], pkt)
+		id, size := parse(t, proto, e[1], pkt)
+		require.Equal(t, uint32(i), id)
+		require.Equal(t, 64, size)
+	}
+}
+
+func testPacketFraming(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	var sizes = []int{4, 1, 512, 17, 1024, 64, 1200, 256}
+
+	var pkt = packet.Make(head, mtu)
+	for i, size := range sizes {
+		require.NoError(t, c1.Write(build(proto, c1, uint32(i), size)))
+
+		read(t, c2, pkt)
+		id, n := parse(t, proto, c2, pkt)
+		require.Equal(t, uint32(i), id)
+		require.Equal(t, max(size, 4), n)
+	}
+}
+
+func testPreserveHead(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	// Write restore the packet head, checksum maybe updated
+	var pkt = build(proto, c1, 1, 64)
+	var n = pkt.Data()
+	require.NoError(t, c1.Write(pkt))
+	require.Equal(t, head, pkt.Head())
+	require.Equal(t, n, pkt.Data())
+
+	// Read not shrink head, the transport packet start after it
+	pkt = packet.Make(head, mtu)
+	read(t, c2, pkt)
+	require.GreaterOrEqual(t, pkt.Head(), head)
+	parse(t, proto, c2, pkt)
+}
+
+func testCloseRead(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	var rerr = make(chan error, 1)
+	go func() {
+		rerr <- c2.Read(packet.Make(head, mtu))
+	}()
+	time.Sleep(time.Millisecond * 100)
+	require.NoError(t, c2.Close())
+
+	select {
+	case err := <-rerr:
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(timeout):
+		t.Fatal("Close not unblock pending Read")
+	}
+
+	err := c2.Read(packet.Make(head, mtu))
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func testCloseWrite(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	require.NoError(t, c1.Close())
+
+	err := c1.Write(build(proto, c1, 1, 64))
+	require.ErrorIs(t, err, net.ErrClosed)
+
+	// repeat Close not panic
+	c1.Close()
+}
+
+func testConcurrency(t *testing.T, proto tcpip.TransportProtocolNumber, c1, c2 rawsock.RawConn) {
+	const (
+		writers = 4
+		readers = 4
+		packets = 64 // every writer
+	)
+
+	var (
+		mu   sync.Mutex
+		seen = map[uint32]bool{}
+		recv atomic.Int32
+		rg   sync.WaitGroup
+	)
+	for i := 0; i < readers; i++ {
+		rg.Add(1)
+		go func() {
+			defer rg.Done()
+			var pkt = packet.Make(head, mtu)
+			for {
+				if err := c2.Read(pkt.Sets(head, mtu)); err != nil {
+					require.ErrorIs(t, err, net.ErrClosed)
+					return
+				}
+				id, _ := parse(t, proto, c2, pkt)
+
+				mu.Lock()
+				require.False(t, seen[id], "packet %d read twice", id)
+				seen[id] = true
+				mu.Unlock()
+				recv.Add(1)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for j := 0; j < packets; j++ {
+				id := uint32(w*packets + j)
+				require.NoError(t, c1.Write(build(proto, c1, id, 32+int(id))))
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// packet maybe dropped by backend queue, but not all
+	for start := time.Now(); recv.Load() < writers*packets && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.NoError(t, c2.Close())
+	rg.Wait()
+	require.Greater(t, recv.Load(), int32(writers*packets/2))
+}
+
+func testAccept(t *testing.T, l rawsock.Listener, dial func() (rawsock.RawConn, error)) {
+	client, err := dial()
+	require.NoError(t, err)
+	defer client.Close()
+
+	var accepted = make(chan rawsock.RawConn, 1)
+	go func() {
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+		require.Equal(t, l.Addr(), conn.LocalAddr())
+		require.Equal(t, client.LocalAddr(), conn.RemoteAddr())
+	case <-time.After(timeout):
+		l.Close()
+		t.Fatal("Accept timeout")
+	}
+}
+
+func testCloseAccept(t *testing.T, l rawsock.Listener, dial func() (rawsock.RawConn, error)) {
+	var aerr = make(chan error, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				aerr <- err
+				return
+			}
+			conn.Close()
+		}
+	}()
+	time.Sleep(time.Millisecond * 100)
+	require.NoError(t, l.Close())
+
+	select {
+	case err := <-aerr:
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(timeout):
+		t.Fatal("Close not unblock pending Accept")
+	}
+
+	_, err := l.Accept()
+	require.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package conntest_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/test/conntest"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_MockRaw(t *testing.T) {
+	for _, proto := range []tcpip.TransportProtocolNumber{header.TCPProtocolNumber, header.UDPProtocolNumber} {
+		conntest.TestConn(t, proto, func() (c1, c2 rawsock.RawConn, stop func(), err error) {
+			var (
+				caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+				saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+			)
+			c, s := test.NewMockRaw(t, proto, caddr, saddr)
+			return c, s, func() { c.Close(); s.Close() }, nil
+		})
+	}
+}
+
+func Test_MockListener(t *testing.T) {
+	conntest.TestListener(t, func() (rawsock.Listener, func() (rawsock.RawConn, error), func(), error) {
+		var (
+			saddr   = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+			clients []rawsock.RawConn
+			servers []rawsock.RawConn
+		)
+		for i := 0; i < 4; i++ {
+			c, s := test.NewMockRaw(t, header.TCPProtocolNumber, netip.AddrPortFrom(test.RandIP(), test.RandPort()), saddr)
+			clients, servers = append(clients, c), append(servers, s)
+		}
+		l := test.NewMockListener(t, servers...)
+
+		var dial = func() (rawsock.RawConn, error) {
+			c := clients[0]
+			clients = clients[1:]
+			return c, nil
+		}
+		return l, dial, func() { l.Close() }, nil
+	})
+}
@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"os/exec"
+	"strings"
+
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// VethTuple two network namespaces connected by a veth pair
+type VethTuple struct {
+	NS1, NS2     string // netns name, use with rawsock.NetNS
+	Name1, Name2 string // veth name
+	Addr1, Addr2 netip.Addr
+}
+
+// CreateVethTuple create netns pair connected by veth, prefixs is the
+// addresses of two veth, default 10.0.3.1/24 and 10.0.3.2/24
+func CreateVethTuple(t require.TestingT, prefixs ...netip.Prefix) *VethTuple {
+	if len(prefixs) == 0 {
+		prefixs = []netip.Prefix{
+			netip.MustParsePrefix("10.0.3.1/24"),
+			netip.MustParsePrefix("10.0.3.2/24"),
+		}
+	}
+	require.Equal(t, 2, len(prefixs))
+
+	id := rand.Uint32() % 0xffff
+	var vt = &VethTuple{
+		NS1:   fmt.Sprintf("sockit%d-1", id),
+		NS2:   fmt.Sprintf("sockit%d-2", id),
+		Name1: fmt.Sprintf("veth%d-1", id),
+		Name2: fmt.Sprintf("veth%d-2", id),
+		Addr1: prefixs[0].Addr(),
+		Addr2: prefixs[1].Addr(),
+	}
+
+	var cmds = [][]string{
+		{"netns", "add", vt.NS1},
+		{"netns", "add", vt.NS2},
+		{"link", "add", vt.Name1, "type", "veth", "peer", "name", vt.Name2},
+		{"link", "set", vt.Name1, "netns", vt.NS1},
+		{"link", "set", vt.Name2, "netns", vt.NS2},
+	}
+	for _, e := range []struct {
+		ns, name string
+		prefix   netip.Prefix
+	}{
+		{vt.NS1, vt.Name1, prefixs[0]},
+		{vt.NS2, vt.Name2, prefixs[1]},
+	} {
+		addr := []string{"-n", e.ns, "addr", "add", e.prefix.String(), "dev", e.name}
+		if !e.prefix.Addr().Is4() {
+			addr = append(addr, "nodad") // skip ipv6 duplicate address detect
+		}
+		cmds = append(cmds,
+			addr,
+			[]string{"-n", e.ns, "link", "set", e.name, "up"},
+			[]string{"-n", e.ns, "link", "set", "lo", "up"},
+		)
+	}
+
+	for _, args := range cmds {
+		if err := ipcmd(args...); err != nil {
+			vt.Close()
+			require.NoError(t, err)
+		}
+	}
+	return vt
+}
+
+func ipcmd(args ...string) error {
+	cmd := exec.Command("ip", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Errorf(`exec "%s", error: %s, message: %s`, cmd.String(), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Do call fn inside netns ns
+func (v *VethTuple) Do(ns string, fn func() error) error {
+	return netns.Do(netns.Path(ns), fn)
+}
+
+func (v *VethTuple) Close() error {
+	// delete netns also delete veth
+	var err error
+	for _, ns := range []string{v.NS1, v.NS2} {
+		if e := ipcmd("netns", "del", ns); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package test_test
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Create_Veth(t *testing.T) {
+	vt := test.CreateVethTuple(t)
+	defer vt.Close()
+
+	var (
+		saddr = netip.AddrPortFrom(vt.Addr1, test.RandPort())
+		caddr = netip.AddrPortFrom(vt.Addr2, test.RandPort())
+	)
+
+	var l *net.TCPListener
+	err := vt.Do(vt.NS1, func() (err error) {
+		l, err = net.ListenTCP("tcp", test.TCPAddr(saddr))
+		return err
+	})
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.AcceptTCP()
+		require.NoError(t, err)
+		io.Copy(conn, conn)
+	}()
+
+	var conn *net.TCPConn
+	err = vt.Do(vt.NS2, func() (err error) {
+		conn, err = net.DialTCP("tcp", test.TCPAddr(caddr), test.TCPAddr(saddr))
+		return err
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello world"))
+	require.NoError(t, err)
+
+	var b = make([]byte, 64)
+	n, err := conn.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(b[:n]))
+}
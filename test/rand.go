@@ -0,0 +1,210 @@
+package test
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net/netip"
+
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// maybe not valid ip
+func RandIP6() netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:], rand.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	b[0] = 0x20 // avoid ipv4-mapped and special prefix
+	return netip.AddrFrom16(b)
+}
+
+func RandPayload(max int) []byte {
+	b := make([]byte, rand.Intn(max+1))
+	rand.Read(b)
+	return b
+}
+
+// RandTCP build ip packet with random tcp header and payload
+func RandTCP(t require.TestingT, src, dst netip.AddrPort, exts ...header.IPv6ExtensionHeaderIdentifier) []byte {
+	payload := RandPayload(512)
+	tcp := header.TCP(make([]byte, header.TCPMinimumSize+len(payload)))
+	tcp.Encode(&header.TCPFields{
+		SrcPort:    src.Port(),
+		DstPort:    dst.Port(),
+		SeqNum:     rand.Uint32(),
+		AckNum:     rand.Uint32(),
+		DataOffset: header.TCPMinimumSize,
+		Flags:      header.TCPFlags(rand.Intn(0x40)),
+		WindowSize: uint16(rand.Uint32()),
+	})
+	copy(tcp.Payload(), payload)
+	tcp.SetChecksum(^checksum.Checksum(tcp, pseudoSum(header.TCPProtocolNumber, src.Addr(), dst.Addr(), len(tcp))))
+
+	return BuildIP(t, src.Addr(), dst.Addr(), header.TCPProtocolNumber, tcp, exts...)
+}
+
+// RandUDP build ip packet with random udp payload
+func RandUDP(t require.TestingT, src, dst netip.AddrPort, exts ...header.IPv6ExtensionHeaderIdentifier) []byte {
+	payload := RandPayload(512)
+	udp := header.UDP(make([]byte, header.UDPMinimumSize+len(payload)))
+	udp.Encode(&header.UDPFields{
+		SrcPort: src.Port(),
+		DstPort: dst.Port(),
+		Length:  uint16(len(udp)),
+	})
+	copy(udp.Payload(), payload)
+	udp.SetChecksum(^checksum.Checksum(udp, pseudoSum(header.UDPProtocolNumber, src.Addr(), dst.Addr(), len(udp))))
+
+	return BuildIP(t, src.Addr(), dst.Addr(), header.UDPProtocolNumber, udp, exts...)
+}
+
+// RandICMP build ip packet with random echo request, ICMPv4 or ICMPv6 decided by address
+func RandICMP(t require.TestingT, src, dst netip.Addr, exts ...header.IPv6ExtensionHeaderIdentifier) []byte {
+	payload := RandPayload(512)
+	if src.Is4() {
+		icmp := header.ICMPv4(make([]byte, header.ICMPv4MinimumSize+len(payload)))
+		icmp.SetType(header.ICMPv4Echo)
+		icmp.SetIdent(uint16(rand.Uint32()))
+		icmp.SetSequence(uint16(rand.Uint32()))
+		copy(icmp.Payload(), payload)
+		icmp.SetChecksum(^checksum.Checksum(icmp, 0))
+		return BuildIP(t, src, dst, header.ICMPv4ProtocolNumber, icmp, exts...)
+	} else {
+		icmp := header.ICMPv6(make([]byte, header.ICMPv6MinimumSize+len(payload)))
+		icmp.SetType(header.ICMPv6EchoRequest)
+		icmp.SetIdent(uint16(rand.Uint32()))
+		icmp.SetSequence(uint16(rand.Uint32()))
+		copy(icmp.Payload(), payload)
+		icmp.SetChecksum(^checksum.Checksum(icmp, pseudoSum(header.ICMPv6ProtocolNumber, src, dst, len(icmp))))
+		return BuildIP(t, src, dst, header.ICMPv6ProtocolNumber, icmp, exts...)
+	}
+}
+
+// BuildIP build ip packet, transport's checksum should be calculated. ipv6 packet can
+// carry empty hop-by-hop/destination-options extension headers in exts order.
+func BuildIP(
+	t require.TestingT, src, dst netip.Addr,
+	proto tcpip.TransportProtocolNumber, transport []byte,
+	exts ...header.IPv6ExtensionHeaderIdentifier,
+) []byte {
+	require.Equal(t, src.Is4(), dst.Is4())
+
+	if src.Is4() {
+		require.Zero(t, len(exts))
+
+		ip := header.IPv4(make([]byte, header.IPv4MinimumSize+len(transport)))
+		ip.Encode(&header.IPv4Fields{
+			TotalLength: uint16(len(ip)),
+			ID:          uint16(rand.Uint32()),
+			TTL:         64,
+			Protocol:    uint8(proto),
+			SrcAddr:     tcpip.AddrFrom4(src.As4()),
+			DstAddr:     tcpip.AddrFrom4(dst.As4()),
+		})
+		ip.SetChecksum(^ip.CalculateChecksum())
+		copy(ip.Payload(), transport)
+		return ip
+	}
+
+	const extLen = 8
+	n := header.IPv6MinimumSize + len(exts)*extLen
+	ip := header.IPv6(make([]byte, n+len(transport)))
+
+	next := proto
+	if len(exts) > 0 {
+		next = tcpip.TransportProtocolNumber(exts[0])
+	}
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(len(ip) - header.IPv6MinimumSize),
+		TransportProtocol: next,
+		HopLimit:          64,
+		SrcAddr:           tcpip.AddrFrom16(src.As16()),
+		DstAddr:           tcpip.AddrFrom16(dst.As16()),
+	})
+	for i, e := range exts {
+		require.Contains(t, []header.IPv6ExtensionHeaderIdentifier{
+			header.IPv6HopByHopOptionsExtHdrIdentifier,
+			header.IPv6DestinationOptionsExtHdrIdentifier,
+		}, e)
+
+		hdr := ip[header.IPv6MinimumSize+i*extLen:]
+		if i+1 < len(exts) {
+			hdr[0] = uint8(exts[i+1])
+		} else {
+			hdr[0] = uint8(proto)
+		}
+		hdr[1] = 0 // (0+1)*8 bytes
+		// PadN option fill remain 6 bytes
+		hdr[2], hdr[3] = 1, 4
+	}
+	copy(ip[n:], transport)
+	return ip
+}
+
+// Fragment split ip packet to fragments, every fragment not exceed mtu. ipv6 packet
+// should not carry hop-by-hop extension header.
+func Fragment(t require.TestingT, ip []byte, mtu int) (frags [][]byte) {
+	switch header.IPVersion(ip) {
+	case 4:
+		hdr := header.IPv4(ip)
+		require.False(t, hdr.Flags()&header.IPv4FlagDontFragment != 0)
+		hdrLen := int(hdr.HeaderLength())
+		payload := hdr.Payload()
+		size := (mtu - hdrLen) &^ 7
+		require.Greater(t, size, 0)
+
+		for off := 0; off < len(payload); off += size {
+			n := min(size, len(payload)-off)
+			frag := header.IPv4(make([]byte, hdrLen+n))
+			copy(frag, hdr[:hdrLen])
+			copy(frag[hdrLen:], payload[off:off+n])
+
+			var flags uint8
+			if off+n < len(payload) {
+				flags = header.IPv4FlagMoreFragments
+			}
+			frag.SetFlagsFragmentOffset(flags, uint16(off))
+			frag.SetTotalLength(uint16(len(frag)))
+			frag.SetChecksum(0)
+			frag.SetChecksum(^frag.CalculateChecksum())
+			frags = append(frags, frag)
+		}
+	case 6:
+		hdr := header.IPv6(ip)
+		require.NotEqual(t, header.IPv6HopByHopOptionsExtHdrIdentifier, hdr.NextHeader())
+		payload := hdr.Payload()
+		const fragLen = header.IPv6FragmentExtHdrLength
+		size := (mtu - header.IPv6MinimumSize - fragLen) &^ 7
+		require.Greater(t, size, 0)
+
+		id := rand.Uint32()
+		for off := 0; off < len(payload); off += size {
+			n := min(size, len(payload)-off)
+			frag := header.IPv6(make([]byte, header.IPv6MinimumSize+fragLen+n))
+			copy(frag, hdr[:header.IPv6MinimumSize])
+			frag.SetNextHeader(uint8(header.IPv6FragmentExtHdrIdentifier))
+			frag.SetPayloadLength(uint16(fragLen + n))
+
+			ext := frag[header.IPv6MinimumSize:]
+			ext[0] = hdr.NextHeader()
+			ext[1] = 0
+			var more uint16
+			if off+n < len(payload) {
+				more = 1
+			}
+			binary.BigEndian.PutUint16(ext[2:], uint16(off)|more)
+			binary.BigEndian.PutUint32(ext[4:], id)
+			copy(ext[fragLen:], payload[off:off+n])
+			frags = append(frags, frag)
+		}
+	default:
+		require.FailNow(t, "invalid ip version")
+	}
+	return frags
+}
+
+func pseudoSum(proto tcpip.TransportProtocolNumber, src, dst netip.Addr, n int) uint16 {
+	return header.PseudoHeaderChecksum(proto, Address(src), Address(dst), uint16(n))
+}
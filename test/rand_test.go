@@ -0,0 +1,64 @@
+package test_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Rand_Packets(t *testing.T) {
+	var (
+		hop  = header.IPv6HopByHopOptionsExtHdrIdentifier
+		dopt = header.IPv6DestinationOptionsExtHdrIdentifier
+	)
+
+	for i := 0; i < 64; i++ {
+		var (
+			src4 = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+			dst4 = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+			src6 = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+			dst6 = netip.AddrPortFrom(test.RandIP6(), test.RandPort())
+		)
+
+		test.ValidIP(t, test.RandTCP(t, src4, dst4))
+		test.ValidIP(t, test.RandUDP(t, src4, dst4))
+		test.ValidIP(t, test.RandICMP(t, src4.Addr(), dst4.Addr()))
+
+		test.ValidIP(t, test.RandTCP(t, src6, dst6))
+		test.ValidIP(t, test.RandUDP(t, src6, dst6, hop))
+		test.ValidIP(t, test.RandICMP(t, src6.Addr(), dst6.Addr(), hop, dopt))
+	}
+}
+
+func Test_Fragment(t *testing.T) {
+	for _, ip := range [][]byte{
+		test.RandUDP(t,
+			netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+			netip.AddrPortFrom(test.RandIP(), test.RandPort()),
+		),
+		test.RandUDP(t,
+			netip.AddrPortFrom(test.RandIP6(), test.RandPort()),
+			netip.AddrPortFrom(test.RandIP6(), test.RandPort()),
+			header.IPv6DestinationOptionsExtHdrIdentifier,
+		),
+	} {
+		const mtu = 128
+		frags := test.Fragment(t, ip, mtu)
+
+		var payload []byte
+		for _, e := range frags {
+			require.LessOrEqual(t, len(e), mtu)
+			test.ValidIP(t, e)
+
+			if header.IPVersion(e) == 4 {
+				payload = append(payload, header.IPv4(e).Payload()...)
+			} else {
+				payload = append(payload, header.IPv6(e).Payload()[header.IPv6FragmentExtHdrLength:]...)
+			}
+		}
+		require.Equal(t, test.StripIP(ip), payload)
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/lysShub/netkit/packet"
 	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/check"
 	"github.com/lysShub/rawsock/helper/ipstack"
 	"github.com/stretchr/testify/require"
 	"gvisor.dev/gvisor/pkg/buffer"
@@ -114,53 +115,27 @@ func BuildTCPSync(t require.TestingT, laddr, raddr netip.AddrPort) header.TCP {
 	return b
 }
 
+// ValidIP valid ip packet and it's transport checksum, the ipv6 extension headers
+// are skipped, and transport of fragment packet is not validated.
 func ValidIP(t require.TestingT, ip []byte) {
-	var iphdr header.Network
-	var totalLen int
-	switch header.IPVersion(ip) {
-	case 4:
-		ip := header.IPv4(ip)
-		require.True(t, ip.IsChecksumValid())
-		iphdr = ip
-		totalLen = int(ip.TotalLength())
-	case 6:
-		iphdr = header.IPv6(ip)
-		totalLen = int(header.IPv6(ip).PayloadLength()) + header.IPv6MinimumSize
-	default:
-		panic(hex.Dump(ip))
+	r, err := check.Packet(ip)
+	require.NoError(t, err, hex.Dump(ip))
+	if r.Fragment {
+		return
 	}
-	require.Equal(t, totalLen, len(ip))
-
-	pseudoSum1 := header.PseudoHeaderChecksum(
-		iphdr.TransportProtocol(),
-		iphdr.SourceAddress(),
-		iphdr.DestinationAddress(),
-		0,
-	)
-
-	switch iphdr.TransportProtocol() {
-	case header.TCPProtocolNumber:
-		ValidTCP(t, iphdr.Payload(), pseudoSum1)
-	case header.UDPProtocolNumber:
-		ValidUDP(t, iphdr.Payload(), pseudoSum1)
-	case header.ICMPv4ProtocolNumber:
-		icmp := header.ICMPv4(iphdr.Payload())
-		sum := checksum.Checksum(icmp, 0)
-		require.Equal(t, uint16(0xffff), sum)
+	switch r.Proto {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber,
+		header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
 	default:
-		panic(iphdr.TransportProtocol())
+		panic(r.Proto)
 	}
 }
 
 func ValidTCP(t require.TestingT, tcp header.TCP, pseudoSum1 uint16) {
-	psum := checksum.Combine(pseudoSum1, uint16(len(tcp)))
-	sum := checksum.Checksum(tcp, psum)
-	require.Equal(t, uint16(0xffff), sum)
+	require.NoError(t, check.Transport(header.TCPProtocolNumber, tcp, pseudoSum1))
 }
 func ValidUDP(t require.TestingT, udp header.UDP, pseudoSum1 uint16) {
-	psum := checksum.Combine(pseudoSum1, uint16(len(udp)))
-	sum := checksum.Checksum(udp, psum)
-	require.Equal(t, uint16(0xffff), sum)
+	require.NoError(t, check.Transport(header.UDPProtocolNumber, udp, pseudoSum1))
 }
 
 func BuildRawTCP(t require.TestingT, laddr, raddr netip.AddrPort, payload []byte) header.IPv4 {
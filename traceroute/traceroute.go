@@ -0,0 +1,423 @@
+// Package traceroute discover hops to destination by TCP SYN, UDP or ICMP
+// echo probes with increasing TTL, and collect ICMP time exceeded errors.
+package traceroute
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Mode uint8
+
+const (
+	ICMP Mode = iota // ICMP echo request
+	UDP              // UDP to high port, destination reply port unreachable
+	TCP              // TCP SYN, destination reply SYN-ACK or RST
+)
+
+type Config struct {
+	Mode    Mode
+	Port    uint16 // UDP base port or TCP destination port
+	MaxHops int
+	Probes  int           // probes per hop
+	Timeout time.Duration // wait reply of every probe
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Mode:    ICMP,
+		Port:    33434,
+		MaxHops: 30,
+		Probes:  3,
+		Timeout: time.Second,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Probe probe mode and port, port is base port for UDP, default 33434,
+// destination port for TCP, such as 80
+func Probe(mode Mode, port uint16) Option {
+	return func(c *Config) {
+		c.Mode, c.Port = mode, port
+	}
+}
+
+// MaxHops max TTL, default 30
+func MaxHops(n int) Option {
+	return func(c *Config) {
+		c.MaxHops = min(max(n, 1), 255)
+	}
+}
+
+// Probes probes of every hop, default 3
+func Probes(n int) Option {
+	return func(c *Config) {
+		c.Probes = max(n, 1)
+	}
+}
+
+// Timeout wait reply of every probe, default 1s
+func Timeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+type Hop struct {
+	TTL     int
+	Addr    netip.Addr      // invalid if all probes timeout
+	RTTs    []time.Duration // -1 means probe timeout
+	Reached bool            // reply from destination
+}
+
+// Trace send probes with increasing TTL until destination reached or
+// MaxHops, require privilege of raw socket.
+func Trace(ctx context.Context, dst netip.Addr, opts ...Option) ([]Hop, error) {
+	t, err := newTracer(dst, Options(opts...))
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	var hops []Hop
+	for ttl := 1; ttl <= t.cfg.MaxHops; ttl++ {
+		var hop = Hop{TTL: ttl}
+		for i := 0; i < t.cfg.Probes; i++ {
+			r, err := t.probe(ctx, ttl)
+			if err != nil {
+				return hops, err
+			}
+			if r.from.IsValid() {
+				hop.Addr, hop.Reached = r.from, hop.Reached || r.reached
+				hop.RTTs = append(hop.RTTs, r.rtt)
+			} else {
+				hop.RTTs = append(hop.RTTs, -1)
+			}
+		}
+		hops = append(hops, hop)
+		if hop.Reached {
+			break
+		}
+	}
+	return hops, nil
+}
+
+type tracer struct {
+	cfg      *Config
+	src, dst netip.Addr
+
+	icmp *icmp.PacketConn // recv ICMP error, send echo if ICMP mode
+	conn net.PacketConn   // send UDP/TCP probes, recv TCP reply
+
+	id      uint16 // ICMP ident or TCP/UDP source port
+	seq     uint32 // TCP isn
+	next    uint16 // next probe id
+	replies chan reply
+}
+
+type reply struct {
+	id      uint16
+	from    netip.Addr
+	reached bool
+	rtt     time.Duration
+}
+
+func newTracer(dst netip.Addr, cfg *Config) (*tracer, error) {
+	src, err := helper.DefaultLocal(netip.IPv4Unspecified(), dst)
+	if dst.Is6() {
+		src, err = helper.DefaultLocal(netip.IPv6Unspecified(), dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t = &tracer{
+		cfg:     cfg,
+		src:     src,
+		dst:     dst,
+		id:      uint16(rand.Intn(16384) + 49152),
+		seq:     rand.Uint32(),
+		replies: make(chan reply, 16),
+	}
+
+	network := "ip4:icmp"
+	if dst.Is6() {
+		network = "ip6:ipv6-icmp"
+	}
+	if t.icmp, err = icmp.ListenPacket(network, src.String()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	go t.recvICMP()
+
+	switch cfg.Mode {
+	case ICMP:
+	case UDP, TCP:
+		network = "ip4:"
+		if dst.Is6() {
+			network = "ip6:"
+		}
+		if cfg.Mode == UDP {
+			network += "udp"
+		} else {
+			network += "tcp"
+		}
+		if t.conn, err = net.ListenPacket(network, src.String()); err != nil {
+			t.close()
+			return nil, errors.WithStack(err)
+		}
+		if cfg.Mode == TCP {
+			go t.recvTCP()
+		}
+	default:
+		t.close()
+		return nil, errors.Errorf("not support probe mode %d", cfg.Mode)
+	}
+	return t, nil
+}
+
+func (t *tracer) probe(ctx context.Context, ttl int) (reply, error) {
+	conn := t.conn
+	if conn == nil {
+		conn = t.icmp
+	}
+	var err error
+	switch {
+	case t.conn == nil && t.dst.Is4():
+		err = t.icmp.IPv4PacketConn().SetTTL(ttl)
+	case t.conn == nil:
+		err = t.icmp.IPv6PacketConn().SetHopLimit(ttl)
+	case t.dst.Is4():
+		err = ipv4.NewPacketConn(conn).SetTTL(ttl)
+	default:
+		err = ipv6.NewPacketConn(conn).SetHopLimit(ttl)
+	}
+	if err != nil {
+		return reply{}, errors.WithStack(err)
+	}
+
+	id := t.next
+	t.next++
+	start := time.Now()
+	if _, err = conn.WriteTo(t.build(id), &net.IPAddr{IP: t.dst.AsSlice()}); err != nil {
+		return reply{}, errors.WithStack(err)
+	}
+
+	timer := time.NewTimer(t.cfg.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-t.replies:
+			if r.id != id {
+				continue // late reply of previous probe
+			}
+			r.rtt = time.Since(start)
+			return r, nil
+		case <-timer.C:
+			return reply{}, nil
+		case <-ctx.Done():
+			return reply{}, ctx.Err()
+		}
+	}
+}
+
+// build probe packet, id can be recovered from the original datagram field
+// (ip header + 8 bytes) of ICMP error
+func (t *tracer) build(id uint16) []byte {
+	switch t.cfg.Mode {
+	case UDP:
+		var b = make([]byte, header.UDPMinimumSize)
+		header.UDP(b).Encode(&header.UDPFields{
+			SrcPort: t.id,
+			DstPort: t.cfg.Port + id,
+		})
+		ipstack.Checksum(header.UDPProtocolNumber, b, t.pseudoSum(header.UDPProtocolNumber))
+		return b
+	case TCP:
+		var b = make([]byte, header.TCPMinimumSize)
+		header.TCP(b).Encode(&header.TCPFields{
+			SrcPort:    t.id,
+			DstPort:    t.cfg.Port,
+			SeqNum:     t.seq + uint32(id),
+			DataOffset: header.TCPMinimumSize,
+			Flags:      header.TCPFlagSyn,
+			WindowSize: 0xffff,
+		})
+		ipstack.Checksum(header.TCPProtocolNumber, b, t.pseudoSum(header.TCPProtocolNumber))
+		return b
+	default:
+		var typ icmp.Type = ipv4.ICMPTypeEcho
+		if t.dst.Is6() {
+			typ = ipv6.ICMPTypeEchoRequest
+		}
+		// ICMPv6 checksum calculated by kernel
+		b, _ := (&icmp.Message{
+			Type: typ,
+			Body: &icmp.Echo{ID: int(t.id), Seq: int(id)},
+		}).Marshal(nil)
+		return b
+	}
+}
+
+func (t *tracer) pseudoSum(proto tcpip.TransportProtocolNumber) uint16 {
+	return header.PseudoHeaderChecksum(
+		proto,
+		tcpip.AddrFromSlice(t.src.AsSlice()), tcpip.AddrFromSlice(t.dst.AsSlice()),
+		0,
+	)
+}
+
+func (t *tracer) recvICMP() {
+	var b = make([]byte, 1500)
+	for {
+		n, from, err := t.icmp.ReadFrom(b)
+		if err != nil {
+			return // closed
+		}
+		addr, _ := netip.AddrFromSlice(from.(*net.IPAddr).IP)
+		if r, ok := t.parseICMP(b[:n]); ok {
+			r.from = addr.Unmap()
+			t.deliver(r)
+		}
+	}
+}
+
+func (t *tracer) parseICMP(b []byte) (reply, bool) {
+	proto := 1 // ICMPv4
+	if t.dst.Is6() {
+		proto = 58
+	}
+	msg, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return reply{}, false
+	}
+
+	var (
+		data    []byte
+		reached bool
+	)
+	switch body := msg.Body.(type) {
+	case *icmp.TimeExceeded:
+		data = body.Data
+	case *icmp.DstUnreach:
+		data, reached = body.Data, true
+	case *icmp.Echo:
+		ok := t.cfg.Mode == ICMP && body.ID == int(t.id) &&
+			(msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply)
+		return reply{id: uint16(body.Seq), reached: true}, ok
+	default:
+		return reply{}, false
+	}
+
+	// original datagram: ip header + at least 8 bytes
+	var (
+		inner     []byte
+		innerDst  netip.Addr
+		innerProt uint8
+	)
+	if t.dst.Is4() {
+		if len(data) < header.IPv4MinimumSize {
+			return reply{}, false
+		}
+		iphdr := header.IPv4(data)
+		if int(iphdr.HeaderLength()) > len(data) {
+			return reply{}, false
+		}
+		inner, innerProt = data[iphdr.HeaderLength():], iphdr.Protocol()
+		innerDst = netip.AddrFrom4(iphdr.DestinationAddress().As4())
+	} else {
+		if len(data) < header.IPv6MinimumSize {
+			return reply{}, false
+		}
+		iphdr := header.IPv6(data)
+		inner, innerProt = data[header.IPv6MinimumSize:], uint8(iphdr.TransportProtocol())
+		innerDst = netip.AddrFrom16(iphdr.DestinationAddress().As16())
+	}
+	if len(inner) < 8 || innerDst != t.dst {
+		return reply{}, false
+	}
+
+	switch t.cfg.Mode {
+	case UDP:
+		udp := header.UDP(inner)
+		if innerProt != uint8(header.UDPProtocolNumber) || udp.SourcePort() != t.id {
+			return reply{}, false
+		}
+		return reply{id: udp.DestinationPort() - t.cfg.Port, reached: reached}, true
+	case TCP:
+		tcp := header.TCP(inner)
+		if innerProt != uint8(header.TCPProtocolNumber) || tcp.SourcePort() != t.id {
+			return reply{}, false
+		}
+		return reply{id: uint16(tcp.SequenceNumber() - t.seq), reached: reached}, true
+	default:
+		if innerProt != uint8(header.ICMPv4ProtocolNumber) && innerProt != uint8(header.ICMPv6ProtocolNumber) {
+			return reply{}, false
+		}
+		echo := header.ICMPv4(inner) // ident and sequence same offset in ICMPv6
+		if echo.Ident() != t.id {
+			return reply{}, false
+		}
+		return reply{id: echo.Sequence(), reached: reached}, true
+	}
+}
+
+// recvTCP recv SYN-ACK or RST reply from destination
+func (t *tracer) recvTCP() {
+	var b = make([]byte, 1500)
+	for {
+		n, from, err := t.conn.ReadFrom(b)
+		if err != nil {
+			return // closed
+		} else if n < header.TCPMinimumSize {
+			continue
+		}
+		addr, _ := netip.AddrFromSlice(from.(*net.IPAddr).IP)
+		if addr.Unmap() != t.dst {
+			continue
+		}
+
+		tcp := header.TCP(b[:n])
+		if tcp.SourcePort() != t.cfg.Port || tcp.DestinationPort() != t.id ||
+			tcp.Flags()&header.TCPFlagAck == 0 {
+			continue
+		}
+		t.deliver(reply{
+			id:      uint16(tcp.AckNumber() - 1 - t.seq),
+			from:    t.dst,
+			reached: true,
+		})
+	}
+}
+
+func (t *tracer) deliver(r reply) {
+	select {
+	case t.replies <- r:
+	default:
+	}
+}
+
+func (t *tracer) close() {
+	if t.icmp != nil {
+		t.icmp.Close()
+	}
+	if t.conn != nil {
+		t.conn.Close()
+	}
+}
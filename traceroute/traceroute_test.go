@@ -0,0 +1,38 @@
+package traceroute_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/lysShub/rawsock/traceroute"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Trace_Loopback(t *testing.T) {
+	var dst = netip.MustParseAddr("127.0.0.1")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+
+	for name, opt := range map[string]traceroute.Option{
+		"icmp": traceroute.Probe(traceroute.ICMP, 0),
+		"udp":  traceroute.Probe(traceroute.UDP, 33434),
+		"tcp":  traceroute.Probe(traceroute.TCP, port),
+	} {
+		t.Run(name, func(t *testing.T) {
+			hops, err := traceroute.Trace(context.Background(), dst, opt, traceroute.Probes(2))
+			require.NoError(t, err)
+			require.Len(t, hops, 1)
+			require.True(t, hops[0].Reached)
+			require.Equal(t, dst, hops[0].Addr)
+			require.Len(t, hops[0].RTTs, 2)
+			for _, rtt := range hops[0].RTTs {
+				require.Positive(t, rtt)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+// Package tun adapt a tun device (such as fd of android VpnService, apple utun) as
+// RawConns, every tcp/udp flow from local apps is accepted as a RawConn,
+// Read get transport packet sent by the app, Write send transport packet
+// to the app, so user-space stack can terminate the flow on behalf of
+// the remote address.
+package tun
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/internal/assert"
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Config struct {
+	MTU int
+
+	// every packet has 4 bytes packet information prefix (flags, ether
+	// type), linux tun device opened without IFF_NO_PI. android VpnService
+	// fd not has it
+	PacketInfo bool
+
+	// every packet has 4 bytes protocol family prefix (big endian AF_INET
+	// or AF_INET6 of darwin), apple utun device
+	Family bool
+
+	// Accept queue size, and Read queue size of every conn
+	Queue int
+
+	// validate ip packet written to device, called with invalid packet
+	Validate func(ip []byte, err error)
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		MTU:   1500,
+		Queue: 64,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MTU mtu of tun device, should same as VpnService.Builder.setMtu, default 1500
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = mtu
+	}
+}
+
+// PacketInfo tun device packet with 4 bytes packet information prefix
+func PacketInfo() Option {
+	return func(c *Config) {
+		c.PacketInfo = true
+	}
+}
+
+// Family tun device packet with 4 bytes protocol family prefix, such as utun
+func Family() Option {
+	return func(c *Config) {
+		c.Family = true
+	}
+}
+
+// Queue accept and read queue size, default 64, packet is dropped if full
+func Queue(n int) Option {
+	return func(c *Config) {
+		c.Queue = max(n, 1)
+	}
+}
+
+// Validate check every ip packet written to device without debug build,
+// see rawsock.Validate
+func Validate(fn func(ip []byte, err error)) Option {
+	return func(c *Config) {
+		c.Validate = fn
+	}
+}
+
+const piSize = 4
+
+// protocol family of darwin
+const (
+	afInet  = 2
+	afInet6 = 30
+)
+
+type Stats struct {
+	Invalid  uint64 // not ipv4/ipv6 tcp/udp packet, or truncated
+	NonSyn   uint64 // not accepted tcp flow without SYN
+	Overflow uint64 // dropped for queue full
+}
+
+type flowID struct {
+	proto    tcpip.TransportProtocolNumber
+	src, dst netip.AddrPort
+}
+
+type Device struct {
+	rw   io.ReadWriteCloser
+	cfg  *Config
+	bufs *bufpool.Pool // queued packet buffers
+
+	mu     sync.RWMutex
+	conns  map[flowID]*Conn
+	accept chan *Conn
+	err    error // valid after done closed
+
+	invalid, nonSyn, overflow atomic.Uint64
+
+	done     chan struct{} // recvService exited
+	closeErr errorx.CloseErr
+}
+
+// New wrap tun device, rw read/write one ip packet every call, Close
+// should unblock pending Read
+func New(rw io.ReadWriteCloser, opts ...Option) *Device {
+	var d = &Device{
+		rw:    rw,
+		cfg:   Options(opts...),
+		conns: map[flowID]*Conn{},
+		done:  make(chan struct{}),
+	}
+	d.accept = make(chan *Conn, d.cfg.Queue)
+	d.bufs = bufpool.New(0, d.cfg.MTU, d.cfg.Queue)
+	go d.recvService()
+	return d
+}
+
+func (d *Device) recvService() {
+	var (
+		b   = make([]byte, d.cfg.MTU+piSize)
+		n   int
+		err error
+	)
+	defer func() {
+		d.mu.Lock()
+		d.err = err
+		close(d.done)
+		d.mu.Unlock()
+	}()
+
+	for {
+		if n, err = d.rw.Read(b); err != nil {
+			if errorx.Temporary(err) {
+				continue
+			} else if errors.Is(err, os.ErrClosed) {
+				err = errors.WithStack(net.ErrClosed)
+			}
+			return
+		}
+		ip := b[:n]
+		if d.cfg.PacketInfo || d.cfg.Family {
+			if len(ip) < piSize {
+				d.invalid.Add(1)
+				continue
+			}
+			ip = ip[piSize:]
+		}
+
+		id, transport, ok := parse(ip)
+		if !ok {
+			d.invalid.Add(1)
+			continue
+		}
+		d.deliver(id, transport)
+	}
+}
+
+// parse ip packet, trim link padding by ip length, only support tcp/udp
+// without ipv6 extension headers
+func parse(ip []byte) (id flowID, transport []byte, ok bool) {
+	var src, dst netip.Addr
+	switch header.IPVersion(ip) {
+	case 4:
+		if len(ip) < header.IPv4MinimumSize {
+			return id, nil, false
+		}
+		hdr := header.IPv4(ip)
+		n, hdrLen := int(hdr.TotalLength()), int(hdr.HeaderLength())
+		if n > len(ip) || hdrLen < header.IPv4MinimumSize || hdrLen > n ||
+			hdr.More() || hdr.FragmentOffset() != 0 {
+			return id, nil, false
+		}
+		src, dst = netip.AddrFrom4(hdr.SourceAddress().As4()), netip.AddrFrom4(hdr.DestinationAddress().As4())
+		id.proto, transport = hdr.TransportProtocol(), ip[hdrLen:n]
+	case 6:
+		if len(ip) < header.IPv6MinimumSize {
+			return id, nil, false
+		}
+		hdr := header.IPv6(ip)
+		n := int(hdr.PayloadLength()) + header.IPv6MinimumSize
+		if n > len(ip) {
+			return id, nil, false
+		}
+		src, dst = netip.AddrFrom16(hdr.SourceAddress().As16()), netip.AddrFrom16(hdr.DestinationAddress().As16())
+		id.proto, transport = hdr.TransportProtocol(), ip[header.IPv6MinimumSize:n]
+	default:
+		return id, nil, false
+	}
+
+	switch id.proto {
+	case header.TCPProtocolNumber:
+		if len(transport) < header.TCPMinimumSize {
+			return id, nil, false
+		}
+	case header.UDPProtocolNumber:
+		if len(transport) < header.UDPMinimumSize {
+			return id, nil, false
+		}
+	default:
+		return id, nil, false
+	}
+	id.src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(transport[0:]))
+	id.dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(transport[2:]))
+	return id, transport, true
+}
+
+func (d *Device) deliver(id flowID, transport []byte) {
+	d.mu.RLock()
+	c, has := d.conns[id]
+	d.mu.RUnlock()
+
+	if !has {
+		if id.proto == header.TCPProtocolNumber {
+			flags := header.TCP(transport).Flags()
+			if !flags.Contains(header.TCPFlagSyn) || flags.Contains(header.TCPFlagAck) {
+				d.nonSyn.Add(1)
+				return
+			}
+		}
+
+		var err error
+		if c, err = d.newConn(id); err != nil {
+			d.invalid.Add(1)
+			return
+		}
+		select {
+		case d.accept <- c:
+		default:
+			d.overflow.Add(1)
+			c.Close()
+			return
+		}
+	}
+
+	var pkt = d.bufs.Get()
+	pkt.SetData(0).Append(transport...)
+	select {
+	case c.queue <- pkt:
+	default:
+		d.overflow.Add(1)
+		d.bufs.Put(pkt)
+	}
+}
+
+func (d *Device) newConn(id flowID) (*Conn, error) {
+	var c = &Conn{
+		d:      d,
+		id:     id,
+		queue:  make(chan *packet.Packet, d.cfg.Queue),
+		closed: make(chan struct{}),
+	}
+
+	// outbound is from the address app dialed, to the app
+	var err error
+	if c.ipstack, err = ipstack.New(id.dst.Addr(), id.src.Addr(), id.proto); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.conns[id] = c
+	d.mu.Unlock()
+	return c, nil
+}
+
+// Accept accept new flow from app, tcp flow start with SYN, udp flow start
+// with any datagram
+func (d *Device) Accept() (rawsock.RawConn, error) {
+	select {
+	case c := <-d.accept:
+		return c, nil
+	case <-d.done:
+		return nil, d.err
+	}
+}
+
+func (d *Device) write(pkt *packet.Packet) error {
+	if d.cfg.PacketInfo || d.cfg.Family {
+		var pi [piSize]byte
+		ipv4 := header.IPVersion(pkt.Bytes()) == 4
+		switch {
+		case d.cfg.Family && ipv4:
+			binary.BigEndian.PutUint32(pi[:], afInet)
+		case d.cfg.Family:
+			binary.BigEndian.PutUint32(pi[:], afInet6)
+		case ipv4:
+			binary.BigEndian.PutUint16(pi[2:], uint16(header.IPv4ProtocolNumber))
+		default:
+			binary.BigEndian.PutUint16(pi[2:], uint16(header.IPv6ProtocolNumber))
+		}
+		pkt.Attach(pi[:]...)
+		defer pkt.DetachN(piSize)
+	}
+
+	_, err := d.rw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
+func (d *Device) Stats() Stats {
+	return Stats{
+		Invalid:  d.invalid.Load(),
+		NonSyn:   d.nonSyn.Load(),
+		Overflow: d.overflow.Load(),
+	}
+}
+
+// Close close tun device and all conns
+func (d *Device) Close() error {
+	return d.closeErr.Close(func() (errs []error) {
+		errs = append(errs, d.rw.Close())
+		<-d.done
+		return errs
+	})
+}
+
+type Conn struct {
+	d       *Device
+	id      flowID
+	ipstack *ipstack.IPStack
+	queue   chan *packet.Packet
+
+	closed   chan struct{}
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+// Read read transport packet sent by app
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	var p *packet.Packet
+	select {
+	case p = <-c.queue:
+	case <-c.closed:
+		return errors.WithStack(net.ErrClosed)
+	case <-c.d.done:
+		select {
+		case p = <-c.queue: // drain queued packets
+		default:
+			return c.d.err
+		}
+	}
+
+	defer c.d.bufs.Put(p)
+	if pkt.Data() < p.Data() {
+		return errorx.ShortBuff(p.Data(), pkt.Data())
+	}
+	pkt.SetData(0).Append(p.Bytes()...)
+	return nil
+}
+
+// Write write transport packet to app
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	select {
+	case <-c.closed:
+		return errors.WithStack(net.ErrClosed)
+	default:
+	}
+	if n := pkt.Data() + c.ipstack.Size(); n > c.d.cfg.MTU {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.d.cfg.MTU})
+	}
+
+	defer pkt.DetachN(c.ipstack.Size())
+	c.ipstack.AttachOutbound(pkt)
+	assert.Validator(c.d.cfg.Validate).ValidIP(pkt.Bytes())
+	return c.d.write(pkt)
+}
+
+// Inject inject transport packet to Read, as if sent by app
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	select {
+	case c.queue <- pkt.Clone():
+		return nil
+	case <-c.closed:
+		return errors.WithStack(net.ErrClosed)
+	default:
+		return errors.New("read queue full")
+	}
+}
+
+// LocalAddr the address app dialed
+func (c *Conn) LocalAddr() netip.AddrPort { return c.id.dst }
+
+// RemoteAddr the app address
+func (c *Conn) RemoteAddr() netip.AddrPort { return c.id.src }
+
+func (c *Conn) Close() error {
+	return c.closeErr.Close(func() (errs []error) {
+		c.d.mu.Lock()
+		delete(c.d.conns, c.id)
+		c.d.mu.Unlock()
+		close(c.closed)
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+//go:build darwin
+// +build darwin
+
+package tun
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	utunControl = "com.apple.net.utun_control"
+	utunOptName = 2 // UTUN_OPT_IFNAME
+)
+
+// Open wrap utun fd, such as the socket of NEPacketTunnelFlow on iOS/macOS,
+// the Device own the fd, protocol family prefix is handled internally.
+func Open(fd int, opts ...Option) (*Device, error) {
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	opts = append([]Option{Family()}, opts...)
+	return New(os.NewFile(uintptr(fd), "utun"), opts...), nil
+}
+
+// Create create utun device utun<unit>, unit -1 is alloc by system,
+// return the Device and interface name, require root
+func Create(unit int, opts ...Option) (*Device, string, error) {
+	fd, err := unix.Socket(unix.AF_SYSTEM, unix.SOCK_DGRAM, unix.AF_SYS_CONTROL)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	unix.CloseOnExec(fd)
+
+	var info = &unix.CtlInfo{}
+	copy(info.Name[:], utunControl)
+	if err = unix.IoctlCtlInfo(fd, info); err != nil {
+		unix.Close(fd)
+		return nil, "", errors.WithStack(err)
+	}
+	// sc_unit 0 is auto alloc, N is utun<N-1>
+	if err = unix.Connect(fd, &unix.SockaddrCtl{ID: info.Id, Unit: uint32(unit + 1)}); err != nil {
+		unix.Close(fd)
+		return nil, "", errors.WithStack(err)
+	}
+	name, err := unix.GetsockoptString(fd, unix.AF_SYS_CONTROL, utunOptName)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", errors.WithStack(err)
+	}
+
+	d, err := Open(fd, opts...)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+	return d, name, nil
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package tun
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Open wrap tun device fd, such as ParcelFileDescriptor.detachFd() of android
+// VpnService, the Device own the fd. android's fd is blocking mode, set it
+// non-blocking, so that Close can unblock pending read.
+func Open(fd int, opts ...Option) (*Device, error) {
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return New(os.NewFile(uintptr(fd), "tun"), opts...), nil
+}
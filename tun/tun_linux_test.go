@@ -0,0 +1,201 @@
+//go:build linux
+// +build linux
+
+package tun_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/tun"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// pair tun device and app side fd, keep packet boundary like tun
+func pair(t *testing.T, opts ...tun.Option) (*tun.Device, int) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(fds[1]) })
+
+	d, err := tun.Open(fds[0], opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close() })
+	return d, fds[1]
+}
+
+func build(t *testing.T, src, dst netip.AddrPort, proto tcpip.TransportProtocolNumber, flags header.TCPFlags, payload string) []byte {
+	var pkt *packet.Packet
+	switch proto {
+	case header.TCPProtocolNumber:
+		pkt = packet.Make(64, header.TCPMinimumSize)
+		header.TCP(pkt.Bytes()).Encode(&header.TCPFields{
+			SrcPort: src.Port(), DstPort: dst.Port(),
+			DataOffset: header.TCPMinimumSize, Flags: flags, WindowSize: 1024,
+		})
+	default:
+		pkt = packet.Make(64, header.UDPMinimumSize)
+		header.UDP(pkt.Bytes()).Encode(&header.UDPFields{
+			SrcPort: src.Port(), DstPort: dst.Port(),
+			Length: uint16(header.UDPMinimumSize + len(payload)),
+		})
+	}
+	pkt.Append([]byte(payload)...)
+
+	s, err := ipstack.New(src.Addr(), dst.Addr(), proto)
+	require.NoError(t, err)
+	s.AttachOutbound(pkt)
+	return pkt.Bytes()
+}
+
+func Test_Device(t *testing.T) {
+	var (
+		app = netip.MustParseAddrPort("10.0.0.2:19986")
+		dst = netip.MustParseAddrPort("8.8.8.8:80")
+	)
+
+	for name, prefix := range map[string][]byte{
+		"no-pi":  {},
+		"pi":     {0, 0, 0x08, 0x00},
+		"family": {0, 0, 0, 2},
+	} {
+		var opts []tun.Option
+		switch name {
+		case "pi":
+			opts = append(opts, tun.PacketInfo())
+		case "family":
+			opts = append(opts, tun.Family())
+		}
+
+		t.Run(name, func(t *testing.T) {
+			var pi = len(prefix)
+			d, fd := pair(t, opts...)
+			write := func(ip []byte) {
+				_, err := unix.Write(fd, append(make([]byte, pi), ip...))
+				require.NoError(t, err)
+			}
+
+			// non-syn flow is dropped
+			write(build(t, app, dst, header.TCPProtocolNumber, header.TCPFlagAck, ""))
+			// syn with link padding
+			write(append(build(t, app, dst, header.TCPProtocolNumber, header.TCPFlagSyn, "hello"), 0, 0, 0))
+
+			conn, err := d.Accept()
+			require.NoError(t, err)
+			require.Equal(t, app, conn.RemoteAddr())
+			require.Equal(t, dst, conn.LocalAddr())
+			require.Equal(t, uint64(1), d.Stats().NonSyn)
+
+			var pkt = packet.Make(64, 1500)
+			require.NoError(t, conn.Read(pkt))
+			tcp := header.TCP(pkt.Bytes())
+			require.Equal(t, header.TCPFlagSyn, tcp.Flags())
+			require.Equal(t, "hello", string(tcp.Payload()))
+
+			// reply to app
+			pkt.SetData(0).Append(build(t, dst, app, header.TCPProtocolNumber, header.TCPFlagSyn|header.TCPFlagAck, "world")[header.IPv4MinimumSize:]...)
+			require.NoError(t, conn.Write(pkt))
+
+			var b = make([]byte, 1536)
+			n, err := unix.Read(fd, b)
+			require.NoError(t, err)
+			ip := b[pi:n]
+			require.Equal(t, prefix, b[:pi:pi])
+			test.ValidIP(t, ip)
+			hdr := header.IPv4(ip)
+			require.Equal(t, dst.Addr().As4(), hdr.SourceAddress().As4())
+			require.Equal(t, app.Addr().As4(), hdr.DestinationAddress().As4())
+			require.Equal(t, "world", string(header.TCP(hdr.Payload()).Payload()))
+
+			require.NoError(t, conn.Close())
+			require.NoError(t, d.Close())
+			_, err = d.Accept()
+			require.Error(t, err)
+		})
+	}
+}
+
+func Test_Device_UDP6(t *testing.T) {
+	var (
+		app = netip.MustParseAddrPort("[fd00::2]:19986")
+		dst = netip.MustParseAddrPort("[2001:db8::1]:53")
+	)
+	d, fd := pair(t)
+
+	_, err := unix.Write(fd, build(t, app, dst, header.UDPProtocolNumber, 0, "query"))
+	require.NoError(t, err)
+	conn, err := d.Accept()
+	require.NoError(t, err)
+	require.Equal(t, app, conn.RemoteAddr())
+
+	var pkt = packet.Make(64, 1500)
+	require.NoError(t, conn.Read(pkt))
+	require.Equal(t, "query", string(header.UDP(pkt.Bytes()).Payload()))
+
+	// same flow not accept again
+	_, err = unix.Write(fd, build(t, app, dst, header.UDPProtocolNumber, 0, "query2"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Read(pkt.SetData(1500)))
+	require.Equal(t, "query2", string(header.UDP(pkt.Bytes()).Payload()))
+
+	// oversize
+	require.Error(t, conn.Write(packet.Make(64, 1500)))
+}
+
+func Test_Device_Close(t *testing.T) {
+	d, _ := pair(t)
+
+	var accepted = make(chan error, 1)
+	go func() {
+		_, err := d.Accept()
+		accepted <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+	require.NoError(t, d.Close())
+
+	select {
+	case err := <-accepted:
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Accept not unblocked")
+	}
+}
+
+func Test_Device_Allocs(t *testing.T) {
+	var (
+		app = netip.MustParseAddrPort("10.0.0.2:19986")
+		dst = netip.MustParseAddrPort("8.8.8.8:53")
+	)
+	d, fd := pair(t)
+
+	var (
+		req   = build(t, app, dst, header.UDPProtocolNumber, 0, "query")
+		reply = build(t, dst, app, header.UDPProtocolNumber, 0, "reply")[header.IPv4MinimumSize:]
+		b     = make([]byte, 1536)
+		pkt   = packet.Make(64, 1500)
+	)
+	_, err := unix.Write(fd, req)
+	require.NoError(t, err)
+	conn, err := d.Accept()
+	require.NoError(t, err)
+
+	// steady state Read→process→Write loop
+	allocs := testing.AllocsPerRun(100, func() {
+		require.NoError(t, conn.Read(pkt.SetData(1500)))
+		pkt.SetData(0).Append(reply...)
+		require.NoError(t, conn.Write(pkt))
+
+		_, err := unix.Write(fd, req)
+		require.NoError(t, err)
+		_, err = unix.Read(fd, b)
+		require.NoError(t, err)
+	})
+	require.Zero(t, allocs)
+}
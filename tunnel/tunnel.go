@@ -0,0 +1,202 @@
+// Package tunnel pump packets between RawConn and stream transport, such as
+// tcp, tls, websocket, packets are carried by helper/frame, empty frame is
+// keepalive.
+package tunnel
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/frame"
+	"github.com/pkg/errors"
+)
+
+// Dialer create stream transport, be called again when stream broken
+type Dialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+type Config struct {
+	Keepalive  time.Duration // send keepalive interval
+	Timeout    time.Duration // stream broken if not recv any frame in timeout
+	Backoff    time.Duration // first reconnect backoff, double every retry
+	MaxBackoff time.Duration
+	MTU        int
+}
+
+type Option func(*Config)
+
+func Options(opts ...Option) *Config {
+	var cfg = &Config{
+		Keepalive:  time.Second * 15,
+		Timeout:    time.Second * 45,
+		Backoff:    time.Millisecond * 100,
+		MaxBackoff: time.Second * 30,
+		MTU:        1536,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Keepalive set keepalive interval and timeout, default 15s and 45s
+func Keepalive(interval, timeout time.Duration) Option {
+	return func(c *Config) {
+		c.Keepalive, c.Timeout = interval, timeout
+	}
+}
+
+// Backoff set first and max reconnect backoff, default 100ms and 30s
+func Backoff(first, max time.Duration) Option {
+	return func(c *Config) {
+		c.Backoff, c.MaxBackoff = first, max
+	}
+}
+
+// MTU max packet size, default 1536
+func MTU(mtu int) Option {
+	return func(c *Config) {
+		c.MTU = min(mtu, frame.MaxSize)
+	}
+}
+
+var ErrTimeout = errors.New("tunnel keepalive timeout")
+
+type Tunnel struct {
+	raw  rawsock.RawConn
+	dial Dialer
+	cfg  *Config
+
+	pool   sync.Pool
+	recv   chan *packet.Packet
+	rawErr error // valid after recv closed
+
+	lastRecv atomic.Int64 // unix nano
+}
+
+func New(raw rawsock.RawConn, dial Dialer, opts ...Option) *Tunnel {
+	var t = &Tunnel{
+		raw:  raw,
+		dial: dial,
+		cfg:  Options(opts...),
+		recv: make(chan *packet.Packet, 64),
+	}
+	t.pool.New = func() any { return packet.Make(64, t.cfg.MTU) }
+	return t
+}
+
+type rawError struct{ error }
+
+// Run pump packets until ctx cancelled or RawConn error, reconnect when
+// stream broken. caller should close RawConn after return.
+func (t *Tunnel) Run(ctx context.Context) error {
+	go t.recvService()
+
+	backoff := t.cfg.Backoff
+	for {
+		stream, err := t.dial(ctx)
+		if err == nil {
+			backoff = t.cfg.Backoff
+
+			err = t.serve(ctx, stream)
+			if e := (*rawError)(nil); errors.As(err, &e) {
+				return e.error
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, t.cfg.MaxBackoff)
+	}
+}
+
+func (t *Tunnel) recvService() {
+	defer close(t.recv)
+	for {
+		pkt := t.pool.Get().(*packet.Packet).Sets(64, t.cfg.MTU)
+		if err := t.raw.Read(pkt); err != nil {
+			t.rawErr = err
+			return
+		}
+		t.recv <- pkt
+	}
+}
+
+func (t *Tunnel) serve(ctx context.Context, stream io.ReadWriteCloser) error {
+	var (
+		w    = frame.NewWriter(stream)
+		r    = frame.NewReader(stream)
+		errs = make(chan error, 2)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.lastRecv.Store(time.Now().UnixNano())
+
+	// uplink and keepalive
+	go func() {
+		ticker := time.NewTicker(min(t.cfg.Keepalive, t.cfg.Timeout/2))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case pkt, ok := <-t.recv:
+				if !ok {
+					errs <- &rawError{t.rawErr}
+					return
+				}
+				err := w.Write(pkt.Bytes())
+				t.pool.Put(pkt)
+				if err != nil {
+					errs <- err
+					return
+				}
+			case <-ticker.C:
+				if time.Since(time.Unix(0, t.lastRecv.Load())) > t.cfg.Timeout {
+					errs <- errors.WithStack(ErrTimeout)
+					return
+				} else if err := w.Write(nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+
+	// downlink
+	go func() {
+		var pkt = packet.Make(64, t.cfg.MTU)
+		for {
+			if err := r.Read(pkt.Sets(64, t.cfg.MTU)); err != nil {
+				errs <- err
+				return
+			}
+			t.lastRecv.Store(time.Now().UnixNano())
+			if pkt.Data() == 0 {
+				continue // keepalive
+			}
+
+			if err := t.raw.Write(pkt); err != nil {
+				errs <- &rawError{err}
+				return
+			}
+		}
+	}()
+
+	err := <-errs
+	if e := stream.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
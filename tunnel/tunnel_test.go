@@ -0,0 +1,85 @@
+package tunnel_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/tunnel"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func Test_Tunnel(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.RandIP(), test.RandPort())
+	)
+	// peerA <-> rawA ==tunnel== rawB <-> peerB
+	peerA, rawA := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+	rawB, peerB := test.NewMockRaw(t, header.UDPProtocolNumber, caddr, saddr)
+
+	var (
+		pipes   = make(chan net.Conn)
+		streams = make(chan net.Conn, 8)
+	)
+	dialA := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		c1, c2 := net.Pipe()
+		select {
+		case pipes <- c2:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		streams <- c1
+		return c1, nil
+	}
+	dialB := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		select {
+		case c := <-pipes:
+			return c, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := []tunnel.Option{
+		tunnel.Keepalive(time.Millisecond*20, time.Millisecond*200),
+		tunnel.Backoff(time.Millisecond, time.Millisecond*10),
+	}
+	go tunnel.New(rawA, dialA, opts...).Run(ctx)
+	go tunnel.New(rawB, dialB, opts...).Run(ctx)
+
+	pingpong := func(t *testing.T) {
+		udp := header.UDP(test.StripIP(test.RandUDP(t, caddr, saddr)))
+		require.NoError(t, peerA.Write(packet.Make(64).Append(udp...)))
+
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, peerB.Read(pkt))
+		require.Equal(t, []byte(udp.Payload()), []byte(header.UDP(pkt.Bytes()).Payload()))
+
+		require.NoError(t, peerB.Write(packet.Make(64).Append(udp...)))
+		require.NoError(t, peerA.Read(pkt.Sets(0, 1536)))
+		require.Equal(t, []byte(udp.Payload()), []byte(header.UDP(pkt.Bytes()).Payload()))
+	}
+
+	t.Run("pingpong", pingpong)
+
+	t.Run("keepalive", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 300)
+		require.Len(t, streams, 1)
+		pingpong(t)
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		(<-streams).Close()
+		require.Eventually(t, func() bool { return len(streams) == 1 }, time.Second, time.Millisecond)
+		pingpong(t)
+	})
+}
@@ -0,0 +1,368 @@
+package divert
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/lysShub/divert-go"
+	"github.com/lysShub/netkit/errorx"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper"
+	"github.com/lysShub/rawsock/helper/bind"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/lysShub/rawsock/helper/rtnl"
+	"github.com/lysShub/rawsock/internal/assert"
+	iudp "github.com/lysShub/rawsock/udp/internal"
+	"golang.org/x/sys/windows"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type Listener struct {
+	addr netip.AddrPort
+	cfg  *rawsock.Config
+
+	udp windows.Handle
+
+	raw *divert.Handle
+
+	conns   map[netip.AddrPort]struct{}
+	connsMu sync.RWMutex
+
+	short, overLimit atomic.Uint64
+
+	closeErr errorx.CloseErr
+}
+
+var _ rawsock.StatsListener = (*Listener)(nil)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+	var l = &Listener{
+		cfg:   rawsock.Options(opts...),
+		conns: make(map[netip.AddrPort]struct{}, 16),
+	}
+
+	// usaully should listen on all nic, but we juse listen on default nic
+	if laddr.Addr().IsUnspecified() {
+		laddr = netip.AddrPortFrom(rawsock.LocalAddr(), laddr.Port())
+	}
+
+	var err error
+	l.udp, l.addr, err = bind.BindLocal(header.UDPProtocolNumber, laddr, l.cfg.UsedPort)
+	if err != nil {
+		return nil, l.close(err)
+	}
+
+	var filter string
+	if l.addr.Addr().IsLoopback() {
+		filter = fmt.Sprintf(
+			"udp and remotePort=%d and remoteAddr=%s",
+			l.addr.Port(), l.addr.Addr().String(),
+		)
+	} else {
+		filter = fmt.Sprintf(
+			"(loopback and udp and remotePort=%d and remoteAddr=%s) or (!loopback and udp and localPort=%d and localAddr=%s)",
+			l.addr.Port(), l.addr.Addr().String(),
+			l.addr.Port(), l.addr.Addr().String(),
+		)
+	}
+
+	if l.raw, err = divert.Open(filter, divert.Network, l.cfg.DivertPriorty, divert.ReadOnly); err != nil {
+		return nil, l.close(err)
+	}
+	return l, nil
+}
+
+func (l *Listener) close(cause error) error {
+	return l.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+
+		if l.raw != nil {
+			errs = append(errs, l.raw.Close())
+		}
+		if l.udp != 0 {
+			errs = append(errs, errors.WithStack(windows.Close(l.udp)))
+		}
+		return
+	})
+}
+
+func (l *Listener) Addr() netip.AddrPort { return l.addr }
+
+// todo: first packet of new conn is dropped
+func (l *Listener) Accept() (rawsock.RawConn, error) {
+	var min, max = iudp.SizeRange(l.addr.Addr().Is4())
+	var addr divert.Address
+
+	var b = make([]byte, max)
+	for {
+		n, err := l.raw.Recv(b[:max], &addr)
+		if err != nil {
+			return nil, l.close(err)
+		} else if n < min {
+			l.short.Add(1)
+			continue
+		}
+
+		var raddr netip.AddrPort
+		switch header.IPVersion(b) {
+		case 4:
+			iphdr := header.IPv4(b[:n])
+			raddr = netip.AddrPortFrom(
+				netip.AddrFrom4(iphdr.SourceAddress().As4()),
+				header.UDP(iphdr[iphdr.HeaderLength():]).SourcePort(),
+			)
+		case 6:
+			iphdr := header.IPv6(b[:n])
+			raddr = netip.AddrPortFrom(
+				netip.AddrFrom16(iphdr.SourceAddress().As16()),
+				header.UDP(iphdr[header.IPv6FixedHeaderSize:]).SourcePort(),
+			)
+		default:
+			continue
+		}
+
+		l.connsMu.Lock()
+		if _, has := l.conns[raddr]; has {
+			l.connsMu.Unlock()
+			continue
+		} else if l.cfg.MaxConns > 0 && len(l.conns) >= l.cfg.MaxConns {
+			l.connsMu.Unlock()
+			l.overLimit.Add(1)
+			continue
+		}
+		l.conns[raddr] = struct{}{}
+		l.connsMu.Unlock()
+
+		c := newConnect(
+			l.addr, raddr,
+			addr.Loopback(), int(addr.Network().IfIdx),
+			l.deleteConn,
+		)
+		if err := c.init(l.cfg); err != nil {
+			return nil, errorx.WrapTemp(c.close(err))
+		}
+		return c, nil
+	}
+}
+
+func (l *Listener) deleteConn(raddr netip.AddrPort) error {
+	if l == nil {
+		return nil
+	}
+	l.connsMu.Lock()
+	delete(l.conns, raddr)
+	l.connsMu.Unlock()
+	return nil
+}
+
+func (l *Listener) Stats() rawsock.ListenerStats {
+	return rawsock.ListenerStats{Short: l.short.Load(), OverLimit: l.overLimit.Load()}
+}
+
+func (l *Listener) Close() error { return l.close(nil) }
+
+type Conn struct {
+	laddr, raddr netip.AddrPort
+	loopback     bool
+
+	udp windows.Handle
+
+	raw *divert.Handle
+
+	injectAddr *divert.Address
+
+	ipstack *ipstack.IPStack
+
+	mtu      int
+	fragment bool
+
+	closeFn  iudp.CloseCallback
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
+	closeErr errorx.CloseErr
+}
+
+var outboundAddr = func() *divert.Address {
+	addr := &divert.Address{}
+	addr.SetOutbound(true)
+	return addr
+}()
+
+var _ rawsock.RawConn = (*Conn)(nil)
+
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+	cfg := rawsock.Options(opts...)
+
+	table, err := rtnl.Table()
+	if err != nil {
+		return nil, err
+	}
+	entry := rtnl.Match(table, raddr.Addr())
+	if !entry.Valid() {
+		err = errors.WithMessagef(
+			windows.ERROR_NETWORK_UNREACHABLE,
+			"%s -> %s", laddr.Addr().String(), raddr.Addr().String(),
+		)
+		return nil, errors.WithStack(err)
+	}
+
+	if laddr.Addr().IsUnspecified() {
+		laddr = netip.AddrPortFrom(entry.Addr, laddr.Port())
+	} else if laddr.Addr() != entry.Addr {
+		err = errors.WithMessagef(
+			windows.WSAEADDRNOTAVAIL, laddr.Addr().String(),
+		)
+		return nil, errors.WithStack(err)
+	}
+
+	udp, laddr, err := bind.BindLocal(header.UDPProtocolNumber, laddr, cfg.UsedPort)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConnect(
+		laddr, raddr,
+		table.Loopback(raddr.Addr()), int(entry.Interface), nil,
+	)
+	c.udp = udp
+
+	if err := c.init(cfg); err != nil {
+		return nil, c.close(err)
+	}
+	return c, nil
+}
+
+func newConnect(laddr, raddr netip.AddrPort, loopback bool, ifIdx int, closeCall iudp.CloseCallback) *Conn {
+	var conn = &Conn{
+		laddr:      laddr,
+		raddr:      raddr,
+		loopback:   loopback,
+		injectAddr: &divert.Address{},
+		closeFn:    closeCall,
+	}
+	conn.injectAddr.SetOutbound(false)
+	conn.injectAddr.Network().IfIdx = uint32(ifIdx)
+	return conn
+}
+
+func (c *Conn) init(cfg *rawsock.Config) (err error) {
+	var filter string
+	if c.loopback {
+		// loopback recv as outbound packet, so raddr is localAddr laddr is remoteAddr
+		filter = fmt.Sprintf(
+			"udp and localPort=%d and localAddr=%s and remotePort=%d and remoteAddr=%s",
+			c.raddr.Port(), c.raddr.Addr().String(), c.laddr.Port(), c.laddr.Addr().String(),
+		)
+	} else {
+		filter = fmt.Sprintf(
+			"udp and localPort=%d and localAddr=%s and remotePort=%d and remoteAddr=%s",
+			c.laddr.Port(), c.laddr.Addr().String(), c.raddr.Port(), c.raddr.Addr().String(),
+		)
+	}
+
+	if c.raw, err = divert.Open(filter, divert.Network, cfg.DivertPriorty, 0); err != nil {
+		return err
+	}
+
+	if c.ipstack, err = ipstack.New(
+		c.laddr.Addr(), c.raddr.Addr(),
+		header.UDPProtocolNumber,
+		cfg.IPStack.Unmarshal(),
+	); err != nil {
+		return err
+	}
+
+	if c.mtu = cfg.MTU; c.mtu == 0 {
+		if c.mtu, err = helper.InterfaceMTU(c.laddr.Addr()); err != nil {
+			return err
+		}
+	}
+	c.fragment = cfg.Fragment && c.laddr.Addr().Is4()
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
+	return nil
+}
+
+func (c *Conn) close(cause error) error {
+	return c.closeErr.Close(func() (errs []error) {
+		errs = append(errs, cause)
+		c.idle.Stop()
+
+		if c.raw != nil {
+			errs = append(errs, c.raw.Close())
+		}
+		if c.udp != 0 {
+			errs = append(errs, errors.WithStack(windows.Close(c.udp)))
+		}
+		if c.closeFn != nil {
+			errs = append(errs, c.closeFn(c.raddr))
+		}
+		return
+	})
+}
+
+func (c *Conn) Read(pkt *packet.Packet) (err error) {
+	n, err := c.raw.Recv(pkt.Bytes(), nil)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
+			return errorx.ShortBuff(-1, pkt.Data())
+		}
+		return err
+	} else if n == 0 {
+		return c.Read(pkt)
+	}
+
+	pkt.SetData(n)
+	c.idle.Touch()
+	hdr, err := helper.IPCheck(pkt.Bytes())
+	if err != nil {
+		return err
+	}
+	c.valid.ValidIP(pkt.Bytes())
+	pkt.SetHead(pkt.Head() + int(hdr))
+	return nil
+}
+
+func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	defer pkt.DetachN(c.ipstack.Size())
+	c.ipstack.AttachOutbound(pkt)
+	c.valid.ValidIP(pkt.Bytes())
+
+	if n := pkt.Data(); n > c.mtu {
+		if !c.fragment {
+			return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu})
+		}
+		return ipstack.Fragment(pkt.Bytes(), c.mtu, func(frag header.IPv4) error {
+			_, err := c.raw.Send(frag, outboundAddr)
+			return err
+		})
+	}
+
+	_, err = c.raw.Send(pkt.Bytes(), outboundAddr)
+	return err
+}
+
+func (c *Conn) Inject(pkt *packet.Packet) (err error) {
+	defer pkt.DetachN(c.ipstack.Size())
+	c.ipstack.AttachInbound(pkt)
+	c.valid.ValidIP(pkt.Bytes())
+
+	_, err = c.raw.Send(pkt.Bytes(), c.injectAddr)
+	return err
+}
+
+func (c *Conn) LocalAddr() netip.AddrPort  { return c.laddr }
+func (c *Conn) RemoteAddr() netip.AddrPort { return c.raddr }
+func (c *Conn) Close() error               { return c.close(nil) }
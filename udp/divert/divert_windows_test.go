@@ -0,0 +1,47 @@
+package divert
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lysShub/divert-go"
+	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock/test"
+	"github.com/stretchr/testify/require"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func init() {
+	divert.MustLoad(divert.DLL)
+}
+
+func Test_Connect(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: saddr.Addr().AsSlice(), Port: int(saddr.Port())})
+	require.NoError(t, err)
+	defer udp.Close()
+
+	conn, err := Connect(caddr, saddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var msg = []byte("hello")
+	pkt := packet.Make(64, header.UDPMinimumSize+len(msg))
+	hdr := header.UDP(pkt.Bytes())
+	hdr.Encode(&header.UDPFields{SrcPort: caddr.Port(), DstPort: saddr.Port()})
+	copy(hdr.Payload(), msg)
+	require.NoError(t, conn.Write(pkt))
+
+	var b = make([]byte, 64)
+	require.NoError(t, udp.SetReadDeadline(time.Now().Add(time.Second*3)))
+	n, addr, err := udp.ReadFromUDPAddrPort(b)
+	require.NoError(t, err)
+	require.Equal(t, msg, b[:n])
+	require.Equal(t, caddr.Port(), addr.Port())
+}
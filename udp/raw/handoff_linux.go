@@ -0,0 +1,139 @@
+//go:build linux
+// +build linux
+
+package raw
+
+import (
+	"net"
+	"net/netip"
+	"os"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/handoff"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ipstack"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+type handoffState struct {
+	Local, Remote netip.AddrPort
+	MTU           int
+	Filter        string
+	Fragment      bool
+	HdrIncl       bool // socket option is kept by the socket
+	PTB           bool // has ICMPv6 watcher socket
+}
+
+// Handoff send conn's sockets to other process by unix socket, the conn is
+// closed after sent, the sockets are kept by receiver. not support the conn
+// accepted by Listener, it's port is owned by listener.
+func Handoff(uc *net.UnixConn, c *Conn) error {
+	if c.closeCallback != nil {
+		return errors.New("not support handoff accepted conn")
+	}
+
+	var (
+		state = handoffState{
+			Local: c.laddr, Remote: c.RemoteAddr(),
+			MTU: c.mtu.Load(), Filter: c.filter, Fragment: c.fragment, HdrIncl: c.hdrincl,
+		}
+		files []*os.File
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	f, err := c.raw.File()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files = append(files, f)
+	fd, err := unix.Dup(c.udp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files = append(files, os.NewFile(uintptr(fd), "udp"))
+	if c.ptb != nil {
+		if ptb, ok := c.ptb.(interface{ File() (*os.File, error) }); ok {
+			if f, err = ptb.File(); err != nil {
+				return errors.WithStack(err)
+			}
+			files, state.PTB = append(files, f), true
+		}
+	}
+
+	if err = handoff.Send(uc, state, files...); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// Adopt recv conn sent by Handoff, not need privilege, opts only used for
+// ReadBuffers, PMTUNotify and IdleTimeout
+func Adopt(uc *net.UnixConn, opts ...rawsock.Option) (*Conn, error) {
+	var state handoffState
+	files, err := handoff.Recv(uc, &state)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if n := 2 + btoi(state.PTB); len(files) != n {
+		return nil, errors.Errorf("handoff expect %d files, got %d", n, len(files))
+	}
+
+	var (
+		cfg = rawsock.Options(opts...)
+		c   = newConnect(state.Local, state.Remote, nil)
+	)
+	c.remote.Store(&c.raddr)
+	c.filter, c.fragment, c.hdrincl = state.Filter, state.Fragment, state.HdrIncl
+
+	if conn, err := net.FileConn(files[0]); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	} else if c.raw, _ = conn.(*net.IPConn); c.raw == nil {
+		conn.Close()
+		return nil, c.close(errors.Errorf("handoff invalid raw socket %T", conn))
+	}
+	if c.udp, err = unix.Dup(int(files[1].Fd())); err != nil {
+		return nil, c.close(errors.WithStack(err))
+	}
+	if state.PTB {
+		if c.ptb, err = net.FilePacketConn(files[2]); err != nil {
+			return nil, c.close(errors.WithStack(err))
+		}
+		ipstack.ServePTB(c.ptb, c.handlePTB)
+	}
+
+	c.mtu = ipstack.NewPMTU(state.MTU, cfg.PMTUNotify)
+	c.bufs = bufpool.New(64, state.MTU, cfg.ReadBuffers)
+	if c.ipstack, err = ipstack.New(
+		c.laddr.Addr(), c.raddr.Addr(),
+		header.TCPProtocolNumber,
+		cfg.IPStack.Unmarshal(),
+	); err != nil {
+		return nil, c.close(err)
+	}
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
+	return c, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -7,73 +7,107 @@ import (
 	"net"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
+	"golang.org/x/net/ipv6"
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 
-	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/errorx"
 	"github.com/lysShub/netkit/packet"
 	"github.com/lysShub/rawsock"
 	"github.com/lysShub/rawsock/helper"
 	"github.com/lysShub/rawsock/helper/bind"
 	"github.com/lysShub/rawsock/helper/bpf"
+	"github.com/lysShub/rawsock/helper/bufpool"
+	"github.com/lysShub/rawsock/helper/cmsg"
+	"github.com/lysShub/rawsock/helper/idle"
+	"github.com/lysShub/rawsock/helper/ip6"
 	"github.com/lysShub/rawsock/helper/ipstack"
-	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/helper/netns"
+	"github.com/lysShub/rawsock/helper/vrf"
+	"github.com/lysShub/rawsock/internal/assert"
 	iudp "github.com/lysShub/rawsock/udp/internal"
 	"github.com/pkg/errors"
 )
 
 type Listener struct {
 	addr netip.AddrPort
+	zone int // interface index of zoned addr
 	cfg  *rawsock.Config
 
 	udp int // unix fd
 
 	raw *net.IPConn
+	pc6 *ipv6.PacketConn // recv destination address of ipv6 packet
 
 	conns   map[netip.AddrPort]struct{}
 	connsMu sync.RWMutex
 
+	short, overLimit atomic.Uint64
+
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.Listener = (*Listener)(nil)
+var _ rawsock.StatsListener = (*Listener)(nil)
 
-func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (l *Listener, err error) {
+	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		l, err = listen(laddr, cfg)
+		return err
+	})
+	return l, err
+}
+
+func listen(laddr netip.AddrPort, cfg *rawsock.Config) (*Listener, error) {
 	var l = &Listener{
-		cfg:   rawsock.Options(opts...),
+		cfg:   cfg,
 		conns: make(map[netip.AddrPort]struct{}, 16),
 	}
 	var err error
 
-	// usaully should listen on all nic, but we juse listen on default nic
-	if laddr.Addr().IsUnspecified() {
-		laddr = netip.AddrPortFrom(rawsock.LocalAddr(), laddr.Port())
+	if l.zone, err = ip6.ZoneIndex(laddr.Addr().Zone()); err != nil {
+		return nil, l.close(err)
 	}
-
 	l.udp, l.addr, err = bind.BindLocal(header.UDPProtocolNumber, laddr, l.cfg.UsedPort)
 	if err != nil {
 		return nil, l.close(err)
 	}
 
+	network := "ip4:udp"
+	if !l.addr.Addr().Is4() {
+		network = "ip6:udp"
+	}
 	l.raw, err = net.ListenIP(
-		"ip:udp",
+		network,
 		&net.IPAddr{IP: l.addr.Addr().AsSlice(), Zone: laddr.Addr().Zone()},
 	)
 	if err != nil {
 		return nil, l.close(err)
 	}
+	if !l.addr.Addr().Is4() {
+		l.pc6 = ipv6.NewPacketConn(l.raw)
+		if err = l.pc6.SetControlMessage(ipv6.FlagDst, true); err != nil {
+			return nil, l.close(errors.WithStack(err))
+		}
+	}
 
 	// todo: bpf can return IPv4HeaderSize+8
 	if raw, err := l.raw.SyscallConn(); err != nil {
 		return nil, l.close(err)
 	} else {
-		if err = bpf.SetRawBPF(
-			raw,
-			bpf.FilterDstPort(l.addr.Port()),
-		); err != nil {
+		if l.cfg.VRF != "" {
+			if err = vrf.Bind(raw, l.cfg.VRF); err != nil {
+				return nil, l.close(err)
+			}
+		}
+		ins, err := bpf.WithFilter(l.cfg.Filter, bpf.WithInterface(l.zone, bpf.WithShard(l.cfg.Shard, l.cfg.Shards, bpf.FilterDstPort(l.addr.Port()))))
+		if err != nil {
+			return nil, l.close(err)
+		}
+		if err = bpf.SetRawBPF(raw, ins); err != nil {
 			return nil, l.close(err)
 		}
 	}
@@ -81,6 +115,23 @@ func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (*Listener, error) {
 	return l, nil
 }
 
+// read first packet of flow, ipv6 packet's addresses are got from sockaddr
+// and IPV6_PKTINFO, dst is invalid if without pktinfo
+func (l *Listener) read(b []byte) (n int, src, dst netip.Addr, err error) {
+	if l.pc6 == nil {
+		n, err = l.raw.Read(b)
+		return n, src, dst, err
+	}
+
+	n, cm, from, err := l.pc6.ReadFrom(b)
+	if err != nil || cm == nil {
+		return n, src, dst, err
+	}
+	src, _ = netip.AddrFromSlice(from.(*net.IPAddr).IP)
+	dst, _ = netip.AddrFromSlice(cm.Dst)
+	return n, ip6.Zone(src, l.zone), ip6.Zone(dst, l.zone), nil
+}
+
 func (l *Listener) close(cause error) error {
 	return l.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
@@ -97,48 +148,57 @@ func (l *Listener) close(cause error) error {
 
 func (l *Listener) Accept() (rawsock.RawConn, error) {
 	min, max := iudp.SizeRange(l.addr.Addr().Is4())
+	if l.pc6 != nil {
+		// ipv6 raw socket not recv ip header
+		min, max = min-header.IPv6MinimumSize, max-header.IPv6MinimumSize
+	}
 
 	var ip = make([]byte, max)
 	for {
-		n, err := l.raw.Read(ip[:max])
+		n, src, dst, err := l.read(ip[:max])
 		if err != nil {
 			return nil, errors.WithStack(err)
 		} else if n < min {
-			return nil, errors.Errorf("recved invalid ip packet, bytes %d", n)
+			l.short.Add(1)
+			continue
 		}
 
-		var id netip.AddrPort
-		switch header.IPVersion(ip) {
-		case 4:
+		// listen on unspecified address accept packet to any local address,
+		// resolve conn's local address from destination address
+		var udp header.UDP
+		if l.pc6 == nil {
+			if header.IPVersion(ip) != 4 {
+				continue
+			}
 			iphdr := header.IPv4(ip[:n])
-			id = netip.AddrPortFrom(
-				netip.AddrFrom4(iphdr.SourceAddress().As4()),
-				header.UDP(iphdr[iphdr.HeaderLength():]).SourcePort(),
-			)
-		case 6:
-			iphdr := header.IPv6(ip[:n])
-			id = netip.AddrPortFrom(
-				netip.AddrFrom16(iphdr.SourceAddress().As16()),
-				header.UDP(iphdr[header.IPv6FixedHeaderSize:]).SourcePort(),
-			)
-		default:
+			udp = header.UDP(iphdr[iphdr.HeaderLength():])
+			src, dst = netip.AddrFrom4(iphdr.SourceAddress().As4()), netip.AddrFrom4(iphdr.DestinationAddress().As4())
+		} else if !dst.IsValid() {
+			l.short.Add(1)
 			continue
+		} else {
+			udp = header.UDP(ip[:n])
 		}
+		local := netip.AddrPortFrom(dst, l.addr.Port())
+		id := netip.AddrPortFrom(src, udp.SourcePort())
 
-		l.connsMu.RLock()
-		_, has := l.conns[id]
-		l.connsMu.RUnlock()
-		if !has {
-			l.connsMu.Lock()
-			l.conns[id] = struct{}{}
+		l.connsMu.Lock()
+		if _, has := l.conns[id]; has {
 			l.connsMu.Unlock()
+			continue
+		} else if l.cfg.MaxConns > 0 && len(l.conns) >= l.cfg.MaxConns {
+			l.connsMu.Unlock()
+			l.overLimit.Add(1)
+			continue
+		}
+		l.conns[id] = struct{}{}
+		l.connsMu.Unlock()
 
-			c := newConnect(l.addr, id, l.deleteConn)
-			if err := c.init(l.cfg); err != nil {
-				return nil, errorx.WrapTemp(c.close(err))
-			}
-			return c, nil
+		c := newConnect(local, id, l.deleteConn)
+		if err := netns.Do(l.cfg.NetNS, func() error { return c.init(l.cfg) }); err != nil {
+			return nil, errorx.WrapTemp(c.close(err))
 		}
+		return c, nil
 	}
 }
 
@@ -152,12 +212,27 @@ func (l *Listener) deleteConn(raddr netip.AddrPort) error {
 	return nil
 }
 func (l *Listener) Addr() netip.AddrPort { return l.addr }
-func (l *Listener) Close() error         { return l.close(nil) }
+func (l *Listener) Stats() rawsock.ListenerStats {
+	return rawsock.ListenerStats{Short: l.short.Load(), OverLimit: l.overLimit.Load()}
+}
+func (l *Listener) Close() error { return l.close(nil) }
 
-func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (*Conn, error) {
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (c *Conn, err error) {
 	cfg := rawsock.Options(opts...)
+	err = netns.Do(cfg.NetNS, func() error {
+		c, err = connect(laddr, raddr, cfg)
+		return err
+	})
+	return c, err
+}
 
-	if l, err := helper.DefaultLocal(laddr.Addr(), raddr.Addr()); err != nil {
+func connect(laddr, raddr netip.AddrPort, cfg *rawsock.Config) (*Conn, error) {
+	if l, r, err := helper.ZoneAddrs(laddr.Addr(), raddr.Addr()); err != nil {
+		return nil, err
+	} else {
+		laddr, raddr = netip.AddrPortFrom(l, laddr.Port()), netip.AddrPortFrom(r, raddr.Port())
+	}
+	if l, err := defaultLocal(laddr.Addr(), raddr.Addr(), cfg.VRF); err != nil {
 		return nil, errors.WithStack(err)
 	} else {
 		laddr = netip.AddrPortFrom(l, laddr.Port())
@@ -186,18 +261,37 @@ type Conn struct {
 	// todo: UDPConn set
 	raw     *net.IPConn
 	ipstack *ipstack.IPStack
-
+	filter  string
+	zone    int                            // interface index of zoned laddr
+	remote  atomic.Pointer[netip.AddrPort] // current remote address, maybe roamed
+
+	mtu      *ipstack.PMTU
+	unwatch  func()         // stop watch interface mtu, nil if MTU specified
+	bufs     *bufpool.Pool  // read buffers
+	ptb      net.PacketConn // recv ICMPv6 packet too big
+	fragment bool           // kernel fragment oversize packet
+	hdrincl  bool           // Write take complete ip packet, if HdrIncl
+
+	idle     *idle.Timer      // close self if IdleTimeout
+	valid    assert.Validator // runtime validation, if Validate
 	closeErr errorx.CloseErr
 }
 
-var _ rawsock.RawConn = (*Conn)(nil)
+var _ rawsock.MetaConn = (*Conn)(nil)
+var _ rawsock.RoamConn = (*Conn)(nil)
+var _ rawsock.BufferConn = (*Conn)(nil)
+var _ syscall.Conn = (*Conn)(nil)
 
 func (c *Conn) close(cause error) error {
 	return c.closeErr.Close(func() (errs []error) {
 		errs = append(errs, cause)
+		c.idle.Stop()
+		if c.unwatch != nil {
+			c.unwatch()
+		}
 
 		if c.closeCallback != nil {
-			errs = append(errs, c.closeCallback(c.RemoteAddr()))
+			errs = append(errs, c.closeCallback(c.raddr))
 		}
 		if c.udp != 0 {
 			errs = append(errs, errors.WithStack(syscall.Close(c.udp)))
@@ -205,6 +299,9 @@ func (c *Conn) close(cause error) error {
 		if c.raw != nil {
 			errs = append(errs, c.raw.Close())
 		}
+		if c.ptb != nil {
+			errs = append(errs, errors.WithStack(c.ptb.Close()))
+		}
 		return
 	})
 }
@@ -213,13 +310,83 @@ func newConnect(laddr, raddr netip.AddrPort, close iudp.CloseCallback) *Conn {
 }
 
 func (c *Conn) init(cfg *rawsock.Config) (err error) {
+	c.remote.Store(&c.raddr)
+	c.filter = cfg.Filter
+	if c.zone, err = ip6.ZoneIndex(c.laddr.Addr().Zone()); err != nil {
+		return err
+	}
 	if c.raw, err = net.DialIP(
 		"ip:udp",
-		&net.IPAddr{IP: c.laddr.Addr().AsSlice()},
-		&net.IPAddr{IP: c.raddr.Addr().AsSlice()},
+		&net.IPAddr{IP: c.laddr.Addr().AsSlice(), Zone: c.laddr.Addr().Zone()},
+		&net.IPAddr{IP: c.raddr.Addr().AsSlice(), Zone: c.raddr.Addr().Zone()},
 	); err != nil {
 		return errors.WithStack(err)
 	}
+	if cfg.VRF != "" {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = vrf.Bind(raw, cfg.VRF); err != nil {
+			return err
+		}
+	}
+
+	mtu := cfg.MTU
+	var ifi *net.Interface
+	if mtu == 0 {
+		if ifi, err = helper.InterfaceByAddr(c.laddr.Addr()); err != nil {
+			return err
+		}
+		mtu = ifi.MTU
+	}
+	c.mtu = ipstack.NewPMTU(mtu, cfg.PMTUNotify)
+	if ifi != nil {
+		// best effort, buffers sized at init, so only interface mtu shrink take effect
+		c.unwatch, _ = helper.WatchMTU(ifi.Name, func(mtu int) { c.mtu.Update(mtu) })
+	}
+	c.bufs = bufpool.New(64, mtu, cfg.ReadBuffers)
+	if c.laddr.Addr().Is6() {
+		if c.ptb, err = ipstack.WatchPTB(c.laddr.Addr(), c.handlePTB); err != nil {
+			return err
+		}
+	}
+	if cfg.HdrIncl {
+		c.hdrincl = true
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.SetHdrIncl(raw, c.laddr.Addr().Is4()); err != nil {
+			return err
+		}
+	}
+	if cfg.Fragment && c.laddr.Addr().Is4() {
+		c.fragment = true
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.DisablePMTUDisc(raw); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Timestamp {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = cmsg.SetTimestamp(raw, cfg.HardwareTimestamp); err != nil {
+			return err
+		}
+	}
+	if cfg.Ancillary {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = cmsg.SetAncillary(raw, c.laddr.Addr().Is4()); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPoll > 0 {
+		if raw, err := c.raw.SyscallConn(); err != nil {
+			return errors.WithStack(err)
+		} else if err = bind.SetBusyPoll(raw, cfg.BusyPoll, cfg.BusyPollBudget); err != nil {
+			return err
+		}
+	}
 
 	if cfg.SetGRO {
 		if err = bind.SetGRO(c.laddr.Addr(), c.raddr.Addr(), false); err != nil {
@@ -230,12 +397,13 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	if raw, err := c.raw.SyscallConn(); err != nil {
 		return errors.WithStack(err)
 	} else {
-		err := bpf.SetRawBPF(raw,
-			bpf.FilterPorts(c.raddr.Port(), c.laddr.Port()),
-		)
+		ins, err := bpf.WithFilter(cfg.Filter, bpf.WithInterface(c.zone, bpf.FilterPorts(c.raddr.Port(), c.laddr.Port())))
 		if err != nil {
 			return err
 		}
+		if err = bpf.SetRawBPF(raw, ins); err != nil {
+			return err
+		}
 	}
 
 	if c.ipstack, err = ipstack.New(
@@ -245,40 +413,149 @@ func (c *Conn) init(cfg *rawsock.Config) (err error) {
 	); err != nil {
 		return err
 	}
+	c.valid = assert.Validator(cfg.Validate)
+	c.idle = idle.New(cfg.IdleTimeout, func() {
+		c.close(nil)
+		if cfg.OnIdle != nil {
+			cfg.OnIdle(c)
+		}
+	})
 	return nil
 }
 
+// trimIP trim ip header of read packet, ipv6 raw socket not recv ip header
+func (c *Conn) trimIP(pkt *packet.Packet) error {
+	if !c.laddr.Addr().Is4() {
+		return nil
+	}
+	hdrLen, err := helper.IPCheck(pkt.Bytes())
+	if err != nil {
+		return err
+	}
+	c.valid.ValidIP(pkt.Bytes())
+	pkt.SetHead(pkt.Head() + int(hdrLen))
+	return nil
+}
+
+func (c *Conn) handlePTB(ptb ipstack.PTB) {
+	if ptb.Proto == header.UDPProtocolNumber && ptb.Src == c.laddr && ptb.Dst == *c.remote.Load() {
+		c.mtu.Update(ptb.MTU)
+	}
+}
+
 func (c *Conn) Read(pkt *packet.Packet) (err error) {
 	n, err := c.raw.Read(pkt.Bytes())
 	if err != nil {
 		return err
 	}
 	pkt.SetData(n)
-
-	hdrLen, err := helper.IPCheck(pkt.Bytes())
+	c.idle.Touch()
+	return c.trimIP(pkt)
+}
+func (c *Conn) ReadMeta(pkt *packet.Packet) (meta rawsock.Meta, err error) {
+	var oob [cmsg.Size]byte
+	n, oobn, _, _, err := c.raw.ReadMsgIP(pkt.Bytes(), oob[:])
 	if err != nil {
-		return err
+		return meta, errors.WithStack(err)
 	}
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
+	pkt.SetData(n)
+	c.idle.Touch()
+	if err := c.trimIP(pkt); err != nil {
+		return meta, err
 	}
-	pkt.SetHead(pkt.Head() + int(hdrLen))
-	return nil
+
+	return meta, cmsg.Parse(oob[:oobn], &meta)
 }
+
 func (c *Conn) Write(pkt *packet.Packet) (err error) {
+	c.idle.Touch()
+	if c.hdrincl {
+		return c.writeIP(pkt)
+	}
+	if n := pkt.Data() + c.ipstack.Size(); n > c.mtu.Load() && !c.fragment {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
 	_, err = c.raw.Write(pkt.Bytes())
 	return err
 }
+
+// writeIP write complete ip packet, if HdrIncl
+func (c *Conn) writeIP(pkt *packet.Packet) (err error) {
+	if _, err = helper.IPCheck(pkt.Bytes()); err != nil {
+		return err
+	} else if n := pkt.Data(); n > c.mtu.Load() {
+		return errors.WithStack(&rawsock.ErrPacketTooLarge{Size: n, MTU: c.mtu.Load()})
+	}
+	c.valid.ValidIP(pkt.Bytes())
+	_, err = c.raw.Write(pkt.Bytes())
+	return errors.WithStack(err)
+}
+
 func (c *Conn) Inject(pkt *packet.Packet) (err error) {
 	defer pkt.DetachN(c.ipstack.Size())
 	c.ipstack.AttachInbound(pkt)
-	if debug.Debug() {
-		test.ValidIP(test.P(), pkt.Bytes())
-	}
+	c.valid.ValidIP(pkt.Bytes())
 	_, err = c.raw.Write(pkt.Bytes())
 	return err
 }
 
+func (c *Conn) SetRemote(raddr netip.AddrPort) error {
+	raw, err := c.raw.SyscallConn()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	raddr = netip.AddrPortFrom(ip6.Zone(raddr.Addr(), c.zone), raddr.Port())
+	if raddr.Addr().Is4() != c.laddr.Addr().Is4() {
+		return errors.Errorf("address family not match %s and %s", c.laddr.Addr(), raddr.Addr())
+	}
+
+	// prepare filters firstly, commit new remote only if every step succeed
+	old := *c.remote.Load()
+	ins, err := bpf.WithFilter(c.filter, bpf.WithInterface(c.zone, bpf.FilterPorts(raddr.Port(), c.laddr.Port())))
+	if err != nil {
+		return err
+	}
+	oldIns, err := bpf.WithFilter(c.filter, bpf.WithInterface(c.zone, bpf.FilterPorts(old.Port(), c.laddr.Port())))
+	if err != nil {
+		return err
+	}
+	rollback := func(cause error) error {
+		bpf.SetRawBPF(raw, oldIns)
+		bind.Reconnect(raw, old.Addr())
+		return cause
+	}
+
+	if err = bpf.SetRawBPF(raw, ins); err != nil {
+		return rollback(err)
+	}
+	if err = bind.Reconnect(raw, raddr.Addr()); err != nil {
+		return rollback(err)
+	}
+	if err := c.ipstack.SetRemote(raddr.Addr()); err != nil {
+		return rollback(errors.WithStack(err))
+	}
+	c.remote.Store(&raddr)
+	return nil
+}
+
+// SyscallConn return underlying socket, used to set socket options
+func (c *Conn) SyscallConn() (syscall.RawConn, error) { return c.raw.SyscallConn() }
+
 func (c *Conn) LocalAddr() netip.AddrPort  { return c.laddr }
-func (c *Conn) RemoteAddr() netip.AddrPort { return c.raddr }
+func (c *Conn) RemoteAddr() netip.AddrPort { return *c.remote.Load() }
 func (c *Conn) Close() error               { return c.close(nil) }
+
+// MTU current egress path mtu
+func (c *Conn) MTU() int { return c.mtu.Load() }
+
+// Packet get a read buffer sized to mtu detected at init
+func (c *Conn) Packet() *packet.Packet { return c.bufs.Get() }
+
+func (c *Conn) Release(pkt *packet.Packet) { c.bufs.Put(pkt) }
+
+func defaultLocal(laddr, raddr netip.Addr, vrfName string) (netip.Addr, error) {
+	if vrfName != "" && laddr.WithZone("").IsUnspecified() {
+		return vrf.DefaultLocal(vrfName, raddr)
+	}
+	return helper.DefaultLocal(laddr, raddr)
+}
@@ -10,13 +10,17 @@ import (
 	"math/rand"
 	"net"
 	"net/netip"
+	"os"
 	"testing"
 	"time"
 
 	"bou.ke/monkey"
 	"github.com/lysShub/netkit/debug"
 	"github.com/lysShub/netkit/packet"
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/helper/ipstack"
 	"github.com/lysShub/rawsock/test"
+	"github.com/lysShub/rawsock/test/conntest"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
@@ -26,66 +30,101 @@ import (
 )
 
 func Test_Listen(t *testing.T) {
-	var (
-		saddr  = netip.AddrPortFrom(test.LocIP(), 8080)
-		caddr1 = netip.AddrPortFrom(test.LocIP(), 1234)
-		caddr2 = netip.AddrPortFrom(test.LocIP(), 5678)
-	)
 	monkey.Patch(debug.Debug, func() bool { return false })
-	eg, _ := errgroup.WithContext(context.Background())
 
-	eg.Go(func() error {
-		l, err := Listen(saddr)
-		require.NoError(t, err)
-		// defer l.Close()
-		fmt.Println("server", l.Addr())
+	t.Run("base", func(t *testing.T) {
+		var (
+			saddr  = netip.AddrPortFrom(test.LocIP(), 8080)
+			caddr1 = netip.AddrPortFrom(test.LocIP(), 1234)
+			caddr2 = netip.AddrPortFrom(test.LocIP(), 5678)
+		)
+		eg, _ := errgroup.WithContext(context.Background())
 
-		for i := 0; i < 2; i++ {
-			conn, err := l.Accept()
+		eg.Go(func() error {
+			l, err := Listen(saddr)
 			require.NoError(t, err)
-			fmt.Println("accpet")
+			// defer l.Close()
+			fmt.Println("server", l.Addr())
+
+			for i := 0; i < 2; i++ {
+				conn, err := l.Accept()
+				require.NoError(t, err)
+				fmt.Println("accpet")
+
+				eg.Go(func() error {
+					var pkt = packet.Make(0, 1500)
+					err := conn.Read(pkt)
+					require.NoError(t, err)
+					fmt.Println("read")
+
+					udp := header.UDP(pkt.Bytes())
+					src, dst := udp.SourcePort(), udp.DestinationPort()
+					udp.SetSourcePort(dst)
+					udp.SetDestinationPort(src)
+
+					err = conn.Write(pkt)
+					require.NoError(t, err)
+					return nil
+				})
+			}
+			return nil
+		})
 
+		time.Sleep(time.Second)
+		for _, e := range []netip.AddrPort{caddr1, caddr2} {
+			caddr := e
 			eg.Go(func() error {
-				var pkt = packet.Make(0, 1500)
-				err := conn.Read(pkt)
+				conn, err := net.DialUDP("udp", &net.UDPAddr{Port: int(caddr.Port())}, &net.UDPAddr{IP: saddr.Addr().AsSlice(), Port: int(saddr.Port())})
 				require.NoError(t, err)
-				fmt.Println("read")
+				fmt.Println("client", conn.LocalAddr(), conn.RemoteAddr())
 
-				udp := header.UDP(pkt.Bytes())
-				src, dst := udp.SourcePort(), udp.DestinationPort()
-				udp.SetSourcePort(dst)
-				udp.SetDestinationPort(src)
+				var b = []byte("hellow")
+				conn.Write(nil)
+				time.Sleep(time.Second)
+				_, err = conn.Write(b)
+				require.NoError(t, err)
 
-				err = conn.Write(pkt)
+				_, err = conn.Read(b)
 				require.NoError(t, err)
+				fmt.Println(string(b))
 				return nil
 			})
 		}
-		return nil
+
+		eg.Wait()
 	})
 
-	time.Sleep(time.Second)
-	for _, e := range []netip.AddrPort{caddr1, caddr2} {
-		caddr := e
-		eg.Go(func() error {
-			conn, err := net.DialUDP("udp", &net.UDPAddr{Port: int(caddr.Port())}, &net.UDPAddr{IP: saddr.Addr().AsSlice(), Port: int(saddr.Port())})
-			require.NoError(t, err)
-			fmt.Println("client", conn.LocalAddr(), conn.RemoteAddr())
+	t.Run("ipv6", func(t *testing.T) {
+		var (
+			saddr = netip.AddrPortFrom(netip.IPv6Loopback(), test.RandPort())
+			caddr = netip.AddrPortFrom(netip.IPv6Loopback(), test.RandPort())
+		)
 
-			var b = []byte("hellow")
-			conn.Write(nil)
-			time.Sleep(time.Second)
-			_, err = conn.Write(b)
-			require.NoError(t, err)
+		l, err := Listen(saddr, rawsock.SetGRO(false))
+		require.NoError(t, err)
+		defer l.Close()
 
-			_, err = conn.Read(b)
-			require.NoError(t, err)
-			fmt.Println(string(b))
-			return nil
-		})
-	}
+		conn, err := net.DialUDP("udp", test.UDPAddr(caddr), test.UDPAddr(saddr))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
 
-	eg.Wait()
+		raw, err := l.Accept()
+		require.NoError(t, err)
+		defer raw.Close()
+		require.Equal(t, saddr, raw.LocalAddr())
+		require.Equal(t, caddr, raw.RemoteAddr())
+
+		// first packet consumed by listener
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		var pkt = packet.Make(0, 1536)
+		require.NoError(t, raw.Read(pkt))
+		udp := header.UDP(pkt.Bytes())
+		require.Equal(t, caddr.Port(), udp.SourcePort())
+		require.Equal(t, "hello", string(udp.Payload()))
+	})
 }
 
 func Test_Connect(t *testing.T) {
@@ -118,6 +157,30 @@ func Test_Connect(t *testing.T) {
 		require.Equal(t, saddr.Port(), u.DestinationPort())
 	})
 
+	t.Run("ipv6", func(t *testing.T) {
+		var (
+			caddr = netip.AddrPortFrom(netip.IPv6Loopback(), test.RandPort())
+			saddr = netip.AddrPortFrom(netip.IPv6Loopback(), test.RandPort())
+		)
+
+		raw, err := Connect(saddr, caddr, rawsock.SetGRO(false))
+		require.NoError(t, err)
+		defer raw.Close()
+
+		conn, err := net.DialUDP("udp", test.UDPAddr(caddr), test.UDPAddr(saddr))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+
+		var p = packet.Make(0, 1536)
+		require.NoError(t, raw.Read(p))
+		u := header.UDP(p.Bytes())
+		require.Equal(t, caddr.Port(), u.SourcePort())
+		require.Equal(t, saddr.Port(), u.DestinationPort())
+		require.Equal(t, "hello", string(u.Payload()))
+	})
+
 	t.Run("loopback", func(t *testing.T) {
 		t.Skip("data changed or out-of-order")
 
@@ -182,3 +245,187 @@ func Test_Default_Addr(t *testing.T) {
 		require.NotZero(t, laddr.Port())
 	})
 }
+
+func Test_ReadMeta(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	raw, err := Connect(saddr, caddr, rawsock.SetGRO(false), rawsock.Timestamp(false))
+	require.NoError(t, err)
+	defer raw.Close()
+
+	conn, err := net.DialUDP("udp", test.UDPAddr(caddr), test.UDPAddr(saddr))
+	require.NoError(t, err)
+	defer conn.Close()
+	start := time.Now()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	var p = packet.Make(0, 1536)
+	meta, err := raw.ReadMeta(p)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(header.UDP(p.Bytes()).Payload()))
+	require.False(t, meta.Time.Before(start.Add(-time.Millisecond)))
+	require.Less(t, meta.Time.Sub(start), time.Second)
+}
+
+func Test_SetRemote(t *testing.T) {
+	var (
+		caddr1 = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		caddr2 = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr  = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	raw, err := Connect(saddr, caddr1, rawsock.SetGRO(false))
+	require.NoError(t, err)
+	defer raw.Close()
+	require.NoError(t, raw.SetRemote(caddr2))
+	require.Equal(t, caddr2, raw.RemoteAddr())
+
+	// failed switch not change remote
+	require.Error(t, raw.SetRemote(netip.MustParseAddrPort("[::1]:19986")))
+	require.Equal(t, caddr2, raw.RemoteAddr())
+
+	conn1, err := net.DialUDP("udp", test.UDPAddr(caddr1), test.UDPAddr(saddr))
+	require.NoError(t, err)
+	defer conn1.Close()
+	conn2, err := net.DialUDP("udp", test.UDPAddr(caddr2), test.UDPAddr(saddr))
+	require.NoError(t, err)
+	defer conn2.Close()
+
+	_, err = conn1.Write([]byte("roamed"))
+	require.NoError(t, err)
+	_, err = conn2.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, raw.Read(p))
+	udp := header.UDP(p.Bytes())
+	require.Equal(t, caddr2.Port(), udp.SourcePort())
+	require.Equal(t, "hello", string(udp.Payload()))
+}
+
+func Test_Handoff(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	var ucs [2]*net.UnixConn
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "pair")
+		conn, err := net.FileConn(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		ucs[i] = conn.(*net.UnixConn)
+		defer ucs[i].Close()
+	}
+
+	raw, err := Connect(saddr, caddr, rawsock.SetGRO(false))
+	require.NoError(t, err)
+	require.NoError(t, Handoff(ucs[0], raw))
+	require.Error(t, raw.Write(packet.Make(0, 8)))
+
+	adopted, err := Adopt(ucs[1])
+	require.NoError(t, err)
+	defer adopted.Close()
+	require.Equal(t, saddr, adopted.LocalAddr())
+	require.Equal(t, caddr, adopted.RemoteAddr())
+
+	conn, err := net.DialUDP("udp", test.UDPAddr(caddr), test.UDPAddr(saddr))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	var p = packet.Make(0, 1536)
+	require.NoError(t, adopted.Read(p))
+	require.Equal(t, "hello", string(header.UDP(p.Bytes()).Payload()))
+}
+
+func Test_IdleTimeout(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		idled = make(chan rawsock.RawConn, 1)
+	)
+
+	raw, err := Connect(saddr, caddr, rawsock.SetGRO(false),
+		rawsock.IdleTimeout(time.Millisecond*200, func(conn rawsock.RawConn) { idled <- conn }),
+	)
+	require.NoError(t, err)
+	defer raw.Close()
+
+	// keep active by write
+	for i := 0; i < 4; i++ {
+		time.Sleep(time.Millisecond * 100)
+		var pkt = packet.Make(64, header.UDPMinimumSize)
+		header.UDP(pkt.Bytes()).Encode(&header.UDPFields{
+			SrcPort: saddr.Port(), DstPort: caddr.Port(), Length: header.UDPMinimumSize,
+		})
+		require.NoError(t, raw.Write(pkt))
+	}
+	require.Empty(t, idled)
+
+	select {
+	case conn := <-idled:
+		require.Equal(t, raw, conn)
+	case <-time.After(time.Second):
+		t.Fatal("not closed by idle")
+	}
+	require.ErrorIs(t, raw.Read(packet.Make(0, 1536)), net.ErrClosed)
+}
+
+func Test_Conntest(t *testing.T) {
+	conntest.TestConn(t, header.UDPProtocolNumber, func() (c1, c2 rawsock.RawConn, stop func(), err error) {
+		var (
+			caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+			saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		)
+		c, err := Connect(caddr, saddr, rawsock.SetGRO(false))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		s, err := Connect(saddr, caddr, rawsock.SetGRO(false))
+		if err != nil {
+			c.Close()
+			return nil, nil, nil, err
+		}
+		return c, s, func() { c.Close(); s.Close() }, nil
+	})
+}
+
+func Test_HdrIncl(t *testing.T) {
+	var (
+		caddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+		saddr = netip.AddrPortFrom(test.LocIP(), test.RandPort())
+	)
+	c, err := Connect(caddr, saddr, rawsock.SetGRO(false), rawsock.HdrIncl())
+	require.NoError(t, err)
+	defer c.Close()
+	s, err := Connect(saddr, caddr, rawsock.SetGRO(false), rawsock.Ancillary())
+	require.NoError(t, err)
+	defer s.Close()
+
+	var msg = []byte("hello")
+	pkt := packet.Make(64, header.UDPMinimumSize+len(msg))
+	copy(pkt.Bytes()[header.UDPMinimumSize:], msg)
+	header.UDP(pkt.Bytes()).Encode(&header.UDPFields{SrcPort: caddr.Port(), DstPort: saddr.Port()})
+	ip, err := ipstack.New(caddr.Addr(), saddr.Addr(), header.UDPProtocolNumber)
+	require.NoError(t, err)
+	ip.AttachOutbound(pkt)
+	header.IPv4(pkt.Bytes()).SetTTL(9)
+	header.IPv4(pkt.Bytes()).SetChecksum(0)
+	header.IPv4(pkt.Bytes()).SetChecksum(^header.IPv4(pkt.Bytes()).CalculateChecksum())
+	require.NoError(t, c.Write(pkt))
+
+	var p = packet.Make(0, 1536)
+	meta, err := s.ReadMeta(p)
+	require.NoError(t, err)
+	require.Equal(t, uint8(9), meta.TTL)
+	require.Equal(t, msg, header.UDP(p.Bytes()).Payload())
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package udp
+
+import (
+	"net/netip"
+
+	"github.com/lysShub/rawsock"
+	"github.com/lysShub/rawsock/udp/divert"
+)
+
+func Listen(laddr netip.AddrPort, opts ...rawsock.Option) (rawsock.Listener, error) {
+	return divert.Listen(laddr, opts...)
+}
+
+func Connect(laddr, raddr netip.AddrPort, opts ...rawsock.Option) (rawsock.RawConn, error) {
+	return divert.Connect(laddr, raddr, opts...)
+}